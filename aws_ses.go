@@ -1,113 +1,138 @@
 package gomail
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ses"
 	"github.com/aws/aws-sdk-go-v2/service/ses/types"
-	"github.com/domodwyer/mailyak"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 )
 
 // awsSesInterface is an interface for ses/mocking
 type awsSesInterface interface {
-	SendRawEmail(raw []byte) (string, error)
+	SendRawEmail(ctx context.Context, raw []byte) (*ses.SendRawEmailOutput, error)
+}
+
+// awsSesRawEmailAPI is the SendRawEmail method of the AWS SDK v2 SES client
+type awsSesRawEmailAPI interface {
+	SendRawEmail(ctx context.Context, params *ses.SendRawEmailInput, optFns ...func(*ses.Options)) (*ses.SendRawEmailOutput, error)
 }
 
 // awsSesSdkV2Client wraps the AWS SDK v2 SES client to implement awsSesInterface
 type awsSesSdkV2Client struct {
-	client *ses.Client
+	client awsSesRawEmailAPI
 }
 
 // SendRawEmail implements the awsSesInterface using AWS SDK v2
-func (c *awsSesSdkV2Client) SendRawEmail(raw []byte) (string, error) {
-	input := &ses.SendRawEmailInput{
+func (c *awsSesSdkV2Client) SendRawEmail(ctx context.Context, raw []byte) (*ses.SendRawEmailOutput, error) {
+	return c.client.SendRawEmail(ctx, &ses.SendRawEmailInput{
 		RawMessage: &types.RawMessage{
 			Data: raw,
 		},
+	})
+}
+
+// awsSesEnabled returns true if static keys or another AWS credential source is configured
+func (m *MailService) awsSesEnabled() bool {
+	return (len(m.AwsSesAccessID) > 0 && len(m.AwsSesSecretKey) > 0) ||
+		m.AwsSesDefaultCredentials || len(m.AwsSesProfile) > 0 || len(m.AwsSesRoleArn) > 0
+}
+
+// loadAwsConfig loads the AWS config for SES
+//
+// Static keys take priority, then the named profile, then the default credential chain.
+// If a role arn is set, the role is assumed using those base credentials.
+func (m *MailService) loadAwsConfig(ctx context.Context) (aws.Config, error) {
+	// Set the region (default to us-east-1 if not provided)
+	region := awsSesDefaultRegion
+	if len(m.AwsSesRegion) > 0 {
+		region = m.AwsSesRegion
+	}
+	options := []func(*config.LoadOptions) error{config.WithRegion(region)}
+
+	// Use static credentials or a named profile (otherwise the default chain is used)
+	if len(m.AwsSesAccessID) > 0 && len(m.AwsSesSecretKey) > 0 {
+		options = append(options, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			m.AwsSesAccessID,
+			m.AwsSesSecretKey,
+			"",
+		)))
+	} else if len(m.AwsSesProfile) > 0 {
+		options = append(options, config.WithSharedConfigProfile(m.AwsSesProfile))
 	}
 
-	result, err := c.client.SendRawEmail(context.TODO(), input)
+	awsConfig, err := config.LoadDefaultConfig(ctx, options...)
 	if err != nil {
-		return "", err
+		return awsConfig, err
 	}
 
-	// Format response similar to what was expected from v1 SDK
-	requestID := "unknown"
-	if result.ResultMetadata.Get("RequestId") != nil {
-		if id, ok := result.ResultMetadata.Get("RequestId").(string); ok {
-			requestID = id
+	// Assume the role using the base credentials
+	if len(m.AwsSesRoleArn) > 0 {
+		sessionName := m.AwsSesRoleSessionName
+		if len(sessionName) == 0 {
+			sessionName = awsSesDefaultRoleSessionName
 		}
+		awsConfig.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(
+			sts.NewFromConfig(awsConfig), m.AwsSesRoleArn, func(o *stscreds.AssumeRoleOptions) {
+				o.RoleSessionName = sessionName
+				if len(m.AwsSesExternalID) > 0 {
+					o.ExternalID = aws.String(m.AwsSesExternalID)
+				}
+			},
+		))
 	}
 
-	responseStr := fmt.Sprintf(`<SendRawEmailResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <SendRawEmailResult>
-    <MessageId>%s</MessageId>
-  </SendRawEmailResult>
-  <ResponseMetadata>
-    <RequestId>%s</RequestId>
-  </ResponseMetadata>
-</SendRawEmailResponse>`, *result.MessageId, requestID)
-
-	return responseStr, nil
+	return awsConfig, nil
 }
 
-// sendViaAwsSes sends an email using the AWS SES service
-func sendViaAwsSes(client awsSesInterface, email *Email) (err error) {
-	// Create new mail message
-	mail := mailyak.New("", nil)
-
-	// Add the "to" recipients
-	mail.To(email.Recipients...)
-
-	// Add the "cc" recipients
-	if len(email.RecipientsCc) > 0 {
-		mail.Cc(email.RecipientsCc...)
-	}
-
-	// Add the "bcc" recipients
-	if len(email.RecipientsBcc) > 0 {
-		mail.WriteBccHeader(true)
-		mail.Bcc(email.RecipientsBcc...)
-	}
-
-	// Add the basics
-	mail.From(email.FromAddress)
-	mail.FromName(email.FromName)
-	mail.Subject(email.Subject)
-
-	// Add a custom reply to address
-	if len(email.ReplyToAddress) > 0 {
-		mail.ReplyTo(email.ReplyToAddress)
-	}
+// awsSesProvider is the AWS SES provider
+type awsSesProvider struct {
+	client   awsSesInterface
+	security *messageSecurity
+}
 
-	// Add plain text
-	if len(email.PlainTextContent) > 0 {
-		mail.Plain().Set(email.PlainTextContent)
-	}
+// Name returns the name of the provider
+func (p *awsSesProvider) Name() string {
+	return "aws_ses"
+}
 
-	// Add html
-	if len(email.HTMLContent) > 0 {
-		mail.HTML().Set(email.HTMLContent)
+// Capabilities returns the features supported by AWS SES
+func (p *awsSesProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Attachments: true,
+		Bcc:         true,
+		Cc:          true,
+		Importance:  true,
+		OpenPGP:     true,
+		ReturnPath:  true,
+		SMIME:       true,
 	}
+}
 
-	// Add any attachments
-	if len(email.Attachments) > 0 {
-		for _, att := range email.Attachments {
-			mail.Attach(att.FileName, att.FileReader)
-		}
-	}
+// Send sends the email using AWS SES
+func (p *awsSesProvider) Send(ctx context.Context, email *Email) (SendResult, error) {
+	return sendViaAwsSes(ctx, p.client, p.security, email)
+}
 
-	// Add importance?
-	if email.Important {
-		mail.AddHeader("X-Priority", "1 (Highest)")
-		mail.AddHeader("X-MSMail-Priority", "High")
-		mail.AddHeader("Importance", "High")
+// awsSesRawMessage builds the raw MIME message for SES (bccHeader writes the Bcc header into the message)
+func awsSesRawMessage(email *Email, bccHeader bool, security *messageSecurity) ([]byte, error) {
+	raw, err := email.buildMIME(mimeOptions{bccHeader: bccHeader, returnPath: true})
+	if err != nil {
+		return nil, err
 	}
+	return security.secure(email, raw)
+}
 
+// sendViaAwsSes sends an email using the AWS SES service
+func sendViaAwsSes(ctx context.Context, client awsSesInterface, security *messageSecurity, email *Email) (result SendResult, err error) {
 	// Warn about features that are set but not available
 	if email.TrackClicks {
 		log.Printf("warning: track clicks is enabled, but AWS SES does not offer this feature")
@@ -118,21 +143,48 @@ func sendViaAwsSes(client awsSesInterface, email *Email) (err error) {
 	if email.AutoText {
 		log.Printf("warning: auto text is enabled, but AWS SES does not offer this feature")
 	}
+	if email.VERP || email.DSN != nil {
+		log.Printf("warning: VERP or DSN is set, but AWS SES does not offer this feature")
+	}
 
-	// Create the email buffer and pass to the ses service
-	var buf *bytes.Buffer
-	if buf, err = mail.MimeBuf(); err != nil {
-		return err
+	// Create the raw message and pass to the ses service
+	var raw []byte
+	if raw, err = awsSesRawMessage(email, true, security); err != nil {
+		return result, err
 	}
 
 	// Send the message post and check the response
-	var awsResponse string
-	awsResponse, err = client.SendRawEmail(buf.Bytes())
+	var output *ses.SendRawEmailOutput
+	output, err = client.SendRawEmail(ctx, raw)
 	if err != nil {
-		return err
-	} else if !strings.Contains(awsResponse, "SendRawEmailResult") {
-		err = fmt.Errorf("aws ses did not return expected valid response: %s: %w", awsResponse, ErrInvalidAWSResponse)
+		return result, classifyAwsSesError(err)
+	} else if output == nil || len(aws.ToString(output.MessageId)) == 0 {
+		return result, permanentError(fmt.Errorf("aws ses did not return a message id: %w", ErrInvalidAWSResponse))
+	}
+
+	// Build the result from the response
+	result = newSendResult(AwsSes, email, RecipientAccepted)
+	result.MessageID = aws.ToString(output.MessageId)
+	result.RawResponse = output
+
+	return result, nil
+}
+
+// classifyAwsSesError marks SES throttling and server faults as transient, other api errors as permanent
+func classifyAwsSesError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return classifyError(err)
 	}
 
-	return err
+	switch apiErr.ErrorCode() {
+	case "Throttling", "ThrottlingException", "TooManyRequestsException",
+		"ServiceUnavailable", "ServiceUnavailableException",
+		"InternalFailure", "InternalServerError", "RequestTimeout", "RequestTimeoutException":
+		return transientError(err)
+	}
+	if apiErr.ErrorFault() == smithy.FaultServer {
+		return transientError(err)
+	}
+	return permanentError(err)
 }
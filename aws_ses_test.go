@@ -2,37 +2,39 @@ package gomail
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ses"
 	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+	"github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// testAwsSesMessageID is the message id returned by the AWS SES mocks
+const testAwsSesMessageID = "01000172d9097ae4-d7e95511-f9d4-434d-9d2f-a0d860c18ee8-000000"
+
 // getSuccessResult returns a successful AWS SES response
-func getSuccessResult() string {
-	return `<SendRawEmailResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <SendRawEmailResult>
-    <MessageId>01000172d9097ae4-d7e95511-f9d4-434d-9d2f-a0d860c18ee8-000000</MessageId>
-  </SendRawEmailResult>
-  <ResponseMetadata>
-    <RequestId>8a9c266b-7b2d-4a93-89f5-9ca0031fezas</RequestId>
-  </ResponseMetadata>
-</SendRawEmailResponse>`
+func getSuccessResult() *ses.SendRawEmailOutput {
+	metadata := middleware.Metadata{}
+	metadata.Set("RequestId", "8a9c266b-7b2d-4a93-89f5-9ca0031fezas")
+	return &ses.SendRawEmailOutput{MessageId: aws.String(testAwsSesMessageID), ResultMetadata: metadata}
 }
 
 // mockAwsSesInterface is a mocking interface for AWS SES
 type mockAwsSesInterface struct{}
 
 // SendRawEmail is for mocking
-func (m *mockAwsSesInterface) SendRawEmail(raw []byte) (string, error) {
+func (m *mockAwsSesInterface) SendRawEmail(_ context.Context, raw []byte) (*ses.SendRawEmailOutput, error) {
 	if len(raw) == 0 {
-		return "", ErrMissingEmailContents
+		return nil, ErrMissingEmailContents
 	}
 
 	rawString := string(raw)
@@ -44,12 +46,12 @@ func (m *mockAwsSesInterface) SendRawEmail(raw []byte) (string, error) {
 
 	// Bad hostname
 	if strings.Contains(rawString, "To: test@badhostname.com") {
-		return "", ErrBadHostname
+		return nil, ErrBadHostname
 	}
 
 	// Bad result
 	if strings.Contains(rawString, "To: test@badresult.com") {
-		return "<ErrorMessage>Failed!</ErrorMessage>", nil
+		return &ses.SendRawEmailOutput{}, nil
 	}
 
 	// Default is success
@@ -108,21 +110,21 @@ func TestSendViaAwsSes(t *testing.T) {
 			email.RecipientsCc = []string{test.input}
 			email.RecipientsBcc = []string{test.input}
 			email.ReplyToAddress = test.input
-			err := sendViaAwsSes(client, email)
+			result, err := sendViaAwsSes(context.Background(), client, nil, email)
 			if test.expectedError {
 				require.Error(t, err)
 			} else {
 				require.NoError(t, err)
+				assert.Equal(t, AwsSes, result.Provider)
+				assert.Equal(t, testAwsSesMessageID, result.MessageID)
+				assert.IsType(t, &ses.SendRawEmailOutput{}, result.RawResponse)
+				assert.Len(t, result.Recipients, 3)
+				assert.False(t, result.SubmittedAt.IsZero())
 			}
 		})
 	}
 }
 
-// sesClientInterface defines the interface that the SES client should implement
-type sesClientInterface interface {
-	SendRawEmail(ctx context.Context, params *ses.SendRawEmailInput, optFns ...func(*ses.Options)) (*ses.SendRawEmailOutput, error)
-}
-
 // mockSESClient is a mock implementation of the AWS SES v2 client
 type mockSESClient struct {
 	sendRawEmailFunc func(ctx context.Context, params *ses.SendRawEmailInput, optFns ...func(*ses.Options)) (*ses.SendRawEmailOutput, error)
@@ -133,145 +135,31 @@ func (m *mockSESClient) SendRawEmail(ctx context.Context, params *ses.SendRawEma
 	return m.sendRawEmailFunc(ctx, params, optFns...)
 }
 
-// testAwsSesSdkV2Client is a test version that accepts an interface instead of concrete type
-type testAwsSesSdkV2Client struct {
-	client sesClientInterface
-}
-
-// SendRawEmail implements the same logic as awsSesSdkV2Client but uses the interface
-func (c *testAwsSesSdkV2Client) SendRawEmail(raw []byte) (string, error) {
-	input := &ses.SendRawEmailInput{
-		RawMessage: &types.RawMessage{
-			Data: raw,
-		},
-	}
-
-	result, err := c.client.SendRawEmail(context.TODO(), input)
-	if err != nil {
-		return "", err
-	}
-
-	// Format response similar to what was expected from v1 SDK
-	requestID := "unknown"
-	if result.ResultMetadata.Get("RequestId") != nil {
-		if id, ok := result.ResultMetadata.Get("RequestId").(string); ok {
-			requestID = id
-		}
-	}
-
-	responseStr := `<SendRawEmailResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <SendRawEmailResult>
-    <MessageId>` + *result.MessageId + `</MessageId>
-  </SendRawEmailResult>
-  <ResponseMetadata>
-    <RequestId>` + requestID + `</RequestId>
-  </ResponseMetadata>
-</SendRawEmailResponse>`
-
-	return responseStr, nil
-}
-
 // TestAwsSesSdkV2Client_SendRawEmail tests the SendRawEmail method of awsSesSdkV2Client
 func TestAwsSesSdkV2Client_SendRawEmail(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name           string
-		rawEmail       []byte
-		mockFunc       func(ctx context.Context, params *ses.SendRawEmailInput, optFns ...func(*ses.Options)) (*ses.SendRawEmailOutput, error)
-		expectedError  bool
-		expectedOutput string
+		name          string
+		rawEmail      []byte
+		mockFunc      func(ctx context.Context, params *ses.SendRawEmailInput, optFns ...func(*ses.Options)) (*ses.SendRawEmailOutput, error)
+		expectedError bool
 	}{
 		{
-			name:     "successful send with request id",
-			rawEmail: []byte("To: test@example.com\r\nSubject: Test\r\n\r\nTest body"),
-			mockFunc: func(_ context.Context, _ *ses.SendRawEmailInput, _ ...func(*ses.Options)) (*ses.SendRawEmailOutput, error) {
-				messageID := "01000172d9097ae4-d7e95511-f9d4-434d-9d2f-a0d860c18ee8-000000"
-				metadata := middleware.Metadata{}
-				metadata.Set("RequestId", "test-request-id-123")
-				output := &ses.SendRawEmailOutput{
-					MessageId:      &messageID,
-					ResultMetadata: metadata,
-				}
-				return output, nil
-			},
-			expectedError: false,
-			expectedOutput: `<SendRawEmailResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <SendRawEmailResult>
-    <MessageId>01000172d9097ae4-d7e95511-f9d4-434d-9d2f-a0d860c18ee8-000000</MessageId>
-  </SendRawEmailResult>
-  <ResponseMetadata>
-    <RequestId>test-request-id-123</RequestId>
-  </ResponseMetadata>
-</SendRawEmailResponse>`,
-		},
-		{
-			name:     "successful send without request id",
-			rawEmail: []byte("To: test@example.com\r\nSubject: Test\r\n\r\nTest body"),
-			mockFunc: func(_ context.Context, _ *ses.SendRawEmailInput, _ ...func(*ses.Options)) (*ses.SendRawEmailOutput, error) {
-				messageID := "message-id-456"
-				metadata := middleware.Metadata{}
-				output := &ses.SendRawEmailOutput{
-					MessageId:      &messageID,
-					ResultMetadata: metadata,
-				}
-				return output, nil
-			},
-			expectedError: false,
-			expectedOutput: `<SendRawEmailResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <SendRawEmailResult>
-    <MessageId>message-id-456</MessageId>
-  </SendRawEmailResult>
-  <ResponseMetadata>
-    <RequestId>unknown</RequestId>
-  </ResponseMetadata>
-</SendRawEmailResponse>`,
-		},
-		{
-			name:     "successful send with non-string request id",
+			name:     "successful send",
 			rawEmail: []byte("To: test@example.com\r\nSubject: Test\r\n\r\nTest body"),
 			mockFunc: func(_ context.Context, _ *ses.SendRawEmailInput, _ ...func(*ses.Options)) (*ses.SendRawEmailOutput, error) {
-				messageID := "message-id-789"
-				metadata := middleware.Metadata{}
-				metadata.Set("RequestId", 12345) // Non-string type
-				output := &ses.SendRawEmailOutput{
-					MessageId:      &messageID,
-					ResultMetadata: metadata,
-				}
-				return output, nil
+				return getSuccessResult(), nil
 			},
 			expectedError: false,
-			expectedOutput: `<SendRawEmailResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <SendRawEmailResult>
-    <MessageId>message-id-789</MessageId>
-  </SendRawEmailResult>
-  <ResponseMetadata>
-    <RequestId>unknown</RequestId>
-  </ResponseMetadata>
-</SendRawEmailResponse>`,
 		},
 		{
 			name:     "empty raw email data",
 			rawEmail: []byte{},
 			mockFunc: func(_ context.Context, _ *ses.SendRawEmailInput, _ ...func(*ses.Options)) (*ses.SendRawEmailOutput, error) {
-				messageID := "empty-message-id"
-				metadata := middleware.Metadata{}
-				metadata.Set("RequestId", "empty-request-id")
-				output := &ses.SendRawEmailOutput{
-					MessageId:      &messageID,
-					ResultMetadata: metadata,
-				}
-				return output, nil
+				return getSuccessResult(), nil
 			},
 			expectedError: false,
-			expectedOutput: `<SendRawEmailResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <SendRawEmailResult>
-    <MessageId>empty-message-id</MessageId>
-  </SendRawEmailResult>
-  <ResponseMetadata>
-    <RequestId>empty-request-id</RequestId>
-  </ResponseMetadata>
-</SendRawEmailResponse>`,
 		},
 		{
 			name:     "aws sdk error",
@@ -297,15 +185,11 @@ func TestAwsSesSdkV2Client_SendRawEmail(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			mockClient := &mockSESClient{
-				sendRawEmailFunc: tt.mockFunc,
+			client := &awsSesSdkV2Client{
+				client: &mockSESClient{sendRawEmailFunc: tt.mockFunc},
 			}
 
-			client := &testAwsSesSdkV2Client{
-				client: mockClient,
-			}
-
-			result, err := client.SendRawEmail(tt.rawEmail)
+			result, err := client.SendRawEmail(context.Background(), tt.rawEmail)
 
 			if tt.expectedError {
 				require.Error(t, err)
@@ -313,8 +197,8 @@ func TestAwsSesSdkV2Client_SendRawEmail(t *testing.T) {
 			}
 
 			require.NoError(t, err)
-
-			assert.Equal(t, tt.expectedOutput, result)
+			assert.Equal(t, testAwsSesMessageID, aws.ToString(result.MessageId))
+			assert.Equal(t, "8a9c266b-7b2d-4a93-89f5-9ca0031fezas", result.ResultMetadata.Get("RequestId"))
 		})
 	}
 }
@@ -339,11 +223,160 @@ func TestAwsSesSdkV2Client_SendRawEmail_InputValidation(t *testing.T) {
 		},
 	}
 
-	client := &testAwsSesSdkV2Client{
+	client := &awsSesSdkV2Client{
 		client: mockClient,
 	}
 
 	testData := []byte("test email data")
-	_, err := client.SendRawEmail(testData)
+	_, err := client.SendRawEmail(context.Background(), testData)
 	require.NoError(t, err)
 }
+
+// TestClassifyAwsSesError will test the classifyAwsSesError() method
+func TestClassifyAwsSesError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"throttling", &smithy.GenericAPIError{Code: "Throttling", Message: "Maximum sending rate exceeded."}, true},
+		{"service unavailable", &smithy.GenericAPIError{Code: "ServiceUnavailable"}, true},
+		{"unknown server fault", &smithy.GenericAPIError{Code: "Unknown", Fault: smithy.FaultServer}, true},
+		{"message rejected", &types.MessageRejected{Message: aws.String("Email address not verified")}, false},
+		{"unknown client fault", &smithy.GenericAPIError{Code: "Unknown", Fault: smithy.FaultClient}, false},
+		{"non api error", ErrAWSServiceError, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := classifyAwsSesError(test.err)
+			require.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.transient, IsTransient(err))
+		})
+	}
+}
+
+// TestMailService_awsSesEnabled will test the awsSesEnabled() method
+func TestMailService_awsSesEnabled(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		mail     *MailService
+		expected bool
+	}{
+		{"nothing set", &MailService{}, false},
+		{"access id only", &MailService{AwsSesAccessID: "1234567"}, false},
+		{"static keys", &MailService{AwsSesAccessID: "1234567", AwsSesSecretKey: "1234567"}, true},
+		{"default credentials", &MailService{AwsSesDefaultCredentials: true}, true},
+		{"profile", &MailService{AwsSesProfile: "ses-sender"}, true},
+		{"role arn", &MailService{AwsSesRoleArn: "arn:aws:iam::123456789012:role/ses-sender"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.mail.awsSesEnabled())
+		})
+	}
+}
+
+// TestMailService_loadAwsConfig will test the loadAwsConfig() method
+//
+// Not parallel: the credential sources are set with environment variables
+func TestMailService_loadAwsConfig(t *testing.T) {
+	t.Run("static keys", func(t *testing.T) {
+		mail := &MailService{AwsSesAccessID: "static-id", AwsSesSecretKey: "static-secret", AwsSesProfile: "ignored"}
+		awsConfig, err := mail.loadAwsConfig(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, awsSesDefaultRegion, awsConfig.Region)
+
+		creds, err := awsConfig.Credentials.Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "static-id", creds.AccessKeyID)
+	})
+
+	t.Run("default credential chain", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "env-id")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+		t.Setenv("AWS_SESSION_TOKEN", "env-token")
+
+		mail := &MailService{AwsSesDefaultCredentials: true, AwsSesRegion: "eu-west-1"}
+		awsConfig, err := mail.loadAwsConfig(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "eu-west-1", awsConfig.Region)
+
+		creds, err := awsConfig.Credentials.Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "env-id", creds.AccessKeyID)
+		assert.Equal(t, "env-token", creds.SessionToken)
+	})
+
+	t.Run("named profile", func(t *testing.T) {
+		dir := t.TempDir()
+		credentialsFile := filepath.Join(dir, "credentials")
+		require.NoError(t, os.WriteFile(credentialsFile, []byte("[ses-sender]\naws_access_key_id = profile-id\naws_secret_access_key = profile-secret\n"), 0o600))
+		t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+		t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+
+		mail := &MailService{AwsSesProfile: "ses-sender"}
+		awsConfig, err := mail.loadAwsConfig(context.Background())
+		require.NoError(t, err)
+
+		creds, err := awsConfig.Credentials.Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "profile-id", creds.AccessKeyID)
+
+		// Missing profile
+		mail.AwsSesProfile = "missing"
+		_, err = mail.loadAwsConfig(context.Background())
+		require.Error(t, err)
+	})
+
+	t.Run("assume role", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "AssumeRole", r.PostForm.Get("Action"))
+			assert.Equal(t, "arn:aws:iam::123456789012:role/ses-sender", r.PostForm.Get("RoleArn"))
+			assert.Equal(t, "billing-mailer", r.PostForm.Get("RoleSessionName"))
+			assert.Equal(t, "external-123", r.PostForm.Get("ExternalId"))
+			assert.Contains(t, r.Header.Get("Authorization"), "Credential=static-id/")
+			w.Header().Set("Content-Type", "text/xml")
+			_, _ = w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>role-id</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-token</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/ses-sender/billing-mailer</Arn>
+      <AssumedRoleId>AROA123:billing-mailer</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata>
+    <RequestId>8a9c266b-7b2d-4a93-89f5-9ca0031fezas</RequestId>
+  </ResponseMetadata>
+</AssumeRoleResponse>`))
+		}))
+		defer server.Close()
+		t.Setenv("AWS_ENDPOINT_URL_STS", server.URL)
+
+		mail := &MailService{
+			AwsSesAccessID:        "static-id",
+			AwsSesExternalID:      "external-123",
+			AwsSesRoleArn:         "arn:aws:iam::123456789012:role/ses-sender",
+			AwsSesRoleSessionName: "billing-mailer",
+			AwsSesSecretKey:       "static-secret",
+		}
+		awsConfig, err := mail.loadAwsConfig(context.Background())
+		require.NoError(t, err)
+
+		creds, err := awsConfig.Credentials.Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "role-id", creds.AccessKeyID)
+		assert.Equal(t, "role-token", creds.SessionToken)
+	})
+}
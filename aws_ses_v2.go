@@ -0,0 +1,174 @@
+package gomail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+const (
+	awsSesTagMaxLength    = 256
+	awsSesTagDefaultValue = "true"
+)
+
+// awsSesV2Interface is an interface for sesv2/mocking (implemented by *sesv2.Client)
+type awsSesV2Interface interface {
+	SendEmail(ctx context.Context, params *sesv2.SendEmailInput, optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+// awsSesV2Options are the SES v2 sending options loaded from the MailService
+type awsSesV2Options struct {
+	security                  *messageSecurity
+	configurationSet          string
+	contactListName           string
+	feedbackForwardingAddress string
+	fromIdentityArn           string
+	topicName                 string
+}
+
+// awsSesV2Provider is the AWS SES v2 provider
+type awsSesV2Provider struct {
+	client  awsSesV2Interface
+	options awsSesV2Options
+}
+
+// Name returns the name of the provider
+func (p *awsSesV2Provider) Name() string {
+	return "aws_ses_v2"
+}
+
+// Capabilities returns the features supported by AWS SES v2
+func (p *awsSesV2Provider) Capabilities() Capabilities {
+	return Capabilities{
+		Attachments: true,
+		Bcc:         true,
+		Cc:          true,
+		Importance:  true,
+		OpenPGP:     true,
+		ReturnPath:  true,
+		SMIME:       true,
+		Tags:        true,
+	}
+}
+
+// Send sends the email using AWS SES v2
+func (p *awsSesV2Provider) Send(ctx context.Context, email *Email) (SendResult, error) {
+	return sendViaAwsSesV2(ctx, p.client, p.options, email)
+}
+
+// awsSesTagPart replaces characters that SES does not allow in tag names and values (letters, numbers, _ and -)
+func awsSesTagPart(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(value))
+	if len(value) > awsSesTagMaxLength {
+		value = value[:awsSesTagMaxLength]
+	}
+	return value
+}
+
+// awsSesMessageTags converts the email tags into SES message tags
+//
+// A tag of "name:value" becomes a tag with that name and value, any other tag is set to "true"
+func awsSesMessageTags(tags []string) []types.MessageTag {
+	messageTags := make([]types.MessageTag, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		name, value, found := strings.Cut(tag, ":")
+		if !found || len(strings.TrimSpace(value)) == 0 {
+			value = awsSesTagDefaultValue
+		}
+		if name = awsSesTagPart(name); len(name) == 0 || seen[name] {
+			continue
+		}
+		seen[name] = true
+		messageTags = append(messageTags, types.MessageTag{
+			Name:  aws.String(name),
+			Value: aws.String(awsSesTagPart(value)),
+		})
+	}
+	return messageTags
+}
+
+// sendViaAwsSesV2 sends an email using the AWS SES v2 service
+func sendViaAwsSesV2(ctx context.Context, client awsSesV2Interface, options awsSesV2Options, email *Email) (result SendResult, err error) {
+	// Warn about features that are set but not available
+	if (email.TrackClicks || email.TrackOpens) && len(options.configurationSet) == 0 {
+		log.Printf("warning: tracking is enabled, but AWS SES requires a configuration set with tracking enabled")
+	}
+	if email.AutoText {
+		log.Printf("warning: auto text is enabled, but AWS SES does not offer this feature")
+	}
+	if email.VERP || email.DSN != nil {
+		log.Printf("warning: VERP or DSN is set, but AWS SES does not offer this feature")
+	}
+
+	// Create the raw message (recipients are set on the destination, bcc is not written into the message)
+	var raw []byte
+	if raw, err = awsSesRawMessage(email, false, options.security); err != nil {
+		return result, err
+	}
+
+	// Create the SES v2 input
+	input := &sesv2.SendEmailInput{
+		Content: &types.EmailContent{
+			Raw: &types.RawMessage{Data: raw},
+		},
+		Destination: &types.Destination{
+			BccAddresses: email.RecipientsBcc,
+			CcAddresses:  email.RecipientsCc,
+			ToAddresses:  email.Recipients,
+		},
+		FromEmailAddress: aws.String(email.FromAddress),
+	}
+
+	// Add the message tags
+	if len(email.Tags) > 0 {
+		input.EmailTags = awsSesMessageTags(email.Tags)
+	}
+
+	// Add the optional settings
+	if len(options.configurationSet) > 0 {
+		input.ConfigurationSetName = aws.String(options.configurationSet)
+	}
+	if len(options.fromIdentityArn) > 0 {
+		input.FromEmailAddressIdentityArn = aws.String(options.fromIdentityArn)
+	}
+	if len(options.feedbackForwardingAddress) > 0 {
+		input.FeedbackForwardingEmailAddress = aws.String(options.feedbackForwardingAddress)
+	} else if len(email.ReturnPath) > 0 {
+		input.FeedbackForwardingEmailAddress = aws.String(email.ReturnPath)
+	}
+	if len(options.contactListName) > 0 {
+		input.ListManagementOptions = &types.ListManagementOptions{
+			ContactListName: aws.String(options.contactListName),
+		}
+		if len(options.topicName) > 0 {
+			input.ListManagementOptions.TopicName = aws.String(options.topicName)
+		}
+	}
+
+	// Send the message
+	var output *sesv2.SendEmailOutput
+	if output, err = client.SendEmail(ctx, input); err != nil {
+		return result, classifyAwsSesError(err)
+	} else if output == nil || output.MessageId == nil {
+		err = fmt.Errorf("aws ses v2 did not return a message id: %w", ErrInvalidAWSResponse)
+		return result, permanentError(err)
+	}
+
+	// Build the result from the response
+	result = newSendResult(AwsSesV2, email, RecipientAccepted)
+	result.MessageID = aws.ToString(output.MessageId)
+	result.RawResponse = output
+
+	return result, nil
+}
@@ -0,0 +1,237 @@
+package gomail
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockAwsSesV2Interface is a mocking interface for AWS SES v2
+type mockAwsSesV2Interface struct {
+	input *sesv2.SendEmailInput
+}
+
+// SendEmail is for mocking
+func (m *mockAwsSesV2Interface) SendEmail(_ context.Context, params *sesv2.SendEmailInput, _ ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	m.input = params
+	to := params.Destination.ToAddresses[0]
+
+	// Success
+	if to == "test@domain.com" {
+		return &sesv2.SendEmailOutput{MessageId: aws.String("01000172d9097ae4-d7e95511-f9d4-434d-9d2f-a0d860c18ee8-000000")}, nil
+	}
+
+	// Bad hostname
+	if to == "test@badhostname.com" {
+		return nil, &smithy.GenericAPIError{Code: "MessageRejected", Message: "Email address is not verified."}
+	}
+
+	// Throttled
+	if to == "test@throttled.com" {
+		return nil, &smithy.GenericAPIError{Code: "TooManyRequestsException", Message: "Too many requests"}
+	}
+
+	// Bad result
+	if to == "test@badresult.com" {
+		return &sesv2.SendEmailOutput{}, nil
+	}
+
+	// Default is success
+	return &sesv2.SendEmailOutput{MessageId: aws.String("default")}, nil
+}
+
+// TestSendViaAwsSesV2 will test the sendViaAwsSesV2() method
+func TestSendViaAwsSesV2(t *testing.T) {
+	t.Parallel()
+
+	// Start the service
+	mail := new(MailService)
+
+	// Set all the defaults, toggle all warnings
+	mail.AutoText = true
+	mail.FromDomain = "example.com"
+	mail.FromName = "No Reply"
+	mail.FromUsername = "no-reply"
+	mail.Important = true
+	mail.TrackClicks = true
+	mail.TrackOpens = true
+
+	// Setup mock client
+	client := &mockAwsSesV2Interface{}
+
+	// New email
+	email := mail.NewEmail()
+	email.HTMLContent = "<html>Test</html>"
+	email.PlainTextContent = "Test"
+	email.Tags = []string{"welcome", "campaign:spring sale"}
+
+	// Add an attachment
+	f, err := os.Open("examples/test-attachment-file.txt")
+	require.NoError(t, err)
+	email.AddAttachment("test-attachment-file.txt", "text/plain", f)
+
+	// Create the list of tests
+	tests := []struct {
+		name          string
+		input         string
+		expectedError bool
+		transient     bool
+	}{
+		{"successful send", "test@domain.com", false, false},
+		{"bad hostname", "test@badhostname.com", true, false},
+		{"throttled", "test@throttled.com", true, true},
+		{"bad result", "test@badresult.com", true, false},
+	}
+
+	// Loop tests
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email.Recipients = []string{test.input}
+			email.RecipientsCc = []string{test.input}
+			email.RecipientsBcc = []string{test.input}
+			email.ReplyToAddress = test.input
+			result, err := sendViaAwsSesV2(context.Background(), client, awsSesV2Options{}, email)
+			if test.expectedError {
+				require.Error(t, err)
+				assert.Equal(t, test.transient, IsTransient(err))
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, AwsSesV2, result.Provider)
+				assert.Equal(t, "01000172d9097ae4-d7e95511-f9d4-434d-9d2f-a0d860c18ee8-000000", result.MessageID)
+				assert.Len(t, result.Recipients, 3)
+			}
+		})
+	}
+
+	t.Run("options are mapped", func(t *testing.T) {
+		email.Recipients = []string{"test@domain.com"}
+		email.RecipientsBcc = []string{"bcc@domain.com"}
+		_, err = sendViaAwsSesV2(context.Background(), client, awsSesV2Options{
+			configurationSet:          "tracking",
+			contactListName:           "newsletter",
+			feedbackForwardingAddress: "bounces@example.com",
+			fromIdentityArn:           "arn:aws:ses:us-east-1:123456789012:identity/example.com",
+			topicName:                 "weekly",
+		}, email)
+		require.NoError(t, err)
+
+		input := client.input
+		assert.Equal(t, "tracking", aws.ToString(input.ConfigurationSetName))
+		assert.Equal(t, "bounces@example.com", aws.ToString(input.FeedbackForwardingEmailAddress))
+		assert.Equal(t, "arn:aws:ses:us-east-1:123456789012:identity/example.com", aws.ToString(input.FromEmailAddressIdentityArn))
+		require.NotNil(t, input.ListManagementOptions)
+		assert.Equal(t, "newsletter", aws.ToString(input.ListManagementOptions.ContactListName))
+		assert.Equal(t, "weekly", aws.ToString(input.ListManagementOptions.TopicName))
+		assert.Equal(t, []string{"bcc@domain.com"}, input.Destination.BccAddresses)
+		assert.NotContains(t, string(input.Content.Raw.Data), "bcc@domain.com")
+		require.Len(t, input.EmailTags, 2)
+	})
+
+	t.Run("return path is mapped", func(t *testing.T) {
+		email.RecipientsBcc = nil
+		email.ReturnPath = "bounces@example.com"
+		_, err = sendViaAwsSesV2(context.Background(), client, awsSesV2Options{}, email)
+		require.NoError(t, err)
+		assert.Equal(t, "bounces@example.com", aws.ToString(client.input.FeedbackForwardingEmailAddress))
+		assert.Contains(t, string(client.input.Content.Raw.Data), "Return-Path: bounces@example.com")
+
+		// The configured feedback address takes priority
+		_, err = sendViaAwsSesV2(context.Background(), client, awsSesV2Options{feedbackForwardingAddress: "feedback@example.com"}, email)
+		require.NoError(t, err)
+		assert.Equal(t, "feedback@example.com", aws.ToString(client.input.FeedbackForwardingEmailAddress))
+	})
+}
+
+// TestAwsSesMessageTags will test the awsSesMessageTags() method
+func TestAwsSesMessageTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		tags     []string
+		expected map[string]string
+	}{
+		{"no tags", nil, map[string]string{}},
+		{"plain tag", []string{"welcome"}, map[string]string{"welcome": "true"}},
+		{"name and value", []string{"campaign:spring-sale"}, map[string]string{"campaign": "spring-sale"}},
+		{"invalid characters", []string{"user type:pro plan!"}, map[string]string{"user_type": "pro_plan_"}},
+		{"empty value", []string{"campaign:"}, map[string]string{"campaign": "true"}},
+		{"duplicate names", []string{"campaign:a", "campaign:b"}, map[string]string{"campaign": "a"}},
+		{"empty name", []string{":value", " "}, map[string]string{}},
+		{"long name", []string{strings.Repeat("a", 300)}, map[string]string{strings.Repeat("a", awsSesTagMaxLength): "true"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tags := make(map[string]string)
+			for _, tag := range awsSesMessageTags(test.tags) {
+				tags[aws.ToString(tag.Name)] = aws.ToString(tag.Value)
+			}
+			assert.Equal(t, test.expected, tags)
+		})
+	}
+}
+
+// TestAwsSesV2_LocalEndpoint will test sending with SES v2 against a local fake using the endpoint override
+func TestAwsSesV2_LocalEndpoint(t *testing.T) {
+	t.Parallel()
+
+	var received struct {
+		ConfigurationSetName string
+		Content              struct {
+			Raw struct {
+				Data []byte
+			}
+		}
+		Destination struct {
+			ToAddresses []string
+		}
+		EmailTags []types.MessageTag
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v2/email/outbound-emails", r.URL.Path)
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=1234567/")
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"MessageId":"local-message-id"}`))
+	}))
+	defer server.Close()
+
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromDomain = testDomainEmail
+	mail.AwsSesAccessID = "1234567"
+	mail.AwsSesSecretKey = "1234567"
+	mail.AwsSesEndpoint = server.URL
+	mail.AwsSesEnableV2 = true
+	mail.AwsSesConfigurationSet = "tracking"
+	require.NoError(t, mail.StartUp())
+	assert.Contains(t, mail.AvailableProviders, AwsSesV2)
+
+	email := mail.NewEmail()
+	email.Subject = "Test subject"
+	email.PlainTextContent = "Test email content"
+	email.Recipients = []string{"test@domain.com"}
+	email.Tags = []string{"welcome"}
+
+	result, err := mail.SendEmailWithResult(context.Background(), email, AwsSesV2)
+	require.NoError(t, err)
+	assert.Equal(t, "local-message-id", result.MessageID)
+	assert.Equal(t, "tracking", received.ConfigurationSetName)
+	assert.Equal(t, []string{"test@domain.com"}, received.Destination.ToAddresses)
+	assert.Contains(t, string(received.Content.Raw.Data), "Subject: Test subject")
+	require.Len(t, received.EmailTags, 1)
+	assert.Equal(t, "welcome", aws.ToString(received.EmailTags[0].Name))
+}
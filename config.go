@@ -2,13 +2,14 @@ package gomail
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"net/smtp"
+	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ses"
-	"github.com/mattbaird/gochimp"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/mrz1836/postmark"
 )
 
@@ -21,51 +22,116 @@ const (
 	Mandrill                        // Mandrill Email Service
 	Postmark                        // Postmark Email Service
 	SMTP                            // SMTP Email Service
+	SendGrid                        // SendGrid Email Service
+	Mailgun                         // Mailgun Email Service
+	AwsSesV2                        // AWS SES v2 Email Service
 )
 
 const (
-	awsSesDefaultEndpoint = "https://email.us-east-1.amazonaws.com"
-	awsSesDefaultRegion   = "us-east-1"
-	maxBccRecipients      = 50
-	maxCcRecipients       = 50
-	maxToRecipients       = 50
+	awsSesDefaultEndpoint        = "https://email.us-east-1.amazonaws.com"
+	awsSesDefaultRegion          = "us-east-1"
+	awsSesDefaultRoleSessionName = "go-mail"
+	defaultHTTPTimeout           = 30 * time.Second // timeout of the Mailgun, Mandrill and SendGrid http clients
+	maxBccRecipients             = 50
+	maxCcRecipients              = 50
+	maxToRecipients              = 50
 )
 
 // MailService is the configuration to use for loading the service and provider's clients
 //
+// Configure the service and call StartUp (and RegisterProvider) before sending. After that, the
+// MailService is safe for concurrent use: SendEmail, SendEmailWithResult, SendWithFailover and Enqueue
+// can be called from multiple goroutines, each email must not be shared between them.
+//
 // DO NOT CHANGE ORDER - Optimized for memory (maligned)
 type MailService struct {
-	AvailableProviders  []ServiceProvider `json:"available_providers" mapstructure:"available_providers"`     // list of providers that loaded successfully
-	EmailCSS            []byte            `json:"email_css" mapstructure:"email_css"`                         // default css pre-parsed into bytes
-	AwsSesAccessID      string            `json:"aws_ses_access_id" mapstructure:"aws_ses_access_id"`         // aws iam access id for ses service
-	AwsSesEndpoint      string            `json:"aws_ses_endpoint" mapstructure:"aws_ses_endpoint"`           // ie: https://email.us-east-1.amazonaws.com
-	AwsSesSecretKey     string            `json:"aws_ses_secret_key" mapstructure:"aws_ses_secret_key"`       // aws iam secret key for corresponding access id
-	AwsSesRegion        string            `json:"aws_ses_region" mapstructure:"aws_ses_region"`               // AWS region
-	FromDomain          string            `json:"from_domain" mapstructure:"from_domain"`                     // ie: example.com
-	FromName            string            `json:"from_name" mapstructure:"from_name"`                         // ie: No Reply
-	FromUsername        string            `json:"from_username" mapstructure:"from_username"`                 // ie: no-reply
-	MandrillAPIKey      string            `json:"mandrill_api_key" mapstructure:"mandrill_api_key"`           // mandrill api key
-	PostmarkServerToken string            `json:"postmark_server_token" mapstructure:"postmark_server_token"` // ie: abc123...
-	SMTPHost            string            `json:"smtp_host" mapstructure:"smtp_host"`                         // ie: example.com
-	SMTPPassword        string            `json:"smtp_password" mapstructure:"smtp_password"`                 // ie: secretPassword
-	awsSesService       awsSesInterface   // AWS SES client
-	mandrillService     mandrillInterface // Mandrill api client
-	postmarkService     postmarkInterface // Postmark api client
-	smtpAuth            smtp.Auth         // Auth credentials for SMTP
-	smtpClient          smtpInterface     // SMTP client
-	SMTPUsername        string            `json:"smtp_username" mapstructure:"smtp_username"`           // ie: testuser
-	MaxBccRecipients    int               `json:"max_bcc_recipients" mapstructure:"max_bcc_recipients"` // max amount for BCC
-	MaxCcRecipients     int               `json:"max_cc_recipients" mapstructure:"max_cc_recipients"`   // max amount for CC
-	MaxToRecipients     int               `json:"max_to_recipients" mapstructure:"max_to_recipients"`   // max amount for TO
-	SMTPPort            int               `json:"smtp_port" mapstructure:"smtp_port"`                   // ie: 25
-	AutoText            bool              `json:"auto_text" mapstructure:"auto_text"`                   // whether to automatically generate a text part for messages that are not given text
-	Important           bool              `json:"important" mapstructure:"important"`                   // whether this message is important, and should be delivered ahead of non-important messages
-	TrackClicks         bool              `json:"track_clicks" mapstructure:"track_clicks"`             // whether to turn on click tracking for the message
-	TrackOpens          bool              `json:"track_opens" mapstructure:"track_opens"`               // whether to turn on open tracking for the message
+	AvailableProviders              []ServiceProvider            `json:"available_providers" mapstructure:"available_providers"`                                 // list of providers that loaded successfully
+	EmailCSS                        []byte                       `json:"email_css" mapstructure:"email_css"`                                                     // default css pre-parsed into bytes
+	DKIMHeaders                     []string                     `json:"dkim_headers" mapstructure:"dkim_headers"`                                               // header fields to sign (From is always signed)
+	PGPRecipientKeys                map[string]string            `json:"pgp_recipient_keys" mapstructure:"pgp_recipient_keys"`                                   // armored public key by recipient address
+	SuppressionActions              SuppressionActions           `json:"suppression_actions" mapstructure:"suppression_actions"`                                 // action for suppressed recipients by reason (default drop)
+	SMIMERecipientCertificates      map[string]string            `json:"smime_recipient_certificates" mapstructure:"smime_recipient_certificates"`               // PEM encryption certificate (RSA) by recipient address
+	ProviderPriority                []ServiceProvider            `json:"provider_priority" mapstructure:"provider_priority"`                                     // order of providers to try when failing over (defaults to available providers)
+	AwsSesAccessID                  string                       `json:"aws_ses_access_id" mapstructure:"aws_ses_access_id"`                                     // aws iam access id for ses service
+	AwsSesConfigurationSet          string                       `json:"aws_ses_configuration_set" mapstructure:"aws_ses_configuration_set"`                     // ses v2 configuration set name (event publishing, tracking)
+	AwsSesContactListName           string                       `json:"aws_ses_contact_list_name" mapstructure:"aws_ses_contact_list_name"`                     // ses v2 list management contact list
+	AwsSesEndpoint                  string                       `json:"aws_ses_endpoint" mapstructure:"aws_ses_endpoint"`                                       // ie: https://email.us-east-1.amazonaws.com
+	AwsSesFeedbackForwardingAddress string                       `json:"aws_ses_feedback_forwarding_address" mapstructure:"aws_ses_feedback_forwarding_address"` // ses v2 address for bounces and complaints
+	AwsSesExternalID                string                       `json:"aws_ses_external_id" mapstructure:"aws_ses_external_id"`                                 // external id for assuming the role (optional)
+	AwsSesFromIdentityArn           string                       `json:"aws_ses_from_identity_arn" mapstructure:"aws_ses_from_identity_arn"`                     // ses v2 identity arn for cross-account sending
+	AwsSesProfile                   string                       `json:"aws_ses_profile" mapstructure:"aws_ses_profile"`                                         // named profile from the shared aws config/credentials files
+	AwsSesRoleArn                   string                       `json:"aws_ses_role_arn" mapstructure:"aws_ses_role_arn"`                                       // role to assume for sending, ie: arn:aws:iam::123456789012:role/ses-sender
+	AwsSesRoleSessionName           string                       `json:"aws_ses_role_session_name" mapstructure:"aws_ses_role_session_name"`                     // session name for the assumed role (defaults to go-mail)
+	AwsSesSecretKey                 string                       `json:"aws_ses_secret_key" mapstructure:"aws_ses_secret_key"`                                   // aws iam secret key for corresponding access id
+	AwsSesRegion                    string                       `json:"aws_ses_region" mapstructure:"aws_ses_region"`                                           // AWS region
+	AwsSesTopicName                 string                       `json:"aws_ses_topic_name" mapstructure:"aws_ses_topic_name"`                                   // ses v2 list management topic
+	FromDomain                      string                       `json:"from_domain" mapstructure:"from_domain"`                                                 // ie: example.com
+	FromName                        string                       `json:"from_name" mapstructure:"from_name"`                                                     // ie: No Reply
+	FromUsername                    string                       `json:"from_username" mapstructure:"from_username"`                                             // ie: no-reply
+	DKIMDomain                      string                       `json:"dkim_domain" mapstructure:"dkim_domain"`                                                 // signing domain (d=), defaults to the from domain
+	DKIMPrivateKey                  string                       `json:"dkim_private_key" mapstructure:"dkim_private_key"`                                       // PEM encoded RSA or Ed25519 private key
+	DKIMPrivateKeyFile              string                       `json:"dkim_private_key_file" mapstructure:"dkim_private_key_file"`                             // path to the PEM private key (if no key is given)
+	DKIMSelector                    string                       `json:"dkim_selector" mapstructure:"dkim_selector"`                                             // selector (s=), ie: mail for mail._domainkey.example.com
+	PGPPassphrase                   string                       `json:"pgp_passphrase" mapstructure:"pgp_passphrase"`                                           // passphrase of the protected private key
+	PGPPrivateKey                   string                       `json:"pgp_private_key" mapstructure:"pgp_private_key"`                                         // armored private key of the sender (signing)
+	PGPPrivateKeyFile               string                       `json:"pgp_private_key_file" mapstructure:"pgp_private_key_file"`                               // path to the armored private key (if no key is given)
+	SMIMECertificate                string                       `json:"smime_certificate" mapstructure:"smime_certificate"`                                     // PEM signer certificate, followed by any intermediate certificates
+	SMIMECertificateFile            string                       `json:"smime_certificate_file" mapstructure:"smime_certificate_file"`                           // path to the PEM signer certificate (if no certificate is given)
+	SMIMEPrivateKey                 string                       `json:"smime_private_key" mapstructure:"smime_private_key"`                                     // PEM encoded RSA or ECDSA private key of the signer
+	SMIMEPrivateKeyFile             string                       `json:"smime_private_key_file" mapstructure:"smime_private_key_file"`                           // path to the PEM private key (if no key is given)
+	MailgunAPIKey                   string                       `json:"mailgun_api_key" mapstructure:"mailgun_api_key"`                                         // mailgun private api key
+	MailgunBaseURL                  string                       `json:"mailgun_base_url" mapstructure:"mailgun_base_url"`                                       // overrides the region, ie: http://localhost:8080
+	MailgunDomain                   string                       `json:"mailgun_domain" mapstructure:"mailgun_domain"`                                           // ie: mg.example.com
+	MailgunRegion                   string                       `json:"mailgun_region" mapstructure:"mailgun_region"`                                           // us (default) or eu
+	MandrillAPIKey                  string                       `json:"mandrill_api_key" mapstructure:"mandrill_api_key"`                                       // mandrill api key
+	MandrillBaseURL                 string                       `json:"mandrill_base_url" mapstructure:"mandrill_base_url"`                                     // ie: http://localhost:8080/api/1.0
+	PostmarkServerToken             string                       `json:"postmark_server_token" mapstructure:"postmark_server_token"`                             // ie: abc123...
+	ReturnPath                      string                       `json:"return_path" mapstructure:"return_path"`                                                 // default envelope sender for bounces, ie: bounces@example.com
+	SendGridAPIKey                  string                       `json:"sendgrid_api_key" mapstructure:"sendgrid_api_key"`                                       // sendgrid api key
+	SendGridBaseURL                 string                       `json:"sendgrid_base_url" mapstructure:"sendgrid_base_url"`                                     // ie: https://api.sendgrid.com
+	SMTPHost                        string                       `json:"smtp_host" mapstructure:"smtp_host"`                                                     // ie: example.com
+	SMTPPassword                    string                       `json:"smtp_password" mapstructure:"smtp_password"`                                             // ie: secretPassword
+	providers                       map[ServiceProvider]Provider // registered providers (built-in and custom)
+	pgp                             *pgpConfig                   // openpgp keys and missing key policy (nil if not configured)
+	SMTPTLSConfig                   *tls.Config                  `json:"-" mapstructure:"-"`                                     // custom tls config (CA pool, client certificates, ServerName, MinVersion)
+	SMTPTokenSource                 SMTPTokenSource              `json:"-" mapstructure:"-"`                                     // returns the oauth2 access token for XOAUTH2 (called for every new connection)
+	Outbox                          Queue                        `json:"-" mapstructure:"-"`                                     // queue of the emails sent with Enqueue (see StartOutbox)
+	OutboxErrorHandler              func(err error)              `json:"-" mapstructure:"-"`                                     // called with the errors of the outbox workers, ie: a queue that fails to save a job (logged if nil)
+	OutboxRetryPolicy               *RetryPolicy                 `json:"outbox_retry_policy" mapstructure:"outbox_retry_policy"` // attempts and backoff of outbox jobs for transient errors (defaults to 5 attempts)
+	outbox                          *outboxWorkers               // running outbox workers (nil if not started)
+	SuppressionStore                SuppressionStore             `json:"-" mapstructure:"-"`                                           // recipients on the list are filtered before sending (nil is no list)
+	RetryPolicy                     *RetryPolicy                 `json:"retry_policy" mapstructure:"retry_policy"`                     // retry policy for transient send errors (nil is no retries)
+	SMTPUsername                    string                       `json:"smtp_username" mapstructure:"smtp_username"`                   // ie: testuser
+	MaxBccRecipients                int                          `json:"max_bcc_recipients" mapstructure:"max_bcc_recipients"`         // max amount for BCC
+	MaxCcRecipients                 int                          `json:"max_cc_recipients" mapstructure:"max_cc_recipients"`           // max amount for CC
+	SMTPIdleTimeout                 time.Duration                `json:"smtp_idle_timeout" mapstructure:"smtp_idle_timeout"`           // pooled connections idle longer are closed (default 30s)
+	SMTPMaxIdleConns                int                          `json:"smtp_max_idle_conns" mapstructure:"smtp_max_idle_conns"`       // max idle pooled connections (default 2)
+	SMTPMaxOpenConns                int                          `json:"smtp_max_open_conns" mapstructure:"smtp_max_open_conns"`       // max open pooled connections (default 10)
+	OutboxPollInterval              time.Duration                `json:"outbox_poll_interval" mapstructure:"outbox_poll_interval"`     // how often idle workers check for due jobs (default 1s)
+	OutboxWorkers                   int                          `json:"outbox_workers" mapstructure:"outbox_workers"`                 // number of outbox workers (default 4)
+	MaxToRecipients                 int                          `json:"max_to_recipients" mapstructure:"max_to_recipients"`           // max amount for TO
+	SMTPTLSMode                     SMTPTLSMode                  `json:"smtp_tls_mode" mapstructure:"smtp_tls_mode"`                   // opportunistic STARTTLS (default), none, required STARTTLS or implicit TLS
+	PGPMissingKeyPolicy             PGPMissingKeyPolicy          `json:"pgp_missing_key_policy" mapstructure:"pgp_missing_key_policy"` // fail (default), plain or skip recipients without a public key
+	SMTPAuthMode                    SMTPAuthMode                 `json:"smtp_auth_mode" mapstructure:"smtp_auth_mode"`                 // auto (default), none, plain, login, cram-md5 or xoauth2
+	SMTPPort                        int                          `json:"smtp_port" mapstructure:"smtp_port"`                           // ie: 25
+	outboxMu                        sync.Mutex                   // guards the outbox workers
+	AwsSesDefaultCredentials        bool                         `json:"aws_ses_default_credentials" mapstructure:"aws_ses_default_credentials"` // use the default aws credential chain (env, shared files, web identity, IAM role)
+	AwsSesEnableV2                  bool                         `json:"aws_ses_enable_v2" mapstructure:"aws_ses_enable_v2"`                     // also load the ses v2 provider (AwsSesV2)
+	SMTPDisablePool                 bool                         `json:"smtp_disable_pool" mapstructure:"smtp_disable_pool"`                     // dial a new connection for every message
+	AutoText                        bool                         `json:"auto_text" mapstructure:"auto_text"`                                     // whether to automatically generate a text part for messages that are not given text
+	Important                       bool                         `json:"important" mapstructure:"important"`                                     // whether this message is important, and should be delivered ahead of non-important messages
+	TrackClicks                     bool                         `json:"track_clicks" mapstructure:"track_clicks"`                               // whether to turn on click tracking for the message
+	TrackOpens                      bool                         `json:"track_opens" mapstructure:"track_opens"`                                 // whether to turn on open tracking for the message
+	outboxClosed                    bool                         // Shutdown was called
 }
 
 // StartUp is fired once to load the email service
-func (m *MailService) StartUp() (err error) {
+func (m *MailService) StartUp() error {
+	return m.StartUpWithContext(context.Background())
+}
+
+// StartUpWithContext is fired once to load the email service, the context is used when loading provider configs
+func (m *MailService) StartUpWithContext(ctx context.Context) (err error) {
 	// Required to have user and domain
 	if len(m.FromUsername) == 0 {
 		err = ErrMissingFromUsername
@@ -80,75 +146,127 @@ func (m *MailService) StartUp() (err error) {
 	m.MaxCcRecipients = maxCcRecipients
 	m.MaxBccRecipients = maxBccRecipients
 
+	// Load the DKIM signer, S/MIME and OpenPGP configs for the raw MIME providers (SMTP and AWS SES)
+	var signer *dkimSigner
+	if signer, err = m.loadDKIMSigner(); err != nil {
+		return err
+	}
+	var smime *smimeConfig
+	if smime, err = m.loadSMIMEConfig(); err != nil {
+		return err
+	}
+	if m.pgp, err = m.loadPGPConfig(); err != nil {
+		return err
+	}
+	security := &messageSecurity{dkim: signer, pgp: m.pgp, smime: smime}
+	awsSesSecurity := &messageSecurity{dkim: signer.without(dkimAwsSesUnsignedHeaders...), pgp: m.pgp, smime: smime}
+
 	// If the key is set, try loading the service
 	if len(m.MandrillAPIKey) > 0 {
 
-		// Will Never return an error - set new MandrillApi
-		m.mandrillService, _ = gochimp.NewMandrill(m.MandrillAPIKey)
-
-		// Add to the list of available providers
-		m.AvailableProviders = append(m.AvailableProviders, Mandrill)
+		// Register the provider
+		if err = m.RegisterProvider(Mandrill, &mandrillProvider{client: newMandrillClient(m.MandrillAPIKey, m.MandrillBaseURL), async: true}); err != nil {
+			return err
+		}
 	}
 
-	// If the AWS SES credentials exist
-	if len(m.AwsSesAccessID) > 0 && len(m.AwsSesSecretKey) > 0 {
+	// If the AWS SES credentials (or another credential source) exist
+	if m.awsSesEnabled() {
 
-		// Set the region (default to us-east-1 if not provided)
-		region := awsSesDefaultRegion
-		if len(m.AwsSesRegion) > 0 {
-			region = m.AwsSesRegion
-		}
-
-		// Create AWS config with static credentials
-		awsConfig, awsErr := config.LoadDefaultConfig(
-			context.TODO(),
-			config.WithRegion(region),
-			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-				m.AwsSesAccessID,
-				m.AwsSesSecretKey,
-				"",
-			)),
-		)
+		// Load the AWS config for the credential source
+		awsConfig, awsErr := m.loadAwsConfig(ctx)
 		if awsErr != nil {
 			return fmt.Errorf("failed to load AWS config: %w", awsErr)
 		}
 
-		// Create SES client
-		sesClient := ses.NewFromConfig(awsConfig)
+		// Create SES client (set custom endpoint if provided)
+		sesClient := ses.NewFromConfig(awsConfig, func(o *ses.Options) {
+			if len(m.AwsSesEndpoint) > 0 {
+				o.BaseEndpoint = aws.String(m.AwsSesEndpoint)
+			}
+		})
 
-		// Set custom endpoint if provided
-		if len(m.AwsSesEndpoint) > 0 {
-			sesClient = ses.NewFromConfig(awsConfig, func(o *ses.Options) {
-				o.BaseEndpoint = &m.AwsSesEndpoint
-			})
+		// Wrap the client with our interface implementation and register the provider
+		if err = m.RegisterProvider(AwsSes, &awsSesProvider{client: &awsSesSdkV2Client{client: sesClient}, security: awsSesSecurity}); err != nil {
+			return err
 		}
 
-		// Wrap the client with our interface implementation
-		m.awsSesService = &awsSesSdkV2Client{client: sesClient}
-
-		// Add to the list of available providers
-		m.AvailableProviders = append(m.AvailableProviders, AwsSes)
+		// Load the SES v2 provider if enabled
+		if m.AwsSesEnableV2 {
+			sesV2Client := sesv2.NewFromConfig(awsConfig, func(o *sesv2.Options) {
+				if len(m.AwsSesEndpoint) > 0 {
+					o.BaseEndpoint = aws.String(m.AwsSesEndpoint)
+				}
+			})
+			if err = m.RegisterProvider(AwsSesV2, &awsSesV2Provider{
+				client: sesV2Client,
+				options: awsSesV2Options{
+					security:                  awsSesSecurity,
+					configurationSet:          m.AwsSesConfigurationSet,
+					contactListName:           m.AwsSesContactListName,
+					feedbackForwardingAddress: m.AwsSesFeedbackForwardingAddress,
+					fromIdentityArn:           m.AwsSesFromIdentityArn,
+					topicName:                 m.AwsSesTopicName,
+				},
+			}); err != nil {
+				return err
+			}
+		}
 	}
 
 	// If the Postmark credentials exist
 	if len(m.PostmarkServerToken) > 0 {
-		m.postmarkService = postmark.NewClient(m.PostmarkServerToken, "")
 
-		// Add to the list of available providers
-		m.AvailableProviders = append(m.AvailableProviders, Postmark)
+		// Register the provider
+		if err = m.RegisterProvider(Postmark, &postmarkProvider{client: postmark.NewClient(m.PostmarkServerToken, "")}); err != nil {
+			return err
+		}
+	}
+
+	// If the SendGrid credentials exist
+	if len(m.SendGridAPIKey) > 0 {
+
+		// Register the provider
+		if err = m.RegisterProvider(SendGrid, &sendGridProvider{client: newSendGridClient(m.SendGridAPIKey, m.SendGridBaseURL)}); err != nil {
+			return err
+		}
+	}
+
+	// If the Mailgun credentials exist
+	if len(m.MailgunAPIKey) > 0 && len(m.MailgunDomain) > 0 {
+
+		// Get the api base url for the region
+		baseURL, mailgunErr := mailgunBaseURL(m.MailgunRegion, m.MailgunBaseURL)
+		if mailgunErr != nil {
+			return mailgunErr
+		}
+
+		// Register the provider
+		if err = m.RegisterProvider(Mailgun, &mailgunProvider{client: newMailgunClient(m.MailgunAPIKey, m.MailgunDomain, baseURL)}); err != nil {
+			return err
+		}
 	}
 
-	// If the smtp credentials exist
-	if len(m.SMTPHost) > 0 && len(m.SMTPUsername) > 0 && len(m.SMTPPassword) > 0 {
+	// If the smtp host exists (credentials are optional for relays)
+	if len(m.SMTPHost) > 0 {
 
-		// Set the credentials
-		m.smtpAuth = smtp.PlainAuth("", m.SMTPUsername, m.SMTPPassword, m.SMTPHost)
+		// Set the credentials for the auth mode
+		smtpAuth, authErr := newSMTPAuth(m.SMTPAuthMode, m.SMTPHost, m.SMTPUsername, m.SMTPPassword, m.SMTPTokenSource)
+		if authErr != nil {
+			return authErr
+		}
 
-		// Create a new client from the connection string
-		m.smtpClient = newSMTPClient(fmt.Sprintf("%s:%d", m.SMTPHost, m.SMTPPort), m.smtpAuth)
+		// Create the dialer from the connection string
+		smtpDialer := newSMTPDialer(fmt.Sprintf("%s:%d", m.SMTPHost, m.SMTPPort), smtpAuth, m.SMTPTLSMode, m.SMTPTLSConfig)
 
-		// Add to the list of available providers
-		m.AvailableProviders = append(m.AvailableProviders, SMTP)
+		// Reuse connections with a pool (unless disabled) and register the provider
+		var sender smtpSender = smtpDialer
+		if !m.SMTPDisablePool {
+			sender = newSMTPPool(smtpDialer, m.SMTPMaxIdleConns, m.SMTPMaxOpenConns, m.SMTPIdleTimeout)
+		}
+		if err = m.RegisterProvider(SMTP, &smtpProvider{security: security, sender: sender}); err != nil {
+			return err
+		}
 	}
 
 	// No service providers found
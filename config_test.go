@@ -76,6 +76,23 @@ func TestMailService_StartUp(t *testing.T) {
 	err = service.StartUp()
 	require.NoError(t, err)
 
+	// Add SendGrid credentials
+	service.SendGridAPIKey = "1234567"
+	err = service.StartUp()
+	require.NoError(t, err)
+
+	// Add Mailgun credentials (invalid region)
+	service.MailgunAPIKey = "1234567"
+	service.MailgunDomain = "mg.example.com"
+	service.MailgunRegion = "mars"
+	err = service.StartUp()
+	require.ErrorIs(t, err, ErrInvalidMailgunRegion)
+
+	// Add Mailgun credentials
+	service.MailgunRegion = MailgunRegionEU
+	err = service.StartUp()
+	require.NoError(t, err)
+
 	// Add SMTP
 	service.SMTPHost = "example.com"
 	service.SMTPPassword = "fake-password"
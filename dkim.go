@@ -0,0 +1,164 @@
+package gomail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// dkimDefaultHeaders are the header fields signed when no headers are configured (From is always signed)
+var dkimDefaultHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID", "MIME-Version", "Content-Type",
+}
+
+// dkimAwsSesUnsignedHeaders are rewritten by AWS SES, so they must not be signed
+var dkimAwsSesUnsignedHeaders = []string{"Message-ID", "Date", "Return-Path", "Bounces-To"}
+
+// dkimSigner signs raw MIME messages with DKIM (RSA-SHA256 or Ed25519-SHA256, relaxed/relaxed)
+//
+// The options are immutable after creation, so the signer is safe for concurrent use
+type dkimSigner struct {
+	options dkim.SignOptions
+}
+
+// newDKIMSigner will create a signer for the domain and selector using a PEM private key
+//
+// The key can be PKCS#1 (RSA) or PKCS#8 (RSA or Ed25519), headers default to dkimDefaultHeaders
+func newDKIMSigner(domain, selector string, privateKeyPEM []byte, headers []string) (*dkimSigner, error) {
+	if len(domain) == 0 || len(selector) == 0 {
+		return nil, fmt.Errorf("dkim signing requires a domain and selector: %w", ErrInvalidDKIMConfig)
+	}
+
+	signer, err := parseDKIMPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// From must always be signed
+	if len(headers) == 0 {
+		headers = dkimDefaultHeaders
+	}
+	hasFrom := false
+	for _, header := range headers {
+		if strings.EqualFold(header, "From") {
+			hasFrom = true
+			break
+		}
+	}
+	if !hasFrom {
+		headers = append([]string{"From"}, headers...)
+	}
+
+	return &dkimSigner{options: dkim.SignOptions{
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		Domain:                 domain,
+		Hash:                   crypto.SHA256,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		HeaderKeys:             headers,
+		Selector:               selector,
+		Signer:                 signer,
+	}}, nil
+}
+
+// parseDKIMPrivateKey parses an RSA or Ed25519 private key from PEM
+func parseDKIMPrivateKey(privateKeyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("dkim private key is not PEM encoded: %w", ErrInvalidDKIMKey)
+	}
+
+	// PKCS#1 is only used for RSA keys
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidDKIMKey, err)
+		}
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDKIMKey, err)
+	}
+	switch signer := key.(type) {
+	case *rsa.PrivateKey:
+		return signer, nil
+	case ed25519.PrivateKey:
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("dkim private key type %T is not supported, use RSA or Ed25519: %w", key, ErrInvalidDKIMKey)
+	}
+}
+
+// without returns a copy of the signer that does not sign the given headers
+func (s *dkimSigner) without(headers ...string) *dkimSigner {
+	if s == nil {
+		return nil
+	}
+	signer := &dkimSigner{options: s.options}
+	signer.options.HeaderKeys = make([]string, 0, len(s.options.HeaderKeys))
+	for _, header := range s.options.HeaderKeys {
+		excluded := false
+		for _, exclude := range headers {
+			if strings.EqualFold(header, exclude) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			signer.options.HeaderKeys = append(signer.options.HeaderKeys, header)
+		}
+	}
+	return signer
+}
+
+// sign returns the message with the DKIM-Signature header prepended (a nil signer returns the message as is)
+func (s *dkimSigner) sign(message []byte) ([]byte, error) {
+	if s == nil {
+		return message, nil
+	}
+
+	options := s.options
+	var signed bytes.Buffer
+	signed.Grow(len(message) + 512)
+	if err := dkim.Sign(&signed, bytes.NewReader(message), &options); err != nil {
+		return nil, fmt.Errorf("dkim signing failed: %w", err)
+	}
+	return signed.Bytes(), nil
+}
+
+// dkimEnabled returns true if any DKIM setting is configured
+func (m *MailService) dkimEnabled() bool {
+	return len(m.DKIMSelector) > 0 || len(m.DKIMPrivateKey) > 0 || len(m.DKIMPrivateKeyFile) > 0
+}
+
+// loadDKIMSigner will create the DKIM signer from the MailService settings (nil if DKIM is not configured)
+func (m *MailService) loadDKIMSigner() (*dkimSigner, error) {
+	if !m.dkimEnabled() {
+		return nil, nil //nolint:nilnil // dkim signing is optional
+	}
+
+	// Load the key from the file if no key is given
+	privateKey := []byte(m.DKIMPrivateKey)
+	if len(privateKey) == 0 && len(m.DKIMPrivateKeyFile) > 0 {
+		var err error
+		if privateKey, err = os.ReadFile(m.DKIMPrivateKeyFile); err != nil {
+			return nil, fmt.Errorf("dkim private key file: %w", err)
+		}
+	}
+
+	// Sign for the from domain unless another domain is given
+	domain := m.DKIMDomain
+	if len(domain) == 0 {
+		domain = m.FromDomain
+	}
+	return newDKIMSigner(domain, m.DKIMSelector, privateKey, m.DKIMHeaders)
+}
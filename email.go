@@ -4,11 +4,13 @@ package gomail
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/aymerick/douceur/inliner"
 )
@@ -24,24 +26,50 @@ type Email struct {
 	RecipientsCc     []string     `json:"recipients_cc" mapstructure:"recipients_cc"`
 	Styles           []byte       `json:"styles" mapstructure:"styles"`
 	Tags             []string     `json:"tags" mapstructure:"tags"`
+	Date             time.Time    `json:"date" mapstructure:"date"`       // date header (defaults to the time the message is rendered)
+	SendAt           time.Time    `json:"send_at" mapstructure:"send_at"` // send the email later (natively if the provider supports scheduling, otherwise by the outbox)
 	FromAddress      string       `json:"from_address" mapstructure:"from_address"`
 	FromName         string       `json:"from_name" mapstructure:"from_name"`
 	HTMLContent      string       `json:"html_content" mapstructure:"html_content"`
+	MessageID        string       `json:"message_id" mapstructure:"message_id"` // message-id header, angle brackets are optional (generated if empty)
 	PlainTextContent string       `json:"plain_text_content" mapstructure:"plain_text_content"`
 	ReplyToAddress   string       `json:"reply_to_address" mapstructure:"reply_to_address"`
+	ReturnPath       string       `json:"return_path" mapstructure:"return_path"` // envelope sender for bounces (defaults to the from address)
 	Subject          string       `json:"subject" mapstructure:"subject"`
+	DSN              *DSN         `json:"dsn" mapstructure:"dsn"` // delivery status notification parameters (SMTP only)
 	AutoText         bool         `json:"auto_text" mapstructure:"auto_text"`
 	Important        bool         `json:"important" mapstructure:"important"`
+	PGPEncrypt       bool         `json:"pgp_encrypt" mapstructure:"pgp_encrypt"`     // encrypt with OpenPGP/MIME for every recipient (SMTP and AWS SES only)
+	PGPSign          bool         `json:"pgp_sign" mapstructure:"pgp_sign"`           // sign with OpenPGP/MIME (SMTP and AWS SES only)
+	SMIMEEncrypt     bool         `json:"smime_encrypt" mapstructure:"smime_encrypt"` // encrypt with S/MIME for every recipient (SMTP and AWS SES only)
+	SMIMESign        bool         `json:"smime_sign" mapstructure:"smime_sign"`       // sign with S/MIME (SMTP and AWS SES only)
 	TrackClicks      bool         `json:"track_clicks" mapstructure:"track_clicks"`
 	TrackOpens       bool         `json:"track_opens" mapstructure:"track_opens"`
+	VERP             bool         `json:"verp" mapstructure:"verp"` // encode each recipient into the return path (SMTP only, one transaction per recipient)
 	ViewContentLink  bool         `json:"view_content_link" mapstructure:"view_content_link"`
 }
 
 // Attachment is the email file attachment
+//
+// The content comes from the first source that is set: Content, Open, FilePath, then FileReader.
+// Content, Open and FilePath can be read for every send (retries, failover), a FileReader is read
+// once unless it implements io.Seeker. In JSON the content is base64 encoded and a file path is
+// kept as is (the file is read when the email is sent).
 type Attachment struct {
-	FileName   string    `json:"file_name" mapstructure:"file_name"`
-	FileReader io.Reader `json:"-" mapstructure:"-"`
-	FileType   string    `json:"file_type" mapstructure:"file_type"`
+	Content    []byte                        `json:"content,omitempty" mapstructure:"content"`     // content of the file
+	FileName   string                        `json:"file_name" mapstructure:"file_name"`           // name of the file
+	FilePath   string                        `json:"file_path,omitempty" mapstructure:"file_path"` // path of the file, opened when the email is sent
+	FileReader io.Reader                     `json:"-" mapstructure:"-"`                           // reader of the file contents
+	FileType   string                        `json:"file_type" mapstructure:"file_type"`           // content type, ie: application/pdf
+	Open       func() (io.ReadCloser, error) `json:"-" mapstructure:"-"`                           // opens the file contents, called for every send
+}
+
+// attachmentJSON is the JSON encoding of an attachment
+type attachmentJSON struct {
+	Content  []byte `json:"content,omitempty"`
+	FileName string `json:"file_name"`
+	FilePath string `json:"file_path,omitempty"`
+	FileType string `json:"file_type"`
 }
 
 // AddAttachment adds a new attachment
@@ -53,6 +81,148 @@ func (e *Email) AddAttachment(name, fileType string, reader io.Reader) {
 	})
 }
 
+// AddAttachmentBytes adds a new attachment with the content in memory
+func (e *Email) AddAttachmentBytes(name, fileType string, content []byte) {
+	e.Attachments = append(e.Attachments, Attachment{
+		Content:  content,
+		FileName: name,
+		FileType: fileType,
+	})
+}
+
+// AddAttachmentFile adds a new attachment that is read from the file when the email is sent
+// (the name defaults to the base name of the path)
+func (e *Email) AddAttachmentFile(name, fileType, path string) {
+	if len(name) == 0 {
+		name = filepath.Base(path)
+	}
+	e.Attachments = append(e.Attachments, Attachment{
+		FileName: name,
+		FilePath: path,
+		FileType: fileType,
+	})
+}
+
+// AddAttachmentFunc adds a new attachment that is opened with the func every time the email is sent
+func (e *Email) AddAttachmentFunc(name, fileType string, open func() (io.ReadCloser, error)) {
+	e.Attachments = append(e.Attachments, Attachment{
+		FileName: name,
+		FileType: fileType,
+		Open:     open,
+	})
+}
+
+// BufferAttachments reads every attachment that only has a reader into Content,
+// so the email can be sent more than once and encoded as JSON
+func (e *Email) BufferAttachments() error {
+	for i := range e.Attachments {
+		if err := e.Attachments[i].buffer(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bytes reads the content of the attachment from its source, readers that implement io.Seeker are rewound
+func (a Attachment) Bytes() ([]byte, error) {
+	switch {
+	case a.Content != nil:
+		return a.Content, nil
+	case a.Open != nil:
+		reader, err := a.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open attachment %s: %w", a.FileName, err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %w", a.FileName, err)
+		}
+		return content, nil
+	case len(a.FilePath) > 0:
+		content, err := os.ReadFile(a.FilePath) //nolint:gosec // path is set by the application
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %w", a.FileName, err)
+		}
+		return content, nil
+	case a.FileReader != nil:
+		return readAttachmentReader(a.FileName, a.FileReader)
+	default:
+		return nil, nil
+	}
+}
+
+// replayable returns true if the content can be read more than once
+func (a Attachment) replayable() bool {
+	if a.Content != nil || a.Open != nil || len(a.FilePath) > 0 || a.FileReader == nil {
+		return true
+	}
+	_, canSeek := a.FileReader.(io.Seeker)
+	return canSeek
+}
+
+// buffer reads the content of an attachment that only has a reader into Content
+func (a *Attachment) buffer() error {
+	if a.Content != nil || a.Open != nil || len(a.FilePath) > 0 || a.FileReader == nil {
+		return nil
+	}
+	content, err := a.Bytes()
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	a.Content, a.FileReader = content, nil
+	return nil
+}
+
+// MarshalJSON encodes the attachment with its content in base64 (an Open func is read, a file path is kept)
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	encoded := attachmentJSON{
+		Content:  a.Content,
+		FileName: a.FileName,
+		FilePath: a.FilePath,
+		FileType: a.FileType,
+	}
+	if a.Content == nil && len(a.FilePath) == 0 && (a.Open != nil || a.FileReader != nil) {
+		if !a.replayable() {
+			return nil, fmt.Errorf("attachment %s: %w", a.FileName, ErrAttachmentNotReplayable)
+		}
+		content, err := a.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		encoded.Content = content
+	}
+	return json.Marshal(encoded)
+}
+
+// readAttachmentReader reads the attachment reader, rewinding readers that implement io.Seeker
+func readAttachmentReader(name string, reader io.Reader) ([]byte, error) {
+	seeker, canSeek := reader.(io.Seeker)
+	var offset int64
+	if canSeek {
+		var err error
+		if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			canSeek = false
+		}
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment %s: %w", name, err)
+	}
+	if canSeek {
+		if _, err = seeker.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind attachment %s: %w", name, err)
+		}
+	}
+	return content, nil
+}
+
 // ApplyTemplates will take the template files and process them with the email data (can be e or overridden)
 func (e *Email) ApplyTemplates(htmlTemplate, textTemplate *template.Template, emailData interface{}) (err error) {
 	// Start the buffer
@@ -142,6 +312,7 @@ func (m *MailService) NewEmail() (email *Email) {
 	email.FromName = m.FromName
 	email.Important = m.Important
 	email.ReplyToAddress = email.FromAddress
+	email.ReturnPath = m.ReturnPath
 	email.TrackClicks = m.TrackClicks
 	email.TrackOpens = m.TrackOpens
 
@@ -168,34 +339,89 @@ func (m *MailService) validateEmail(email *Email) error {
 	if len(email.RecipientsBcc) > m.MaxBccRecipients {
 		return fmt.Errorf("max BCC recipient limit of %d reached: %d: %w", m.MaxBccRecipients, len(email.RecipientsBcc), ErrMaxBccRecipientsReached)
 	}
+	if err := email.validateSecurity(); err != nil {
+		return err
+	}
+	if email.DSN != nil {
+		return email.DSN.validate()
+	}
 	return nil
 }
 
 // SendEmail will send an email using the given provider
+//
+// Recipients on the SuppressionStore are filtered first, see SendEmailWithResult for which were dropped.
+// An email with a future SendAt is scheduled by the provider, or added to the Outbox if the provider cannot schedule it.
 func (m *MailService) SendEmail(ctx context.Context, email *Email, provider ServiceProvider) (err error) {
+	_, err = m.SendEmailWithResult(ctx, email, provider)
+	return err
+}
+
+// SendEmailWithResult will send an email using the given provider and return the provider's result
+// (message id, recipient statuses, raw response) for correlating later events with the sent message
+func (m *MailService) SendEmailWithResult(ctx context.Context, email *Email, provider ServiceProvider) (result SendResult, err error) {
 	// Check if provider is available
 	if !containsServiceProvider(m.AvailableProviders, provider) {
-		return fmt.Errorf("service provider: %x was not in the list of available service providers: %x, email not sent: %w", provider, m.AvailableProviders, ErrProviderNotFound)
+		return result, fmt.Errorf("service provider: %x was not in the list of available service providers: %x, email not sent: %w", provider, m.AvailableProviders, ErrProviderNotFound)
 	}
 
 	// Validate email configuration
 	if err = m.validateEmail(email); err != nil {
-		return err
+		return result, err
 	}
 
-	// Send it via the given provider
-	switch provider {
-	case AwsSes:
-		err = sendViaAwsSes(m.awsSesService, email)
-	case Mandrill:
-		err = sendViaMandrill(m.mandrillService, email, true)
-	case Postmark:
-		err = sendViaPostmark(ctx, m.postmarkService, email)
-	case SMTP:
-		err = sendViaSMTP(m.smtpClient, email)
-	default:
-		err = fmt.Errorf("service provider: %x was not in the list of available service providers: %x, email not sent: %w", provider, m.AvailableProviders, ErrProviderNotFound)
+	// Send it later via the outbox if the provider cannot schedule it
+	if email.scheduled() && !m.canSchedule(provider) {
+		return m.scheduleInOutbox(ctx, email, []ServiceProvider{provider})
 	}
 
-	return err
+	// Filter the suppressed recipients (reported in the result)
+	var suppressed []RecipientResult
+	if email, suppressed, err = m.filterSuppressed(ctx, email); err != nil {
+		return SendResult{Provider: provider, Recipients: suppressed}, err
+	}
+	defer func() {
+		result.Recipients = append(result.Recipients, suppressed...)
+	}()
+
+	// Send it via the given provider (only buffer the attachments if the send can be retried)
+	if m.RetryPolicy.attempts() <= 1 {
+		return m.sendViaProvider(ctx, email, provider)
+	}
+	var replay *replayableEmail
+	if replay, err = newReplayableEmail(email); err != nil {
+		return result, err
+	}
+	return m.sendWithRetry(ctx, replay, provider)
+}
+
+// sendViaProvider sends an already validated email using the given provider
+func (m *MailService) sendViaProvider(ctx context.Context, email *Email, provider ServiceProvider) (result SendResult, err error) {
+	p, ok := m.providers[provider]
+	if !ok {
+		return result, fmt.Errorf("service provider: %x was not in the list of available service providers: %x, email not sent: %w", provider, m.AvailableProviders, ErrProviderNotFound)
+	}
+
+	// Never send a message that should be signed or encrypted in the clear
+	if err = email.checkSecurity(p); err != nil {
+		return result, err
+	}
+
+	// Recipients without an OpenPGP key are handled by the missing key policy
+	if email.PGPEncrypt && m.pgp != nil {
+		if missing := m.pgp.missingKeys(email); len(missing) > 0 {
+			if result, err = m.sendWithMissingPGPKeys(ctx, p, email, missing); err != nil {
+				return result, classifyError(err)
+			}
+			result.Provider = provider
+			return result, nil
+		}
+	}
+
+	if result, err = p.Send(ctx, email); err != nil {
+		return result, classifyError(err)
+	}
+	result.Provider = provider
+
+	return result, nil
 }
@@ -2,11 +2,19 @@ package gomail
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -114,6 +122,164 @@ func BenchmarkEmail_AddAttachment(b *testing.B) {
 	}
 }
 
+// TestEmail_AddAttachmentSources tests the methods AddAttachmentBytes(), AddAttachmentFile() and AddAttachmentFunc()
+func TestEmail_AddAttachmentSources(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, os.WriteFile(path, []byte("file contents"), 0o600))
+
+	var opened int
+	email := new(Email)
+	email.AddAttachmentBytes("bytes.txt", "text/plain", []byte("bytes contents"))
+	email.AddAttachmentFile("", "text/csv", path)
+	email.AddAttachmentFile("renamed.csv", "text/csv", path)
+	email.AddAttachmentFunc("func.txt", "text/plain", func() (io.ReadCloser, error) {
+		opened++
+		return io.NopCloser(strings.NewReader("func contents")), nil
+	})
+	require.Len(t, email.Attachments, 4)
+	assert.Equal(t, "report.csv", email.Attachments[1].FileName)
+	assert.Equal(t, "renamed.csv", email.Attachments[2].FileName)
+
+	// Every source can be read more than once
+	expected := []string{"bytes contents", "file contents", "file contents", "func contents"}
+	for i := 0; i < 2; i++ {
+		for j, attachment := range email.Attachments {
+			content, err := attachment.Bytes()
+			require.NoError(t, err)
+			assert.Equal(t, expected[j], string(content))
+		}
+	}
+	assert.Equal(t, 2, opened)
+}
+
+// TestAttachment_Bytes tests the method Bytes()
+func TestAttachment_Bytes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("source order", func(t *testing.T) {
+		t.Parallel()
+
+		attachment := Attachment{
+			Content:    []byte("content"),
+			FileReader: strings.NewReader("reader"),
+			Open:       func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("open")), nil },
+		}
+		content, err := attachment.Bytes()
+		require.NoError(t, err)
+		assert.Equal(t, "content", string(content))
+
+		attachment.Content = nil
+		content, err = attachment.Bytes()
+		require.NoError(t, err)
+		assert.Equal(t, "open", string(content))
+
+		attachment.Open = nil
+		content, err = attachment.Bytes()
+		require.NoError(t, err)
+		assert.Equal(t, "reader", string(content))
+
+		// Seekable readers are rewound
+		content, err = attachment.Bytes()
+		require.NoError(t, err)
+		assert.Equal(t, "reader", string(content))
+
+		content, err = Attachment{}.Bytes()
+		require.NoError(t, err)
+		assert.Nil(t, content)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := Attachment{FileName: "missing.txt", FilePath: filepath.Join(t.TempDir(), "missing.txt")}.Bytes()
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		_, err = Attachment{Open: func() (io.ReadCloser, error) { return nil, ErrMissingEmailContents }}.Bytes()
+		require.ErrorIs(t, err, ErrMissingEmailContents)
+
+		_, err = Attachment{Open: func() (io.ReadCloser, error) { return io.NopCloser(&errorReader{}), nil }}.Bytes()
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+		_, err = Attachment{FileReader: &errorReader{}}.Bytes()
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+// TestAttachment_JSON tests encoding attachments as JSON
+func TestAttachment_JSON(t *testing.T) {
+	t.Parallel()
+
+	email := &Email{Subject: "attachments", Recipients: []string{"test@domain.com"}}
+	email.AddAttachmentBytes("bytes.txt", "text/plain", []byte("bytes contents"))
+	email.AddAttachmentFile("report.csv", "text/csv", "/data/report.csv")
+	email.AddAttachmentFunc("func.txt", "text/plain", func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("func contents")), nil
+	})
+	email.AddAttachment("reader.txt", "text/plain", strings.NewReader("reader contents"))
+
+	encoded, err := json.Marshal(email)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `{"content":"Ynl0ZXMgY29udGVudHM=","file_name":"bytes.txt","file_type":"text/plain"}`)
+	assert.Contains(t, string(encoded), `{"file_name":"report.csv","file_path":"/data/report.csv","file_type":"text/csv"}`)
+
+	// The reader is still readable after encoding
+	content, err := email.Attachments[3].Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, "reader contents", string(content))
+
+	decoded := new(Email)
+	require.NoError(t, json.Unmarshal(encoded, decoded))
+	require.Len(t, decoded.Attachments, 4)
+	assert.Equal(t, Attachment{Content: []byte("bytes contents"), FileName: "bytes.txt", FileType: "text/plain"}, decoded.Attachments[0])
+	assert.Equal(t, Attachment{FileName: "report.csv", FilePath: "/data/report.csv", FileType: "text/csv"}, decoded.Attachments[1])
+	assert.Equal(t, "func contents", string(decoded.Attachments[2].Content))
+	assert.Equal(t, "reader contents", string(decoded.Attachments[3].Content))
+
+	// Readers that cannot be rewound must be buffered first
+	email = &Email{}
+	email.AddAttachment("pipe.txt", "text/plain", io.MultiReader(strings.NewReader("pipe contents")))
+	_, err = json.Marshal(email)
+	require.ErrorIs(t, err, ErrAttachmentNotReplayable)
+
+	require.NoError(t, email.BufferAttachments())
+	assert.Nil(t, email.Attachments[0].FileReader)
+	encoded, err = json.Marshal(email)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"content":"cGlwZSBjb250ZW50cw=="`)
+
+	email.AddAttachment("bad.txt", "text/plain", &errorReader{})
+	require.Error(t, email.BufferAttachments())
+}
+
+// TestMailService_SendEmailTwice tests sending the same email more than once with replayable attachments
+func TestMailService_SendEmailTwice(t *testing.T) {
+	t.Parallel()
+
+	mail := newFailoverTestService(t)
+	capture := &mockCaptureMandrillInterface{}
+	require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: capture, async: true}))
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, os.WriteFile(path, []byte("file contents"), 0o600))
+
+	email := mail.NewEmail()
+	email.Subject = "Test subject"
+	email.PlainTextContent = "Test email content"
+	email.Recipients = []string{"test@domain.com"}
+	email.AddAttachmentBytes("bytes.txt", "text/plain", []byte("bytes contents"))
+	email.AddAttachmentFile("", "text/csv", path)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, mail.SendEmail(context.Background(), email, Mandrill))
+		require.Len(t, capture.messages, i+1)
+		require.Len(t, capture.messages[i].Attachments, 2)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("bytes contents")), capture.messages[i].Attachments[0].Content)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("file contents")), capture.messages[i].Attachments[1].Content)
+	}
+}
+
 // TestEmail_ParseTemplate tests the method ParseTemplate()
 func TestEmail_ParseTemplate(t *testing.T) {
 	t.Parallel()
@@ -247,10 +413,10 @@ func TestMailService_SendEmail(t *testing.T) {
 	require.NoError(t, err)
 
 	// Set mock interface(s)
-	mail.postmarkService = &mockPostmarkInterface{}
-	mail.mandrillService = &mockMandrillInterface{}
-	mail.smtpClient = newMockSMTPClient()
-	mail.awsSesService = &mockAwsSesInterface{}
+	require.NoError(t, mail.RegisterProvider(Postmark, &postmarkProvider{client: &mockPostmarkInterface{}}))
+	require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: &mockMandrillInterface{}, async: true}))
+	require.NoError(t, mail.RegisterProvider(SMTP, &smtpProvider{sender: &mockSMTPSender{}}))
+	require.NoError(t, mail.RegisterProvider(AwsSes, &awsSesProvider{client: &mockAwsSesInterface{}}))
 
 	email := mail.NewEmail()
 	email.Subject = "Test subject"
@@ -274,6 +440,123 @@ func TestMailService_SendEmail(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// TestMailService_SendEmailWithResult tests the method SendEmailWithResult()
+func TestMailService_SendEmailWithResult(t *testing.T) {
+	t.Parallel()
+
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromName = testFromNameEmail
+	mail.FromDomain = testDomainEmail
+
+	// Use the Postmark and Mandrill providers
+	mail.PostmarkServerToken = "1234567"
+	mail.MandrillAPIKey = "1234567"
+
+	// Start the mail service
+	err := mail.StartUp()
+	require.NoError(t, err)
+
+	// Set mock interface(s)
+	require.NoError(t, mail.RegisterProvider(Postmark, &postmarkProvider{client: &mockPostmarkInterface{}}))
+	require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: &mockMandrillInterface{}, async: true}))
+
+	email := mail.NewEmail()
+	email.Subject = "Test subject"
+	email.PlainTextContent = "Test email content"
+	email.Recipients = []string{"test@domain.com"}
+
+	// Valid (Postmark)
+	var result SendResult
+	result, err = mail.SendEmailWithResult(context.Background(), email, Postmark)
+	require.NoError(t, err)
+	assert.Equal(t, Postmark, result.Provider)
+	assert.NotEmpty(t, result.MessageID)
+	require.Len(t, result.Recipients, 1)
+	assert.Equal(t, "test@domain.com", result.Recipients[0].Email)
+	assert.Equal(t, RecipientAccepted, result.Recipients[0].Status)
+
+	// Valid (Mandrill)
+	result, err = mail.SendEmailWithResult(context.Background(), email, Mandrill)
+	require.NoError(t, err)
+	assert.Equal(t, Mandrill, result.Provider)
+	assert.NotEmpty(t, result.MessageID)
+
+	// Invalid provider
+	_, err = mail.SendEmailWithResult(context.Background(), email, SMTP)
+	require.ErrorIs(t, err, ErrProviderNotFound)
+}
+
+// TestMailService_SendEmailConcurrent tests concurrent calls to SendEmail() (run with -race)
+func TestMailService_SendEmailConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const sends = 25
+
+	// Start a local SMTP server
+	server := newTestSMTPServer(t)
+	host, port, err := net.SplitHostPort(server.addr)
+	require.NoError(t, err)
+
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromName = testFromNameEmail
+	mail.FromDomain = testDomainEmail
+	mail.PostmarkServerToken = "1234567"
+	mail.SMTPHost = host
+	mail.SMTPPort, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	mail.SMTPUsername = "fake-username"
+	mail.SMTPPassword = "fake-password"
+	mail.RetryPolicy = &RetryPolicy{InitialBackoff: time.Millisecond, MaxAttempts: 2}
+	require.NoError(t, mail.StartUp())
+	require.NoError(t, mail.RegisterProvider(Postmark, &postmarkProvider{client: &mockPostmarkInterface{}}))
+
+	// Send a unique email from each goroutine
+	var wg sync.WaitGroup
+	errs := make(chan error, sends*2)
+	for i := 0; i < sends; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			email := mail.NewEmail()
+			email.Subject = fmt.Sprintf("Test subject %d", i)
+			email.PlainTextContent = "Test email content"
+			email.Recipients = []string{fmt.Sprintf("to-%d@domain.com", i)}
+			email.AddAttachment(fmt.Sprintf("file-%d.txt", i), "text/plain", strings.NewReader("attachment contents"))
+			email.Important = i%2 == 0
+			errs <- mail.SendEmail(context.Background(), email, SMTP)
+
+			email = mail.NewEmail()
+			email.Subject = fmt.Sprintf("Test subject %d", i)
+			email.PlainTextContent = "Test email content"
+			email.Recipients = []string{"test@domain.com"}
+			_, sendErr := mail.SendWithFailover(context.Background(), email, Postmark, SMTP)
+			errs <- sendErr
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for sendErr := range errs {
+		require.NoError(t, sendErr)
+	}
+
+	// Every message only has its own recipient, attachment and headers
+	messages := server.messages()
+	require.Len(t, messages, sends)
+	for _, message := range messages {
+		require.Len(t, message.to, 1)
+		var i int
+		_, err = fmt.Sscanf(message.to[0], "to-%d@domain.com", &i)
+		require.NoError(t, err)
+		assert.Contains(t, message.data, fmt.Sprintf("Subject: Test subject %d\r\n", i))
+		assert.Equal(t, 1, strings.Count(message.data, "Content-Disposition: attachment"))
+		assert.Contains(t, message.data, fmt.Sprintf("file-%d.txt", i))
+		assert.Equal(t, i%2 == 0, strings.Contains(message.data, "Importance: High"))
+	}
+}
+
 // TestMailService_SendEmailInValid tests the method SendEmail()
 func TestMailService_SendEmailInValid(t *testing.T) {
 	t.Parallel()
@@ -294,7 +577,7 @@ func TestMailService_SendEmailInValid(t *testing.T) {
 	require.NoError(t, err)
 
 	// Set mock interface(s)
-	mail.postmarkService = &mockPostmarkInterface{}
+	require.NoError(t, mail.RegisterProvider(Postmark, &postmarkProvider{client: &mockPostmarkInterface{}}))
 
 	email := mail.NewEmail()
 
@@ -343,4 +626,10 @@ func TestMailService_SendEmailInValid(t *testing.T) {
 	}
 	err = mail.SendEmail(context.Background(), email, Postmark)
 	require.Error(t, err)
+	email.RecipientsBcc = []string{"someone@domain.com"}
+
+	// Invalid DSN options
+	email.DSN = &DSN{Notify: []string{DSNNotifyNever, DSNNotifyFailure}}
+	err = mail.SendEmail(context.Background(), email, Postmark)
+	require.ErrorIs(t, err, ErrInvalidDSN)
 }
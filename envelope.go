@@ -0,0 +1,97 @@
+package gomail
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DSN notify conditions (RFC 3461)
+const (
+	DSNNotifyDelay   = "DELAY"   // notify when delivery is delayed
+	DSNNotifyFailure = "FAILURE" // notify when delivery fails
+	DSNNotifyNever   = "NEVER"   // never notify (cannot be combined)
+	DSNNotifySuccess = "SUCCESS" // notify when the message is delivered
+)
+
+// DSN return options (RFC 3461)
+const (
+	DSNReturnFull    = "FULL" // return the full message in failure notifications
+	DSNReturnHeaders = "HDRS" // return only the headers in failure notifications
+)
+
+// DSN are the delivery status notification parameters (RFC 3461) sent with the SMTP envelope
+//
+// They are only sent if the SMTP server advertises the DSN extension
+type DSN struct {
+	EnvelopeID string   `json:"envelope_id" mapstructure:"envelope_id"` // ENVID, returned in the notifications to identify the message
+	Notify     []string `json:"notify" mapstructure:"notify"`           // NOTIFY per recipient, ie: SUCCESS, FAILURE, DELAY or NEVER
+	Return     string   `json:"return" mapstructure:"return"`           // RET, ie: FULL or HDRS
+}
+
+// validate checks the notify conditions and return option
+func (d *DSN) validate() error {
+	for _, notify := range d.Notify {
+		switch notify {
+		case DSNNotifySuccess, DSNNotifyFailure, DSNNotifyDelay:
+		case DSNNotifyNever:
+			if len(d.Notify) > 1 {
+				return fmt.Errorf("dsn notify %s cannot be combined with other conditions: %w", DSNNotifyNever, ErrInvalidDSN)
+			}
+		default:
+			return fmt.Errorf("dsn notify %q is not supported: %w", notify, ErrInvalidDSN)
+		}
+	}
+	if len(d.Return) > 0 && d.Return != DSNReturnFull && d.Return != DSNReturnHeaders {
+		return fmt.Errorf("dsn return %q is not supported: %w", d.Return, ErrInvalidDSN)
+	}
+	if strings.ContainsAny(d.EnvelopeID, "\r\n") {
+		return fmt.Errorf("dsn envelope id contains a line break: %w", ErrInvalidDSN)
+	}
+	return nil
+}
+
+// envelopeSender returns the envelope sender (MAIL FROM) for the recipient
+//
+// The return path is used if set (VERP encoded for the recipient if enabled), otherwise the from address
+func (e *Email) envelopeSender(recipient string) string {
+	if len(e.ReturnPath) == 0 {
+		return e.FromAddress
+	}
+	if e.VERP && len(recipient) > 0 {
+		return verpAddress(e.ReturnPath, recipient)
+	}
+	return e.ReturnPath
+}
+
+// verpAddress encodes the recipient into the return path (VERP)
+//
+// ie: bounces@example.com and john@doe.com become bounces+john=doe.com@example.com
+func verpAddress(returnPath, recipient string) string {
+	local, domain, found := strings.Cut(returnPath, "@")
+	if !found {
+		return returnPath
+	}
+	return local + "+" + strings.Replace(recipient, "@", "=", 1) + "@" + domain
+}
+
+// returnPathDomain returns the domain of the return path (empty if not set)
+func (e *Email) returnPathDomain() string {
+	if index := strings.LastIndex(e.ReturnPath, "@"); index >= 0 {
+		return e.ReturnPath[index+1:]
+	}
+	return ""
+}
+
+// smtpXText encodes a DSN parameter value as xtext (RFC 3461)
+func smtpXText(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			_, _ = fmt.Fprintf(&builder, "+%02X", c)
+			continue
+		}
+		builder.WriteByte(c)
+	}
+	return builder.String()
+}
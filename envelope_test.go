@@ -0,0 +1,210 @@
+package gomail
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDSN_validate will test the validate() method
+func TestDSN_validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		dsn           DSN
+		expectedError bool
+	}{
+		{"empty", DSN{}, false},
+		{"all conditions", DSN{Notify: []string{DSNNotifySuccess, DSNNotifyFailure, DSNNotifyDelay}, Return: DSNReturnHeaders}, false},
+		{"never", DSN{Notify: []string{DSNNotifyNever}, Return: DSNReturnFull}, false},
+		{"never combined", DSN{Notify: []string{DSNNotifyNever, DSNNotifySuccess}}, true},
+		{"unknown condition", DSN{Notify: []string{"ALWAYS"}}, true},
+		{"unknown return", DSN{Return: "BODY"}, true},
+		{"envelope id with line break", DSN{EnvelopeID: "id\r\nRSET"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.dsn.validate()
+			if test.expectedError {
+				require.ErrorIs(t, err, ErrInvalidDSN)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestEmail_envelopeSender will test the envelopeSender() method
+func TestEmail_envelopeSender(t *testing.T) {
+	t.Parallel()
+
+	email := &Email{FromAddress: "no-reply@example.com"}
+	assert.Equal(t, "no-reply@example.com", email.envelopeSender("john@doe.com"))
+
+	email.ReturnPath = "bounces@example.com"
+	assert.Equal(t, "bounces@example.com", email.envelopeSender("john@doe.com"))
+	assert.Equal(t, "example.com", email.returnPathDomain())
+
+	email.VERP = true
+	assert.Equal(t, "bounces+john=doe.com@example.com", email.envelopeSender("john@doe.com"))
+	assert.Equal(t, "bounces@example.com", email.envelopeSender(""))
+
+	// Not an address
+	assert.Equal(t, "bounces", verpAddress("bounces", "john@doe.com"))
+	assert.Empty(t, (&Email{}).returnPathDomain())
+}
+
+// TestSMTPXText will test the smtpXText() method
+func TestSMTPXText(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "order-123", smtpXText("order-123"))
+	assert.Equal(t, "a+2Bb+3Dc+20d", smtpXText("a+b=c d"))
+	assert.Equal(t, "john@doe.com", smtpXText("john@doe.com"))
+}
+
+// TestSendViaSMTP_Envelope will test the return path, VERP and DSN against a local SMTP server
+func TestSendViaSMTP_Envelope(t *testing.T) {
+	t.Parallel()
+
+	newEmail := func() *Email {
+		email := &Email{
+			FromAddress:      "no-reply@example.com",
+			PlainTextContent: "Test",
+			Recipients:       []string{"john@doe.com"},
+			RecipientsCc:     []string{"jane@doe.com"},
+			ReturnPath:       "bounces@example.com",
+			Subject:          "Test",
+		}
+		return email
+	}
+
+	t.Run("return path", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		dialer := newSMTPDialer(server.addr, nil, SMTPTLSNone, nil)
+		email := newEmail()
+		_, err := sendViaSMTP(context.Background(), dialer, nil, email)
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "bounces@example.com", messages[0].from)
+		assert.Equal(t, []string{"john@doe.com", "jane@doe.com"}, messages[0].to)
+		assert.Contains(t, messages[0].data, "From: no-reply@example.com")
+	})
+
+	t.Run("verp sends a transaction per recipient", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		dialer := newSMTPDialer(server.addr, nil, SMTPTLSNone, nil)
+		email := newEmail()
+		email.VERP = true
+		email.RecipientsBcc = []string{"reject@doe.com"}
+
+		// Recipients that accepted the message are not sent it again by a retry or failover
+		result, err := sendViaSMTP(context.Background(), dialer, nil, email)
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 2)
+		assert.Equal(t, "bounces+john=doe.com@example.com", messages[0].from)
+		assert.Equal(t, []string{"john@doe.com"}, messages[0].to)
+		assert.Equal(t, "bounces+jane=doe.com@example.com", messages[1].from)
+		assert.Equal(t, []string{"jane@doe.com"}, messages[1].to)
+
+		require.Len(t, result.Recipients, 3)
+		assert.Equal(t, RecipientAccepted, result.Recipients[0].Status)
+		assert.Equal(t, RecipientAccepted, result.Recipients[1].Status)
+		assert.Equal(t, RecipientRejected, result.Recipients[2].Status)
+		assert.Equal(t, "5.1.1 No such user", result.Recipients[2].RejectReason)
+	})
+
+	t.Run("verp fails if every recipient is rejected", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		dialer := newSMTPDialer(server.addr, nil, SMTPTLSNone, nil)
+		email := newEmail()
+		email.VERP = true
+		email.Recipients = []string{"reject@doe.com"}
+		email.RecipientsCc = nil
+		result, err := sendViaSMTP(context.Background(), dialer, nil, email)
+		require.Error(t, err)
+		assert.True(t, IsPermanent(err))
+		require.Len(t, result.Recipients, 1)
+		assert.Equal(t, RecipientRejected, result.Recipients[0].Status)
+		assert.Empty(t, server.messages())
+	})
+
+	t.Run("verp connection failure keeps the accepted recipients", func(t *testing.T) {
+		email := newEmail()
+		email.VERP = true
+		email.Recipients = []string{"test@domain.com"}
+		email.RecipientsCc = []string{"test@badhostname.com", "test@domain.com"}
+		result, err := sendViaSMTP(context.Background(), &mockSMTPSender{}, nil, email)
+		require.NoError(t, err)
+
+		require.Len(t, result.Recipients, 3)
+		assert.Equal(t, RecipientAccepted, result.Recipients[0].Status)
+		assert.Equal(t, RecipientNotSent, result.Recipients[1].Status)
+		assert.Equal(t, ErrDNSLookup.Error(), result.Recipients[1].RejectReason)
+		assert.Equal(t, RecipientNotSent, result.Recipients[2].Status)
+
+		// Nothing was sent
+		email.Recipients = []string{"test@badhostname.com"}
+		result, err = sendViaSMTP(context.Background(), &mockSMTPSender{}, nil, email)
+		require.ErrorIs(t, err, ErrDNSLookup)
+		assert.Equal(t, RecipientNotSent, result.Recipients[0].Status)
+	})
+
+	t.Run("dsn parameters are sent when advertised", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		server.enableDSN()
+		dialer := newSMTPDialer(server.addr, nil, SMTPTLSNone, nil)
+		email := newEmail()
+		email.DSN = &DSN{
+			EnvelopeID: "order 123",
+			Notify:     []string{DSNNotifySuccess, DSNNotifyFailure, DSNNotifyDelay},
+			Return:     DSNReturnHeaders,
+		}
+		_, err := sendViaSMTP(context.Background(), dialer, nil, email)
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "bounces@example.com", messages[0].from)
+		assert.Equal(t, "BODY=8BITMIME RET=HDRS ENVID=order+20123", messages[0].mailParams)
+		assert.Equal(t, []string{
+			"NOTIFY=SUCCESS,FAILURE,DELAY ORCPT=rfc822;john@doe.com",
+			"NOTIFY=SUCCESS,FAILURE,DELAY ORCPT=rfc822;jane@doe.com",
+		}, messages[0].rcptParams)
+	})
+
+	t.Run("dsn parameters are skipped when not advertised", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		dialer := newSMTPDialer(server.addr, nil, SMTPTLSNone, nil)
+		email := newEmail()
+		email.DSN = &DSN{Notify: []string{DSNNotifyFailure}, Return: DSNReturnFull}
+		_, err := sendViaSMTP(context.Background(), dialer, nil, email)
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "BODY=8BITMIME", messages[0].mailParams)
+		assert.Equal(t, []string{"", ""}, messages[0].rcptParams)
+	})
+
+	t.Run("rejected recipient with dsn", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		server.enableDSN()
+		dialer := newSMTPDialer(server.addr, nil, SMTPTLSNone, nil)
+		email := newEmail()
+		email.Recipients = []string{"reject@doe.com"}
+		email.DSN = &DSN{Notify: []string{DSNNotifyFailure}}
+		_, err := sendViaSMTP(context.Background(), dialer, nil, email)
+		require.Error(t, err)
+		assert.True(t, IsPermanent(err))
+		assert.Empty(t, server.messages())
+	})
+}
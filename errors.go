@@ -10,17 +10,61 @@ var (
 	ErrNoServiceProvider   = errors.New("attempted to startup the email service provider(s) however there's no available service provider")
 
 	// Email validation errors
-	ErrMissingSubject          = errors.New("email is missing a subject")
-	ErrMissingContent          = errors.New("email is missing content (plain & html)")
-	ErrMissingRecipient        = errors.New("email is missing a recipient")
-	ErrInvalidFromAddress      = errors.New("invalid FromAddress, domain not found")
-	ErrProviderNotFound        = errors.New("service provider was not in the list of available service providers, email not sent")
-	ErrMaxToRecipientsReached  = errors.New("max TO recipient limit reached")
-	ErrMaxCcRecipientsReached  = errors.New("max CC recipient limit reached")
-	ErrMaxBccRecipientsReached = errors.New("max BCC recipient limit reached")
-	ErrInvalidAWSResponse      = errors.New("aws ses did not return expected valid response")
-	ErrMessageNotSent          = errors.New("message status and not sent")
-	ErrPostmarkError           = errors.New("error from postmark")
+	ErrMissingSubject           = errors.New("email is missing a subject")
+	ErrMissingContent           = errors.New("email is missing content (plain & html)")
+	ErrMissingRecipient         = errors.New("email is missing a recipient")
+	ErrInvalidFromAddress       = errors.New("invalid FromAddress, domain not found")
+	ErrProviderNotFound         = errors.New("service provider was not in the list of available service providers, email not sent")
+	ErrMaxToRecipientsReached   = errors.New("max TO recipient limit reached")
+	ErrMaxCcRecipientsReached   = errors.New("max CC recipient limit reached")
+	ErrMaxBccRecipientsReached  = errors.New("max BCC recipient limit reached")
+	ErrInvalidAWSResponse       = errors.New("aws ses did not return expected valid response")
+	ErrMessageNotSent           = errors.New("message status and not sent")
+	ErrPostmarkError            = errors.New("error from postmark")
+	ErrSendGridError            = errors.New("error from sendgrid")
+	ErrMailgunError             = errors.New("error from mailgun")
+	ErrInvalidMailgunRegion     = errors.New("invalid mailgun region, use us or eu")
+	ErrAllProvidersFailed       = errors.New("all service providers failed to send the email")
+	ErrNilProvider              = errors.New("service provider cannot be nil")
+	ErrSMTPStartTLSNotSupported = errors.New("smtp server does not support STARTTLS")
+	ErrMissingSMTPCredentials   = errors.New("missing smtp credentials for the auth mode")
+	ErrInvalidSMTPAuthMode      = errors.New("invalid smtp auth mode")
+	ErrSMTPUnencryptedAuth      = errors.New("smtp auth refused over an unencrypted connection")
+	ErrSMTPAuthWrongHost        = errors.New("smtp auth host does not match the server")
+	ErrSMTPAuthLogin            = errors.New("smtp auth login failed")
+	ErrInvalidDSN               = errors.New("invalid delivery status notification (dsn) options")
+	ErrInvalidDKIMConfig        = errors.New("invalid dkim config")
+	ErrInvalidDKIMKey           = errors.New("invalid dkim private key")
+	ErrInvalidSMTPCommand       = errors.New("invalid smtp command")
+	ErrInvalidSMIMEConfig       = errors.New("invalid smime config")
+	ErrInvalidSMIMECertificate  = errors.New("invalid smime certificate")
+	ErrSMIMENotConfigured       = errors.New("smime is not configured")
+	ErrSMIMENotSupported        = errors.New("service provider does not support smime")
+	ErrSMIMEMissingCertificate  = errors.New("missing smime certificate for the recipient")
+	ErrSMIMEAndPGP              = errors.New("email cannot be secured with both smime and openpgp")
+	ErrInvalidPGPConfig         = errors.New("invalid openpgp config")
+	ErrInvalidPGPKey            = errors.New("invalid openpgp key")
+	ErrPGPNotConfigured         = errors.New("openpgp is not configured")
+	ErrPGPNotSupported          = errors.New("service provider does not support openpgp")
+	ErrPGPMissingKey            = errors.New("missing openpgp public key for the recipient")
+	ErrInvalidMIME              = errors.New("invalid mime message")
+	ErrMissingSuppressionEmail  = errors.New("suppression is missing an email address")
+	ErrRecipientSuppressed      = errors.New("recipient is on the suppression list")
+	ErrAllRecipientsSuppressed  = errors.New("every TO recipient of the email is on the suppression list")
+	ErrOutboxNotConfigured      = errors.New("outbox queue is not configured")
+	ErrOutboxClosed             = errors.New("outbox is shut down")
+	ErrOutboxJobNotFound        = errors.New("outbox job not found")
+	ErrOutboxJobExists          = errors.New("outbox job already exists")
+	ErrInvalidOutboxJobID       = errors.New("invalid outbox job id")
+	ErrOutboxJobNotPending      = errors.New("outbox job is not pending")
+	ErrSchedulingNotSupported   = errors.New("service provider cannot schedule emails and the outbox is not configured")
+	ErrScheduledMessageNotFound = errors.New("scheduled message not found")
+	ErrAttachmentNotReplayable  = errors.New("attachment reader can only be read once, use Content, FilePath or Open")
+
+	// Send error classifications
+	ErrTransient = errors.New("transient send error, the email can be retried")
+	ErrPermanent = errors.New("permanent send error, the email should not be retried")
+	ErrRejected  = errors.New("recipient rejected by the service provider, the email should not be sent by another provider")
 
 	// Test-specific errors
 	ErrMissingEmailContents = errors.New("missing email contents")
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	gomail "github.com/mrz1836/go-mail"
 )
@@ -25,6 +26,12 @@ func main() {
 	// Run the SMTP example
 	// smtpExample()
 
+	// Run the SendGrid example
+	// sendGridExample()
+
+	// Run the Mailgun example
+	// mailgunExample()
+
 	// Example using ALL options available
 	// allOptionsExample()
 }
@@ -217,6 +224,99 @@ func smtpExample() { //nolint:unused // this is an example function
 	log.Printf("email sent!")
 }
 
+// sendGridExample shows an example using SendGrid as the provider
+func sendGridExample() { //nolint:unused // this is an example function
+
+	// Config
+	mail := new(gomail.MailService)
+	mail.FromName = "No Reply"
+	mail.FromUsername = "no-reply"
+	mail.FromDomain = os.Getenv("EMAIL_FROM_DOMAIN")
+	if len(mail.FromDomain) == 0 {
+		log.Fatal("missing env: EMAIL_FROM_DOMAIN")
+	}
+
+	// Set the to field
+	toRecipients := os.Getenv("EMAIL_TEST_TO_RECIPIENT")
+	if len(toRecipients) == 0 {
+		log.Fatal("missing env: EMAIL_TEST_TO_RECIPIENT")
+	}
+
+	// Provider
+	mail.SendGridAPIKey = os.Getenv("EMAIL_SENDGRID_API_KEY")
+	if len(mail.SendGridAPIKey) == 0 {
+		log.Fatal("missing env: EMAIL_SENDGRID_API_KEY")
+	}
+	provider := gomail.SendGrid
+
+	// Start the service
+	err := mail.StartUp()
+	if err != nil {
+		log.Printf("error in StartUp: %s using provider: %x", err.Error(), provider)
+	}
+
+	// Create and send a basic email
+	email := mail.NewEmail()
+	email.HTMLContent = "<html><body>This is a <b>go-mail</b> example email using <i>HTML</i></body></html>"
+	email.Recipients = []string{toRecipients}
+	email.Subject = "example go-mail email using SendGrid"
+
+	// Send the email
+	if err = mail.SendEmail(context.Background(), email, provider); err != nil {
+		log.Fatalf("error in SendEmail: %s using provider: %x", err.Error(), provider)
+	}
+	log.Printf("email sent!")
+}
+
+// mailgunExample shows an example using Mailgun as the provider
+func mailgunExample() { //nolint:unused // this is an example function
+
+	// Config
+	mail := new(gomail.MailService)
+	mail.FromName = "No Reply"
+	mail.FromUsername = "no-reply"
+	mail.FromDomain = os.Getenv("EMAIL_FROM_DOMAIN")
+	if len(mail.FromDomain) == 0 {
+		log.Fatal("missing env: EMAIL_FROM_DOMAIN")
+	}
+
+	// Set the to field
+	toRecipients := os.Getenv("EMAIL_TEST_TO_RECIPIENT")
+	if len(toRecipients) == 0 {
+		log.Fatal("missing env: EMAIL_TEST_TO_RECIPIENT")
+	}
+
+	// Provider
+	mail.MailgunAPIKey = os.Getenv("EMAIL_MAILGUN_API_KEY")
+	if len(mail.MailgunAPIKey) == 0 {
+		log.Fatal("missing env: EMAIL_MAILGUN_API_KEY")
+	}
+	mail.MailgunDomain = os.Getenv("EMAIL_MAILGUN_DOMAIN")
+	if len(mail.MailgunDomain) == 0 {
+		log.Fatal("missing env: EMAIL_MAILGUN_DOMAIN")
+	}
+	mail.MailgunRegion = os.Getenv("EMAIL_MAILGUN_REGION") // us (default) or eu
+	provider := gomail.Mailgun
+
+	// Start the service
+	err := mail.StartUp()
+	if err != nil {
+		log.Printf("error in StartUp: %s using provider: %x", err.Error(), provider)
+	}
+
+	// Create and send a basic email
+	email := mail.NewEmail()
+	email.HTMLContent = "<html><body>This is a <b>go-mail</b> example email using <i>HTML</i></body></html>"
+	email.Recipients = []string{toRecipients}
+	email.Subject = "example go-mail email using Mailgun"
+
+	// Send the email
+	if err = mail.SendEmail(context.Background(), email, provider); err != nil {
+		log.Fatalf("error in SendEmail: %s using provider: %x", err.Error(), provider)
+	}
+	log.Printf("email sent!")
+}
+
 // allOptionsExample is using the most number of options/features
 func allOptionsExample() { //nolint:unused // this is an example function
 
@@ -233,16 +333,54 @@ func allOptionsExample() { //nolint:unused // this is an example function
 	mail.AwsSesAccessID = os.Getenv("EMAIL_AWS_SES_ACCESS_ID")   // AKIAY...
 	mail.AwsSesSecretKey = os.Getenv("EMAIL_AWS_SES_SECRET_KEY") // tOpw3WU...
 
+	// AWS SES without static keys (default credential chain or a named profile, optionally assuming a role)
+	// mail.AwsSesDefaultCredentials = true
+	// mail.AwsSesProfile = "ses-sender"
+	// mail.AwsSesRoleArn = "arn:aws:iam::123456789012:role/ses-sender"
+	// mail.AwsSesExternalID = "external-id"
+
+	// AWS SES v2 (loaded as gomail.AwsSesV2 using the AWS SES credentials)
+	mail.AwsSesEnableV2 = true
+	mail.AwsSesConfigurationSet = os.Getenv("EMAIL_AWS_SES_CONFIGURATION_SET") // my-tracking-set
+
 	// Postmark
 	mail.PostmarkServerToken = os.Getenv("EMAIL_POSTMARK_SERVER_TOKEN") // AKIAY...
 
+	// SendGrid
+	mail.SendGridAPIKey = os.Getenv("EMAIL_SENDGRID_API_KEY") // SG.abc123...
+
+	// Mailgun
+	mail.MailgunAPIKey = os.Getenv("EMAIL_MAILGUN_API_KEY") // key-abc123...
+	mail.MailgunDomain = os.Getenv("EMAIL_MAILGUN_DOMAIN")  // mg.example.com
+	mail.MailgunRegion = gomail.MailgunRegionEU             // or MailgunRegionUS (default)
+
 	// SMTP
 	mail.SMTPHost = os.Getenv("EMAIL_SMTP_HOST")                  // example.com
 	mail.SMTPPort, _ = strconv.Atoi(os.Getenv("EMAIL_SMTP_PORT")) // 25
 	mail.SMTPUsername = os.Getenv("EMAIL_SMTP_USERNAME")          // johndoe
 	mail.SMTPPassword = os.Getenv("EMAIL_SMTP_PASSWORD")          // secretPassword
+	mail.SMTPAuthMode = gomail.SMTPAuthPlain                      // or SMTPAuthLogin, SMTPAuthCRAMMD5, SMTPAuthNone (relays)
+	mail.SMTPMaxIdleConns = 2                                     // pooled connections kept open between sends
+	mail.SMTPMaxOpenConns = 10                                    // max connections open at the same time
+	mail.SMTPIdleTimeout = 30 * time.Second                       // close pooled connections idle longer than this
+	mail.SMTPTLSMode = gomail.SMTPTLSRequired                     // fail if the server does not offer STARTTLS (SMTPTLSImplicit for port 465)
+	// mail.SMTPTLSConfig = &tls.Config{RootCAs: pool}            // custom CAs, client certificates or server name
+	// mail.SMTPTokenSource = func() (string, error) { ... }      // XOAUTH2: return a fresh oauth2 access token
+
+	// DKIM signing for SMTP and AWS SES (RSA or Ed25519 PEM key)
+	mail.DKIMSelector = os.Getenv("EMAIL_DKIM_SELECTOR")               // mail (mail._domainkey.example.com)
+	mail.DKIMPrivateKeyFile = os.Getenv("EMAIL_DKIM_PRIVATE_KEY_FILE") // /etc/dkim/mail.pem
 
-	provider := gomail.SMTP // Other options: AwsSes Mandrill Postmark
+	// S/MIME for SMTP and AWS SES (set Email.SMIMESign or Email.SMIMEEncrypt per message)
+	mail.SMIMECertificateFile = os.Getenv("EMAIL_SMIME_CERTIFICATE_FILE") // /etc/smime/no-reply.pem (with any intermediates)
+	mail.SMIMEPrivateKeyFile = os.Getenv("EMAIL_SMIME_PRIVATE_KEY_FILE")  // /etc/smime/no-reply.key
+
+	// OpenPGP/MIME for SMTP and AWS SES (set Email.PGPSign or Email.PGPEncrypt per message)
+	mail.PGPPrivateKeyFile = os.Getenv("EMAIL_PGP_PRIVATE_KEY_FILE") // /etc/pgp/no-reply.asc
+	mail.PGPPassphrase = os.Getenv("EMAIL_PGP_PASSPHRASE")           // passphrase of the private key
+	mail.PGPMissingKeyPolicy = gomail.PGPMissingKeyPlain             // or PGPMissingKeyFail (default), PGPMissingKeySkip
+
+	provider := gomail.SMTP // Other options: AwsSes AwsSesV2 Mailgun Mandrill Postmark SendGrid
 
 	// Start the service
 	err := mail.StartUp()
@@ -250,6 +388,11 @@ func allOptionsExample() { //nolint:unused // this is an example function
 		log.Printf("error in StartUp: %s using provider: %x", err.Error(), provider)
 	}
 
+	// Close any pooled connections when done
+	defer func() {
+		_ = mail.Close()
+	}()
+
 	// Available services given the config above
 	log.Printf("available service providers: %x", mail.AvailableProviders)
 
@@ -268,13 +411,27 @@ func allOptionsExample() { //nolint:unused // this is an example function
 	email.TrackOpens = true
 	email.AutoText = true
 
-	// Add an attachment
-	var f *os.File
-	f, err = os.Open("test-attachment-file.txt")
-	if err != nil {
+	// Send bounces to a dedicated address, VERP encoded for each recipient with DSN (SMTP)
+	email.ReturnPath = "bounces@" + mail.FromDomain
+	email.VERP = true
+	email.DSN = &gomail.DSN{
+		Notify: []string{gomail.DSNNotifyFailure, gomail.DSNNotifyDelay},
+		Return: gomail.DSNReturnHeaders,
+	}
+
+	// Add an attachment (the file is read every time the email is sent)
+	if _, err = os.Stat("test-attachment-file.txt"); err != nil {
 		log.Printf("unable to load file for attachment")
 	} else {
-		email.AddAttachment("test-attachment-file.txt", "text/plain", f)
+		email.AddAttachmentFile("", "text/plain", "test-attachment-file.txt")
+	}
+
+	// Archive the raw MIME message (the same Date and Message-ID are used when sending)
+	var raw []byte
+	if raw, err = email.ToMIME(); err != nil {
+		log.Printf("error in ToMIME: %s", err.Error())
+	} else if err = os.WriteFile("example-email.eml", raw, 0o600); err != nil {
+		log.Printf("unable to archive the email: %s", err.Error())
 	}
 
 	// Send the email (basic example using one provider)
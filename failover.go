@@ -0,0 +1,106 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// replayableEmail holds an email with the attachments that can only be read once buffered
+// in memory, so it can be sent more than once (failover, retries)
+type replayableEmail struct {
+	email *Email
+}
+
+// newReplayableEmail reads every attachment that only has a reader into memory (the email is not changed)
+func newReplayableEmail(email *Email) (*replayableEmail, error) {
+	buffered := *email
+	buffered.Attachments = make([]Attachment, len(email.Attachments))
+	copy(buffered.Attachments, email.Attachments)
+	if err := buffered.BufferAttachments(); err != nil {
+		return nil, err
+	}
+	return &replayableEmail{email: &buffered}, nil
+}
+
+// next returns a copy of the email for the next attempt
+func (r *replayableEmail) next() *Email {
+	email := *r.email
+	email.Attachments = make([]Attachment, len(r.email.Attachments))
+	copy(email.Attachments, r.email.Attachments)
+	return &email
+}
+
+// SendWithFailover will send an email using the first provider that delivers it
+//
+// Providers are tried in the order given, falling back to ProviderPriority and then
+// AvailableProviders. Each provider is retried per the RetryPolicy for transient errors,
+// then the next provider is tried with the same email (attachments are buffered so they
+// can be replayed). The result reports which provider finally delivered the email.
+// Failover only happens for provider failures: a rejected recipient (ErrRejected) or a send
+// that reached some of the recipients is returned as is, so no recipient gets the email twice.
+// An email with a future SendAt is added to the Outbox (unless every provider can schedule it).
+func (m *MailService) SendWithFailover(ctx context.Context, email *Email, providers ...ServiceProvider) (result SendResult, err error) {
+	// Default to the configured priority, then every available provider
+	if len(providers) == 0 {
+		providers = m.ProviderPriority
+	}
+	if len(providers) == 0 {
+		providers = m.AvailableProviders
+	}
+	if len(providers) == 0 {
+		return result, ErrNoServiceProvider
+	}
+
+	// Validate email configuration (applies to every provider)
+	if err = m.validateEmail(email); err != nil {
+		return result, err
+	}
+
+	// Send it later via the outbox (unless every provider can schedule it)
+	if email.scheduled() && !m.canSchedule(providers...) {
+		return m.scheduleInOutbox(ctx, email, providers)
+	}
+
+	// Filter the suppressed recipients (reported in the result)
+	var suppressed []RecipientResult
+	if email, suppressed, err = m.filterSuppressed(ctx, email); err != nil {
+		return SendResult{Recipients: suppressed}, err
+	}
+
+	// Buffer the attachments so each attempt gets a fresh reader
+	var replay *replayableEmail
+	if replay, err = newReplayableEmail(email); err != nil {
+		return result, err
+	}
+
+	// Try each provider in order
+	errs := make([]error, 0, len(providers))
+	for _, provider := range providers {
+
+		// Stop if the caller has given up
+		if err = ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		// Skip providers that did not load
+		if !containsServiceProvider(m.AvailableProviders, provider) {
+			errs = append(errs, fmt.Errorf("service provider: %x: %w", provider, ErrProviderNotFound))
+			continue
+		}
+
+		// Send via the provider (with retries), move to the next on a provider failure
+		if result, err = m.sendWithRetry(ctx, replay, provider); err == nil {
+			result.Recipients = append(result.Recipients, suppressed...)
+			return result, nil
+		} else if errors.Is(err, ErrRejected) || result.delivered() {
+			result.Provider = provider
+			result.Recipients = append(result.Recipients, suppressed...)
+			return result, fmt.Errorf("service provider: %x: %w", provider, err)
+		}
+		errs = append(errs, fmt.Errorf("service provider: %x: %w", provider, err))
+	}
+
+	return SendResult{Recipients: suppressed}, fmt.Errorf("%w: %w", ErrAllProvidersFailed, errors.Join(errs...))
+}
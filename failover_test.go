@@ -0,0 +1,242 @@
+package gomail
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattbaird/gochimp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCaptureMandrillInterface is a mocking interface for Mandrill that records each message
+type mockCaptureMandrillInterface struct {
+	messages []gochimp.Message
+	options  []gochimp.MessageSendOptions
+}
+
+// MessageSend is for mocking
+func (m *mockCaptureMandrillInterface) MessageSend(_ context.Context, message gochimp.Message, options gochimp.MessageSendOptions) ([]gochimp.SendResponse, error) {
+	m.messages = append(m.messages, message)
+	m.options = append(m.options, options)
+	return []gochimp.SendResponse{{Email: message.To[0].Email, Status: "sent", Id: "failover-id"}}, nil
+}
+
+// mockPartialProvider is a provider that reaches some of the recipients and fails for the others
+type mockPartialProvider struct {
+	err   error
+	calls int
+}
+
+// Name returns the name of the provider
+func (p *mockPartialProvider) Name() string {
+	return "partial_test"
+}
+
+// Capabilities returns the features supported by the provider
+func (p *mockPartialProvider) Capabilities() Capabilities {
+	return Capabilities{Cc: true}
+}
+
+// Send accepts the first recipient and rejects the others
+func (p *mockPartialProvider) Send(_ context.Context, email *Email) (SendResult, error) {
+	p.calls++
+	result := newSendResult(testRelayProvider, email, RecipientRejected)
+	result.Recipients[0].Status = RecipientAccepted
+	return result, p.err
+}
+
+// newFailoverTestService will create a service with Postmark and Mandrill loaded
+func newFailoverTestService(t *testing.T) *MailService {
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromName = testFromNameEmail
+	mail.FromDomain = testDomainEmail
+	mail.PostmarkServerToken = "1234567"
+	mail.MandrillAPIKey = "1234567"
+	require.NoError(t, mail.StartUp())
+
+	require.NoError(t, mail.RegisterProvider(Postmark, &postmarkProvider{client: &mockPostmarkInterface{}}))
+	require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: &mockMandrillInterface{}, async: true}))
+	return mail
+}
+
+// TestReplayableEmail will test the replayableEmail methods
+func TestReplayableEmail(t *testing.T) {
+	t.Parallel()
+
+	email := &Email{Subject: "replay"}
+	email.AddAttachment("file.txt", "text/plain", strings.NewReader("attachment contents"))
+	email.AddAttachment("empty.txt", "text/plain", nil)
+
+	replay, err := newReplayableEmail(email)
+	require.NoError(t, err)
+
+	// Each copy has the full contents
+	for i := 0; i < 3; i++ {
+		next := replay.next()
+		require.Len(t, next.Attachments, 2)
+		var content []byte
+		content, err = next.Attachments[0].Bytes()
+		require.NoError(t, err)
+		assert.Equal(t, "attachment contents", string(content))
+		assert.Nil(t, next.Attachments[1].FileReader)
+		assert.Equal(t, "replay", next.Subject)
+	}
+}
+
+// TestMailService_SendWithFailover tests the method SendWithFailover()
+func TestMailService_SendWithFailover(t *testing.T) {
+	t.Parallel()
+
+	t.Run("first provider delivers", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@domain.com"}
+
+		result, err := mail.SendWithFailover(context.Background(), email, Postmark, Mandrill)
+		require.NoError(t, err)
+		assert.Equal(t, Postmark, result.Provider)
+	})
+
+	t.Run("fails over to next provider with attachments", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		capture := &mockCaptureMandrillInterface{}
+		require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: capture}))
+
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@errorcode.com"}
+		email.AddAttachment("file.txt", "text/plain", strings.NewReader("attachment contents"))
+
+		result, err := mail.SendWithFailover(context.Background(), email, Postmark, Mandrill)
+		require.NoError(t, err)
+		assert.Equal(t, Mandrill, result.Provider)
+		assert.Equal(t, "failover-id", result.MessageID)
+
+		// The attachment was replayed for the second provider
+		require.Len(t, capture.messages, 1)
+		require.Len(t, capture.messages[0].Attachments, 1)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("attachment contents")), capture.messages[0].Attachments[0].Content)
+	})
+
+	t.Run("uses provider priority", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		mail.ProviderPriority = []ServiceProvider{Mandrill, Postmark}
+
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@domain.com"}
+
+		result, err := mail.SendWithFailover(context.Background(), email)
+		require.NoError(t, err)
+		assert.Equal(t, Mandrill, result.Provider)
+	})
+
+	t.Run("all providers fail", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@badtoken.com"}
+
+		_, err := mail.SendWithFailover(context.Background(), email, SMTP, Postmark, Mandrill)
+		require.ErrorIs(t, err, ErrAllProvidersFailed)
+		require.ErrorIs(t, err, ErrProviderNotFound)
+		require.ErrorIs(t, err, ErrPostmarkTokenError)
+		require.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("rejected recipients do not fail over", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		next := &mockOutboxProvider{}
+		require.NoError(t, mail.RegisterProvider(testRelayProvider, next))
+
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@rejected.com"}
+
+		result, err := mail.SendWithFailover(context.Background(), email, Mandrill, testRelayProvider)
+		require.ErrorIs(t, err, ErrRejected)
+		require.ErrorIs(t, err, ErrPermanent)
+		assert.NotErrorIs(t, err, ErrAllProvidersFailed)
+		assert.Equal(t, Mandrill, result.Provider)
+		assert.Equal(t, 0, next.sentCount())
+	})
+
+	t.Run("partly delivered email does not fail over", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		mail.RetryPolicy = &RetryPolicy{InitialBackoff: time.Millisecond, MaxAttempts: 3}
+		partial := &mockPartialProvider{err: transientError(errOutboxTest)}
+		require.NoError(t, mail.RegisterProvider(testRelayProvider, partial))
+		capture := &mockCaptureMandrillInterface{}
+		require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: capture}))
+
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@domain.com"}
+		email.RecipientsCc = []string{"test@errorcode.com"}
+
+		result, err := mail.SendWithFailover(context.Background(), email, testRelayProvider, Mandrill)
+		require.ErrorIs(t, err, errOutboxTest)
+		assert.Equal(t, 1, partial.calls)
+		assert.Empty(t, capture.messages)
+		assert.Equal(t, testRelayProvider, result.Provider)
+		require.Len(t, result.Recipients, 2)
+		assert.Equal(t, RecipientAccepted, result.Recipients[0].Status)
+		assert.Equal(t, RecipientRejected, result.Recipients[1].Status)
+	})
+
+	t.Run("all providers fail with suppressed recipients", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		mail.SuppressionStore = NewMemorySuppressionStore()
+		require.NoError(t, mail.SuppressionStore.Add(context.Background(), Suppression{Email: "bounced@domain.com", Reason: SuppressionHardBounce}))
+
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@badtoken.com", "bounced@domain.com"}
+
+		result, err := mail.SendWithFailover(context.Background(), email, Postmark, Mandrill)
+		require.ErrorIs(t, err, ErrAllProvidersFailed)
+		require.Len(t, result.Recipients, 1)
+		assert.Equal(t, RecipientSuppressed, result.Recipients[0].Status)
+	})
+
+	t.Run("invalid email is not sent", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		email := mail.NewEmail()
+
+		_, err := mail.SendWithFailover(context.Background(), email)
+		require.ErrorIs(t, err, ErrMissingSubject)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		mail := newFailoverTestService(t)
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@domain.com"}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := mail.SendWithFailover(ctx, email)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("no providers", func(t *testing.T) {
+		mail := new(MailService)
+		_, err := mail.SendWithFailover(context.Background(), new(Email))
+		require.ErrorIs(t, err, ErrNoServiceProvider)
+	})
+}
@@ -505,3 +505,32 @@ func FuzzAttachmentProcessing(f *testing.F) {
 		require.Equal(t, content, string(readContent), "content should match")
 	})
 }
+
+// FuzzParseMIME tests parsing raw MIME messages and rendering the parsed email again
+func FuzzParseMIME(f *testing.F) {
+	// Seed corpus with rendered and hand written messages
+	raw, err := newTestMIMEEmail().ToMIME()
+	require.NoError(f, err)
+	f.Add(raw)
+	f.Add([]byte(testParseMIMEMessage))
+	f.Add([]byte("Subject: =?UTF-8?Q?Hi?=\r\n\r\nHello"))
+	f.Add([]byte("Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n\r\nbody\r\n--b--\r\n"))
+	f.Add([]byte(""))
+
+	f.Fuzz(func(t *testing.T, message []byte) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Errorf("ParseMIME panicked: %v", r)
+			}
+		}()
+
+		email, parseErr := ParseMIME(bytes.NewReader(message))
+		if parseErr != nil {
+			return
+		}
+
+		// A parsed email can always be rendered
+		_, renderErr := email.ToMIME()
+		require.NoError(t, renderErr, "parsed email should render")
+	})
+}
@@ -0,0 +1,311 @@
+package gomail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// Mailgun api regions
+const (
+	MailgunRegionEU = "eu" // Mailgun EU region (api.eu.mailgun.net)
+	MailgunRegionUS = "us" // Mailgun US region (api.mailgun.net)
+)
+
+const (
+	mailgunBaseURLEU = "https://api.eu.mailgun.net"
+	mailgunBaseURLUS = "https://api.mailgun.net"
+	mailgunMaxTags   = 3
+)
+
+// mailgunInterface is an interface for Mailgun/mocking
+type mailgunInterface interface {
+	SendEmail(ctx context.Context, message *mailgunMessage) (mailgunResponse, error)
+}
+
+// mailgunMessage is the Mailgun messages api request
+type mailgunMessage struct {
+	attachments []mailgunAttachment
+	fields      url.Values
+}
+
+// mailgunAttachment is an attachment uploaded with the message
+type mailgunAttachment struct {
+	content  []byte
+	fileName string
+	fileType string
+}
+
+// mailgunResponse is the response of an accepted Mailgun message
+type mailgunResponse struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// mailgunError is an error response from the Mailgun api
+type mailgunError struct {
+	Message    string `json:"message"`
+	StatusCode int    `json:"-"`
+}
+
+// Error returns the error message from Mailgun
+func (e *mailgunError) Error() string {
+	return fmt.Sprintf("mailgun returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// mailgunClient is a minimal client for the Mailgun messages api
+type mailgunClient struct {
+	apiKey     string
+	baseURL    string
+	domain     string
+	httpClient *http.Client
+}
+
+// mailgunBaseURL returns the api base url for the region (custom base url takes priority)
+func mailgunBaseURL(region, baseURL string) (string, error) {
+	if len(baseURL) > 0 {
+		return strings.TrimSuffix(baseURL, "/"), nil
+	}
+	switch strings.ToLower(region) {
+	case "", MailgunRegionUS:
+		return mailgunBaseURLUS, nil
+	case MailgunRegionEU:
+		return mailgunBaseURLEU, nil
+	default:
+		return "", fmt.Errorf("mailgun region %s is not supported: %w", region, ErrInvalidMailgunRegion)
+	}
+}
+
+// newMailgunClient will create a new Mailgun client for the domain
+func newMailgunClient(apiKey, domain, baseURL string) *mailgunClient {
+	return &mailgunClient{
+		apiKey:     apiKey,
+		baseURL:    baseURL,
+		domain:     domain,
+		httpClient: &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+// SendEmail posts the message to the Mailgun messages api as a multipart form
+func (c *mailgunClient) SendEmail(ctx context.Context, message *mailgunMessage) (response mailgunResponse, err error) {
+	// Build the multipart form
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, values := range message.fields {
+		for _, value := range values {
+			if err = form.WriteField(key, value); err != nil {
+				return response, err
+			}
+		}
+	}
+	for _, attachment := range message.attachments {
+		contentType := attachment.fileType
+		if len(contentType) == 0 {
+			contentType = "application/octet-stream"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     "attachment",
+			"filename": attachment.fileName,
+		}))
+		header.Set("Content-Type", contentType)
+
+		var part io.Writer
+		if part, err = form.CreatePart(header); err != nil {
+			return response, err
+		}
+		if _, err = part.Write(attachment.content); err != nil {
+			return response, err
+		}
+	}
+	if err = form.Close(); err != nil {
+		return response, err
+	}
+
+	// Create the request
+	endpoint := fmt.Sprintf("%s/v3/%s/messages", c.baseURL, url.PathEscape(c.domain))
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body); err != nil {
+		return response, err
+	}
+	req.SetBasicAuth("api", c.apiKey)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	var resp *http.Response
+	if resp, err = c.httpClient.Do(req); err != nil {
+		return response, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var respBody []byte
+	if respBody, err = io.ReadAll(resp.Body); err != nil {
+		return response, err
+	}
+
+	// Check for an error response
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &mailgunError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(respBody, apiErr) != nil || len(apiErr.Message) == 0 {
+			apiErr.Message = strings.TrimSpace(string(respBody))
+		}
+		return response, apiErr
+	}
+
+	err = json.Unmarshal(respBody, &response)
+	return response, err
+}
+
+// mailgunProvider is the Mailgun provider
+type mailgunProvider struct {
+	client mailgunInterface
+}
+
+// Name returns the name of the provider
+func (p *mailgunProvider) Name() string {
+	return "mailgun"
+}
+
+// Capabilities returns the features supported by Mailgun
+func (p *mailgunProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Attachments: true,
+		Bcc:         true,
+		Cc:          true,
+		Importance:  true,
+		Tags:        true,
+		TrackClicks: true,
+		TrackOpens:  true,
+	}
+}
+
+// Send sends the email using Mailgun
+func (p *mailgunProvider) Send(ctx context.Context, email *Email) (SendResult, error) {
+	return sendViaMailgun(ctx, p.client, email)
+}
+
+// mailgunYesNo converts a bool to the yes/no values used by Mailgun options
+func mailgunYesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// sendViaMailgun sends an email using the Mailgun service
+func sendViaMailgun(ctx context.Context, client mailgunInterface, email *Email) (result SendResult, err error) {
+	// Create the Mailgun message
+	message := &mailgunMessage{fields: url.Values{}}
+
+	// Add the basics
+	from := email.FromAddress
+	if len(email.FromName) > 0 {
+		from = fmt.Sprintf("%s <%s>", email.FromName, email.FromAddress)
+	}
+	message.fields.Set("from", from)
+	message.fields.Set("subject", email.Subject)
+
+	// Add the recipients (to, cc, bcc)
+	message.fields["to"] = email.Recipients
+	if len(email.RecipientsCc) > 0 {
+		message.fields["cc"] = email.RecipientsCc
+	}
+	if len(email.RecipientsBcc) > 0 {
+		message.fields["bcc"] = email.RecipientsBcc
+	}
+
+	// Add a custom reply to address
+	if len(email.ReplyToAddress) > 0 {
+		message.fields.Set("h:Reply-To", email.ReplyToAddress)
+	}
+
+	// Add the content
+	if len(email.PlainTextContent) > 0 {
+		message.fields.Set("text", email.PlainTextContent)
+	}
+	if len(email.HTMLContent) > 0 {
+		message.fields.Set("html", email.HTMLContent)
+	}
+
+	// Convert tags
+	tags := email.Tags
+	if len(tags) > mailgunMaxTags {
+		log.Printf("warning: Mailgun only allows %d tags per message, extra tags are ignored", mailgunMaxTags)
+		tags = tags[:mailgunMaxTags]
+	}
+	if len(tags) > 0 {
+		message.fields["o:tag"] = tags
+	}
+
+	// Set the tracking
+	message.fields.Set("o:tracking-clicks", mailgunYesNo(email.TrackClicks))
+	message.fields.Set("o:tracking-opens", mailgunYesNo(email.TrackOpens))
+
+	// Warn about features that are set but not available
+	if email.AutoText {
+		log.Printf("warning: auto text is enabled, but Mailgun does not offer this feature")
+	}
+	if len(email.ReturnPath) > 0 || email.VERP || email.DSN != nil {
+		log.Printf("warning: a return path, VERP or DSN is set, but Mailgun uses the return path of the sending domain")
+	}
+
+	// Add importance
+	if email.Important {
+		message.fields.Set("h:X-Priority", "1 (Highest)")
+		message.fields.Set("h:X-MSMail-Priority", "High")
+		message.fields.Set("h:Importance", "High")
+	}
+
+	// Add any attachments
+	for _, attachment := range email.Attachments {
+
+		// Read all content from the attachment
+		var content []byte
+		if content, err = attachment.Bytes(); err != nil {
+			return result, err
+		}
+
+		message.attachments = append(message.attachments, mailgunAttachment{
+			content:  content,
+			fileName: attachment.FileName,
+			fileType: attachment.FileType,
+		})
+	}
+
+	// Send the email
+	var resp mailgunResponse
+	if resp, err = client.SendEmail(ctx, message); err != nil {
+		return result, classifyMailgunError(err)
+	}
+
+	// Build the result from the response (Mailgun queues every message)
+	result = newSendResult(Mailgun, email, RecipientQueued)
+	result.MessageID = strings.Trim(resp.ID, "<>")
+	result.RawResponse = resp
+
+	return result, nil
+}
+
+// classifyMailgunError marks rate limits and server errors as transient
+func classifyMailgunError(err error) error {
+	var apiErr *mailgunError
+	if errors.As(err, &apiErr) {
+		err = fmt.Errorf("%w: %w", ErrMailgunError, err)
+		if apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError {
+			return transientError(err)
+		}
+		return permanentError(err)
+	}
+	return classifyError(err)
+}
@@ -0,0 +1,238 @@
+package gomail
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockMailgunInterface is a mocking interface for Mailgun
+type mockMailgunInterface struct{}
+
+// SendEmail is for mocking
+func (m *mockMailgunInterface) SendEmail(_ context.Context, message *mailgunMessage) (mailgunResponse, error) {
+	to := message.fields.Get("to")
+
+	// Success
+	if to == "test@domain.com" {
+		return mailgunResponse{ID: "<20250101120000.1.ABCDEF@mg.example.com>", Message: "Queued. Thank you."}, nil
+	}
+
+	// Invalid from address
+	if to == "test@badhostname.com" {
+		return mailgunResponse{}, &mailgunError{Message: "from parameter is not a valid address", StatusCode: http.StatusBadRequest}
+	}
+
+	// Invalid api key
+	if to == "test@badtoken.com" {
+		return mailgunResponse{}, &mailgunError{Message: "Forbidden", StatusCode: http.StatusUnauthorized}
+	}
+
+	// Default is success
+	return mailgunResponse{Message: "Queued. Thank you."}, nil
+}
+
+// newMockMailgunClient will create a new mock client for Mailgun
+func newMockMailgunClient() mailgunInterface {
+	return &mockMailgunInterface{}
+}
+
+// TestSendViaMailgun will test the sendViaMailgun() method
+func TestSendViaMailgun(t *testing.T) {
+	t.Parallel()
+
+	// Start the service
+	mail := new(MailService)
+
+	// Set all the defaults, toggle all warnings
+	mail.AutoText = true
+	mail.FromDomain = "example.com"
+	mail.FromName = "No Reply"
+	mail.FromUsername = "no-reply"
+	mail.Important = true
+	mail.TrackClicks = true
+	mail.TrackOpens = true
+
+	// Setup mock client
+	client := newMockMailgunClient()
+
+	// New email
+	email := mail.NewEmail()
+	email.HTMLContent = "<html>Test</html>"
+	email.PlainTextContent = "Test"
+	email.Tags = []string{"tag1", "tag2", "tag3", "tag4"}
+
+	// Add an attachment
+	f, err := os.Open("examples/test-attachment-file.txt")
+	if err != nil {
+		require.NoError(t, err, "failed to attach file")
+	} else {
+		email.AddAttachment("test-attachment-file.txt", "text/plain", f)
+	}
+
+	// Create the list of tests
+	tests := []struct {
+		name          string
+		input         string
+		expectedError bool
+	}{
+		{"successful send", "test@domain.com", false},
+		{"invalid from address error", "test@badhostname.com", true},
+		{"invalid token error", "test@badtoken.com", true},
+	}
+
+	// Loop tests
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email.Recipients = []string{test.input}
+			email.RecipientsCc = []string{test.input}
+			email.RecipientsBcc = []string{test.input}
+			email.ReplyToAddress = test.input
+			result, err := sendViaMailgun(context.Background(), client, email)
+			if test.expectedError {
+				require.ErrorIs(t, err, ErrMailgunError)
+				assert.True(t, IsPermanent(err))
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, Mailgun, result.Provider)
+				assert.Equal(t, "20250101120000.1.ABCDEF@mg.example.com", result.MessageID)
+				assert.Len(t, result.Recipients, 3)
+				assert.Equal(t, RecipientQueued, result.Recipients[0].Status)
+			}
+		})
+	}
+}
+
+// TestMailgunClient_SendEmail will test the SendEmail() method against a local server
+func TestMailgunClient_SendEmail(t *testing.T) {
+	t.Parallel()
+
+	t.Run("successful send maps the email", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/v3/mg.example.com/messages", r.URL.Path)
+			user, pass, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "api", user)
+			assert.Equal(t, "test-api-key", pass)
+
+			// Check the mapping of the email
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			assert.Equal(t, "No Reply <no-reply@example.com>", r.FormValue("from"))
+			assert.Equal(t, []string{"to@domain.com"}, r.MultipartForm.Value["to"])
+			assert.Equal(t, []string{"cc@domain.com"}, r.MultipartForm.Value["cc"])
+			assert.Equal(t, []string{"bcc@domain.com"}, r.MultipartForm.Value["bcc"])
+			assert.Equal(t, "reply@example.com", r.FormValue("h:Reply-To"))
+			assert.Equal(t, "Test", r.FormValue("text"))
+			assert.Equal(t, "<html>Test</html>", r.FormValue("html"))
+			assert.Equal(t, []string{"tag1"}, r.MultipartForm.Value["o:tag"])
+			assert.Equal(t, "yes", r.FormValue("o:tracking-clicks"))
+			assert.Equal(t, "no", r.FormValue("o:tracking-opens"))
+			assert.Equal(t, "High", r.FormValue("h:Importance"))
+
+			// Check the attachment
+			files := r.MultipartForm.File["attachment"]
+			if assert.Len(t, files, 1) {
+				assert.Equal(t, "file.txt", files[0].Filename)
+				assert.Equal(t, "text/plain", files[0].Header.Get("Content-Type"))
+				file, err := files[0].Open()
+				assert.NoError(t, err)
+				contents, _ := io.ReadAll(file)
+				assert.Equal(t, "attachment contents", string(contents))
+			}
+
+			_, _ = w.Write([]byte(`{"id":"<test-message-id@mg.example.com>","message":"Queued. Thank you."}`))
+		}))
+		defer server.Close()
+
+		email := &Email{
+			FromAddress:      "no-reply@example.com",
+			FromName:         "No Reply",
+			HTMLContent:      "<html>Test</html>",
+			Important:        true,
+			PlainTextContent: "Test",
+			Recipients:       []string{"to@domain.com"},
+			RecipientsBcc:    []string{"bcc@domain.com"},
+			RecipientsCc:     []string{"cc@domain.com"},
+			ReplyToAddress:   "reply@example.com",
+			Subject:          "Test subject",
+			Tags:             []string{"tag1"},
+			TrackClicks:      true,
+		}
+		email.AddAttachment("file.txt", "text/plain", strings.NewReader("attachment contents"))
+
+		result, err := sendViaMailgun(context.Background(), newMailgunClient("test-api-key", "mg.example.com", server.URL), email)
+		require.NoError(t, err)
+		assert.Equal(t, "test-message-id@mg.example.com", result.MessageID)
+	})
+
+	t.Run("error response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"to parameter is missing"}`))
+		}))
+		defer server.Close()
+
+		_, err := newMailgunClient("test-api-key", "mg.example.com", server.URL).SendEmail(context.Background(), &mailgunMessage{})
+		require.Error(t, err)
+		assert.Equal(t, "mailgun returned status 400: to parameter is missing", err.Error())
+	})
+
+	t.Run("server error is transient", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("bad gateway"))
+		}))
+		defer server.Close()
+
+		email := &Email{FromAddress: "no-reply@example.com", Recipients: []string{"to@domain.com"}, Subject: "Test", PlainTextContent: "Test"}
+		_, err := sendViaMailgun(context.Background(), newMailgunClient("test-api-key", "mg.example.com", server.URL), email)
+		require.ErrorIs(t, err, ErrMailgunError)
+		assert.True(t, IsTransient(err))
+		assert.Contains(t, err.Error(), "bad gateway")
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		client := newMailgunClient("test-api-key", "mg.example.com", "")
+		assert.Equal(t, defaultHTTPTimeout, client.httpClient.Timeout)
+	})
+}
+
+// TestMailgunBaseURL will test the mailgunBaseURL() method
+func TestMailgunBaseURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		region        string
+		baseURL       string
+		expected      string
+		expectedError bool
+	}{
+		{"default region", "", "", mailgunBaseURLUS, false},
+		{"us region", MailgunRegionUS, "", mailgunBaseURLUS, false},
+		{"eu region", MailgunRegionEU, "", mailgunBaseURLEU, false},
+		{"eu region uppercase", "EU", "", mailgunBaseURLEU, false},
+		{"custom base url", MailgunRegionEU, "http://localhost:8080/", "http://localhost:8080", false},
+		{"invalid region", "mars", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			baseURL, err := mailgunBaseURL(test.region, test.baseURL)
+			if test.expectedError {
+				require.ErrorIs(t, err, ErrInvalidMailgunRegion)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, baseURL)
+		})
+	}
+}
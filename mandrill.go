@@ -1,28 +1,222 @@
 package gomail
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/mattbaird/gochimp"
 )
 
+// mandrillAPIURL is the base url of the Mandrill api (used by gochimp)
+const mandrillAPIURL = "https://mandrillapp.com/api/1.0"
+
 // mandrillInterface is an interface for Mandrill/mocking
 type mandrillInterface interface {
-	MessageSend(message gochimp.Message, async bool) ([]gochimp.SendResponse, error)
+	MessageSend(ctx context.Context, message gochimp.Message, options gochimp.MessageSendOptions) ([]gochimp.SendResponse, error)
+}
+
+// mandrillScheduler lists and cancels the messages scheduled in Mandrill (not supported by gochimp)
+type mandrillScheduler interface {
+	CancelScheduled(ctx context.Context, id string) error
+	ListScheduled(ctx context.Context) ([]mandrillScheduledMessage, error)
+}
+
+// mandrillScheduledMessage is a message scheduled in Mandrill
+type mandrillScheduledMessage struct {
+	CreatedAt string `json:"created_at"`
+	FromEmail string `json:"from_email"`
+	ID        string `json:"_id"`
+	SendAt    string `json:"send_at"`
+	Subject   string `json:"subject"`
+	To        string `json:"to"`
+}
+
+// mandrillClient wraps the gochimp Mandrill api to implement mandrillInterface with a context
+type mandrillClient struct {
+	api     *gochimp.MandrillAPI
+	baseURL string // base url of the api, ie: http://localhost:8080/api/1.0 (empty is mandrillAPIURL)
+}
+
+// newMandrillClient returns a Mandrill client for the api key, the base url overrides the Mandrill api
+func newMandrillClient(apiKey, baseURL string) *mandrillClient {
+	// Will Never return an error - set new MandrillApi
+	api, _ := gochimp.NewMandrill(apiKey)
+	api.Timeout = defaultHTTPTimeout
+	return &mandrillClient{api: api, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// endpoint returns the base url of the api
+func (c *mandrillClient) endpoint() string {
+	if len(c.baseURL) > 0 {
+		return c.baseURL
+	}
+	return mandrillAPIURL
+}
+
+// MessageSend sends the message using a copy of the api that carries the context on every request
+func (c *mandrillClient) MessageSend(ctx context.Context, message gochimp.Message, options gochimp.MessageSendOptions) ([]gochimp.SendResponse, error) {
+	api := *c.api
+	api.Transport = &contextTransport{baseURL: c.baseURL, ctx: ctx, transport: c.api.Transport}
+	return api.MessageSendWithOptions(message, options)
+}
+
+// CancelScheduled cancels the scheduled message
+func (c *mandrillClient) CancelScheduled(ctx context.Context, id string) error {
+	var canceled mandrillScheduledMessage
+	return c.call(ctx, "/messages/cancel-scheduled.json", map[string]interface{}{"id": id}, &canceled)
+}
+
+// ListScheduled returns the scheduled messages
+func (c *mandrillClient) ListScheduled(ctx context.Context) ([]mandrillScheduledMessage, error) {
+	var scheduled []mandrillScheduledMessage
+	if err := c.call(ctx, "/messages/list-scheduled.json", map[string]interface{}{}, &scheduled); err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+// call posts the parameters to the api method and decodes the response (errors are returned as gochimp.MandrillError)
+func (c *mandrillClient) call(ctx context.Context, path string, params map[string]interface{}, response interface{}) error {
+	params["key"] = c.api.Key
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint()+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Transport: c.api.Transport, Timeout: c.api.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if body, err = io.ReadAll(io.LimitReader(resp.Body, 10<<20)); err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr gochimp.MandrillError
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Status == "error" {
+			return apiErr
+		}
+		return fmt.Errorf("request failure: HTTP %s", resp.Status)
+	}
+	return json.Unmarshal(body, response)
+}
+
+// contextTransport is a http.RoundTripper that sets the context on requests made by clients without context support
+type contextTransport struct {
+	baseURL   string          // replaces mandrillAPIURL in the request url (gochimp does not expose its endpoint)
+	ctx       context.Context //nolint:containedctx // the context is only held for a single call
+	transport http.RoundTripper
+}
+
+// RoundTrip executes the request with the context, the request is also canceled when its own context is done
+// (http.Client sets the api timeout as a deadline on the request context)
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	u := req.URL
+	if rawURL := req.URL.String(); len(t.baseURL) > 0 && strings.HasPrefix(rawURL, mandrillAPIURL) {
+		var err error
+		if u, err = url.Parse(t.baseURL + strings.TrimPrefix(rawURL, mandrillAPIURL)); err != nil {
+			return nil, err
+		}
+	}
+	parent := req.Context()
+	ctx, cancel := context.WithCancelCause(t.ctx)
+	stop := context.AfterFunc(parent, func() {
+		cancel(context.Cause(parent))
+	})
+	release := func() {
+		stop()
+		cancel(context.Canceled)
+	}
+	req = req.WithContext(ctx)
+	if u != req.URL {
+		req.URL, req.Host = u, u.Host
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnClose is a response body that releases the request context once the body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close closes the body and releases the request context
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// mandrillProvider is the Mandrill provider
+type mandrillProvider struct {
+	client mandrillInterface
+	async  bool
+}
+
+// Name returns the name of the provider
+func (p *mandrillProvider) Name() string {
+	return "mandrill"
+}
+
+// Capabilities returns the features supported by Mandrill
+func (p *mandrillProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Attachments:     true,
+		AutoText:        true,
+		Bcc:             true,
+		Cc:              true,
+		Importance:      true,
+		ReturnPath:      true,
+		Scheduling:      true,
+		Tags:            true,
+		TrackClicks:     true,
+		TrackOpens:      true,
+		ViewContentLink: true,
+	}
+}
+
+// Send sends the email using Mandrill
+func (p *mandrillProvider) Send(ctx context.Context, email *Email) (SendResult, error) {
+	return sendViaMandrill(ctx, p.client, email, p.async)
 }
 
 // sendViaMandrill sends an email using the Mandrill service
 // Mandrill uses the word Message for their email
-func sendViaMandrill(client mandrillInterface, email *Email, async bool) (err error) {
+func sendViaMandrill(ctx context.Context, client mandrillInterface, email *Email, async bool) (result SendResult, err error) {
 	// Get the signing domain from the FromAddress
 	emailParts := strings.Split(email.FromAddress, "@")
 	if len(emailParts) <= 1 || emailParts[1] == "" {
 		err = fmt.Errorf("invalid FromAddress, domain not found using: %s: %w", email.FromAddress, ErrInvalidFromAddress)
-		return err
+		return result, err
 	}
 
 	// Create the Mandrill email
@@ -42,6 +236,14 @@ func sendViaMandrill(client mandrillInterface, email *Email, async bool) (err er
 		ViewContentLink:    email.ViewContentLink,
 	}
 
+	// Mandrill only supports a custom return path domain (must be set up for the account)
+	if domain := email.returnPathDomain(); len(domain) > 0 {
+		message.ReturnPathDomain = domain
+	}
+	if email.VERP || email.DSN != nil {
+		log.Printf("warning: VERP or DSN is set, but Mandrill does not offer this feature")
+	}
+
 	// Convert recipients
 	for _, recipient := range email.Recipients {
 		emailRecipient := gochimp.Recipient{
@@ -79,10 +281,9 @@ func sendViaMandrill(client mandrillInterface, email *Email, async bool) (err er
 		}
 
 		// Read all content from the attachment
-		reader := bufio.NewReader(attachment.FileReader)
 		var content []byte
-		if content, err = io.ReadAll(reader); err != nil {
-			return err
+		if content, err = attachment.Bytes(); err != nil {
+			return result, err
 		}
 
 		// Encode as base64
@@ -92,19 +293,77 @@ func sendViaMandrill(client mandrillInterface, email *Email, async bool) (err er
 		message.Attachments = append(message.Attachments, *mandrillAttachment)
 	}
 
+	// Schedule the email in Mandrill
+	options := gochimp.MessageSendOptions{Async: async}
+	if email.scheduled() {
+		sendAt := email.SendAt.UTC()
+		options.SendAt = &sendAt
+	}
+
 	// Send the email
 	var sendResponse []gochimp.SendResponse
-	if sendResponse, err = client.MessageSend(message, async); err != nil {
-		return err
+	if sendResponse, err = client.MessageSend(ctx, message, options); err != nil {
+		return result, classifyMandrillError(err)
+	}
+
+	// Build the result from the response
+	result = SendResult{
+		Provider:    Mandrill,
+		RawResponse: sendResponse,
+		SubmittedAt: time.Now().UTC(),
 	}
 
 	// Check the response of each email that was sent
-	if len(sendResponse) > 0 {
-		for _, response := range sendResponse {
-			if response.Status != "sent" && response.Status != "queued" && response.Status != "scheduled" {
-				err = fmt.Errorf("message status was %s and not sent - given reason: %s: %w", response.Status, response.RejectedReason, ErrMessageNotSent)
-			}
+	for _, response := range sendResponse {
+		recipient := RecipientResult{
+			Email:        response.Email,
+			MessageID:    response.Id,
+			RejectReason: response.RejectedReason,
+			Status:       mandrillRecipientStatus(response.Status),
+		}
+		if len(result.MessageID) == 0 {
+			result.MessageID = response.Id
+		}
+		if recipient.Status == RecipientRejected {
+			err = rejectedError(fmt.Errorf("message status was %s and not sent - given reason: %s: %w", response.Status, response.RejectedReason, ErrMessageNotSent))
 		}
+		result.Recipients = append(result.Recipients, recipient)
+	}
+	return result, err
+}
+
+// classifyMandrillError marks Mandrill general errors and server failures as transient
+func classifyMandrillError(err error) error {
+	var apiErr gochimp.MandrillError
+	if errors.As(err, &apiErr) {
+		if apiErr.Name == "GeneralError" {
+			return transientError(err)
+		}
+		return permanentError(err)
+	}
+
+	// Non-JSON error response (ie: "request failure: HTTP 503 Service Unavailable")
+	var status int
+	if _, scanErr := fmt.Sscanf(err.Error(), "request failure: HTTP %d", &status); scanErr == nil {
+		if status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+			return transientError(err)
+		}
+		return permanentError(err)
+	}
+
+	return classifyError(err)
+}
+
+// mandrillRecipientStatus converts a Mandrill send status into a recipient status
+func mandrillRecipientStatus(status string) RecipientStatus {
+	switch status {
+	case "sent":
+		return RecipientAccepted
+	case "queued":
+		return RecipientQueued
+	case "scheduled":
+		return RecipientScheduled
+	default:
+		return RecipientRejected
 	}
-	return err
 }
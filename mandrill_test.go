@@ -1,8 +1,16 @@
 package gomail
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mattbaird/gochimp"
 	"github.com/stretchr/testify/assert"
@@ -18,13 +26,27 @@ const (
 // mockMandrillInterface is a mocking interface for Mandrill
 type mockMandrillInterface struct{}
 
-// MessageSend is for mocking
-func (m *mockMandrillInterface) MessageSend(message gochimp.Message, _ bool) ([]gochimp.SendResponse, error) {
-	// todo: is async (bool) needed?
+// mockMandrillCapture records the message sent to the mock
+type mockMandrillCapture struct {
+	mockMandrillInterface
+	message gochimp.Message
+	options gochimp.MessageSendOptions
+}
 
+// MessageSend records the message
+func (m *mockMandrillCapture) MessageSend(ctx context.Context, message gochimp.Message, options gochimp.MessageSendOptions) ([]gochimp.SendResponse, error) {
+	m.message = message
+	m.options = options
+	return m.mockMandrillInterface.MessageSend(ctx, message, options)
+}
+
+// MessageSend is for mocking
+func (m *mockMandrillInterface) MessageSend(_ context.Context, message gochimp.Message, _ gochimp.MessageSendOptions) ([]gochimp.SendResponse, error) {
 	// Success
 	if message.To[0].Email == "test@domain.com" {
-		return []gochimp.SendResponse{}, nil
+		return []gochimp.SendResponse{
+			{Email: message.To[0].Email, Status: "sent", Id: "abc123abc123abc123abc123abc123"},
+		}, nil
 	}
 
 	// Invalid from domain
@@ -42,6 +64,13 @@ func (m *mockMandrillInterface) MessageSend(message gochimp.Message, _ bool) ([]
 		return []gochimp.SendResponse{{Status: "unknown"}}, nil
 	}
 
+	// Rejected recipient
+	if message.To[0].Email == "test@rejected.com" {
+		return []gochimp.SendResponse{
+			{Email: message.To[0].Email, Status: "rejected", Id: "def456", RejectedReason: "hard-bounce"},
+		}, nil
+	}
+
 	// Default is success
 	return []gochimp.SendResponse{}, nil
 }
@@ -93,6 +122,7 @@ func TestSendViaMandrill(t *testing.T) {
 		{"invalid domain error", "test@badhostname.com", true},
 		{"invalid token error", "test@badtoken.com", true},
 		{"bad status error", "test@badstatus.com", true},
+		{"rejected recipient error", "test@rejected.com", true},
 	}
 
 	// Loop tests
@@ -102,7 +132,7 @@ func TestSendViaMandrill(t *testing.T) {
 			email.RecipientsCc = []string{test.input}
 			email.RecipientsBcc = []string{test.input}
 			email.ReplyToAddress = test.input
-			err := sendViaMandrill(client, email, false)
+			_, err := sendViaMandrill(context.Background(), client, email, false)
 			if test.expectedError {
 				assert.Error(t, err)
 			} else {
@@ -111,10 +141,211 @@ func TestSendViaMandrill(t *testing.T) {
 		})
 	}
 
+	// Test the result of a successful send
+	t.Run("successful send result", func(t *testing.T) {
+		email.Recipients = []string{"test@domain.com"}
+		result, err := sendViaMandrill(context.Background(), client, email, false)
+		require.NoError(t, err)
+		assert.Equal(t, Mandrill, result.Provider)
+		assert.Equal(t, "abc123abc123abc123abc123abc123", result.MessageID)
+		require.Len(t, result.Recipients, 1)
+		assert.Equal(t, RecipientAccepted, result.Recipients[0].Status)
+	})
+
+	// Test the result of a rejected recipient
+	t.Run("rejected recipient result", func(t *testing.T) {
+		email.Recipients = []string{"test@rejected.com"}
+		result, err := sendViaMandrill(context.Background(), client, email, false)
+		require.ErrorIs(t, err, ErrMessageNotSent)
+		require.Len(t, result.Recipients, 1)
+		assert.Equal(t, RecipientRejected, result.Recipients[0].Status)
+		assert.Equal(t, "hard-bounce", result.Recipients[0].RejectReason)
+	})
+
+	// Test the return path domain is mapped
+	t.Run("return path domain", func(t *testing.T) {
+		capture := &mockMandrillCapture{}
+		email.Recipients = []string{"test@domain.com"}
+		email.ReturnPath = "bounces@mail.example.com"
+		_, err := sendViaMandrill(context.Background(), capture, email, false)
+		require.NoError(t, err)
+		assert.Equal(t, "mail.example.com", capture.message.ReturnPathDomain)
+		email.ReturnPath = ""
+	})
+
 	// Test bad from address
 	t.Run("invalid from address error", func(t *testing.T) {
 		email.FromAddress = "invalid@"
-		err := sendViaMandrill(client, email, false)
+		_, err := sendViaMandrill(context.Background(), client, email, false)
 		assert.Error(t, err)
 	})
 }
+
+// TestMandrillRecipientStatus will test the mandrillRecipientStatus() method
+func TestMandrillRecipientStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status   string
+		expected RecipientStatus
+	}{
+		{"sent", RecipientAccepted},
+		{"queued", RecipientQueued},
+		{"scheduled", RecipientScheduled},
+		{"rejected", RecipientRejected},
+		{"invalid", RecipientRejected},
+		{"", RecipientRejected},
+	}
+
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			assert.Equal(t, test.expected, mandrillRecipientStatus(test.status))
+		})
+	}
+}
+
+// TestClassifyMandrillError will test the classifyMandrillError() method
+func TestClassifyMandrillError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"general error", gochimp.MandrillError{Status: "error", Code: -1, Name: "GeneralError", Message: "unexpected"}, true},
+		{"invalid key", gochimp.MandrillError{Status: "error", Code: -1, Name: "Invalid_Key", Message: "Invalid API key"}, false},
+		{"server failure", fmt.Errorf("request failure: HTTP 502 Bad Gateway: %w", ErrMessageNotSent), true},
+		{"client failure", fmt.Errorf("request failure: HTTP 404 Not Found: %w", ErrMessageNotSent), false},
+		{"unknown error", ErrValidationError, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := classifyMandrillError(test.err)
+			require.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.transient, IsTransient(err))
+		})
+	}
+}
+
+// roundTripFunc is a http.RoundTripper for testing
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls the func
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// testContextKey is a context key for testing
+type testContextKey struct{}
+
+// TestMandrillClient_MessageSend will test the context is used by MessageSend()
+func TestMandrillClient_MessageSend(t *testing.T) {
+	t.Parallel()
+
+	newClient := func(t *testing.T) *mandrillClient {
+		api, err := gochimp.NewMandrill("1234567")
+		require.NoError(t, err)
+		api.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if err = req.Context().Err(); err != nil {
+				return nil, err
+			}
+			assert.Equal(t, "request-id", req.Context().Value(testContextKey{}))
+			return &http.Response{
+				Body:       io.NopCloser(strings.NewReader(`[{"email":"test@domain.com","status":"sent","_id":"abc123"}]`)),
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Request:    req,
+				StatusCode: http.StatusOK,
+			}, nil
+		})
+		return &mandrillClient{api: api}
+	}
+
+	email := &Email{
+		FromAddress:      "no-reply@example.com",
+		PlainTextContent: "Test",
+		Recipients:       []string{"test@domain.com"},
+		Subject:          "Test",
+	}
+
+	t.Run("context is passed to the request", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), testContextKey{}, "request-id")
+		result, err := sendViaMandrill(ctx, newClient(t), email, false)
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", result.MessageID)
+	})
+
+	t.Run("canceled context aborts the request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testContextKey{}, "request-id"))
+		cancel()
+		_, err := sendViaMandrill(ctx, newClient(t), email, false)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("api timeout aborts the request", func(t *testing.T) {
+		api, err := gochimp.NewMandrill("1234567")
+		require.NoError(t, err)
+		api.Timeout = 50 * time.Millisecond
+		api.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "request-id", req.Context().Value(testContextKey{}))
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		})
+
+		ctx := context.WithValue(context.Background(), testContextKey{}, "request-id")
+		_, err = sendViaMandrill(ctx, &mandrillClient{api: api}, email, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Client.Timeout exceeded")
+	})
+}
+
+// TestMandrillClient_BaseURL will test every request is sent to the base url
+func TestMandrillClient_BaseURL(t *testing.T) {
+	t.Parallel()
+
+	var paths []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		paths = append(paths, req.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/api/1.0/messages/send.json":
+			_, _ = w.Write([]byte(`[{"email":"test@domain.com","status":"sent","_id":"abc123"}]`))
+		case "/api/1.0/messages/list-scheduled.json":
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			_, _ = w.Write([]byte(`{"_id":"abc123"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := newMandrillClient("1234567", server.URL+"/api/1.0/")
+	assert.Equal(t, server.URL+"/api/1.0", client.endpoint())
+	assert.Equal(t, mandrillAPIURL, newMandrillClient("1234567", "").endpoint())
+	assert.Equal(t, defaultHTTPTimeout, client.api.Timeout)
+
+	result, err := sendViaMandrill(context.Background(), client, &Email{
+		FromAddress:      "no-reply@example.com",
+		PlainTextContent: "Test",
+		Recipients:       []string{"test@domain.com"},
+		Subject:          "Test",
+	}, false)
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", result.MessageID)
+
+	scheduled, err := client.ListScheduled(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, scheduled)
+	require.NoError(t, client.CancelScheduled(context.Background(), "abc123"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"/api/1.0/messages/send.json",
+		"/api/1.0/messages/list-scheduled.json",
+		"/api/1.0/messages/cancel-scheduled.json",
+	}, paths)
+}
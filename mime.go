@@ -0,0 +1,252 @@
+package gomail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mimeHeaderLength is the line length headers are folded at
+const mimeHeaderLength = 78
+
+// mimeHeaderSanitizer removes line breaks from header values (prevents header injection)
+var mimeHeaderSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+// mimeOptions are the provider specific headers of a rendered message
+type mimeOptions struct {
+	bccHeader  bool // write the bcc recipients into the message (AWS SES v1 reads the recipients from the headers)
+	returnPath bool // write the return path into the message (AWS SES uses it for bounces and complaints)
+}
+
+// WriteMIME writes the email as a raw MIME message (RFC 5322), as rendered by the SMTP provider
+// before the message is secured
+//
+// The message is not signed or encrypted: DKIM, S/MIME and OpenPGP are applied by the MailService
+// when the email is sent. Bcc recipients and the return path are not written into the message
+// (the AWS SES providers add them as headers).
+//
+// WriteMIME changes the email: an empty Date or MessageID is set, so sending the email afterwards
+// uses the same date and message id.
+//
+// Attachment readers are read, readers that implement io.Seeker are rewound so the email can be sent.
+func (e *Email) WriteMIME(w io.Writer) error {
+	if e.Date.IsZero() {
+		e.Date = time.Now()
+	}
+	if len(e.MessageID) == 0 {
+		messageID, err := newMessageID(e.FromAddress)
+		if err != nil {
+			return err
+		}
+		e.MessageID = messageID
+	}
+
+	message, err := e.buildMIME(mimeOptions{})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message)
+	return err
+}
+
+// ToMIME returns the email as a raw MIME message (see WriteMIME)
+func (e *Email) ToMIME() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.WriteMIME(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// buildMIME renders the raw MIME message shared by the SMTP and AWS SES providers
+//
+// An empty Date or MessageID is generated for this message only (the email is not changed).
+// The boundaries are derived from the message id and date, so the same email renders the same message.
+func (e *Email) buildMIME(options mimeOptions) ([]byte, error) {
+	date := e.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := e.MessageID
+	if len(messageID) == 0 {
+		var err error
+		if messageID, err = newMessageID(e.FromAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	// Encode the body parts first, the boundaries must not appear in them
+	var parts [][]byte
+	for _, content := range []string{e.PlainTextContent, e.HTMLContent} {
+		encoded, err := mimeQuotedPrintable(content)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, encoded)
+	}
+	mixed, alternative := mimeBoundaries(messageID, date, parts...)
+
+	// Write the headers
+	var buf bytes.Buffer
+	from := mimeHeaderSanitizer.Replace(e.FromAddress)
+	if len(e.FromName) > 0 {
+		from = (&mail.Address{Name: mimeHeaderSanitizer.Replace(e.FromName), Address: from}).String()
+	}
+	writeMIMEHeader(&buf, "From", from)
+	if len(e.Recipients) > 0 {
+		writeMIMEHeader(&buf, "To", mimeAddressList(e.Recipients))
+	}
+	if len(e.RecipientsCc) > 0 {
+		writeMIMEHeader(&buf, "Cc", mimeAddressList(e.RecipientsCc))
+	}
+	if options.bccHeader && len(e.RecipientsBcc) > 0 {
+		writeMIMEHeader(&buf, "Bcc", mimeAddressList(e.RecipientsBcc))
+	}
+	if len(e.ReplyToAddress) > 0 {
+		writeMIMEHeader(&buf, "Reply-To", mimeHeaderSanitizer.Replace(e.ReplyToAddress))
+	}
+	writeMIMEHeader(&buf, "Subject", mime.QEncoding.Encode("UTF-8", mimeHeaderSanitizer.Replace(e.Subject)))
+	writeMIMEHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeMIMEHeader(&buf, "Message-ID", "<"+strings.Trim(mimeHeaderSanitizer.Replace(messageID), "<>")+">")
+	if options.returnPath && len(e.ReturnPath) > 0 {
+		writeMIMEHeader(&buf, "Return-Path", mimeHeaderSanitizer.Replace(e.ReturnPath))
+	}
+	if e.Important {
+		writeMIMEHeader(&buf, "X-Priority", "1 (Highest)")
+		writeMIMEHeader(&buf, "X-MSMail-Priority", "High")
+		writeMIMEHeader(&buf, "Importance", "High")
+	}
+	writeMIMEHeader(&buf, "MIME-Version", "1.0")
+	buf.WriteString("Content-Type: multipart/mixed;\r\n\tboundary=\"" + mixed + "\"\r\n\r\n")
+
+	// Write the plain text and html parts
+	buf.WriteString("--" + mixed + "\r\n")
+	buf.WriteString("Content-Type: multipart/alternative;\r\n\tboundary=\"" + alternative + "\"\r\n\r\n")
+	for i, mediaType := range []string{"text/plain", "text/html"} {
+		if len(parts[i]) == 0 {
+			continue
+		}
+		buf.WriteString("--" + alternative + "\r\n")
+		writeMIMEHeader(&buf, "Content-Transfer-Encoding", "quoted-printable")
+		writeMIMEHeader(&buf, "Content-Type", mediaType+"; charset=UTF-8")
+		buf.WriteString("\r\n")
+		buf.Write(parts[i])
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("--" + alternative + "--\r\n")
+
+	// Write the attachments
+	for _, attachment := range e.Attachments {
+		content, err := attachment.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		name := mimeHeaderSanitizer.Replace(attachment.FileName)
+		buf.WriteString("--" + mixed + "\r\n")
+		writeMIMEHeader(&buf, "Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		writeMIMEHeader(&buf, "Content-Transfer-Encoding", "base64")
+		writeMIMEHeader(&buf, "Content-Type", attachmentMediaType(attachment.FileType, name, content))
+		buf.WriteString("\r\n")
+		buf.Write(mimeBase64(content))
+	}
+	buf.WriteString("--" + mixed + "--\r\n")
+
+	return buf.Bytes(), nil
+}
+
+// newMessageID returns a random message id in the domain of the from address
+func newMessageID(fromAddress string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("message id: %w", err)
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(fromAddress, "@"); at >= 0 && at < len(fromAddress)-1 {
+		domain = strings.Trim(fromAddress[at+1:], "<> ")
+	}
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">", nil
+}
+
+// mimeBoundaries derives the multipart boundaries from the message id and date,
+// skipping any boundary that appears in the encoded parts (prevents content injection)
+func mimeBoundaries(messageID string, date time.Time, parts ...[]byte) (mixed, alternative string) {
+	counter := 0
+	next := func() string {
+		for {
+			sum := sha256.Sum256([]byte(messageID + "\x00" + date.UTC().Format(time.RFC3339Nano) + "\x00" + strconv.Itoa(counter)))
+			counter++
+			boundary := hex.EncodeToString(sum[:30])
+			found := false
+			for _, part := range parts {
+				found = found || bytes.Contains(part, []byte(boundary))
+			}
+			if !found {
+				return boundary
+			}
+		}
+	}
+	return next(), next()
+}
+
+// mimeQuotedPrintable encodes the content as quoted-printable with CRLF line breaks
+func mimeQuotedPrintable(content string) ([]byte, error) {
+	if len(content) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	writer := quotedprintable.NewWriter(&buf)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mimeAddressList joins the addresses for an address header
+func mimeAddressList(addresses []string) string {
+	list := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if address = strings.TrimSpace(mimeHeaderSanitizer.Replace(address)); len(address) > 0 {
+			list = append(list, address)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// writeMIMEHeader writes the header, folded at spaces so lines stay under 78 characters where possible
+func writeMIMEHeader(buf *bytes.Buffer, name, value string) {
+	line := name + ":"
+	for _, word := range strings.Split(value, " ") {
+		if len(line)+1+len(word) > mimeHeaderLength && len(line) > len(name)+1 {
+			buf.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += " " + word
+	}
+	buf.WriteString(line + "\r\n")
+}
+
+// attachmentMediaType returns the content type of the attachment (detected from the content if not set)
+func attachmentMediaType(fileType, name string, content []byte) string {
+	mediaType, params, err := mime.ParseMediaType(fileType)
+	if err != nil {
+		mediaType, params, _ = mime.ParseMediaType(http.DetectContentType(content))
+	}
+	params["name"] = name
+	if formatted := mime.FormatMediaType(mediaType, params); len(formatted) > 0 {
+		return formatted
+	}
+	return mime.FormatMediaType("application/octet-stream", map[string]string{"name": name})
+}
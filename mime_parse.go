@@ -0,0 +1,214 @@
+package gomail
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// mimeMaxDepth is the deepest nesting of multipart entities accepted by ParseMIME
+const mimeMaxDepth = 16
+
+// mimeWordDecoder decodes RFC 2047 encoded words in headers
+var mimeWordDecoder = &mime.WordDecoder{CharsetReader: mimeCharsetReader}
+
+// ParseMIME parses a raw MIME message (RFC 5322, such as an .eml file) into an email
+//
+// Encoded words (RFC 2047) in the headers are decoded. The first text/plain and text/html
+// bodies become the content, every other part (inline or not) becomes an attachment.
+// Date and Message-ID are kept, so the email renders with the same values.
+func ParseMIME(r io.Reader) (*Email, error) {
+	message, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMIME, err)
+	}
+
+	email := new(Email)
+	if err = email.parseMIMEHeaders(message.Header); err != nil {
+		return nil, err
+	}
+	if err = email.parseMIMEEntity(textproto.MIMEHeader(message.Header), message.Body, 0); err != nil {
+		return nil, err
+	}
+	return email, nil
+}
+
+// parseMIMEHeaders sets the addresses, subject, date, message id and importance from the message headers
+func (e *Email) parseMIMEHeaders(header mail.Header) error {
+	parser := mail.AddressParser{WordDecoder: mimeWordDecoder}
+	addresses := func(name string) ([]*mail.Address, error) {
+		if len(strings.TrimSpace(header.Get(name))) == 0 {
+			return nil, nil
+		}
+		list, err := parser.ParseList(header.Get(name))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s header: %w", ErrInvalidMIME, name, err)
+		}
+		return list, nil
+	}
+
+	// From and Reply-To are single addresses, the first one is used
+	from, err := addresses("From")
+	if err != nil {
+		return err
+	}
+	if len(from) > 0 {
+		e.FromAddress, e.FromName = from[0].Address, from[0].Name
+	}
+	var replyTo []*mail.Address
+	if replyTo, err = addresses("Reply-To"); err != nil {
+		return err
+	}
+	if len(replyTo) > 0 {
+		e.ReplyToAddress = replyTo[0].Address
+	}
+
+	// Recipients
+	for _, field := range []struct {
+		name       string
+		recipients *[]string
+	}{
+		{"To", &e.Recipients},
+		{"Cc", &e.RecipientsCc},
+		{"Bcc", &e.RecipientsBcc},
+	} {
+		var list []*mail.Address
+		if list, err = addresses(field.name); err != nil {
+			return err
+		}
+		for _, address := range list {
+			*field.recipients = append(*field.recipients, address.Address)
+		}
+	}
+
+	// Subject, date and message id
+	if e.Subject, err = mimeWordDecoder.DecodeHeader(header.Get("Subject")); err != nil {
+		return fmt.Errorf("subject header: %w", err)
+	}
+	if len(header.Get("Date")) > 0 {
+		if e.Date, err = header.Date(); err != nil {
+			return fmt.Errorf("%w: date header: %w", ErrInvalidMIME, err)
+		}
+	}
+	e.MessageID = strings.TrimSpace(header.Get("Message-ID"))
+	e.ReturnPath = strings.Trim(strings.TrimSpace(header.Get("Return-Path")), "<>")
+	e.Important = strings.HasPrefix(strings.TrimSpace(header.Get("X-Priority")), "1") ||
+		strings.EqualFold(strings.TrimSpace(header.Get("Importance")), "high")
+	return nil
+}
+
+// parseMIMEEntity adds the entity to the email content or attachments, walking into multipart entities
+func (e *Email) parseMIMEEntity(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	// A missing content type is plain text (RFC 2045)
+	mediaType, params := "text/plain", map[string]string{}
+	if contentType := header.Get("Content-Type"); len(contentType) > 0 {
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(contentType); err != nil && len(mediaType) == 0 {
+			mediaType, params = "application/octet-stream", map[string]string{}
+		}
+	}
+
+	// Walk the parts of multipart entities (mixed, alternative, related, signed...)
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= mimeMaxDepth {
+			return fmt.Errorf("%w: multipart entities nested deeper than %d", ErrInvalidMIME, mimeMaxDepth)
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidMIME, err)
+			}
+			if err = e.parseMIMEEntity(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := mimeDecodeBody(header.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return err
+	}
+
+	// The first plain text and html bodies are the content
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := dispositionParams["filename"]
+	if len(name) == 0 {
+		name = params["name"]
+	}
+	if decoded, decodeErr := mimeWordDecoder.DecodeHeader(name); decodeErr == nil {
+		name = decoded
+	}
+	isText := (mediaType == "text/plain" && len(e.PlainTextContent) == 0) || (mediaType == "text/html" && len(e.HTMLContent) == 0)
+	if isText && disposition != "attachment" && len(name) == 0 {
+		text := strings.ReplaceAll(mimeDecodeCharset(params["charset"], content), "\r\n", "\n")
+		if mediaType == "text/plain" {
+			e.PlainTextContent = text
+		} else {
+			e.HTMLContent = text
+		}
+		return nil
+	}
+
+	// Everything else is an attachment (the name is set on the content type when rendered)
+	delete(params, "name")
+	e.Attachments = append(e.Attachments, Attachment{
+		Content:  content,
+		FileName: name,
+		FileType: mime.FormatMediaType(mediaType, params),
+	})
+	return nil
+}
+
+// mimeDecodeBody decodes the content transfer encoding of the body
+func mimeDecodeBody(encoding string, body io.Reader) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s body: %w", ErrInvalidMIME, encoding, err)
+	}
+	return content, nil
+}
+
+// mimeDecodeCharset converts the text to UTF-8 (any charset known to the WHATWG encoding standard,
+// ie: windows-1252, iso-8859-15, shift_jis), text in an unknown charset is kept as is
+func mimeDecodeCharset(charset string, content []byte) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if len(charset) == 0 || charset == "utf-8" || charset == "utf8" || charset == "us-ascii" || charset == "ascii" {
+		return string(content)
+	}
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(content)
+	}
+	decoded, err := encoding.NewDecoder().Bytes(content)
+	if err != nil {
+		return string(content)
+	}
+	return string(decoded)
+}
+
+// mimeCharsetReader converts the encoded words of other charsets for the word decoder
+func mimeCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(mimeDecodeCharset(charset, content)), nil
+}
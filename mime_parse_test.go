@@ -0,0 +1,201 @@
+package gomail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testParseMIMEMessage is a message from another mail client (encoded words, related images, latin-1 text)
+const testParseMIMEMessage = "Return-Path: <bounces@example.com>\r\n" +
+	"From: =?UTF-8?Q?J=C3=B6hn_Doe?= <john@example.com>\r\n" +
+	"To: \"Jane Doe\" <jane@domain.com>, test@domain.com\r\n" +
+	"Cc: =?ISO-8859-1?Q?Andr=E9?= <andre@domain.com>\r\n" +
+	"Reply-To: Support <support@example.com>\r\n" +
+	"Subject: =?UTF-8?B?R3LDvMOfZQ==?= from\r\n =?UTF-8?Q?the_team?=\r\n" +
+	"Date: Fri, 16 Oct 2026 18:04:05 +0200\r\n" +
+	"Message-ID: <abc123@example.com>\r\n" +
+	"X-Priority: 1\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"mixed\"\r\n" +
+	"\r\n" +
+	"This is a multi-part message in MIME format.\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"alt\"\r\n" +
+	"\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Caf=E9 menu\r\n" +
+	"Second line\r\n" +
+	"--alt\r\n" +
+	"Content-Type: multipart/related; boundary=\"related\"\r\n" +
+	"\r\n" +
+	"--related\r\n" +
+	"Content-Type: text/html; charset=UTF-8\r\n" +
+	"\r\n" +
+	"<p>Caf\xc3\xa9 <img src=\"cid:logo\"></p>\r\n" +
+	"--related\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-Disposition: inline; filename=\"logo.png\"\r\n" +
+	"Content-ID: <logo>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw0K\r\n" +
+	"Ggo=\r\n" +
+	"--related--\r\n" +
+	"--alt--\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: text/plain; charset=UTF-8; name=\"notes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename*=UTF-8''r%C3%A9sum%C3%A9.txt\r\n" +
+	"\r\n" +
+	"attachment contents\r\n" +
+	"--mixed--\r\n"
+
+// testNestedMIMEMessage will create a message with the multipart entities nested depth times
+func testNestedMIMEMessage(depth int) string {
+	var message strings.Builder
+	for i := 0; i < depth; i++ {
+		fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=b%d\r\n\r\n--b%d\r\n", i, i)
+	}
+	message.WriteString("\r\nbody\r\n")
+	for i := depth - 1; i >= 0; i-- {
+		fmt.Fprintf(&message, "--b%d--\r\n", i)
+	}
+	return message.String()
+}
+
+// TestParseMIME will test the ParseMIME() method
+func TestParseMIME(t *testing.T) {
+	t.Parallel()
+
+	t.Run("message from another client", func(t *testing.T) {
+		email, err := ParseMIME(strings.NewReader(testParseMIMEMessage))
+		require.NoError(t, err)
+
+		assert.Equal(t, "john@example.com", email.FromAddress)
+		assert.Equal(t, "Jöhn Doe", email.FromName)
+		assert.Equal(t, []string{"jane@domain.com", "test@domain.com"}, email.Recipients)
+		assert.Equal(t, []string{"andre@domain.com"}, email.RecipientsCc)
+		assert.Empty(t, email.RecipientsBcc)
+		assert.Equal(t, "support@example.com", email.ReplyToAddress)
+		assert.Equal(t, "bounces@example.com", email.ReturnPath)
+		assert.Equal(t, "Grüße from the team", email.Subject)
+		assert.True(t, email.Date.Equal(time.Date(2026, 10, 16, 16, 4, 5, 0, time.UTC)))
+		assert.Equal(t, "<abc123@example.com>", email.MessageID)
+		assert.True(t, email.Important)
+		assert.Equal(t, "Café menu\nSecond line", email.PlainTextContent)
+		assert.Equal(t, "<p>Café <img src=\"cid:logo\"></p>", email.HTMLContent)
+
+		require.Len(t, email.Attachments, 2)
+		assert.Equal(t, "logo.png", email.Attachments[0].FileName)
+		assert.Equal(t, "image/png", email.Attachments[0].FileType)
+		assert.Nil(t, email.Attachments[0].FileReader)
+		assert.Equal(t, []byte("\x89PNG\r\n\x1a\n"), email.Attachments[0].Content)
+		assert.Equal(t, "résumé.txt", email.Attachments[1].FileName)
+		assert.Equal(t, "text/plain; charset=UTF-8", email.Attachments[1].FileType)
+		assert.Equal(t, "attachment contents", string(email.Attachments[1].Content))
+
+		// The parsed email can be serialized (ie: queued in the outbox)
+		encoded, err := json.Marshal(email)
+		require.NoError(t, err)
+		decoded := new(Email)
+		require.NoError(t, json.Unmarshal(encoded, decoded))
+		assert.Equal(t, email.Attachments, decoded.Attachments)
+	})
+
+	t.Run("other charsets", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			message  string
+			subject  string
+			expected string
+		}{
+			{"windows-1252", "Subject: =?windows-1252?Q?=80_price?=\r\nContent-Type: text/plain; charset=windows-1252\r\n\r\n\x93quoted\x94", "€ price", "\u201cquoted\u201d"},
+			{"iso-8859-15", "Subject: =?ISO-8859-15?Q?=A4uro?=\r\nContent-Type: text/plain; charset=iso-8859-15\r\n\r\n\xa4", "€uro", "€"},
+			{"shift_jis", "Subject: =?shift_jis?B?k/qWe4zq?=\r\nContent-Type: text/plain; charset=shift_jis\r\n\r\n\x93\xfa\x96\x7b", "日本語", "日本"},
+			{"koi8-r", "Subject: =?koi8-r?Q?=F0=D2=C9=D7=C5=D4?=\r\nContent-Type: text/plain; charset=koi8-r\r\n\r\n\xf0\xd2\xc9\xd7\xc5\xd4", "Привет", "Привет"},
+			{"unknown charset is kept as is", "Subject: =?x-unknown?Q?abc?=\r\nContent-Type: text/plain; charset=x-unknown\r\n\r\nbody", "abc", "body"},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				email, err := ParseMIME(strings.NewReader(test.message))
+				require.NoError(t, err)
+				assert.Equal(t, test.subject, email.Subject)
+				assert.Equal(t, test.expected, email.PlainTextContent)
+			})
+		}
+	})
+
+	t.Run("plain message without a content type", func(t *testing.T) {
+		email, err := ParseMIME(strings.NewReader("From: john@example.com\r\nTo: test@domain.com\r\nSubject: Hi\r\nImportance: High\r\n\r\nHello\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "Hello\n", email.PlainTextContent)
+		assert.Empty(t, email.HTMLContent)
+		assert.Empty(t, email.Attachments)
+		assert.True(t, email.Date.IsZero())
+		assert.True(t, email.Important)
+	})
+
+	t.Run("round trip with the renderer", func(t *testing.T) {
+		original := newTestMIMEEmail()
+		original.RecipientsBcc = nil
+		original.RecipientsCc = []string{"cc@domain.com"}
+		original.ReplyToAddress = "reply@example.com"
+		original.Subject = "Grüße – ünïcödé"
+		original.PlainTextContent = "First line\nSecond line with a long tail " + strings.Repeat("=", 80)
+		original.Important = true
+		raw, err := original.ToMIME()
+		require.NoError(t, err)
+
+		email, err := ParseMIME(bytes.NewReader(raw))
+		require.NoError(t, err)
+		assert.Equal(t, original.FromAddress, email.FromAddress)
+		assert.Equal(t, original.FromName, email.FromName)
+		assert.Equal(t, original.Recipients, email.Recipients)
+		assert.Equal(t, original.RecipientsCc, email.RecipientsCc)
+		assert.Equal(t, original.ReplyToAddress, email.ReplyToAddress)
+		assert.Equal(t, original.Subject, email.Subject)
+		assert.Equal(t, original.PlainTextContent, email.PlainTextContent)
+		assert.Equal(t, original.HTMLContent, email.HTMLContent)
+		assert.Equal(t, original.MessageID, email.MessageID)
+		assert.True(t, original.Date.Equal(email.Date))
+		assert.True(t, email.Important)
+		require.Len(t, email.Attachments, 1)
+		assert.Equal(t, "test.txt", email.Attachments[0].FileName)
+		assert.Equal(t, "text/plain", email.Attachments[0].FileType)
+
+		// The parsed email renders the same message
+		rendered, err := email.ToMIME()
+		require.NoError(t, err)
+		assert.Equal(t, string(raw), string(rendered))
+	})
+
+	t.Run("invalid messages", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			message string
+			err     error
+		}{
+			{"malformed header", "From john@example.com\r\n\r\nbody", ErrInvalidMIME},
+			{"invalid from", "From: <john@\r\n\r\nbody", ErrInvalidMIME},
+			{"invalid date", "Date: yesterday\r\n\r\nbody", ErrInvalidMIME},
+			{"missing boundary", "Content-Type: multipart/mixed\r\n\r\nbody", ErrInvalidMIME},
+			{"invalid base64", "Content-Type: image/png\r\nContent-Transfer-Encoding: base64\r\n\r\n!!!!", ErrInvalidMIME},
+			{"nested too deep", testNestedMIMEMessage(mimeMaxDepth + 1), ErrInvalidMIME},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				_, err := ParseMIME(strings.NewReader(test.message))
+				require.ErrorIs(t, err, test.err)
+			})
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package gomail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMIMEEmail will create an email with a fixed date and message id
+func newTestMIMEEmail() *Email {
+	email := &Email{
+		Date:             time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC),
+		FromAddress:      "no-reply@example.com",
+		FromName:         "No Reply",
+		HTMLContent:      "<p>Test email content</p>",
+		MessageID:        "<test@example.com>",
+		PlainTextContent: "Test email content",
+		Recipients:       []string{"test@domain.com"},
+		RecipientsBcc:    []string{"hidden@domain.com"},
+		Subject:          "Test subject",
+	}
+	email.AddAttachment("test.txt", "text/plain", strings.NewReader("attachment contents"))
+	return email
+}
+
+// TestEmail_ToMIME will test the ToMIME() method
+func TestEmail_ToMIME(t *testing.T) {
+	t.Parallel()
+
+	t.Run("golden message", func(t *testing.T) {
+		raw, err := newTestMIMEEmail().ToMIME()
+		require.NoError(t, err)
+		assert.Equal(t, "From: \"No Reply\" <no-reply@example.com>\r\n"+
+			"To: test@domain.com\r\n"+
+			"Subject: Test subject\r\n"+
+			"Date: Sat, 17 Oct 2026 09:30:00 +0000\r\n"+
+			"Message-ID: <test@example.com>\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: multipart/mixed;\r\n\tboundary=\"e960fe7ac62b1637ae12aa1ea2dc42f45886e2b00c86833cf5944fec69fe\"\r\n"+
+			"\r\n"+
+			"--e960fe7ac62b1637ae12aa1ea2dc42f45886e2b00c86833cf5944fec69fe\r\n"+
+			"Content-Type: multipart/alternative;\r\n\tboundary=\"c5c66f25347fd369ef86bf3f6a95b122ec3cb1df3b60bbec5a8c55929304\"\r\n"+
+			"\r\n"+
+			"--c5c66f25347fd369ef86bf3f6a95b122ec3cb1df3b60bbec5a8c55929304\r\n"+
+			"Content-Transfer-Encoding: quoted-printable\r\n"+
+			"Content-Type: text/plain; charset=UTF-8\r\n"+
+			"\r\n"+
+			"Test email content\r\n"+
+			"--c5c66f25347fd369ef86bf3f6a95b122ec3cb1df3b60bbec5a8c55929304\r\n"+
+			"Content-Transfer-Encoding: quoted-printable\r\n"+
+			"Content-Type: text/html; charset=UTF-8\r\n"+
+			"\r\n"+
+			"<p>Test email content</p>\r\n"+
+			"--c5c66f25347fd369ef86bf3f6a95b122ec3cb1df3b60bbec5a8c55929304--\r\n"+
+			"--e960fe7ac62b1637ae12aa1ea2dc42f45886e2b00c86833cf5944fec69fe\r\n"+
+			"Content-Disposition: attachment; filename=test.txt\r\n"+
+			"Content-Transfer-Encoding: base64\r\n"+
+			"Content-Type: text/plain; name=test.txt\r\n"+
+			"\r\n"+
+			"YXR0YWNobWVudCBjb250ZW50cw==\r\n"+
+			"--e960fe7ac62b1637ae12aa1ea2dc42f45886e2b00c86833cf5944fec69fe--\r\n", string(raw))
+	})
+
+	t.Run("rendering twice is identical", func(t *testing.T) {
+		email := newTestMIMEEmail()
+		email.Date = time.Time{}
+		email.MessageID = ""
+
+		first, err := email.ToMIME()
+		require.NoError(t, err)
+		assert.False(t, email.Date.IsZero())
+		assert.True(t, strings.HasSuffix(email.MessageID, "@example.com>"))
+
+		var second bytes.Buffer
+		require.NoError(t, email.WriteMIME(&second))
+		assert.Equal(t, string(first), second.String())
+	})
+
+	t.Run("parses as a mime message", func(t *testing.T) {
+		email := newTestMIMEEmail()
+		email.Subject = "Grüße – ünïcödé"
+		email.FromName = "Jöhn Doe"
+		email.PlainTextContent = strings.Repeat("A long line of plain text content. ", 10) + "\nSecond line"
+		email.RecipientsCc = []string{"cc1@domain.com", "cc2@domain.com"}
+		email.ReplyToAddress = "reply@example.com"
+		email.Important = true
+		email.AddAttachment("image.png", "", bytes.NewReader([]byte("\x89PNG\r\n\x1a\n")))
+
+		raw, err := email.ToMIME()
+		require.NoError(t, err)
+		for _, line := range strings.Split(string(raw), "\r\n") {
+			assert.LessOrEqual(t, len(line), 998)
+		}
+
+		message, err := mail.ReadMessage(bytes.NewReader(raw))
+		require.NoError(t, err)
+		decoder := new(mime.WordDecoder)
+		subject, err := decoder.DecodeHeader(message.Header.Get("Subject"))
+		require.NoError(t, err)
+		assert.Equal(t, email.Subject, subject)
+		from, err := mail.ParseAddress(message.Header.Get("From"))
+		require.NoError(t, err)
+		assert.Equal(t, "Jöhn Doe", from.Name)
+		cc, err := message.Header.AddressList("Cc")
+		require.NoError(t, err)
+		assert.Len(t, cc, 2)
+		assert.Equal(t, "reply@example.com", message.Header.Get("Reply-To"))
+		assert.Equal(t, "High", message.Header.Get("Importance"))
+		assert.Empty(t, message.Header.Get("Bcc"))
+		assert.Empty(t, message.Header.Get("Return-Path"))
+
+		// Walk the parts
+		mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/mixed", mediaType)
+		mixed := multipart.NewReader(message.Body, params["boundary"])
+
+		part, err := mixed.NextPart()
+		require.NoError(t, err)
+		_, params, err = mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		alternative := multipart.NewReader(part, params["boundary"])
+		text, err := alternative.NextPart()
+		require.NoError(t, err)
+		content, err := io.ReadAll(text)
+		require.NoError(t, err)
+		assert.Equal(t, strings.ReplaceAll(email.PlainTextContent, "\n", "\r\n"), string(content))
+
+		var names, types []string
+		for {
+			if part, err = mixed.NextPart(); err != nil {
+				break
+			}
+			names = append(names, part.FileName())
+			types = append(types, part.Header.Get("Content-Type"))
+		}
+		require.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, []string{"test.txt", "image.png"}, names)
+		assert.Equal(t, []string{"text/plain; name=test.txt", "image/png; name=image.png"}, types)
+	})
+
+	t.Run("header injection is removed", func(t *testing.T) {
+		email := newTestMIMEEmail()
+		email.Subject = "Test\r\nBcc: victim@domain.com"
+		email.Recipients = []string{"test@domain.com\r\nX-Injected: true"}
+
+		raw, err := email.ToMIME()
+		require.NoError(t, err)
+		message, err := mail.ReadMessage(bytes.NewReader(raw))
+		require.NoError(t, err)
+		assert.Empty(t, message.Header.Get("Bcc"))
+		assert.Empty(t, message.Header.Get("X-Injected"))
+	})
+
+	t.Run("seekable attachments are rewound", func(t *testing.T) {
+		email := newTestMIMEEmail()
+		first, err := email.ToMIME()
+		require.NoError(t, err)
+		second, err := email.ToMIME()
+		require.NoError(t, err)
+		assert.Equal(t, string(first), string(second))
+	})
+
+	t.Run("failed attachment reader", func(t *testing.T) {
+		email := newTestMIMEEmail()
+		email.AddAttachment("broken.txt", "text/plain", &errorReader{})
+		_, err := email.ToMIME()
+		require.Error(t, err)
+	})
+}
+
+// errorReader is a reader that always fails
+type errorReader struct{}
+
+// Read will always return an error
+func (r *errorReader) Read(_ []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+// TestMimeBoundaries will test the mimeBoundaries() method
+func TestMimeBoundaries(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	mixed, alternative := mimeBoundaries("<test@example.com>", date)
+	assert.NotEqual(t, mixed, alternative)
+
+	// Content that contains the boundaries gets different ones
+	content := []byte("--" + mixed + "\r\n--" + alternative + "--\r\n")
+	safeMixed, safeAlternative := mimeBoundaries("<test@example.com>", date, content)
+	assert.NotContains(t, string(content), safeMixed)
+	assert.NotContains(t, string(content), safeAlternative)
+}
+
+// TestWriteMIMEHeader will test the writeMIMEHeader() method
+func TestWriteMIMEHeader(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	writeMIMEHeader(&buf, "To", strings.Repeat("someone@example.com, ", 9)+"last@example.com")
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), mimeHeaderLength)
+	}
+	header, err := mail.ReadMessage(strings.NewReader(buf.String() + "\r\n"))
+	require.NoError(t, err)
+	addresses, err := header.Header.AddressList("To")
+	require.NoError(t, err)
+	assert.Len(t, addresses, 10)
+
+	// A word longer than the line is not split
+	buf.Reset()
+	writeMIMEHeader(&buf, "Subject", strings.Repeat("x", 100))
+	assert.Equal(t, "Subject: "+strings.Repeat("x", 100)+"\r\n", buf.String())
+}
+
+// TestEmail_ToMIME_Providers will test that the raw MIME providers send the rendered message
+func TestEmail_ToMIME_Providers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("smtp sends the rendered message", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		email := newTestMIMEEmail()
+		raw, err := email.ToMIME()
+		require.NoError(t, err)
+
+		_, err = sendViaSMTP(context.Background(), newSMTPDialer(server.addr, nil, SMTPTLSNone, nil), nil, email)
+		require.NoError(t, err)
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, strings.TrimSuffix(string(raw), "\r\n"), strings.TrimSuffix(messages[0].data, "\r\n"))
+		assert.Equal(t, []string{"test@domain.com", "hidden@domain.com"}, messages[0].to)
+	})
+
+	t.Run("aws ses writes the bcc and return path headers", func(t *testing.T) {
+		email := newTestMIMEEmail()
+		email.ReturnPath = "bounces@example.com"
+
+		raw, err := awsSesRawMessage(email, true, nil)
+		require.NoError(t, err)
+		assert.Contains(t, string(raw), "Bcc: hidden@domain.com\r\n")
+		assert.Contains(t, string(raw), "Return-Path: bounces@example.com\r\n")
+		assert.Contains(t, string(raw), "Message-ID: <test@example.com>\r\n")
+
+		raw, err = awsSesRawMessage(email, false, nil)
+		require.NoError(t, err)
+		assert.NotContains(t, string(raw), "Bcc:")
+	})
+
+	t.Run("sending does not change the email", func(t *testing.T) {
+		email := newTestMIMEEmail()
+		email.Date = time.Time{}
+		email.MessageID = ""
+		_, err := awsSesRawMessage(email, true, nil)
+		require.NoError(t, err)
+		assert.True(t, email.Date.IsZero())
+		assert.Empty(t, email.MessageID)
+	})
+}
@@ -0,0 +1,303 @@
+package gomail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOutboxMaxAttempts  = 5
+	defaultOutboxPollInterval = time.Second
+	defaultOutboxWorkers      = 4
+)
+
+// EnqueueOptions are the options for an email sent through the outbox
+type EnqueueOptions struct {
+	Providers   []ServiceProvider // providers to try in order (defaults to ProviderPriority, then AvailableProviders)
+	ID          string            // job id (generated if empty), enqueueing the same id twice is refused
+	MaxAttempts int               // attempts before the job fails (defaults to the OutboxRetryPolicy)
+}
+
+// outboxWorkers is the running worker pool of the outbox
+type outboxWorkers struct {
+	cancel context.CancelFunc // cancels the sends that are in flight
+	ctx    context.Context    // context of the sends
+	stop   chan struct{}      // closed to stop taking new jobs
+	wake   chan struct{}      // signals a new job
+	wg     sync.WaitGroup
+}
+
+// Enqueue will add the email to the outbox and return the job id, the email is sent by the outbox workers
+//
+// The email is validated and its attachments are read before it is queued. Each attempt sends the email
+// with SendWithFailover, transient failures are retried per the OutboxRetryPolicy. The final status
+// (and the result) is recorded on the job, see Outbox.Get (done jobs are kept for the queue Retention).
+// An email with a future SendAt is not sent before that time, see ListScheduled and CancelScheduled.
+func (m *MailService) Enqueue(ctx context.Context, email *Email, options EnqueueOptions) (string, error) {
+	if m.Outbox == nil {
+		return "", ErrOutboxNotConfigured
+	}
+	m.outboxMu.Lock()
+	closed := m.outboxClosed
+	m.outboxMu.Unlock()
+	if closed {
+		return "", ErrOutboxClosed
+	}
+
+	// Validate email configuration (fail before it is queued)
+	if err := m.validateEmail(email); err != nil {
+		return "", err
+	}
+
+	job, err := newOutboxJob(email, options)
+	if err != nil {
+		return "", err
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = m.outboxRetryPolicy().attempts()
+	}
+	if email.scheduled() {
+		job.NextAttemptAt = email.SendAt.UTC()
+	}
+	if err = m.Outbox.Push(ctx, job); err != nil {
+		return "", err
+	}
+
+	// Wake a worker (if they are running)
+	m.outboxMu.Lock()
+	if m.outbox != nil {
+		select {
+		case m.outbox.wake <- struct{}{}:
+		default:
+		}
+	}
+	m.outboxMu.Unlock()
+	return job.ID, nil
+}
+
+// StartOutbox will start the workers that send the emails in the outbox
+//
+// Call it after StartUp (and RegisterProvider), jobs left pending by a previous process are sent as well
+func (m *MailService) StartOutbox() error {
+	if m.Outbox == nil {
+		return ErrOutboxNotConfigured
+	}
+	m.outboxMu.Lock()
+	defer m.outboxMu.Unlock()
+	if m.outboxClosed {
+		return ErrOutboxClosed
+	} else if m.outbox != nil {
+		return nil
+	}
+
+	workers := m.OutboxWorkers
+	if workers <= 0 {
+		workers = defaultOutboxWorkers
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.outbox = &outboxWorkers{
+		cancel: cancel,
+		ctx:    ctx,
+		stop:   make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+	}
+	for i := 0; i < workers; i++ {
+		m.outbox.wg.Add(1)
+		go m.outboxWorker(m.outbox)
+	}
+	return nil
+}
+
+// Shutdown will stop the outbox workers once the jobs in flight are done
+//
+// If the context ends first, the sends in flight are canceled and their jobs are left pending
+// (a durable queue sends them after a restart). Enqueue is refused after Shutdown.
+func (m *MailService) Shutdown(ctx context.Context) error {
+	m.outboxMu.Lock()
+	m.outboxClosed = true
+	workers := m.outbox
+	m.outboxMu.Unlock()
+	if workers == nil {
+		return nil
+	}
+
+	select {
+	case <-workers.stop:
+	default:
+		close(workers.stop)
+	}
+	done := make(chan struct{})
+	go func() {
+		workers.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		workers.cancel()
+		return nil
+	case <-ctx.Done():
+		workers.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// outboxWorker sends the due jobs until the workers are stopped
+func (m *MailService) outboxWorker(workers *outboxWorkers) {
+	defer workers.wg.Done()
+
+	interval := m.OutboxPollInterval
+	if interval <= 0 {
+		interval = defaultOutboxPollInterval
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-workers.stop:
+			return
+		default:
+		}
+
+		job, err := m.Outbox.Pop(workers.ctx)
+		if err != nil && workers.ctx.Err() == nil {
+			m.outboxError(fmt.Errorf("failed to get the next outbox job: %w", err))
+		} else if err == nil && job != nil {
+			m.sendOutboxJob(workers.ctx, job)
+
+			// Another job may be due already
+			continue
+		}
+
+		// Wait for a new job or the next poll
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(interval)
+		select {
+		case <-workers.stop:
+			return
+		case <-workers.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// sendOutboxJob makes an attempt to send the job and records the status
+func (m *MailService) sendOutboxJob(ctx context.Context, job *OutboxJob) {
+	job.Attempts++
+	result, err := m.SendWithFailover(ctx, job.email(), job.Providers...)
+
+	now := time.Now().UTC()
+	job.UpdatedAt = now
+	job.Result = nil
+	if len(result.Recipients) > 0 || len(result.MessageID) > 0 {
+		job.Result = &result
+	}
+	switch {
+	case err == nil:
+		job.Status, job.Error = OutboxSent, ""
+	case ctx.Err() != nil:
+		// Shutting down, this attempt does not count
+		job.Attempts--
+		job.Status, job.Error = OutboxPending, err.Error()
+	case IsTransient(err) && job.Attempts < job.MaxAttempts && !result.delivered():
+		// Retry unless some recipients already have the email
+		job.Status, job.Error = OutboxPending, err.Error()
+		job.NextAttemptAt = now.Add(m.outboxRetryPolicy().backoff(job.Attempts))
+	default:
+		job.Status, job.Error = OutboxFailed, err.Error()
+	}
+
+	// Record the status even if the workers are stopping
+	if err = m.Outbox.Update(context.WithoutCancel(ctx), job); err != nil {
+		m.outboxError(fmt.Errorf("failed to update outbox job %s to %s: %w", job.ID, job.Status, err))
+	}
+}
+
+// outboxError reports an error of the outbox workers to the OutboxErrorHandler (logged if there is none)
+func (m *MailService) outboxError(err error) {
+	if m.OutboxErrorHandler != nil {
+		m.OutboxErrorHandler(err)
+		return
+	}
+	log.Printf("error: %s", err.Error())
+}
+
+// outboxRetryPolicy returns the retry policy of the outbox jobs
+func (m *MailService) outboxRetryPolicy() *RetryPolicy {
+	if m.OutboxRetryPolicy != nil {
+		return m.OutboxRetryPolicy
+	}
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = defaultOutboxMaxAttempts
+	return policy
+}
+
+// newOutboxJob creates a pending job for the email
+func newOutboxJob(email *Email, options EnqueueOptions) (*OutboxJob, error) {
+	id := options.ID
+	if len(id) == 0 {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return nil, fmt.Errorf("outbox job id: %w", err)
+		}
+		id = hex.EncodeToString(random)
+	}
+
+	// Keep a copy (later changes by the caller are not sent) with the readers buffered
+	queued := email.clone()
+	if err := queued.BufferAttachments(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &OutboxJob{
+		CreatedAt:     now,
+		Email:         queued,
+		ID:            id,
+		MaxAttempts:   options.MaxAttempts,
+		NextAttemptAt: now,
+		Providers:     options.Providers,
+		Status:        OutboxPending,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// email returns a copy of the email of the job for an attempt
+func (j *OutboxJob) email() *Email {
+	return j.Email.clone()
+}
+
+// clone returns a copy of the email that shares no slices with it (attachment readers are shared)
+func (e *Email) clone() *Email {
+	clone := *e
+	clone.Attachments = slices.Clone(e.Attachments)
+	for i := range clone.Attachments {
+		clone.Attachments[i].Content = bytes.Clone(e.Attachments[i].Content)
+	}
+	clone.CSS = bytes.Clone(e.CSS)
+	clone.Recipients = slices.Clone(e.Recipients)
+	clone.RecipientsBcc = slices.Clone(e.RecipientsBcc)
+	clone.RecipientsCc = slices.Clone(e.RecipientsCc)
+	clone.Styles = bytes.Clone(e.Styles)
+	clone.Tags = slices.Clone(e.Tags)
+	if e.DSN != nil {
+		dsn := *e.DSN
+		dsn.Notify = slices.Clone(e.DSN.Notify)
+		clone.DSN = &dsn
+	}
+	return &clone
+}
@@ -0,0 +1,393 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errOutboxTest is the error returned by the outbox test provider
+var errOutboxTest = errors.New("outbox test error")
+
+// mockOutboxProvider is a provider for outbox tests that is safe for concurrent use
+type mockOutboxProvider struct {
+	block    chan struct{} // if set, sends wait for it to be closed (or the context)
+	err      error
+	failures int
+	mu       sync.Mutex
+	calls    int
+	sent     []*Email
+	contents []string
+}
+
+// Name returns the name of the provider
+func (p *mockOutboxProvider) Name() string {
+	return "outbox_test"
+}
+
+// Capabilities returns the features supported by the provider
+func (p *mockOutboxProvider) Capabilities() Capabilities {
+	return Capabilities{Attachments: true}
+}
+
+// Send records the email (after failing the configured number of times)
+func (p *mockOutboxProvider) Send(ctx context.Context, email *Email) (SendResult, error) {
+	if p.block != nil {
+		select {
+		case <-p.block:
+		case <-ctx.Done():
+			return SendResult{}, ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.calls <= p.failures {
+		return SendResult{}, p.err
+	}
+	for _, attachment := range email.Attachments {
+		content, err := attachment.Bytes()
+		if err != nil {
+			return SendResult{}, err
+		}
+		p.contents = append(p.contents, string(content))
+	}
+	p.sent = append(p.sent, email)
+	return newSendResult(testRelayProvider, email, RecipientAccepted), nil
+}
+
+// sentCount returns the number of emails sent
+func (p *mockOutboxProvider) sentCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sent)
+}
+
+// mockFailingQueue is a queue that fails to pop and update jobs
+type mockFailingQueue struct {
+	*MemoryQueue
+	popErr    error
+	updateErr error
+}
+
+// Pop is for mocking
+func (q *mockFailingQueue) Pop(ctx context.Context) (*OutboxJob, error) {
+	if q.popErr != nil {
+		return nil, q.popErr
+	}
+	return q.MemoryQueue.Pop(ctx)
+}
+
+// Update is for mocking
+func (q *mockFailingQueue) Update(ctx context.Context, job *OutboxJob) error {
+	if q.updateErr != nil {
+		return q.updateErr
+	}
+	return q.MemoryQueue.Update(ctx, job)
+}
+
+// newOutboxTestService will create a service with the test provider and a fast outbox
+func newOutboxTestService(t *testing.T, queue Queue, provider *mockOutboxProvider) *MailService {
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromDomain = testDomainEmail
+	mail.MandrillAPIKey = "1234567"
+	require.NoError(t, mail.StartUp())
+
+	mail.Outbox = queue
+	mail.OutboxPollInterval = 5 * time.Millisecond
+	mail.OutboxWorkers = 2
+	mail.OutboxRetryPolicy = &RetryPolicy{InitialBackoff: time.Millisecond, MaxAttempts: 3, MaxBackoff: 5 * time.Millisecond}
+	mail.ProviderPriority = []ServiceProvider{testRelayProvider}
+	require.NoError(t, mail.RegisterProvider(testRelayProvider, provider))
+	return mail
+}
+
+// newOutboxTestEmail will create an email with an attachment
+func newOutboxTestEmail(mail *MailService, subject string) *Email {
+	email := mail.NewEmail()
+	email.Subject = subject
+	email.PlainTextContent = "Test email content"
+	email.Recipients = []string{"test@domain.com"}
+	email.AddAttachment("file.txt", "text/plain", strings.NewReader("attachment for "+subject))
+	return email
+}
+
+// waitForOutboxJob waits until the job is done and returns it
+func waitForOutboxJob(t *testing.T, queue Queue, id string) *OutboxJob {
+	var job *OutboxJob
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = queue.Get(context.Background(), id)
+		return err == nil && job.done()
+	}, 5*time.Second, 5*time.Millisecond)
+	return job
+}
+
+// TestMailService_Enqueue tests the methods Enqueue(), StartOutbox() and Shutdown()
+func TestMailService_Enqueue(t *testing.T) {
+	t.Parallel()
+
+	t.Run("emails are sent by the workers", func(t *testing.T) {
+		t.Parallel()
+
+		provider := &mockOutboxProvider{}
+		queue := NewMemoryQueue()
+		mail := newOutboxTestService(t, queue, provider)
+		require.NoError(t, mail.StartOutbox())
+		require.NoError(t, mail.StartOutbox())
+
+		ids := make([]string, 0, 10)
+		for i := 0; i < 10; i++ {
+			email := newOutboxTestEmail(mail, fmt.Sprintf("email %d", i))
+			id, err := mail.Enqueue(context.Background(), email, EnqueueOptions{})
+			require.NoError(t, err)
+			require.Len(t, id, 32)
+			ids = append(ids, id)
+
+			// Changes after enqueueing are not sent
+			email.Subject = "changed"
+		}
+		for _, id := range ids {
+			job := waitForOutboxJob(t, queue, id)
+			assert.Equal(t, OutboxSent, job.Status)
+			assert.Equal(t, 1, job.Attempts)
+			assert.Empty(t, job.Error)
+			require.NotNil(t, job.Result)
+			assert.Equal(t, testRelayProvider, job.Result.Provider)
+		}
+		require.NoError(t, mail.Shutdown(context.Background()))
+
+		assert.Equal(t, 10, provider.sentCount())
+		for _, email := range provider.sent {
+			assert.NotEqual(t, "changed", email.Subject)
+		}
+		assert.Contains(t, provider.contents, "attachment for email 3")
+	})
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		t.Parallel()
+
+		provider := &mockOutboxProvider{err: transientError(errOutboxTest), failures: 2}
+		queue := NewMemoryQueue()
+		mail := newOutboxTestService(t, queue, provider)
+		require.NoError(t, mail.StartOutbox())
+
+		id, err := mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "retried"), EnqueueOptions{ID: "retried", Providers: []ServiceProvider{testRelayProvider}})
+		require.NoError(t, err)
+		assert.Equal(t, "retried", id)
+		_, err = mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "retried"), EnqueueOptions{ID: "retried"})
+		require.ErrorIs(t, err, ErrOutboxJobExists)
+
+		job := waitForOutboxJob(t, queue, id)
+		require.NoError(t, mail.Shutdown(context.Background()))
+		assert.Equal(t, OutboxSent, job.Status)
+		assert.Equal(t, 3, job.Attempts)
+		assert.Equal(t, []string{"attachment for retried"}, provider.contents)
+	})
+
+	t.Run("jobs fail after the max attempts or a permanent error", func(t *testing.T) {
+		t.Parallel()
+
+		provider := &mockOutboxProvider{err: transientError(errOutboxTest), failures: 10}
+		queue := NewMemoryQueue()
+		mail := newOutboxTestService(t, queue, provider)
+		require.NoError(t, mail.StartOutbox())
+
+		id, err := mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "transient"), EnqueueOptions{MaxAttempts: 2})
+		require.NoError(t, err)
+		job := waitForOutboxJob(t, queue, id)
+		assert.Equal(t, OutboxFailed, job.Status)
+		assert.Equal(t, 2, job.Attempts)
+		assert.Contains(t, job.Error, errOutboxTest.Error())
+
+		provider.mu.Lock()
+		provider.err = permanentError(errOutboxTest)
+		provider.mu.Unlock()
+		id, err = mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "permanent"), EnqueueOptions{})
+		require.NoError(t, err)
+		job = waitForOutboxJob(t, queue, id)
+		assert.Equal(t, OutboxFailed, job.Status)
+		assert.Equal(t, 1, job.Attempts)
+		require.NoError(t, mail.Shutdown(context.Background()))
+	})
+
+	t.Run("jobs survive a restart", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		queue, err := NewDiskQueue(dir)
+		require.NoError(t, err)
+
+		// Enqueued before the workers are started, then the process exits
+		provider := &mockOutboxProvider{}
+		mail := newOutboxTestService(t, queue, provider)
+		id, err := mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "restart"), EnqueueOptions{})
+		require.NoError(t, err)
+
+		queue, err = NewDiskQueue(dir)
+		require.NoError(t, err)
+		mail = newOutboxTestService(t, queue, provider)
+		require.NoError(t, mail.StartOutbox())
+		job := waitForOutboxJob(t, queue, id)
+		require.NoError(t, mail.Shutdown(context.Background()))
+		assert.Equal(t, OutboxSent, job.Status)
+		assert.Equal(t, []string{"attachment for restart"}, provider.contents)
+
+		// The final status is saved
+		queue, err = NewDiskQueue(dir)
+		require.NoError(t, err)
+		job, err = queue.Get(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, OutboxSent, job.Status)
+	})
+
+	t.Run("shutdown drains the jobs in flight", func(t *testing.T) {
+		t.Parallel()
+
+		provider := &mockOutboxProvider{block: make(chan struct{})}
+		queue := NewMemoryQueue()
+		mail := newOutboxTestService(t, queue, provider)
+		require.NoError(t, mail.StartOutbox())
+		id, err := mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "in flight"), EnqueueOptions{})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			job, getErr := queue.Get(context.Background(), id)
+			return getErr == nil && job.Status == OutboxRunning
+		}, 5*time.Second, time.Millisecond)
+
+		shutdown := make(chan error)
+		go func() {
+			shutdown <- mail.Shutdown(context.Background())
+		}()
+		time.Sleep(20 * time.Millisecond)
+		close(provider.block)
+		require.NoError(t, <-shutdown)
+
+		job, err := queue.Get(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, OutboxSent, job.Status)
+
+		_, err = mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "closed"), EnqueueOptions{})
+		require.ErrorIs(t, err, ErrOutboxClosed)
+		require.ErrorIs(t, mail.StartOutbox(), ErrOutboxClosed)
+		require.NoError(t, mail.Shutdown(context.Background()))
+	})
+
+	t.Run("shutdown deadline leaves the job pending", func(t *testing.T) {
+		t.Parallel()
+
+		provider := &mockOutboxProvider{block: make(chan struct{})}
+		queue := NewMemoryQueue()
+		mail := newOutboxTestService(t, queue, provider)
+		require.NoError(t, mail.StartOutbox())
+		id, err := mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "canceled"), EnqueueOptions{})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			job, getErr := queue.Get(context.Background(), id)
+			return getErr == nil && job.Status == OutboxRunning
+		}, 5*time.Second, time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, mail.Shutdown(ctx), context.DeadlineExceeded)
+
+		job, err := queue.Get(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, OutboxPending, job.Status)
+		assert.Equal(t, 0, job.Attempts)
+	})
+
+	t.Run("later changes by the caller are not queued", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		queue := NewMemoryQueue()
+		mail := newOutboxTestService(t, queue, &mockOutboxProvider{})
+		email := newOutboxTestEmail(mail, "copy")
+		email.RecipientsCc = []string{"cc@domain.com"}
+		email.Tags = []string{"tag"}
+		email.DSN = &DSN{Notify: []string{DSNNotifyFailure}}
+		id, err := mail.Enqueue(ctx, email, EnqueueOptions{})
+		require.NoError(t, err)
+
+		email.Recipients[0] = "changed@domain.com"
+		email.RecipientsCc[0] = "changed@domain.com"
+		email.Tags[0] = "changed"
+		email.DSN.Notify[0] = DSNNotifyDelay
+		job, err := queue.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"test@domain.com"}, job.Email.Recipients)
+		assert.Equal(t, []string{"cc@domain.com"}, job.Email.RecipientsCc)
+		assert.Equal(t, []string{"tag"}, job.Email.Tags)
+		assert.Equal(t, []string{DSNNotifyFailure}, job.Email.DSN.Notify)
+
+		// Nor are changes to a job returned by the queue
+		job.Email.Recipients[0] = "changed@domain.com"
+		job, err = queue.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"test@domain.com"}, job.email().Recipients)
+	})
+
+	t.Run("queue errors are reported", func(t *testing.T) {
+		t.Parallel()
+
+		errPop, errUpdate := errors.New("pop failed"), errors.New("update failed")
+		for _, queue := range []*mockFailingQueue{
+			{MemoryQueue: NewMemoryQueue(), popErr: errPop},
+			{MemoryQueue: NewMemoryQueue(), updateErr: errUpdate},
+		} {
+			reported := make(chan error, 10)
+			mail := newOutboxTestService(t, queue, &mockOutboxProvider{})
+			mail.OutboxErrorHandler = func(err error) {
+				select {
+				case reported <- err:
+				default:
+				}
+			}
+			id, err := mail.Enqueue(context.Background(), newOutboxTestEmail(mail, "queue error"), EnqueueOptions{})
+			require.NoError(t, err)
+			require.NoError(t, mail.StartOutbox())
+
+			select {
+			case err = <-reported:
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "no error was reported")
+			}
+			require.NoError(t, mail.Shutdown(context.Background()))
+			if queue.popErr != nil {
+				require.ErrorIs(t, err, errPop)
+				continue
+			}
+			require.ErrorIs(t, err, errUpdate)
+			assert.Contains(t, err.Error(), id)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		mail := new(MailService)
+		_, err := mail.Enqueue(context.Background(), &Email{}, EnqueueOptions{})
+		require.ErrorIs(t, err, ErrOutboxNotConfigured)
+		require.ErrorIs(t, mail.StartOutbox(), ErrOutboxNotConfigured)
+		require.NoError(t, mail.Shutdown(context.Background()))
+
+		mail = newOutboxTestService(t, NewMemoryQueue(), &mockOutboxProvider{})
+		_, err = mail.Enqueue(context.Background(), &Email{}, EnqueueOptions{})
+		require.ErrorIs(t, err, ErrMissingSubject)
+
+		email := newOutboxTestEmail(mail, "unreadable")
+		email.AddAttachment("bad.txt", "text/plain", &errorReader{})
+		_, err = mail.Enqueue(context.Background(), email, EnqueueOptions{})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,396 @@
+package gomail
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// PGPMissingKeyPolicy decides what happens to recipients without a public key when encrypting with OpenPGP
+type PGPMissingKeyPolicy int
+
+// OpenPGP missing key policies
+const (
+	PGPMissingKeyFail  PGPMissingKeyPolicy = iota // refuse to send the email (default)
+	PGPMissingKeyPlain                            // send those recipients a separate unencrypted copy (still signed if requested)
+	PGPMissingKeySkip                             // do not send to those recipients, they are reported as rejected
+)
+
+// pgpMissingKeyReason is the reject reason for recipients skipped by PGPMissingKeySkip
+const pgpMissingKeyReason = "no openpgp public key for the recipient"
+
+// String returns the name of the policy
+func (p PGPMissingKeyPolicy) String() string {
+	switch p {
+	case PGPMissingKeyFail:
+		return "fail"
+	case PGPMissingKeyPlain:
+		return "plain"
+	case PGPMissingKeySkip:
+		return "skip"
+	default:
+		return fmt.Sprintf("PGPMissingKeyPolicy(%d)", int(p))
+	}
+}
+
+// pgpConfig signs and encrypts raw MIME messages with OpenPGP/MIME (RFC 3156)
+//
+// The keys are decrypted when loaded and never changed, so the config is safe for concurrent use
+type pgpConfig struct {
+	packetConfig *packet.Config             // signing and encryption settings (SHA-256, AES-256)
+	recipients   map[string]*openpgp.Entity // public keys by lower case address
+	signer       *openpgp.Entity            // sender key with a decrypted private key (nil if signing is not configured)
+	policy       PGPMissingKeyPolicy        // what to do with recipients without a key
+}
+
+// newPGPConfig will create the OpenPGP config from armored keys
+//
+// The private key is decrypted with the passphrase (if it is protected), the recipient keys must be able to encrypt
+func newPGPConfig(privateKey []byte, passphrase string, recipientKeys map[string]string, policy PGPMissingKeyPolicy) (*pgpConfig, error) {
+	if policy < PGPMissingKeyFail || policy > PGPMissingKeySkip {
+		return nil, fmt.Errorf("openpgp missing key policy %s is not supported: %w", policy, ErrInvalidPGPConfig)
+	}
+	config := &pgpConfig{
+		packetConfig: &packet.Config{DefaultCipher: packet.CipherAES256, DefaultHash: crypto.SHA256},
+		policy:       policy,
+		recipients:   make(map[string]*openpgp.Entity, len(recipientKeys)),
+	}
+
+	// Load the signer and unlock the private keys
+	if len(privateKey) > 0 {
+		signer, err := readPGPKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		if signer.PrivateKey == nil {
+			return nil, fmt.Errorf("openpgp signing key is a public key: %w", ErrInvalidPGPKey)
+		}
+		if signer.PrivateKey.Encrypted {
+			if len(passphrase) == 0 {
+				return nil, fmt.Errorf("openpgp signing key is protected, a passphrase is required: %w", ErrInvalidPGPKey)
+			}
+			if err = signer.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidPGPKey, err)
+			}
+		}
+		if _, ok := signer.SigningKey(config.packetConfig.Now()); !ok {
+			return nil, fmt.Errorf("openpgp key has no valid signing key: %w", ErrInvalidPGPKey)
+		}
+		config.signer = signer
+	}
+
+	// Load the public key of each recipient
+	for address, armored := range recipientKeys {
+		recipient, err := readPGPKey([]byte(armored))
+		if err != nil {
+			return nil, fmt.Errorf("openpgp recipient %s: %w", address, err)
+		}
+		if _, ok := recipient.EncryptionKey(config.packetConfig.Now()); !ok {
+			return nil, fmt.Errorf("openpgp recipient %s has no valid encryption key: %w", address, ErrInvalidPGPKey)
+		}
+		config.recipients[smimeAddress(address)] = recipient
+	}
+
+	return config, nil
+}
+
+// readPGPKey reads the first key from an armored key block
+func readPGPKey(armored []byte) (*openpgp.Entity, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPGPKey, err)
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("openpgp key block is empty: %w", ErrInvalidPGPKey)
+	}
+	return entities[0], nil
+}
+
+// missingKeys returns the recipients (to, cc and bcc) that do not have a public key
+func (c *pgpConfig) missingKeys(email *Email) (missing []string) {
+	for _, list := range [][]string{email.Recipients, email.RecipientsCc, email.RecipientsBcc} {
+		for _, address := range list {
+			if _, ok := c.recipients[smimeAddress(address)]; !ok {
+				missing = append(missing, address)
+			}
+		}
+	}
+	return missing
+}
+
+// apply signs and/or encrypts the message as requested by the email
+//
+// A nil config returns ErrPGPNotConfigured if the email requests OpenPGP, otherwise the message as is
+func (c *pgpConfig) apply(email *Email, message []byte) ([]byte, error) {
+	if !email.PGPSign && !email.PGPEncrypt {
+		return message, nil
+	}
+	if c == nil || (email.PGPSign && c.signer == nil) {
+		return nil, fmt.Errorf("openpgp is requested but no key is configured: %w", ErrPGPNotConfigured)
+	}
+
+	// Sign first, so the signature is protected by the encryption
+	headers, entity := splitMIMEEntity(message)
+	var err error
+	if email.PGPSign {
+		if entity, err = c.sign(entity); err != nil {
+			return nil, err
+		}
+	}
+	if email.PGPEncrypt {
+		if entity, err = c.encrypt(email, entity); err != nil {
+			return nil, err
+		}
+	}
+	return append(headers, entity...), nil
+}
+
+// sign wraps the entity in a multipart/signed entity with a detached signature (RFC 3156 section 5)
+func (c *pgpConfig) sign(entity []byte) ([]byte, error) {
+	var signature bytes.Buffer
+	if err := openpgp.DetachSign(&signature, c.signer, bytes.NewReader(entity), c.packetConfig); err != nil {
+		return nil, fmt.Errorf("openpgp signing failed: %w", err)
+	}
+
+	// The micalg parameter must name the hash that was used (it depends on the key)
+	micalg, err := pgpMicalg(signature.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	var armored []byte
+	if armored, err = pgpArmor(openpgp.SignatureType, signature.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var boundary string
+	if boundary, err = mimeBoundary(); err != nil {
+		return nil, err
+	}
+
+	// The signed entity is everything between the first boundary and the line break before the next
+	var buf bytes.Buffer
+	buf.Grow(len(entity) + len(armored) + 512)
+	buf.WriteString("Content-Type: multipart/signed; protocol=\"application/pgp-signature\"; micalg=" + micalg + ";\r\n")
+	buf.WriteString("\tboundary=\"" + boundary + "\"\r\n\r\n")
+	buf.WriteString("This is an OpenPGP/MIME signed message (RFC 3156)\r\n\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.Write(entity)
+	buf.WriteString("\r\n--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: application/pgp-signature; name=\"signature.asc\"\r\n")
+	buf.WriteString("Content-Description: OpenPGP digital signature\r\n")
+	buf.WriteString("Content-Disposition: attachment; filename=\"signature.asc\"\r\n\r\n")
+	buf.Write(armored)
+	buf.WriteString("--" + boundary + "--\r\n")
+	return buf.Bytes(), nil
+}
+
+// encrypt replaces the entity with a multipart/encrypted entity for every recipient (RFC 3156 section 4)
+//
+// Every recipient (to, cc and bcc) must have a public key, bcc recipients are visible in the encrypted message
+func (c *pgpConfig) encrypt(email *Email, entity []byte) ([]byte, error) {
+	if missing := c.missingKeys(email); len(missing) > 0 {
+		return nil, fmt.Errorf("openpgp recipients %s: %w", strings.Join(missing, ", "), ErrPGPMissingKey)
+	}
+	recipients := make([]*openpgp.Entity, 0, len(email.Recipients)+len(email.RecipientsCc)+len(email.RecipientsBcc)+1)
+	for _, list := range [][]string{email.Recipients, email.RecipientsCc, email.RecipientsBcc} {
+		for _, address := range list {
+			recipients = append(recipients, c.recipients[smimeAddress(address)])
+		}
+	}
+
+	// The sender can read the sent copy
+	if c.signer != nil {
+		if _, ok := c.signer.EncryptionKey(c.packetConfig.Now()); ok {
+			recipients = append(recipients, c.signer)
+		}
+	}
+
+	var encrypted bytes.Buffer
+	armorWriter, err := armor.Encode(&encrypted, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, fmt.Errorf("openpgp encryption failed: %w", err)
+	}
+	var plaintext io.WriteCloser
+	if plaintext, err = openpgp.Encrypt(armorWriter, recipients, nil, &openpgp.FileHints{IsBinary: true}, c.packetConfig); err != nil {
+		return nil, fmt.Errorf("openpgp encryption failed: %w", err)
+	}
+	if _, err = plaintext.Write(entity); err != nil {
+		return nil, fmt.Errorf("openpgp encryption failed: %w", err)
+	}
+	if err = plaintext.Close(); err != nil {
+		return nil, fmt.Errorf("openpgp encryption failed: %w", err)
+	}
+	if err = armorWriter.Close(); err != nil {
+		return nil, fmt.Errorf("openpgp encryption failed: %w", err)
+	}
+
+	var boundary string
+	if boundary, err = mimeBoundary(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(encrypted.Len() + 512)
+	buf.WriteString("Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\";\r\n")
+	buf.WriteString("\tboundary=\"" + boundary + "\"\r\n\r\n")
+	buf.WriteString("This is an OpenPGP/MIME encrypted message (RFC 3156)\r\n\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: application/pgp-encrypted\r\n")
+	buf.WriteString("Content-Description: PGP/MIME version identification\r\n\r\n")
+	buf.WriteString("Version: 1\r\n\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n")
+	buf.WriteString("Content-Description: OpenPGP encrypted message\r\n")
+	buf.WriteString("Content-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n")
+	buf.Write(mimeCRLF(encrypted.Bytes()))
+	buf.WriteString("\r\n--" + boundary + "--\r\n")
+	return buf.Bytes(), nil
+}
+
+// pgpMicalg returns the micalg parameter for the hash of the signature, ie: pgp-sha256
+func pgpMicalg(signature []byte) (string, error) {
+	parsed, err := packet.Read(bytes.NewReader(signature))
+	if err != nil {
+		return "", fmt.Errorf("openpgp signing failed: %w", err)
+	}
+	sig, ok := parsed.(*packet.Signature)
+	if !ok {
+		return "", fmt.Errorf("openpgp signing returned a %T packet: %w", parsed, ErrInvalidPGPKey)
+	}
+	return "pgp-" + strings.ToLower(strings.ReplaceAll(sig.Hash.String(), "-", "")), nil
+}
+
+// pgpArmor armors the data with CRLF line endings
+func pgpArmor(blockType string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return mimeCRLF(buf.Bytes()), nil
+}
+
+// sendWithMissingPGPKeys applies the missing key policy to an email that is encrypted with OpenPGP
+//
+// With PGPMissingKeyPlain the recipients with a key get the encrypted email and the others a separate
+// unencrypted email, so each copy only lists its own recipients in the headers. Once the encrypted copy
+// is sent no error is returned (a retry would send it again), recipients of a plain copy that failed
+// are reported as rejected in the result instead.
+func (m *MailService) sendWithMissingPGPKeys(ctx context.Context, p Provider, email *Email, missing []string) (result SendResult, err error) {
+	switch m.pgp.policy {
+	case PGPMissingKeySkip:
+		encrypted := withoutRecipients(email, missing)
+		if len(encrypted.Recipients)+len(encrypted.RecipientsCc)+len(encrypted.RecipientsBcc) == 0 {
+			return result, permanentError(fmt.Errorf("openpgp recipients %s: %w", strings.Join(missing, ", "), ErrPGPMissingKey))
+		}
+		if result, err = p.Send(ctx, encrypted); err != nil {
+			return result, err
+		}
+		for _, address := range missing {
+			result.Recipients = append(result.Recipients, RecipientResult{
+				Email:        address,
+				RejectReason: pgpMissingKeyReason,
+				Status:       RecipientRejected,
+			})
+		}
+		return result, nil
+	case PGPMissingKeyPlain:
+		// Buffer the attachments so both copies can read them
+		var replay *replayableEmail
+		if replay, err = newReplayableEmail(email); err != nil {
+			return result, err
+		}
+		plain := withOnlyRecipients(replay.next(), missing)
+		plain.PGPEncrypt = false
+		encrypted := withoutRecipients(replay.next(), missing)
+		if len(encrypted.Recipients)+len(encrypted.RecipientsCc)+len(encrypted.RecipientsBcc) == 0 {
+			return p.Send(ctx, plain)
+		}
+		if result, err = p.Send(ctx, encrypted); err != nil {
+			return result, err
+		}
+		plainResult, plainErr := p.Send(ctx, plain)
+		if plainErr != nil && len(plainResult.Recipients) == 0 {
+			plainResult = newSendResult(result.Provider, plain, RecipientRejected)
+			for i := range plainResult.Recipients {
+				plainResult.Recipients[i].RejectReason = plainErr.Error()
+			}
+		}
+		result.Recipients = append(result.Recipients, plainResult.Recipients...)
+		return result, nil
+	default:
+		return result, permanentError(fmt.Errorf("openpgp recipients %s: %w", strings.Join(missing, ", "), ErrPGPMissingKey))
+	}
+}
+
+// withoutRecipients returns a copy of the email without the given recipients
+func withoutRecipients(email *Email, remove []string) *Email {
+	removed := make(map[string]bool, len(remove))
+	for _, address := range remove {
+		removed[address] = true
+	}
+	return filterRecipients(email, func(address string) bool { return !removed[address] })
+}
+
+// withOnlyRecipients returns a copy of the email with only the given recipients
+func withOnlyRecipients(email *Email, keep []string) *Email {
+	kept := make(map[string]bool, len(keep))
+	for _, address := range keep {
+		kept[address] = true
+	}
+	return filterRecipients(email, func(address string) bool { return kept[address] })
+}
+
+// filterRecipients returns a copy of the email with the to, cc and bcc recipients that pass the filter
+func filterRecipients(email *Email, keep func(address string) bool) *Email {
+	filter := func(addresses []string) (filtered []string) {
+		for _, address := range addresses {
+			if keep(address) {
+				filtered = append(filtered, address)
+			}
+		}
+		return filtered
+	}
+	filtered := *email
+	filtered.Recipients = filter(email.Recipients)
+	filtered.RecipientsCc = filter(email.RecipientsCc)
+	filtered.RecipientsBcc = filter(email.RecipientsBcc)
+	return &filtered
+}
+
+// pgpEnabled returns true if any OpenPGP key is configured
+func (m *MailService) pgpEnabled() bool {
+	return len(m.PGPPrivateKey) > 0 || len(m.PGPPrivateKeyFile) > 0 || len(m.PGPRecipientKeys) > 0
+}
+
+// loadPGPConfig will create the OpenPGP config from the MailService settings (nil if OpenPGP is not configured)
+func (m *MailService) loadPGPConfig() (*pgpConfig, error) {
+	if !m.pgpEnabled() {
+		return nil, nil //nolint:nilnil // openpgp is optional
+	}
+
+	// Load the key from the file if no key is given
+	privateKey := []byte(m.PGPPrivateKey)
+	if len(privateKey) == 0 && len(m.PGPPrivateKeyFile) > 0 {
+		var err error
+		if privateKey, err = os.ReadFile(m.PGPPrivateKeyFile); err != nil {
+			return nil, fmt.Errorf("openpgp private key file: %w", err)
+		}
+	}
+	return newPGPConfig(privateKey, m.PGPPassphrase, m.PGPRecipientKeys, m.PGPMissingKeyPolicy)
+}
@@ -0,0 +1,505 @@
+package gomail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPGPPassphrase protects the test private key
+const testPGPPassphrase = "correct horse battery staple"
+
+// testPGPKeys are the armored test keys
+type testPGPKeys struct {
+	other            *openpgp.Entity
+	protectedPrivate string // sender private key protected with testPGPPassphrase
+	recipient        *openpgp.Entity
+	recipientPublic  string
+	sender           *openpgp.Entity
+	senderPrivate    string
+	senderPublic     string
+}
+
+// testPGPKeysOnce generates the test keys once
+var testPGPKeysOnce = sync.OnceValues(newTestPGPKeys)
+
+// newTestPGPKeys will create the sender and recipient keys (Ed25519 signing and X25519 encryption)
+func newTestPGPKeys() (*testPGPKeys, error) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	keys := new(testPGPKeys)
+	var err error
+	if keys.sender, err = openpgp.NewEntity("No Reply", "", "no-reply@example.com", config); err != nil {
+		return nil, err
+	}
+	if keys.recipient, err = openpgp.NewEntity("Test", "", "test@domain.com", config); err != nil {
+		return nil, err
+	}
+	if keys.other, err = openpgp.NewEntity("Other", "", "other@domain.com", config); err != nil {
+		return nil, err
+	}
+	if keys.senderPrivate, err = testPGPArmor(keys.sender, true); err != nil {
+		return nil, err
+	}
+	if keys.senderPublic, err = testPGPArmor(keys.sender, false); err != nil {
+		return nil, err
+	}
+	if keys.recipientPublic, err = testPGPArmor(keys.recipient, false); err != nil {
+		return nil, err
+	}
+
+	// Protect a copy of the sender key with the passphrase
+	var protected *openpgp.Entity
+	if protected, err = readPGPKey([]byte(keys.senderPrivate)); err != nil {
+		return nil, err
+	}
+	if err = protected.EncryptPrivateKeys([]byte(testPGPPassphrase), nil); err != nil {
+		return nil, err
+	}
+	if keys.protectedPrivate, err = testPGPArmor(protected, true); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// testPGPArmor armors the public or private key
+func testPGPArmor(entity *openpgp.Entity, private bool) (string, error) {
+	var buf bytes.Buffer
+	blockType := openpgp.PublicKeyType
+	if private {
+		blockType = openpgp.PrivateKeyType
+	}
+	writer, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		return "", err
+	}
+	if private {
+		err = entity.SerializePrivateWithoutSigning(writer, nil)
+	} else {
+		err = entity.Serialize(writer)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// testPGP returns the test keys
+func testPGP(t testing.TB) *testPGPKeys {
+	t.Helper()
+	keys, err := testPGPKeysOnce()
+	require.NoError(t, err)
+	return keys
+}
+
+// verifyTestPGP verifies the multipart/signed message with the sender key and returns the signed entity
+func verifyTestPGP(t *testing.T, keys *testPGPKeys, message []byte) []byte {
+	t.Helper()
+
+	_, mediaType, params, body := parseTestMIME(t, message)
+	require.Equal(t, "multipart/signed", mediaType)
+	assert.Equal(t, "application/pgp-signature", params["protocol"])
+	assert.Equal(t, "pgp-sha256", params["micalg"])
+
+	// The signed entity is the raw first part (between the delimiters)
+	delimiter := []byte("--" + params["boundary"] + "\r\n")
+	start := bytes.Index(body, delimiter)
+	require.GreaterOrEqual(t, start, 0)
+	entity := body[start+len(delimiter):]
+	end := bytes.Index(entity, []byte("\r\n--"+params["boundary"]))
+	require.GreaterOrEqual(t, end, 0)
+	entity = entity[:end]
+
+	// The second part is the armored detached signature
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	_, err := reader.NextPart()
+	require.NoError(t, err)
+	part, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "application/pgp-signature; name=\"signature.asc\"", part.Header.Get("Content-Type"))
+	signature, err := io.ReadAll(part)
+	require.NoError(t, err)
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{keys.sender}, bytes.NewReader(entity), bytes.NewReader(signature), nil)
+	require.NoError(t, err)
+	assert.Equal(t, keys.sender.PrimaryKey.KeyId, signer.PrimaryKey.KeyId)
+	return entity
+}
+
+// decryptTestPGP decrypts the multipart/encrypted message with the key and returns the entity
+func decryptTestPGP(t *testing.T, key *openpgp.Entity, message []byte) ([]byte, error) {
+	t.Helper()
+
+	_, mediaType, params, body := parseTestMIME(t, message)
+	require.Equal(t, "multipart/encrypted", mediaType)
+	assert.Equal(t, "application/pgp-encrypted", params["protocol"])
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	part, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "application/pgp-encrypted", part.Header.Get("Content-Type"))
+	version, err := io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, "Version: 1\r\n", string(version))
+
+	part, err = reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "application/octet-stream; name=\"encrypted.asc\"", part.Header.Get("Content-Type"))
+	block, err := armor.Decode(part)
+	require.NoError(t, err)
+	details, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{key}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(details.UnverifiedBody)
+}
+
+// newTestPGPConfig will create the OpenPGP config for the sender with the test recipient key
+func newTestPGPConfig(t *testing.T, keys *testPGPKeys, policy PGPMissingKeyPolicy) *pgpConfig {
+	t.Helper()
+	config, err := newPGPConfig([]byte(keys.senderPrivate), "", map[string]string{
+		"Test <TEST@domain.com>": keys.recipientPublic,
+	}, policy)
+	require.NoError(t, err)
+	return config
+}
+
+// TestNewPGPConfig will test the newPGPConfig() method
+func TestNewPGPConfig(t *testing.T) {
+	t.Parallel()
+
+	keys := testPGP(t)
+
+	tests := []struct {
+		name        string
+		privateKey  string
+		passphrase  string
+		recipients  map[string]string
+		policy      PGPMissingKeyPolicy
+		expectedErr error
+	}{
+		{"signer", keys.senderPrivate, "", nil, PGPMissingKeyFail, nil},
+		{"protected signer", keys.protectedPrivate, testPGPPassphrase, nil, PGPMissingKeyPlain, nil},
+		{"recipients only", "", "", map[string]string{"test@domain.com": keys.recipientPublic}, PGPMissingKeySkip, nil},
+		{"protected signer without passphrase", keys.protectedPrivate, "", nil, PGPMissingKeyFail, ErrInvalidPGPKey},
+		{"protected signer wrong passphrase", keys.protectedPrivate, "wrong", nil, PGPMissingKeyFail, ErrInvalidPGPKey},
+		{"public key as signer", keys.senderPublic, "", nil, PGPMissingKeyFail, ErrInvalidPGPKey},
+		{"invalid signer", "invalid", "", nil, PGPMissingKeyFail, ErrInvalidPGPKey},
+		{"invalid recipient", "", "", map[string]string{"test@domain.com": "invalid"}, PGPMissingKeyFail, ErrInvalidPGPKey},
+		{"invalid policy", keys.senderPrivate, "", nil, PGPMissingKeyPolicy(99), ErrInvalidPGPConfig},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := newPGPConfig([]byte(test.privateKey), test.passphrase, test.recipients, test.policy)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.policy, config.policy)
+			assert.Len(t, config.recipients, len(test.recipients))
+			assert.Equal(t, len(test.privateKey) > 0, config.signer != nil)
+		})
+	}
+
+	assert.Equal(t, "plain", PGPMissingKeyPlain.String())
+	assert.Equal(t, "PGPMissingKeyPolicy(99)", PGPMissingKeyPolicy(99).String())
+}
+
+// TestPGP_RoundTrip will test signed and encrypted messages can be verified and decrypted
+func TestPGP_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	keys := testPGP(t)
+	config := newTestPGPConfig(t, keys, PGPMissingKeyFail)
+
+	newEmail := func(sign, encrypt bool) *Email {
+		return &Email{
+			FromAddress:      "no-reply@example.com",
+			FromName:         "No Reply",
+			HTMLContent:      "<html>Secret content</html>",
+			PGPEncrypt:       encrypt,
+			PGPSign:          sign,
+			PlainTextContent: "Secret content",
+			Recipients:       []string{"test@domain.com"},
+			Subject:          "Signed and sealed",
+		}
+	}
+
+	t.Run("signed via smtp", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		_, err := sendViaSMTP(context.Background(), newSMTPDialer(server.addr, nil, SMTPTLSNone, nil), &messageSecurity{pgp: config}, newEmail(true, false))
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		header, _, _, _ := parseTestMIME(t, []byte(messages[0].data))
+		assert.Equal(t, "Signed and sealed", header.Get("Subject"))
+
+		entity := verifyTestPGP(t, keys, []byte(messages[0].data))
+		assert.True(t, bytes.HasPrefix(entity, []byte("Content-Type: multipart/mixed;\r\n\tboundary=")))
+		assert.Contains(t, string(entity), "Secret content")
+	})
+
+	t.Run("tampered message fails verification", func(t *testing.T) {
+		raw, err := awsSesRawMessage(newEmail(true, false), true, &messageSecurity{pgp: config})
+		require.NoError(t, err)
+		_, _, params, body := parseTestMIME(t, raw)
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		_, err = reader.NextPart()
+		require.NoError(t, err)
+		part, err := reader.NextPart()
+		require.NoError(t, err)
+		signature, err := io.ReadAll(part)
+		require.NoError(t, err)
+
+		_, entity := splitMIMEEntity(raw)
+		tampered := bytes.Replace(entity, []byte("Secret content"), []byte("Secret c0ntent"), 1)
+		_, err = openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{keys.sender}, bytes.NewReader(tampered), bytes.NewReader(signature), nil)
+		require.Error(t, err)
+	})
+
+	t.Run("encrypted via aws ses", func(t *testing.T) {
+		raw, err := awsSesRawMessage(newEmail(false, true), true, &messageSecurity{pgp: config})
+		require.NoError(t, err)
+		assert.NotContains(t, string(raw), "Secret content")
+
+		// The recipient and the sender can decrypt, another key cannot
+		entity, err := decryptTestPGP(t, keys.recipient, raw)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(entity, []byte("Content-Type: multipart/mixed;")))
+		assert.Contains(t, string(entity), "Secret content")
+		_, err = decryptTestPGP(t, keys.sender, raw)
+		require.NoError(t, err)
+		_, err = decryptTestPGP(t, keys.other, raw)
+		require.Error(t, err)
+	})
+
+	t.Run("signed then encrypted", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		_, err := sendViaSMTP(context.Background(), newSMTPDialer(server.addr, nil, SMTPTLSNone, nil), &messageSecurity{pgp: config}, newEmail(true, true))
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		entity, err := decryptTestPGP(t, keys.recipient, []byte(messages[0].data))
+		require.NoError(t, err)
+		assert.Contains(t, string(verifyTestPGP(t, keys, entity)), "Secret content")
+	})
+
+	t.Run("dkim signs the secured message", func(t *testing.T) {
+		signer, err := newDKIMSigner("football.example.com", "brisbane", testDKIMEd25519PrivateKey(t), nil)
+		require.NoError(t, err)
+		raw, err := awsSesRawMessage(newEmail(true, true), false, &messageSecurity{dkim: signer, pgp: config})
+		require.NoError(t, err)
+		verifyTestDKIM(t, raw)
+		_, err = decryptTestPGP(t, keys.recipient, raw)
+		require.NoError(t, err)
+	})
+
+	t.Run("recipient without a key", func(t *testing.T) {
+		email := newEmail(false, true)
+		email.RecipientsCc = []string{"other@domain.com"}
+		_, err := awsSesRawMessage(email, true, &messageSecurity{pgp: config})
+		require.ErrorIs(t, err, ErrPGPMissingKey)
+		assert.Contains(t, err.Error(), "other@domain.com")
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		_, err := awsSesRawMessage(newEmail(true, false), true, nil)
+		require.ErrorIs(t, err, ErrPGPNotConfigured)
+
+		// Encryption only config cannot sign
+		encryptOnly, err := newPGPConfig(nil, "", map[string]string{"test@domain.com": keys.recipientPublic}, PGPMissingKeyFail)
+		require.NoError(t, err)
+		_, err = awsSesRawMessage(newEmail(true, false), true, &messageSecurity{pgp: encryptOnly})
+		require.ErrorIs(t, err, ErrPGPNotConfigured)
+		raw, err := awsSesRawMessage(newEmail(false, true), true, &messageSecurity{pgp: encryptOnly})
+		require.NoError(t, err)
+		_, err = decryptTestPGP(t, keys.recipient, raw)
+		require.NoError(t, err)
+	})
+}
+
+// TestMailService_PGPMissingKeyPolicy will test the missing key policies when sending via SMTP
+func TestMailService_PGPMissingKeyPolicy(t *testing.T) {
+	t.Parallel()
+
+	keys := testPGP(t)
+
+	// newService starts a mail service for a new test server with the policy
+	newService := func(t *testing.T, policy PGPMissingKeyPolicy) (*MailService, *testSMTPServer) {
+		server := newTestSMTPServer(t)
+		mail := newTestSMTPMailService(t, server)
+		mail.PGPPrivateKey = keys.protectedPrivate
+		mail.PGPPassphrase = testPGPPassphrase
+		mail.PGPRecipientKeys = map[string]string{"test@domain.com": keys.recipientPublic}
+		mail.PGPMissingKeyPolicy = policy
+		require.NoError(t, mail.StartUp())
+		t.Cleanup(func() {
+			_ = mail.Close()
+		})
+		return mail, server
+	}
+
+	// newEmail creates a signed and encrypted email for a recipient with a key and one without
+	newEmail := func(mail *MailService) *Email {
+		email := newTestSMTPEmail(mail)
+		email.RecipientsCc = []string{"other@domain.com"}
+		email.PGPSign = true
+		email.PGPEncrypt = true
+		email.AddAttachment("report.txt", "text/plain", strings.NewReader("Quarterly report"))
+		return email
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		mail, server := newService(t, PGPMissingKeyFail)
+		err := mail.SendEmail(context.Background(), newEmail(mail), SMTP)
+		require.ErrorIs(t, err, ErrPGPMissingKey)
+		assert.True(t, IsPermanent(err))
+		assert.Contains(t, err.Error(), "other@domain.com")
+		assert.Empty(t, server.messages())
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		mail, server := newService(t, PGPMissingKeyPlain)
+		result, err := mail.SendEmailWithResult(context.Background(), newEmail(mail), SMTP)
+		require.NoError(t, err)
+		assert.Equal(t, SMTP, result.Provider)
+		require.Len(t, result.Recipients, 2)
+
+		messages := server.messages()
+		require.Len(t, messages, 2)
+
+		// The recipient with a key gets the encrypted message
+		assert.Equal(t, []string{"test@domain.com"}, messages[0].to)
+		entity, err := decryptTestPGP(t, keys.recipient, []byte(messages[0].data))
+		require.NoError(t, err)
+		signed := verifyTestPGP(t, keys, entity)
+		assert.Contains(t, string(signed), "report.txt")
+
+		// The recipient without a key gets a signed copy
+		assert.Equal(t, []string{"other@domain.com"}, messages[1].to)
+		signed = verifyTestPGP(t, keys, []byte(messages[1].data))
+		assert.Contains(t, string(signed), "Test email content")
+		assert.Contains(t, string(signed), "report.txt")
+		assert.NotContains(t, messages[1].data, "test@domain.com")
+	})
+
+	t.Run("plain copy fails after the encrypted copy was sent", func(t *testing.T) {
+		mail, server := newService(t, PGPMissingKeyPlain)
+		mail.RetryPolicy = &RetryPolicy{InitialBackoff: time.Millisecond, MaxAttempts: 3}
+		email := newEmail(mail)
+		email.RecipientsCc = []string{"reject@domain.com"}
+		result, err := mail.SendEmailWithResult(context.Background(), email, SMTP)
+		require.NoError(t, err)
+
+		// The encrypted copy is not sent again
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, []string{"test@domain.com"}, messages[0].to)
+
+		require.Len(t, result.Recipients, 2)
+		assert.Equal(t, RecipientAccepted, result.Recipients[0].Status)
+		assert.Equal(t, "reject@domain.com", result.Recipients[1].Email)
+		assert.Equal(t, RecipientRejected, result.Recipients[1].Status)
+		assert.Contains(t, result.Recipients[1].RejectReason, "No such user")
+	})
+
+	t.Run("plain without any key", func(t *testing.T) {
+		mail, server := newService(t, PGPMissingKeyPlain)
+		email := newEmail(mail)
+		email.Recipients = []string{"another@domain.com"}
+		require.NoError(t, mail.SendEmail(context.Background(), email, SMTP))
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		verifyTestPGP(t, keys, []byte(messages[0].data))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		mail, server := newService(t, PGPMissingKeySkip)
+		result, err := mail.SendEmailWithResult(context.Background(), newEmail(mail), SMTP)
+		require.NoError(t, err)
+		require.Len(t, result.Recipients, 2)
+		assert.Equal(t, RecipientResult{Email: "test@domain.com", Status: RecipientAccepted}, result.Recipients[0])
+		assert.Equal(t, RecipientResult{Email: "other@domain.com", RejectReason: pgpMissingKeyReason, Status: RecipientRejected}, result.Recipients[1])
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, []string{"test@domain.com"}, messages[0].to)
+		_, err = decryptTestPGP(t, keys.recipient, []byte(messages[0].data))
+		require.NoError(t, err)
+	})
+
+	t.Run("skip every recipient", func(t *testing.T) {
+		mail, server := newService(t, PGPMissingKeySkip)
+		email := newEmail(mail)
+		email.Recipients = []string{"another@domain.com"}
+		require.ErrorIs(t, mail.SendEmail(context.Background(), email, SMTP), ErrPGPMissingKey)
+		assert.Empty(t, server.messages())
+	})
+
+	t.Run("smime and openpgp cannot be combined", func(t *testing.T) {
+		mail, _ := newService(t, PGPMissingKeyFail)
+		email := newEmail(mail)
+		email.SMIMESign = true
+		require.ErrorIs(t, mail.SendEmail(context.Background(), email, SMTP), ErrSMIMEAndPGP)
+	})
+
+	t.Run("providers without openpgp are refused", func(t *testing.T) {
+		mail, _ := newService(t, PGPMissingKeyFail)
+		provider := &mockCustomProvider{}
+		require.NoError(t, mail.RegisterProvider(testRelayProvider, provider))
+		err := mail.SendEmail(context.Background(), newEmail(mail), testRelayProvider)
+		require.ErrorIs(t, err, ErrPGPNotSupported)
+		assert.Empty(t, provider.sent)
+	})
+}
+
+// TestMailService_loadPGPConfig will test loading OpenPGP from the MailService
+func TestMailService_loadPGPConfig(t *testing.T) {
+	t.Parallel()
+
+	keys := testPGP(t)
+	keyFile := filepath.Join(t.TempDir(), "sender.asc")
+	require.NoError(t, os.WriteFile(keyFile, []byte(keys.senderPrivate), 0o600))
+
+	t.Run("not configured", func(t *testing.T) {
+		config, err := (&MailService{}).loadPGPConfig()
+		require.NoError(t, err)
+		assert.Nil(t, config)
+	})
+
+	t.Run("key file", func(t *testing.T) {
+		config, err := (&MailService{PGPPrivateKeyFile: keyFile}).loadPGPConfig()
+		require.NoError(t, err)
+		assert.Equal(t, keys.sender.PrimaryKey.KeyId, config.signer.PrimaryKey.KeyId)
+	})
+
+	t.Run("missing key file", func(t *testing.T) {
+		_, err := (&MailService{PGPPrivateKeyFile: keyFile + ".missing"}).loadPGPConfig()
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("startup fails with an invalid key", func(t *testing.T) {
+		mail := newTestSMTPMailService(t, newTestSMTPServer(t))
+		mail.PGPRecipientKeys = map[string]string{"test@domain.com": "invalid"}
+		require.ErrorIs(t, mail.StartUp(), ErrInvalidPGPKey)
+	})
+}
@@ -1,24 +1,55 @@
 package gomail
 
 import (
-	"bufio"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"net/http"
 	"strings"
 
 	"github.com/mrz1836/postmark"
 )
 
+// postmarkErrorMaintenance is the Postmark error code returned while the api is offline for maintenance
+const postmarkErrorMaintenance = 100
+
 // postmarkInterface is an interface for Postmark/mocking
 type postmarkInterface interface {
 	SendEmail(ctx context.Context, email postmark.Email) (postmark.EmailResponse, error)
 }
 
+// postmarkProvider is the Postmark provider
+type postmarkProvider struct {
+	client postmarkInterface
+}
+
+// Name returns the name of the provider
+func (p *postmarkProvider) Name() string {
+	return "postmark"
+}
+
+// Capabilities returns the features supported by Postmark
+func (p *postmarkProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Attachments: true,
+		Bcc:         true,
+		Cc:          true,
+		Importance:  true,
+		Tags:        true,
+		TrackClicks: true,
+		TrackOpens:  true,
+	}
+}
+
+// Send sends the email using Postmark
+func (p *postmarkProvider) Send(ctx context.Context, email *Email) (SendResult, error) {
+	return sendViaPostmark(ctx, p.client, email)
+}
+
 // sendViaPostmark sends an email using the Postmark service
-func sendViaPostmark(ctx context.Context, client postmarkInterface, email *Email) (err error) {
+func sendViaPostmark(ctx context.Context, client postmarkInterface, email *Email) (result SendResult, err error) {
 	// Create the email struct
 	postmarkEmail := postmark.Email{
 		From:       email.FromAddress,
@@ -39,6 +70,9 @@ func sendViaPostmark(ctx context.Context, client postmarkInterface, email *Email
 	if email.AutoText {
 		log.Printf("warning: auto text is enabled, but Postmark does not offer this feature")
 	}
+	if len(email.ReturnPath) > 0 || email.VERP || email.DSN != nil {
+		log.Printf("warning: a return path, VERP or DSN is set, but Postmark uses the return path of the sending domain")
+	}
 
 	// Set the "from" name if given
 	if len(email.FromName) > 0 {
@@ -71,10 +105,9 @@ func sendViaPostmark(ctx context.Context, client postmarkInterface, email *Email
 		}
 
 		// Read all content from the attachment
-		reader := bufio.NewReader(attachment.FileReader)
 		var content []byte
-		if content, err = io.ReadAll(reader); err != nil {
-			return err
+		if content, err = attachment.Bytes(); err != nil {
+			return result, err
 		}
 
 		// Encode as base64
@@ -97,13 +130,63 @@ func sendViaPostmark(ctx context.Context, client postmarkInterface, email *Email
 	// Send the email
 	var resp postmark.EmailResponse
 	if resp, err = client.SendEmail(ctx, postmarkEmail); err != nil {
-		return err
+		return result, classifyPostmarkError(err)
 	}
 
 	// Check the response from Postmark
 	if resp.ErrorCode > 0 {
 		err = fmt.Errorf("error from postmark: %s error code: %d: %w", resp.Message, resp.ErrorCode, ErrPostmarkError)
+		return result, classifyPostmarkErrorCode(resp.ErrorCode, err)
+	}
+
+	// Build the result from the response
+	result = newSendResult(Postmark, email, RecipientAccepted)
+	result.MessageID = resp.MessageID
+	result.RawResponse = resp
+	if !resp.SubmittedAt.IsZero() {
+		result.SubmittedAt = resp.SubmittedAt.UTC()
 	}
 
-	return err
+	return result, nil
+}
+
+// classifyPostmarkError classifies an error returned by the Postmark client
+func classifyPostmarkError(err error) error {
+	// Api error with a Postmark error code
+	var apiErr postmark.APIError
+	if errors.As(err, &apiErr) {
+		return classifyPostmarkErrorCode(apiErr.ErrorCode, err)
+	}
+
+	// Error code returned in a successful response (ie: "email send failed: 406 ...")
+	if errors.Is(err, postmark.ErrEmailFailed) {
+		var code int64
+		message := strings.TrimPrefix(err.Error(), postmark.ErrEmailFailed.Error()+": ")
+		if _, scanErr := fmt.Sscanf(message, "%d", &code); scanErr == nil {
+			return classifyPostmarkErrorCode(code, err)
+		}
+		return permanentError(err)
+	}
+
+	// Non-JSON error response (ie: "request failed with status 503: ...")
+	var status int
+	if _, scanErr := fmt.Sscanf(err.Error(), "request failed with status %d", &status); scanErr == nil {
+		if status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+			return transientError(err)
+		}
+		return permanentError(err)
+	}
+
+	return classifyError(err)
+}
+
+// classifyPostmarkErrorCode classifies the error by its Postmark error code
+// See: https://postmarkapp.com/developer/api/overview#error-codes
+func classifyPostmarkErrorCode(code int64, err error) error {
+	switch code {
+	case postmarkErrorMaintenance, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable:
+		return transientError(err)
+	default:
+		return permanentError(err)
+	}
 }
@@ -19,7 +19,10 @@ type mockPostmarkInterface struct{}
 func (m *mockPostmarkInterface) SendEmail(_ context.Context, email postmark.Email) (postmark.EmailResponse, error) {
 	// Success
 	if email.To == "test@domain.com" {
-		return *new(postmark.EmailResponse), nil
+		return postmark.EmailResponse{
+			To:        email.To,
+			MessageID: "b7bc2f4a-e38e-4336-af7d-e6c392c2f817",
+		}, nil
 	}
 
 	// Invalid domain name
@@ -100,12 +103,45 @@ func TestSendViaPostmark(t *testing.T) {
 			email.RecipientsCc = []string{test.input}
 			email.RecipientsBcc = []string{test.input}
 			email.ReplyToAddress = test.input
-			err := sendViaPostmark(context.Background(), client, email)
+			result, err := sendViaPostmark(context.Background(), client, email)
 			if test.expectedError {
 				assert.Error(t, err)
 			} else {
-				assert.NoError(t, err)
+				require.NoError(t, err)
+				assert.Equal(t, Postmark, result.Provider)
+				assert.Equal(t, "b7bc2f4a-e38e-4336-af7d-e6c392c2f817", result.MessageID)
+				assert.Len(t, result.Recipients, 3)
+				assert.IsType(t, postmark.EmailResponse{}, result.RawResponse)
 			}
 		})
 	}
 }
+
+// TestClassifyPostmarkError will test the classifyPostmarkError() method
+func TestClassifyPostmarkError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"api maintenance", postmark.APIError{ErrorCode: 100, Message: "Maintenance"}, true},
+		{"api rate limit", postmark.APIError{ErrorCode: http.StatusTooManyRequests, Message: "Rate limit exceeded"}, true},
+		{"api invalid token", postmark.APIError{ErrorCode: 10, Message: "Bad or missing API token"}, false},
+		{"response inactive recipient", fmt.Errorf("%w: 406 You tried to send to a recipient that has been marked as inactive", postmark.ErrEmailFailed), false},
+		{"response maintenance", fmt.Errorf("%w: 100 Maintenance", postmark.ErrEmailFailed), true},
+		{"response without code", fmt.Errorf("%w: unknown", postmark.ErrEmailFailed), false},
+		{"non-json server error", fmt.Errorf("request failed with status 503: %w", ErrPostmarkError), true},
+		{"non-json client error", fmt.Errorf("request failed with status 404: %w", ErrPostmarkError), false},
+		{"unknown error", ErrPostmarkFromError, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := classifyPostmarkError(test.err)
+			require.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.transient, IsTransient(err))
+		})
+	}
+}
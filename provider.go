@@ -0,0 +1,78 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CustomProvider is the first ServiceProvider id reserved for custom providers
+//
+// Built-in providers will never use an id at or above this value, ie:
+//
+//	const MyRelay = gomail.CustomProvider + 1
+const CustomProvider ServiceProvider = 1000
+
+// Provider is an email service provider that can send an email
+//
+// Built-in providers are registered by StartUp, custom providers can be added with RegisterProvider()
+type Provider interface {
+	Capabilities() Capabilities
+	Name() string
+	Send(ctx context.Context, email *Email) (SendResult, error)
+}
+
+// Capabilities are the email features supported by a provider
+type Capabilities struct {
+	Attachments     bool `json:"attachments" mapstructure:"attachments"`             // supports file attachments
+	AutoText        bool `json:"auto_text" mapstructure:"auto_text"`                 // can generate a text part from the html
+	Bcc             bool `json:"bcc" mapstructure:"bcc"`                             // supports BCC recipients
+	Cc              bool `json:"cc" mapstructure:"cc"`                               // supports CC recipients
+	Importance      bool `json:"importance" mapstructure:"importance"`               // supports marking a message as important
+	OpenPGP         bool `json:"open_pgp" mapstructure:"open_pgp"`                   // supports OpenPGP/MIME signing and encryption
+	ReturnPath      bool `json:"return_path" mapstructure:"return_path"`             // supports a return path (envelope sender) for bounces
+	Scheduling      bool `json:"scheduling" mapstructure:"scheduling"`               // schedules messages for SendAt itself (others use the outbox)
+	SMIME           bool `json:"smime" mapstructure:"smime"`                         // supports S/MIME signing and encryption
+	Tags            bool `json:"tags" mapstructure:"tags"`                           // supports tagging messages
+	TrackClicks     bool `json:"track_clicks" mapstructure:"track_clicks"`           // supports click tracking
+	TrackOpens      bool `json:"track_opens" mapstructure:"track_opens"`             // supports open tracking
+	ViewContentLink bool `json:"view_content_link" mapstructure:"view_content_link"` // supports a view content link
+}
+
+// RegisterProvider adds (or replaces) the provider for the given id and makes it available for sending
+func (m *MailService) RegisterProvider(id ServiceProvider, provider Provider) error {
+	if provider == nil {
+		return fmt.Errorf("service provider: %x: %w", id, ErrNilProvider)
+	}
+
+	if m.providers == nil {
+		m.providers = make(map[ServiceProvider]Provider)
+	}
+	m.providers[id] = provider
+
+	// Add to the list of available providers
+	if !containsServiceProvider(m.AvailableProviders, id) {
+		m.AvailableProviders = append(m.AvailableProviders, id)
+	}
+	return nil
+}
+
+// Close releases the resources held by the providers (ie: pooled SMTP connections)
+func (m *MailService) Close() error {
+	var errs []error
+	for _, provider := range m.providers {
+		if closer, ok := provider.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LookupProvider returns the provider registered for the given id
+func (m *MailService) LookupProvider(id ServiceProvider) (Provider, bool) {
+	provider, ok := m.providers[id]
+	return provider, ok
+}
@@ -0,0 +1,151 @@
+package gomail
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRelayProvider is a custom provider used for testing the registry
+const testRelayProvider = CustomProvider + 1
+
+// mockCustomProvider is a custom provider for testing
+type mockCustomProvider struct {
+	err  error
+	sent []*Email
+}
+
+// Name returns the name of the provider
+func (p *mockCustomProvider) Name() string {
+	return "in_house_relay"
+}
+
+// Capabilities returns the features supported by the provider
+func (p *mockCustomProvider) Capabilities() Capabilities {
+	return Capabilities{Attachments: true}
+}
+
+// Send records the email
+func (p *mockCustomProvider) Send(_ context.Context, email *Email) (SendResult, error) {
+	if p.err != nil {
+		return SendResult{}, p.err
+	}
+	p.sent = append(p.sent, email)
+	return SendResult{MessageID: fmt.Sprintf("relay-%d", len(p.sent))}, nil
+}
+
+// TestMailService_RegisterProvider tests the method RegisterProvider()
+func TestMailService_RegisterProvider(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil provider", func(t *testing.T) {
+		mail := new(MailService)
+		err := mail.RegisterProvider(testRelayProvider, nil)
+		require.ErrorIs(t, err, ErrNilProvider)
+		assert.Empty(t, mail.AvailableProviders)
+	})
+
+	t.Run("register and lookup", func(t *testing.T) {
+		mail := new(MailService)
+		relay := &mockCustomProvider{}
+		require.NoError(t, mail.RegisterProvider(testRelayProvider, relay))
+		require.NoError(t, mail.RegisterProvider(testRelayProvider, relay))
+		assert.Equal(t, []ServiceProvider{testRelayProvider}, mail.AvailableProviders)
+
+		provider, ok := mail.LookupProvider(testRelayProvider)
+		require.True(t, ok)
+		assert.Equal(t, "in_house_relay", provider.Name())
+		assert.True(t, provider.Capabilities().Attachments)
+
+		_, ok = mail.LookupProvider(SMTP)
+		assert.False(t, ok)
+	})
+
+	t.Run("custom provider sends without built-in providers", func(t *testing.T) {
+		mail := new(MailService)
+		mail.FromUsername = testUsernameEmail
+		mail.FromDomain = testDomainEmail
+		relay := &mockCustomProvider{}
+		require.NoError(t, mail.RegisterProvider(testRelayProvider, relay))
+
+		// StartUp finds the custom provider
+		require.NoError(t, mail.StartUp())
+
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@domain.com"}
+
+		result, err := mail.SendEmailWithResult(context.Background(), email, testRelayProvider)
+		require.NoError(t, err)
+		assert.Equal(t, testRelayProvider, result.Provider)
+		assert.Equal(t, "relay-1", result.MessageID)
+		require.Len(t, relay.sent, 1)
+	})
+
+	t.Run("custom provider errors are classified", func(t *testing.T) {
+		mail := new(MailService)
+		mail.FromUsername = testUsernameEmail
+		mail.FromDomain = testDomainEmail
+		require.NoError(t, mail.RegisterProvider(testRelayProvider, &mockCustomProvider{err: ErrBadHostname}))
+		require.NoError(t, mail.StartUp())
+
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@domain.com"}
+
+		err := mail.SendEmail(context.Background(), email, testRelayProvider)
+		require.ErrorIs(t, err, ErrBadHostname)
+		require.ErrorIs(t, err, ErrPermanent)
+	})
+}
+
+// TestBuiltInProviders will test the names and capabilities of the built-in providers
+func TestBuiltInProviders(t *testing.T) {
+	t.Parallel()
+
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromDomain = testDomainEmail
+	mail.AwsSesAccessID = "1234567"
+	mail.AwsSesSecretKey = "1234567"
+	mail.AwsSesEnableV2 = true
+	mail.MandrillAPIKey = "1234567"
+	mail.PostmarkServerToken = "1234567"
+	mail.SendGridAPIKey = "1234567"
+	mail.MailgunAPIKey = "1234567"
+	mail.MailgunDomain = "mg.example.com"
+	mail.SMTPHost = testDomainEmail
+	mail.SMTPUsername = "fake"
+	mail.SMTPPassword = "fake"
+	require.NoError(t, mail.StartUp())
+
+	tests := []struct {
+		id          ServiceProvider
+		name        string
+		trackOpens  bool
+		attachments bool
+	}{
+		{AwsSes, "aws_ses", false, true},
+		{Mandrill, "mandrill", true, true},
+		{Postmark, "postmark", true, true},
+		{SMTP, "smtp", false, true},
+		{SendGrid, "sendgrid", true, true},
+		{Mailgun, "mailgun", true, true},
+		{AwsSesV2, "aws_ses_v2", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider, ok := mail.LookupProvider(test.id)
+			require.True(t, ok)
+			assert.Equal(t, test.name, provider.Name())
+			assert.Equal(t, test.trackOpens, provider.Capabilities().TrackOpens)
+			assert.Equal(t, test.attachments, provider.Capabilities().Attachments)
+		})
+	}
+}
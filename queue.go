@@ -0,0 +1,373 @@
+package gomail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOutboxRetention is how long the queues keep the jobs that are done (sent, failed or canceled)
+const DefaultOutboxRetention = 24 * time.Hour
+
+// OutboxStatus is the status of a job in the outbox
+type OutboxStatus string
+
+// Outbox job statuses
+const (
+	OutboxPending  OutboxStatus = "pending"  // Waiting to be sent (new or waiting for a retry)
+	OutboxRunning  OutboxStatus = "running"  // A worker is sending the email
+	OutboxSent     OutboxStatus = "sent"     // The email was sent (see Result)
+	OutboxFailed   OutboxStatus = "failed"   // The email could not be sent (see Error)
+	OutboxCanceled OutboxStatus = "canceled" // The job was canceled before it was sent
+)
+
+// OutboxJob is an email in the outbox with its send status
+//
+// DO NOT CHANGE ORDER - Optimized for memory (maligned)
+type OutboxJob struct {
+	CreatedAt     time.Time         `json:"created_at" mapstructure:"created_at"`           // when the email was enqueued
+	NextAttemptAt time.Time         `json:"next_attempt_at" mapstructure:"next_attempt_at"` // pending jobs are not sent before this time
+	UpdatedAt     time.Time         `json:"updated_at" mapstructure:"updated_at"`           // last status change
+	Providers     []ServiceProvider `json:"providers" mapstructure:"providers"`             // providers to try in order (empty is the failover default)
+	Email         *Email            `json:"email" mapstructure:"email"`                     // email to send
+	Result        *SendResult       `json:"result" mapstructure:"result"`                   // result of the last attempt (if the provider returned one)
+	Error         string            `json:"error" mapstructure:"error"`                     // error of the last attempt
+	ID            string            `json:"id" mapstructure:"id"`                           // unique job id
+	Status        OutboxStatus      `json:"status" mapstructure:"status"`                   // send status
+	Attempts      int               `json:"attempts" mapstructure:"attempts"`               // attempts made so far
+	MaxAttempts   int               `json:"max_attempts" mapstructure:"max_attempts"`       // attempts before the job fails
+}
+
+// done returns true if the job will not be sent again
+func (j *OutboxJob) done() bool {
+	return j.Status == OutboxSent || j.Status == OutboxFailed || j.Status == OutboxCanceled
+}
+
+// clone returns a copy of the job that shares no slices with it (attachment readers are shared)
+func (j *OutboxJob) clone() *OutboxJob {
+	clone := *j
+	clone.Providers = slices.Clone(j.Providers)
+	if j.Email != nil {
+		clone.Email = j.Email.clone()
+	}
+	if j.Result != nil {
+		result := *j.Result
+		result.Recipients = slices.Clone(j.Result.Recipients)
+		clone.Result = &result
+	}
+	return &clone
+}
+
+// Queue stores the outbox jobs
+//
+// Pop hands each pending job to a single worker, implementations must be safe for concurrent use
+type Queue interface {
+	Cancel(ctx context.Context, id string) error // set a pending job to canceled
+	Get(ctx context.Context, id string) (*OutboxJob, error)
+	List(ctx context.Context) ([]*OutboxJob, error) // jobs that are pending or running, in the order they were pushed
+	Pop(ctx context.Context) (*OutboxJob, error)    // next pending job that is due (set to running), nil if there is none
+	Push(ctx context.Context, job *OutboxJob) error
+	Update(ctx context.Context, job *OutboxJob) error
+}
+
+// MemoryQueue is a Queue kept in memory (jobs are lost when the process exits)
+//
+// Jobs that are done are kept for the Retention, so Get returns their final status,
+// then they are removed by Pop.
+type MemoryQueue struct {
+	Retention time.Duration // how long jobs that are done are kept (DefaultOutboxRetention, 0 removes them on the next Pop)
+	done      []doneJob     // jobs that are done, with the time they were done
+	jobs      map[string]*OutboxJob
+	pending   []string // ids of the jobs that are not done, in the order they were pushed
+	mu        sync.Mutex
+}
+
+// doneJob is the id of a job that is done and when it was done (its last update)
+type doneJob struct {
+	at time.Time
+	id string
+}
+
+// NewMemoryQueue returns an empty in-memory queue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{jobs: make(map[string]*OutboxJob), Retention: DefaultOutboxRetention}
+}
+
+// Cancel will set the pending job to canceled, so it is never sent
+func (q *MemoryQueue) Cancel(_ context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("outbox job %s: %w", id, ErrOutboxJobNotFound)
+	} else if job.Status != OutboxPending {
+		return fmt.Errorf("outbox job %s is %s: %w", id, job.Status, ErrOutboxJobNotPending)
+	}
+	canceled := *job
+	canceled.Status = OutboxCanceled
+	canceled.UpdatedAt = time.Now().UTC()
+	q.store(&canceled)
+	return nil
+}
+
+// Get will return a copy of the job
+func (q *MemoryQueue) Get(_ context.Context, id string) (*OutboxJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("outbox job %s: %w", id, ErrOutboxJobNotFound)
+	}
+	return job.clone(), nil
+}
+
+// List will return a copy of the jobs that are pending or running, in the order they were pushed
+func (q *MemoryQueue) List(_ context.Context) ([]*OutboxJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]*OutboxJob, 0, len(q.pending))
+	for _, id := range q.pending {
+		jobs = append(jobs, q.jobs[id].clone())
+	}
+	return jobs, nil
+}
+
+// Pop will return the pending job that is due first (oldest first) and set it to running,
+// jobs that are done for longer than the Retention are removed
+func (q *MemoryQueue) Pop(_ context.Context) (*OutboxJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	q.prune(now.Add(-q.Retention))
+	return q.pop(now), nil
+}
+
+// pop returns the pending job that is due first and sets it to running (nil if there is none)
+func (q *MemoryQueue) pop(now time.Time) *OutboxJob {
+	var next *OutboxJob
+	for _, id := range q.pending {
+		job := q.jobs[id]
+		if job.Status != OutboxPending || job.NextAttemptAt.After(now) {
+			continue
+		}
+		if next == nil || job.NextAttemptAt.Before(next.NextAttemptAt) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	next.Status = OutboxRunning
+	next.UpdatedAt = now.UTC()
+	return next.clone()
+}
+
+// prune removes the jobs that were done before the time and returns their ids
+func (q *MemoryQueue) prune(before time.Time) []string {
+	var removed []string
+	kept := q.done[:0]
+	for _, done := range q.done {
+		if done.at.After(before) {
+			kept = append(kept, done)
+			continue
+		}
+		delete(q.jobs, done.id)
+		removed = append(removed, done.id)
+	}
+	q.done = kept
+	return removed
+}
+
+// Push will add a new job
+func (q *MemoryQueue) Push(_ context.Context, job *OutboxJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.jobs[job.ID]; ok {
+		return fmt.Errorf("outbox job %s: %w", job.ID, ErrOutboxJobExists)
+	}
+	q.store(job)
+	return nil
+}
+
+// Update will replace the job (jobs that are done are no longer considered by Pop)
+func (q *MemoryQueue) Update(_ context.Context, job *OutboxJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.jobs[job.ID]; !ok {
+		return fmt.Errorf("outbox job %s: %w", job.ID, ErrOutboxJobNotFound)
+	}
+	q.store(job)
+	return nil
+}
+
+// store saves a copy of the job and keeps the pending ids in order
+func (q *MemoryQueue) store(job *OutboxJob) {
+	previous, exists := q.jobs[job.ID]
+	q.jobs[job.ID] = job.clone()
+	if !exists && !job.done() {
+		q.pending = append(q.pending, job.ID)
+	} else if exists && job.done() && !previous.done() {
+		for i, id := range q.pending {
+			if id == job.ID {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				break
+			}
+		}
+	}
+	if job.done() && (!exists || !previous.done()) {
+		at := job.UpdatedAt
+		if at.IsZero() {
+			at = time.Now()
+		}
+		q.done = append(q.done, doneJob{at: at, id: job.ID})
+	}
+}
+
+// DiskQueue is a Queue saved as one JSON file per job in a directory
+//
+// The jobs are loaded once and every change rewrites the job file, so pending jobs
+// survive a restart (jobs that were running when the process stopped are sent again).
+// Jobs that are done are kept for the Retention after their last update (also across restarts),
+// then Pop removes them and their files.
+type DiskQueue struct {
+	Retention time.Duration // how long jobs that are done are kept (DefaultOutboxRetention, 0 removes them on the next Pop)
+	memory    *MemoryQueue
+	dir       string
+	mu        sync.Mutex
+}
+
+// diskQueueExtension is the extension of the job files
+const diskQueueExtension = ".json"
+
+// NewDiskQueue loads the jobs from the directory (created if it does not exist)
+func NewDiskQueue(dir string) (*DiskQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox directory: %w", err)
+	}
+
+	jobs := make([]*OutboxJob, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), diskQueueExtension) {
+			continue
+		}
+		var contents []byte
+		if contents, err = os.ReadFile(filepath.Join(dir, entry.Name())); err != nil { //nolint:gosec // dir is set by the application
+			return nil, fmt.Errorf("failed to read outbox job: %w", err)
+		}
+		job := new(OutboxJob)
+		if err = json.Unmarshal(contents, job); err != nil {
+			return nil, fmt.Errorf("failed to parse outbox job %s: %w", entry.Name(), err)
+		}
+		if job.Status == OutboxRunning {
+			job.Status = OutboxPending
+		}
+		jobs = append(jobs, job)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	queue := &DiskQueue{Retention: DefaultOutboxRetention, memory: NewMemoryQueue(), dir: dir}
+	for _, job := range jobs {
+		queue.memory.store(job)
+	}
+	return queue, nil
+}
+
+// Cancel will set the pending job to canceled and save it
+func (q *DiskQueue) Cancel(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.memory.Cancel(ctx, id); err != nil {
+		return err
+	}
+	job, err := q.memory.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return q.save(job)
+}
+
+// Get will return a copy of the job
+func (q *DiskQueue) Get(ctx context.Context, id string) (*OutboxJob, error) {
+	return q.memory.Get(ctx, id)
+}
+
+// List will return a copy of the jobs that are pending or running, in the order they were pushed
+func (q *DiskQueue) List(ctx context.Context) ([]*OutboxJob, error) {
+	return q.memory.List(ctx)
+}
+
+// Pop will return the pending job that is due first (oldest first), set it to running and save it,
+// jobs that are done for longer than the Retention are removed with their files
+func (q *DiskQueue) Pop(_ context.Context) (*OutboxJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	q.memory.mu.Lock()
+	removed := q.memory.prune(now.Add(-q.Retention))
+	q.memory.mu.Unlock()
+	for _, id := range removed {
+		if err := os.Remove(filepath.Join(q.dir, id+diskQueueExtension)); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove outbox job %s: %w", id, err)
+		}
+	}
+
+	q.memory.mu.Lock()
+	job := q.memory.pop(now)
+	q.memory.mu.Unlock()
+	if job == nil {
+		return nil, nil //nolint:nilnil // no job is due
+	}
+	if err := q.save(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Push will add and save a new job
+func (q *DiskQueue) Push(ctx context.Context, job *OutboxJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.memory.Get(ctx, job.ID); err == nil {
+		return fmt.Errorf("outbox job %s: %w", job.ID, ErrOutboxJobExists)
+	}
+	if err := q.save(job); err != nil {
+		return err
+	}
+	return q.memory.Push(ctx, job)
+}
+
+// Update will replace and save the job
+func (q *DiskQueue) Update(ctx context.Context, job *OutboxJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.memory.Update(ctx, job); err != nil {
+		return err
+	}
+	return q.save(job)
+}
+
+// save writes the job file
+func (q *DiskQueue) save(job *OutboxJob) error {
+	if len(job.ID) == 0 || strings.ContainsAny(job.ID, `/\.`) {
+		return fmt.Errorf("outbox job %q: %w", job.ID, ErrInvalidOutboxJobID)
+	}
+	contents, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox job %s: %w", job.ID, err)
+	}
+	if err = writeFileAtomic(filepath.Join(q.dir, job.ID+diskQueueExtension), contents); err != nil {
+		return fmt.Errorf("failed to save outbox job %s: %w", job.ID, err)
+	}
+	return nil
+}
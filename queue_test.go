@@ -0,0 +1,263 @@
+package gomail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOutboxJob will create a pending job with the id
+func newTestOutboxJob(id string, createdAt time.Time) *OutboxJob {
+	return &OutboxJob{
+		CreatedAt:     createdAt,
+		Email:         &Email{Subject: "job " + id, Recipients: []string{"test@domain.com"}},
+		ID:            id,
+		MaxAttempts:   3,
+		NextAttemptAt: createdAt,
+		Status:        OutboxPending,
+	}
+}
+
+// testQueue runs the same checks against any queue
+func testQueue(t *testing.T, queue Queue) {
+	ctx := context.Background()
+	now := time.Now().Add(-time.Minute)
+
+	require.NoError(t, queue.Push(ctx, newTestOutboxJob("first", now)))
+	require.NoError(t, queue.Push(ctx, newTestOutboxJob("second", now.Add(time.Second))))
+	later := newTestOutboxJob("later", now)
+	later.NextAttemptAt = time.Now().Add(time.Hour)
+	require.NoError(t, queue.Push(ctx, later))
+	require.ErrorIs(t, queue.Push(ctx, newTestOutboxJob("first", now)), ErrOutboxJobExists)
+
+	// Jobs are handed out oldest first, jobs that are not due are skipped
+	job, err := queue.Pop(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, "first", job.ID)
+	assert.Equal(t, OutboxRunning, job.Status)
+	assert.Equal(t, "job first", job.Email.Subject)
+
+	// Changes to the returned job are not stored until Update
+	job.Error = "not saved"
+	stored, err := queue.Get(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, OutboxRunning, stored.Status)
+	assert.Empty(t, stored.Error)
+
+	second, err := queue.Pop(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, second)
+	assert.Equal(t, "second", second.ID)
+
+	job, err = queue.Pop(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, job)
+
+	// Retry the second job, the first is sent
+	second.Status = OutboxPending
+	second.Attempts = 1
+	require.NoError(t, queue.Update(ctx, second))
+	stored.Status = OutboxSent
+	require.NoError(t, queue.Update(ctx, stored))
+
+	job, err = queue.Pop(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, "second", job.ID)
+	assert.Equal(t, 1, job.Attempts)
+
+	stored, err = queue.Get(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, OutboxSent, stored.Status)
+
+	_, err = queue.Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrOutboxJobNotFound)
+	require.ErrorIs(t, queue.Update(ctx, newTestOutboxJob("missing", now)), ErrOutboxJobNotFound)
+
+	// Jobs that are not done are listed in the order they were pushed
+	jobs, err := queue.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "second", jobs[0].ID)
+	assert.Equal(t, OutboxRunning, jobs[0].Status)
+	assert.Equal(t, "later", jobs[1].ID)
+
+	// Only pending jobs can be canceled
+	require.ErrorIs(t, queue.Cancel(ctx, "second"), ErrOutboxJobNotPending)
+	require.ErrorIs(t, queue.Cancel(ctx, "first"), ErrOutboxJobNotPending)
+	require.ErrorIs(t, queue.Cancel(ctx, "missing"), ErrOutboxJobNotFound)
+	require.NoError(t, queue.Cancel(ctx, "later"))
+	require.ErrorIs(t, queue.Cancel(ctx, "later"), ErrOutboxJobNotPending)
+
+	stored, err = queue.Get(ctx, "later")
+	require.NoError(t, err)
+	assert.Equal(t, OutboxCanceled, stored.Status)
+	jobs, err = queue.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "second", jobs[0].ID)
+}
+
+// TestMemoryQueue will test the MemoryQueue methods
+func TestMemoryQueue(t *testing.T) {
+	t.Parallel()
+
+	testQueue(t, NewMemoryQueue())
+
+	t.Run("done jobs are removed after the retention", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		queue := NewMemoryQueue()
+		assert.Equal(t, DefaultOutboxRetention, queue.Retention)
+		for _, id := range []string{"sent", "canceled", "pending"} {
+			require.NoError(t, queue.Push(ctx, newTestOutboxJob(id, time.Now().Add(time.Hour))))
+		}
+		job, err := queue.Get(ctx, "sent")
+		require.NoError(t, err)
+		job.Status = OutboxSent
+		require.NoError(t, queue.Update(ctx, job))
+		require.NoError(t, queue.Cancel(ctx, "canceled"))
+
+		// Kept during the retention
+		job, err = queue.Pop(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, job)
+		_, err = queue.Get(ctx, "sent")
+		require.NoError(t, err)
+
+		queue.Retention = 0
+		job, err = queue.Pop(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, job)
+		_, err = queue.Get(ctx, "sent")
+		require.ErrorIs(t, err, ErrOutboxJobNotFound)
+		_, err = queue.Get(ctx, "canceled")
+		require.ErrorIs(t, err, ErrOutboxJobNotFound)
+		_, err = queue.Get(ctx, "pending")
+		require.NoError(t, err)
+	})
+}
+
+// TestDiskQueue will test the DiskQueue methods
+func TestDiskQueue(t *testing.T) {
+	t.Parallel()
+
+	t.Run("queue", func(t *testing.T) {
+		t.Parallel()
+
+		queue, err := NewDiskQueue(filepath.Join(t.TempDir(), "outbox"))
+		require.NoError(t, err)
+		testQueue(t, queue)
+	})
+
+	t.Run("jobs survive a restart", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		dir := t.TempDir()
+		queue, err := NewDiskQueue(dir)
+		require.NoError(t, err)
+
+		now := time.Now().Add(-time.Minute)
+		job := newTestOutboxJob("crashed", now)
+		job.Email.AddAttachmentBytes("file.txt", "text/plain", []byte("attachment contents"))
+		require.NoError(t, queue.Push(ctx, job))
+		require.NoError(t, queue.Push(ctx, newTestOutboxJob("pending", now.Add(time.Second))))
+		sent := newTestOutboxJob("sent", now)
+		require.NoError(t, queue.Push(ctx, sent))
+		sent.Status = OutboxSent
+		sent.UpdatedAt = time.Now().UTC()
+		require.NoError(t, queue.Update(ctx, sent))
+		expired := newTestOutboxJob("expired", now.Add(-2*DefaultOutboxRetention))
+		require.NoError(t, queue.Push(ctx, expired))
+		expired.Status = OutboxFailed
+		expired.UpdatedAt = now.Add(-2 * DefaultOutboxRetention)
+		require.NoError(t, queue.Update(ctx, expired))
+
+		// The process stops while the first job is being sent
+		job, err = queue.Pop(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "crashed", job.ID)
+
+		// Other files in the directory are ignored
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("{"), 0o600))
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "archive"), 0o700))
+
+		queue, err = NewDiskQueue(dir)
+		require.NoError(t, err)
+		job, err = queue.Pop(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		assert.Equal(t, "crashed", job.ID)
+		require.Len(t, job.Email.Attachments, 1)
+		assert.Equal(t, Attachment{Content: []byte("attachment contents"), FileName: "file.txt", FileType: "text/plain"}, job.Email.Attachments[0])
+
+		job, err = queue.Pop(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		assert.Equal(t, "pending", job.ID)
+
+		job, err = queue.Pop(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, job)
+
+		// Jobs that are done are kept for the retention after their last update
+		sent, err = queue.Get(ctx, "sent")
+		require.NoError(t, err)
+		assert.Equal(t, OutboxSent, sent.Status)
+		_, err = queue.Get(ctx, "expired")
+		require.ErrorIs(t, err, ErrOutboxJobNotFound)
+		assert.NoFileExists(t, filepath.Join(dir, "expired"+diskQueueExtension))
+		assert.FileExists(t, filepath.Join(dir, "sent"+diskQueueExtension))
+	})
+
+	t.Run("done jobs are removed after the retention", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		dir := t.TempDir()
+		queue, err := NewDiskQueue(dir)
+		require.NoError(t, err)
+		assert.Equal(t, DefaultOutboxRetention, queue.Retention)
+		queue.Retention = 0
+
+		job := newTestOutboxJob("sent", time.Now())
+		require.NoError(t, queue.Push(ctx, job))
+		job.Status = OutboxSent
+		require.NoError(t, queue.Update(ctx, job))
+		assert.FileExists(t, filepath.Join(dir, "sent"+diskQueueExtension))
+
+		job, err = queue.Pop(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, job)
+		_, err = queue.Get(ctx, "sent")
+		require.ErrorIs(t, err, ErrOutboxJobNotFound)
+		assert.NoFileExists(t, filepath.Join(dir, "sent"+diskQueueExtension))
+	})
+
+	t.Run("invalid jobs", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		queue, err := NewDiskQueue(dir)
+		require.NoError(t, err)
+		require.ErrorIs(t, queue.Push(context.Background(), newTestOutboxJob("../escape", time.Now())), ErrInvalidOutboxJobID)
+		require.ErrorIs(t, queue.Push(context.Background(), newTestOutboxJob("", time.Now())), ErrInvalidOutboxJobID)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600))
+		_, err = NewDiskQueue(dir)
+		require.Error(t, err)
+
+		file := filepath.Join(dir, "file")
+		require.NoError(t, os.WriteFile(file, nil, 0o600))
+		_, err = NewDiskQueue(file)
+		require.Error(t, err)
+	})
+}
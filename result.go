@@ -0,0 +1,62 @@
+package gomail
+
+import "time"
+
+// RecipientStatus is the delivery status reported by a provider for a single recipient
+type RecipientStatus string
+
+// Recipient statuses
+const (
+	RecipientAccepted   RecipientStatus = "accepted"   // Provider accepted the message for this recipient
+	RecipientNotSent    RecipientStatus = "not_sent"   // The send failed before the message was attempted for this recipient
+	RecipientQueued     RecipientStatus = "queued"     // Provider queued the message and will process it asynchronously
+	RecipientRejected   RecipientStatus = "rejected"   // Provider rejected the message for this recipient
+	RecipientScheduled  RecipientStatus = "scheduled"  // Provider scheduled the message to be sent later
+	RecipientSuppressed RecipientStatus = "suppressed" // Recipient is on the suppression list and was not sent the message
+)
+
+// SendResult is the provider-neutral result of sending an email
+//
+// DO NOT CHANGE ORDER - Optimized for memory (maligned)
+type SendResult struct {
+	SubmittedAt time.Time         `json:"submitted_at" mapstructure:"submitted_at"` // when the provider accepted the message
+	RawResponse interface{}       `json:"raw_response" mapstructure:"raw_response"` // unmodified response from the provider
+	Recipients  []RecipientResult `json:"recipients" mapstructure:"recipients"`     // status of each recipient
+	MessageID   string            `json:"message_id" mapstructure:"message_id"`     // provider message id (first id if provider returns many)
+	Provider    ServiceProvider   `json:"provider" mapstructure:"provider"`         // provider that sent the message
+}
+
+// RecipientResult is the status of the message for a single recipient
+type RecipientResult struct {
+	Email        string          `json:"email" mapstructure:"email"`                 // recipient email address
+	MessageID    string          `json:"message_id" mapstructure:"message_id"`       // provider message id for this recipient (if given)
+	RejectReason string          `json:"reject_reason" mapstructure:"reject_reason"` // reason given by the provider for a rejection
+	Status       RecipientStatus `json:"status" mapstructure:"status"`               // status of the recipient
+}
+
+// delivered returns true if any recipient was sent (or will be sent) the message
+func (r *SendResult) delivered() bool {
+	for _, recipient := range r.Recipients {
+		if recipient.Status == RecipientAccepted || recipient.Status == RecipientQueued || recipient.Status == RecipientScheduled {
+			return true
+		}
+	}
+	return false
+}
+
+// newSendResult creates a result for the provider with every recipient set to the given status
+func newSendResult(provider ServiceProvider, email *Email, status RecipientStatus) SendResult {
+	result := SendResult{
+		Provider:    provider,
+		SubmittedAt: time.Now().UTC(),
+	}
+	for _, recipients := range [][]string{email.Recipients, email.RecipientsCc, email.RecipientsBcc} {
+		for _, recipient := range recipients {
+			result.Recipients = append(result.Recipients, RecipientResult{
+				Email:  recipient,
+				Status: status,
+			})
+		}
+	}
+	return result
+}
@@ -0,0 +1,170 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+const (
+	defaultRetryInitialBackoff = 200 * time.Millisecond
+	defaultRetryJitter         = 0.2
+	defaultRetryMaxAttempts    = 3
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryMultiplier     = 2
+)
+
+// RetryPolicy is the configuration for retrying sends that failed with a transient error
+//
+// Zero values fall back to the defaults of DefaultRetryPolicy()
+//
+// DO NOT CHANGE ORDER - Optimized for memory (maligned)
+type RetryPolicy struct {
+	InitialBackoff time.Duration `json:"initial_backoff" mapstructure:"initial_backoff"` // wait before the first retry
+	Jitter         float64       `json:"jitter" mapstructure:"jitter"`                   // fraction of the backoff to randomize (0-1)
+	MaxBackoff     time.Duration `json:"max_backoff" mapstructure:"max_backoff"`         // max wait between retries
+	Multiplier     float64       `json:"multiplier" mapstructure:"multiplier"`           // growth of the backoff after each retry
+	MaxAttempts    int           `json:"max_attempts" mapstructure:"max_attempts"`       // max attempts per provider (including the first)
+}
+
+// DefaultRetryPolicy returns a retry policy with the default settings
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		InitialBackoff: defaultRetryInitialBackoff,
+		Jitter:         defaultRetryJitter,
+		MaxAttempts:    defaultRetryMaxAttempts,
+		MaxBackoff:     defaultRetryMaxBackoff,
+		Multiplier:     defaultRetryMultiplier,
+	}
+}
+
+// attempts returns the max attempts allowed by the policy (no policy is a single attempt)
+func (p *RetryPolicy) attempts() int {
+	if p == nil {
+		return 1
+	} else if p.MaxAttempts <= 0 {
+		return defaultRetryMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the wait before the given retry (1 is the first retry)
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initial, maxBackoff, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = defaultRetryMultiplier
+	}
+
+	// Grow the backoff exponentially up to the max
+	wait := float64(initial)
+	for i := 1; i < retry && wait < float64(maxBackoff); i++ {
+		wait *= multiplier
+	}
+	if wait > float64(maxBackoff) {
+		wait = float64(maxBackoff)
+	}
+
+	// Randomize part of the wait to spread out retries
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		wait -= wait * jitter * rand.Float64() //nolint:gosec // jitter does not need a secure random source
+	}
+
+	return time.Duration(wait)
+}
+
+// sendWithRetry sends the email via the provider, retrying transient errors per the retry policy
+func (m *MailService) sendWithRetry(ctx context.Context, replay *replayableEmail, provider ServiceProvider) (result SendResult, err error) {
+	attempts := m.RetryPolicy.attempts()
+	for attempt := 1; ; attempt++ {
+		if result, err = m.sendViaProvider(ctx, replay.next(), provider); err == nil {
+			return result, nil
+		}
+
+		// Only transient errors are worth another attempt (never resend to recipients that have the email)
+		if attempt >= attempts || !IsTransient(err) || result.delivered() {
+			return result, err
+		}
+
+		// Do not wait past the deadline of the caller
+		wait := m.RetryPolicy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return result, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// IsTransient returns true if the error is temporary and the send can be retried
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrTransient)
+}
+
+// IsPermanent returns true if the error will not go away by retrying the send
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrPermanent)
+}
+
+// transientError marks the error as transient
+func transientError(err error) error {
+	return fmt.Errorf("%w: %w", ErrTransient, err)
+}
+
+// permanentError marks the error as permanent
+func permanentError(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// rejectedError marks the error as a permanent rejection of a recipient (not a provider failure)
+func rejectedError(err error) error {
+	return permanentError(fmt.Errorf("%w: %w", ErrRejected, err))
+}
+
+// isClassified returns true if the error is already marked as transient or permanent
+func isClassified(err error) bool {
+	return IsTransient(err) || IsPermanent(err)
+}
+
+// classifyError marks any unclassified error as transient (network failures, timeouts) or permanent
+func classifyError(err error) error {
+	if err == nil || isClassified(err) {
+		return err
+	}
+
+	// A missing host will not appear by retrying
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return permanentError(err)
+		}
+		return transientError(err)
+	}
+
+	// Timeouts and connection failures are usually temporary
+	var netErr net.Error
+	var opErr *net.OpError
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) || errors.As(err, &opErr) {
+		return transientError(err)
+	}
+
+	return permanentError(err)
+}
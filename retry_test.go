@@ -0,0 +1,204 @@
+package gomail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mrz1836/postmark"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockFlakyPostmarkInterface is a mocking interface for Postmark that fails a number of times before sending
+type mockFlakyPostmarkInterface struct {
+	calls    int
+	failures int
+	err      error
+}
+
+// SendEmail is for mocking
+func (m *mockFlakyPostmarkInterface) SendEmail(_ context.Context, _ postmark.Email) (postmark.EmailResponse, error) {
+	m.calls++
+	if m.calls <= m.failures {
+		return postmark.EmailResponse{}, m.err
+	}
+	return postmark.EmailResponse{MessageID: fmt.Sprintf("attempt-%d", m.calls)}, nil
+}
+
+// newRetryTestService will create a service with Postmark loaded and a fast retry policy
+func newRetryTestService(t *testing.T, client postmarkInterface) *MailService {
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromDomain = testDomainEmail
+	mail.PostmarkServerToken = "1234567"
+	mail.RetryPolicy = &RetryPolicy{
+		InitialBackoff: time.Millisecond,
+		MaxAttempts:    3,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+	require.NoError(t, mail.StartUp())
+	require.NoError(t, mail.RegisterProvider(Postmark, &postmarkProvider{client: client}))
+	return mail
+}
+
+// TestRetryPolicy_attempts will test the attempts() method
+func TestRetryPolicy_attempts(t *testing.T) {
+	t.Parallel()
+
+	var policy *RetryPolicy
+	assert.Equal(t, 1, policy.attempts())
+	assert.Equal(t, defaultRetryMaxAttempts, (&RetryPolicy{}).attempts())
+	assert.Equal(t, 5, (&RetryPolicy{MaxAttempts: 5}).attempts())
+	assert.Equal(t, defaultRetryMaxAttempts, DefaultRetryPolicy().attempts())
+}
+
+// TestRetryPolicy_backoff will test the backoff() method
+func TestRetryPolicy_backoff(t *testing.T) {
+	t.Parallel()
+
+	t.Run("exponential growth with a cap", func(t *testing.T) {
+		policy := &RetryPolicy{
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     time.Second,
+			Multiplier:     2,
+		}
+		assert.Equal(t, 100*time.Millisecond, policy.backoff(1))
+		assert.Equal(t, 200*time.Millisecond, policy.backoff(2))
+		assert.Equal(t, 400*time.Millisecond, policy.backoff(3))
+		assert.Equal(t, 800*time.Millisecond, policy.backoff(4))
+		assert.Equal(t, time.Second, policy.backoff(5))
+		assert.Equal(t, time.Second, policy.backoff(50))
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		policy := &RetryPolicy{}
+		assert.Equal(t, defaultRetryInitialBackoff, policy.backoff(1))
+		assert.Equal(t, defaultRetryMaxBackoff, policy.backoff(100))
+	})
+
+	t.Run("jitter stays within bounds", func(t *testing.T) {
+		policy := &RetryPolicy{
+			InitialBackoff: 100 * time.Millisecond,
+			Jitter:         0.5,
+		}
+		for i := 0; i < 100; i++ {
+			wait := policy.backoff(1)
+			assert.GreaterOrEqual(t, wait, 50*time.Millisecond)
+			assert.LessOrEqual(t, wait, 100*time.Millisecond)
+		}
+	})
+}
+
+// TestClassifyError will test the classifyError() method
+func TestClassifyError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"unknown error", ErrBadHostname, false},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"connection refused", &net.OpError{Op: "dial", Err: ErrBadHostname}, true},
+		{"host not found", &net.DNSError{Name: "smtp.badhostname.com", IsNotFound: true}, false},
+		{"dns timeout", &net.DNSError{Name: "smtp.example.com", IsTimeout: true}, true},
+		{"already transient", transientError(ErrBadHostname), true},
+		{"already permanent", permanentError(context.DeadlineExceeded), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := classifyError(test.err)
+			require.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.transient, IsTransient(err))
+			assert.Equal(t, !test.transient, IsPermanent(err))
+		})
+	}
+
+	require.NoError(t, classifyError(nil))
+}
+
+// TestMailService_SendEmailRetry tests retrying in SendEmailWithResult()
+func TestMailService_SendEmailRetry(t *testing.T) {
+	t.Parallel()
+
+	newEmail := func(mail *MailService) *Email {
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@domain.com"}
+		return email
+	}
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		client := &mockFlakyPostmarkInterface{failures: 2, err: postmark.APIError{ErrorCode: http.StatusServiceUnavailable, Message: "unavailable"}}
+		mail := newRetryTestService(t, client)
+
+		result, err := mail.SendEmailWithResult(context.Background(), newEmail(mail), Postmark)
+		require.NoError(t, err)
+		assert.Equal(t, 3, client.calls)
+		assert.Equal(t, "attempt-3", result.MessageID)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		client := &mockFlakyPostmarkInterface{failures: 5, err: postmark.APIError{ErrorCode: http.StatusServiceUnavailable, Message: "unavailable"}}
+		mail := newRetryTestService(t, client)
+
+		_, err := mail.SendEmailWithResult(context.Background(), newEmail(mail), Postmark)
+		require.ErrorIs(t, err, ErrTransient)
+		assert.Equal(t, 3, client.calls)
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		client := &mockFlakyPostmarkInterface{failures: 5, err: postmark.APIError{ErrorCode: 406, Message: "inactive recipient"}}
+		mail := newRetryTestService(t, client)
+
+		_, err := mail.SendEmailWithResult(context.Background(), newEmail(mail), Postmark)
+		require.ErrorIs(t, err, ErrPermanent)
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("no retry policy is a single attempt", func(t *testing.T) {
+		client := &mockFlakyPostmarkInterface{failures: 1, err: postmark.APIError{ErrorCode: http.StatusServiceUnavailable, Message: "unavailable"}}
+		mail := newRetryTestService(t, client)
+		mail.RetryPolicy = nil
+
+		_, err := mail.SendEmailWithResult(context.Background(), newEmail(mail), Postmark)
+		require.ErrorIs(t, err, ErrTransient)
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("does not wait past the context deadline", func(t *testing.T) {
+		client := &mockFlakyPostmarkInterface{failures: 5, err: postmark.APIError{ErrorCode: http.StatusServiceUnavailable, Message: "unavailable"}}
+		mail := newRetryTestService(t, client)
+		mail.RetryPolicy.InitialBackoff = time.Hour
+		mail.RetryPolicy.MaxBackoff = time.Hour
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		_, err := mail.SendEmailWithResult(ctx, newEmail(mail), Postmark)
+		require.ErrorIs(t, err, ErrTransient)
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("stops when the context is canceled", func(t *testing.T) {
+		client := &mockFlakyPostmarkInterface{failures: 5, err: postmark.APIError{ErrorCode: http.StatusServiceUnavailable, Message: "unavailable"}}
+		mail := newRetryTestService(t, client)
+		mail.RetryPolicy.InitialBackoff = time.Hour
+		mail.RetryPolicy.MaxBackoff = time.Hour
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		_, err := mail.SendEmailWithResult(ctx, newEmail(mail), Postmark)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, client.calls)
+	})
+}
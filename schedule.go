@@ -0,0 +1,160 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mattbaird/gochimp"
+)
+
+// mandrillTimeLayout is the layout of the Mandrill timestamps (UTC)
+const mandrillTimeLayout = "2006-01-02 15:04:05"
+
+// ScheduledMessage is an email waiting to be sent at its SendAt time
+//
+// DO NOT CHANGE ORDER - Optimized for memory (maligned)
+type ScheduledMessage struct {
+	CreatedAt   time.Time         `json:"created_at" mapstructure:"created_at"`     // when the email was scheduled
+	SendAt      time.Time         `json:"send_at" mapstructure:"send_at"`           // when the email will be sent
+	Providers   []ServiceProvider `json:"providers" mapstructure:"providers"`       // providers that will send the email (empty is the failover default)
+	Recipients  []string          `json:"recipients" mapstructure:"recipients"`     // recipients of the email
+	FromAddress string            `json:"from_address" mapstructure:"from_address"` // sender of the email
+	ID          string            `json:"id" mapstructure:"id"`                     // id to cancel the email with (outbox job id or provider message id)
+	Subject     string            `json:"subject" mapstructure:"subject"`           // subject of the email
+	Local       bool              `json:"local" mapstructure:"local"`               // scheduled in the outbox (false if the provider scheduled it)
+}
+
+// scheduled returns true if the email should be sent later
+func (e *Email) scheduled() bool {
+	return e.SendAt.After(time.Now())
+}
+
+// canSchedule returns true if every provider schedules emails natively
+func (m *MailService) canSchedule(providers ...ServiceProvider) bool {
+	for _, provider := range providers {
+		if p, ok := m.providers[provider]; !ok || !p.Capabilities().Scheduling {
+			return false
+		}
+	}
+	return len(providers) > 0
+}
+
+// scheduleInOutbox adds the email to the outbox to be sent at its SendAt time by the providers,
+// the result has the job id as the message id and every recipient is scheduled
+func (m *MailService) scheduleInOutbox(ctx context.Context, email *Email, providers []ServiceProvider) (SendResult, error) {
+	if m.Outbox == nil {
+		return SendResult{}, fmt.Errorf("service provider: %x: %w", providers, ErrSchedulingNotSupported)
+	}
+	id, err := m.Enqueue(ctx, email, EnqueueOptions{Providers: providers})
+	if err != nil {
+		return SendResult{}, err
+	}
+
+	var provider ServiceProvider
+	if len(providers) > 0 {
+		provider = providers[0]
+	}
+	result := newSendResult(provider, email, RecipientScheduled)
+	result.MessageID = id
+	return result, nil
+}
+
+// mandrillScheduler returns the Mandrill client if it can list and cancel scheduled messages
+func (m *MailService) mandrillScheduler() (mandrillScheduler, bool) {
+	provider, ok := m.providers[Mandrill].(*mandrillProvider)
+	if !ok {
+		return nil, false
+	}
+	scheduler, ok := provider.client.(mandrillScheduler)
+	return scheduler, ok
+}
+
+// ListScheduled will return the emails scheduled with SendAt, sorted by send time
+//
+// The list has the emails waiting in the outbox and the messages scheduled in Mandrill
+func (m *MailService) ListScheduled(ctx context.Context) ([]ScheduledMessage, error) {
+	var scheduled []ScheduledMessage
+
+	// Emails waiting in the outbox
+	if m.Outbox != nil {
+		jobs, err := m.Outbox.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			if job.Status != OutboxPending || job.Email.SendAt.IsZero() {
+				continue
+			}
+			recipients := make([]string, 0, len(job.Email.Recipients)+len(job.Email.RecipientsCc)+len(job.Email.RecipientsBcc))
+			recipients = append(recipients, job.Email.Recipients...)
+			recipients = append(recipients, job.Email.RecipientsCc...)
+			recipients = append(recipients, job.Email.RecipientsBcc...)
+			scheduled = append(scheduled, ScheduledMessage{
+				CreatedAt:   job.CreatedAt,
+				FromAddress: job.Email.FromAddress,
+				ID:          job.ID,
+				Local:       true,
+				Providers:   job.Providers,
+				Recipients:  recipients,
+				SendAt:      job.Email.SendAt,
+				Subject:     job.Email.Subject,
+			})
+		}
+	}
+
+	// Messages scheduled in Mandrill
+	if scheduler, ok := m.mandrillScheduler(); ok {
+		messages, err := scheduler.ListScheduled(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list mandrill scheduled messages: %w", classifyMandrillError(err))
+		}
+		for _, message := range messages {
+			createdAt, _ := time.Parse(mandrillTimeLayout, message.CreatedAt)
+			sendAt, _ := time.Parse(mandrillTimeLayout, message.SendAt)
+			scheduled = append(scheduled, ScheduledMessage{
+				CreatedAt:   createdAt,
+				FromAddress: message.FromEmail,
+				ID:          message.ID,
+				Providers:   []ServiceProvider{Mandrill},
+				Recipients:  []string{message.To},
+				SendAt:      sendAt,
+				Subject:     message.Subject,
+			})
+		}
+	}
+
+	sort.SliceStable(scheduled, func(i, j int) bool { return scheduled[i].SendAt.Before(scheduled[j].SendAt) })
+	return scheduled, nil
+}
+
+// CancelScheduled will cancel the scheduled email with the id (from ListScheduled or the SendResult message id)
+func (m *MailService) CancelScheduled(ctx context.Context, id string) error {
+	// Emails waiting in the outbox
+	if m.Outbox != nil {
+		err := m.Outbox.Cancel(ctx, id)
+		if err == nil {
+			return nil
+		} else if errors.Is(err, ErrOutboxJobNotPending) {
+			return fmt.Errorf("%w: %w", ErrScheduledMessageNotFound, err)
+		} else if !errors.Is(err, ErrOutboxJobNotFound) {
+			return err
+		}
+	}
+
+	// Messages scheduled in Mandrill
+	if scheduler, ok := m.mandrillScheduler(); ok {
+		err := scheduler.CancelScheduled(ctx, id)
+		var apiErr gochimp.MandrillError
+		if errors.As(err, &apiErr) && apiErr.Name == "Unknown_Message" {
+			return fmt.Errorf("scheduled message %s: %w: %w", id, ErrScheduledMessageNotFound, err)
+		} else if err != nil {
+			return fmt.Errorf("failed to cancel mandrill scheduled message %s: %w", id, classifyMandrillError(err))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("scheduled message %s: %w", id, ErrScheduledMessageNotFound)
+}
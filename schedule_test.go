@@ -0,0 +1,335 @@
+package gomail
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattbaird/gochimp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockMandrillScheduler is a Mandrill client with scheduled messages
+type mockMandrillScheduler struct {
+	mockCaptureMandrillInterface
+	canceled  []string
+	scheduled []mandrillScheduledMessage
+}
+
+// CancelScheduled is for mocking
+func (m *mockMandrillScheduler) CancelScheduled(_ context.Context, id string) error {
+	for i, message := range m.scheduled {
+		if message.ID == id {
+			m.scheduled = append(m.scheduled[:i], m.scheduled[i+1:]...)
+			m.canceled = append(m.canceled, id)
+			return nil
+		}
+	}
+	return gochimp.MandrillError{Status: "error", Code: 11, Name: "Unknown_Message", Message: "No message exists with the id '" + id + "'"}
+}
+
+// ListScheduled is for mocking
+func (m *mockMandrillScheduler) ListScheduled(_ context.Context) ([]mandrillScheduledMessage, error) {
+	return m.scheduled, nil
+}
+
+// newScheduleTestEmail will create an email to send an hour from now
+func newScheduleTestEmail(mail *MailService, subject string) *Email {
+	email := mail.NewEmail()
+	email.Subject = subject
+	email.PlainTextContent = "Test email content"
+	email.Recipients = []string{"test@domain.com"}
+	email.RecipientsCc = []string{"cc@domain.com"}
+	email.SendAt = time.Now().Add(time.Hour).Truncate(time.Second)
+	return email
+}
+
+// TestMailService_SendAt will test sending an email with SendAt
+func TestMailService_SendAt(t *testing.T) {
+	t.Parallel()
+
+	t.Run("mandrill schedules the email", func(t *testing.T) {
+		t.Parallel()
+
+		mail := newFailoverTestService(t)
+		capture := &mockCaptureMandrillInterface{}
+		require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: capture}))
+		assert.True(t, mail.providers[Mandrill].Capabilities().Scheduling)
+
+		email := newScheduleTestEmail(mail, "native")
+		result, err := mail.SendEmailWithResult(context.Background(), email, Mandrill)
+		require.NoError(t, err)
+		assert.Equal(t, "failover-id", result.MessageID)
+		require.Len(t, capture.options, 1)
+		require.NotNil(t, capture.options[0].SendAt)
+		assert.True(t, email.SendAt.Equal(*capture.options[0].SendAt))
+		assert.Equal(t, time.UTC, capture.options[0].SendAt.Location())
+
+		// Failover with only Mandrill is scheduled natively as well
+		_, err = mail.SendWithFailover(context.Background(), email, Mandrill)
+		require.NoError(t, err)
+		require.Len(t, capture.options, 2)
+		require.NotNil(t, capture.options[1].SendAt)
+	})
+
+	t.Run("past send time is sent now", func(t *testing.T) {
+		t.Parallel()
+
+		mail := newFailoverTestService(t)
+		capture := &mockCaptureMandrillInterface{}
+		require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: capture}))
+
+		email := newScheduleTestEmail(mail, "past")
+		email.SendAt = time.Now().Add(-time.Minute)
+		require.NoError(t, mail.SendEmail(context.Background(), email, Mandrill))
+		require.Len(t, capture.options, 1)
+		assert.Nil(t, capture.options[0].SendAt)
+	})
+
+	t.Run("providers without scheduling need the outbox", func(t *testing.T) {
+		t.Parallel()
+
+		mail := newFailoverTestService(t)
+		assert.False(t, mail.providers[Postmark].Capabilities().Scheduling)
+
+		email := newScheduleTestEmail(mail, "no outbox")
+		_, err := mail.SendEmailWithResult(context.Background(), email, Postmark)
+		require.ErrorIs(t, err, ErrSchedulingNotSupported)
+
+		_, err = mail.SendWithFailover(context.Background(), email, Mandrill, Postmark)
+		require.ErrorIs(t, err, ErrSchedulingNotSupported)
+	})
+
+	t.Run("outbox sends the email later", func(t *testing.T) {
+		t.Parallel()
+
+		provider := &mockOutboxProvider{}
+		queue := NewMemoryQueue()
+		mail := newOutboxTestService(t, queue, provider)
+		require.NoError(t, mail.StartOutbox())
+		t.Cleanup(func() {
+			_ = mail.Shutdown(context.Background())
+		})
+
+		email := newOutboxTestEmail(mail, "later")
+		email.SendAt = time.Now().Add(100 * time.Millisecond)
+		result, err := mail.SendEmailWithResult(context.Background(), email, testRelayProvider)
+		require.NoError(t, err)
+		require.Len(t, result.MessageID, 32)
+		assert.Equal(t, testRelayProvider, result.Provider)
+		require.Len(t, result.Recipients, 1)
+		assert.Equal(t, RecipientScheduled, result.Recipients[0].Status)
+
+		job, err := queue.Get(context.Background(), result.MessageID)
+		require.NoError(t, err)
+		assert.True(t, job.NextAttemptAt.Equal(email.SendAt))
+		assert.Equal(t, 0, provider.sentCount())
+
+		job = waitForOutboxJob(t, queue, result.MessageID)
+		assert.Equal(t, OutboxSent, job.Status)
+		assert.False(t, time.Now().Before(email.SendAt))
+		assert.Equal(t, 1, provider.sentCount())
+	})
+
+	t.Run("enqueue honors the send time", func(t *testing.T) {
+		t.Parallel()
+
+		mail := newOutboxTestService(t, NewMemoryQueue(), &mockOutboxProvider{})
+		email := newOutboxTestEmail(mail, "enqueue")
+		email.SendAt = time.Now().Add(time.Hour)
+		id, err := mail.Enqueue(context.Background(), email, EnqueueOptions{})
+		require.NoError(t, err)
+
+		job, err := mail.Outbox.Pop(context.Background())
+		require.NoError(t, err)
+		assert.Nil(t, job)
+		job, err = mail.Outbox.Get(context.Background(), id)
+		require.NoError(t, err)
+		assert.True(t, job.NextAttemptAt.Equal(email.SendAt))
+	})
+}
+
+// TestMailService_ListScheduled will test the methods ListScheduled() and CancelScheduled()
+func TestMailService_ListScheduled(t *testing.T) {
+	t.Parallel()
+
+	t.Run("outbox and mandrill messages", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		mail := newFailoverTestService(t)
+		mail.Outbox = NewMemoryQueue()
+		mandrill := &mockMandrillScheduler{scheduled: []mandrillScheduledMessage{{
+			CreatedAt: "2024-01-02 03:04:05",
+			FromEmail: "no-reply@domain.com",
+			ID:        "mandrill-id",
+			SendAt:    time.Now().Add(30 * time.Minute).UTC().Format(mandrillTimeLayout),
+			Subject:   "mandrill",
+			To:        "test@domain.com",
+		}}}
+		require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: mandrill}))
+
+		// An email sent now is not listed
+		_, err := mail.Enqueue(ctx, newOutboxTestEmail(mail, "now"), EnqueueOptions{Providers: []ServiceProvider{Postmark}})
+		require.NoError(t, err)
+
+		email := newScheduleTestEmail(mail, "outbox")
+		result, err := mail.SendEmailWithResult(ctx, email, Postmark)
+		require.NoError(t, err)
+		assert.Equal(t, Postmark, result.Provider)
+		require.Len(t, result.Recipients, 2)
+
+		scheduled, err := mail.ListScheduled(ctx)
+		require.NoError(t, err)
+		require.Len(t, scheduled, 2)
+
+		assert.Equal(t, "mandrill-id", scheduled[0].ID)
+		assert.False(t, scheduled[0].Local)
+		assert.Equal(t, []ServiceProvider{Mandrill}, scheduled[0].Providers)
+		assert.Equal(t, []string{"test@domain.com"}, scheduled[0].Recipients)
+		assert.Equal(t, "no-reply@domain.com", scheduled[0].FromAddress)
+		assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), scheduled[0].CreatedAt)
+
+		assert.Equal(t, result.MessageID, scheduled[1].ID)
+		assert.True(t, scheduled[1].Local)
+		assert.Equal(t, []ServiceProvider{Postmark}, scheduled[1].Providers)
+		assert.Equal(t, []string{"test@domain.com", "cc@domain.com"}, scheduled[1].Recipients)
+		assert.Equal(t, "outbox", scheduled[1].Subject)
+		assert.True(t, email.SendAt.Equal(scheduled[1].SendAt))
+
+		// Cancel both
+		require.NoError(t, mail.CancelScheduled(ctx, result.MessageID))
+		require.NoError(t, mail.CancelScheduled(ctx, "mandrill-id"))
+		assert.Equal(t, []string{"mandrill-id"}, mandrill.canceled)
+
+		job, err := mail.Outbox.Get(ctx, result.MessageID)
+		require.NoError(t, err)
+		assert.Equal(t, OutboxCanceled, job.Status)
+
+		scheduled, err = mail.ListScheduled(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, scheduled)
+
+		// Canceled or unknown messages are not found
+		require.ErrorIs(t, mail.CancelScheduled(ctx, result.MessageID), ErrScheduledMessageNotFound)
+		err = mail.CancelScheduled(ctx, "unknown")
+		require.ErrorIs(t, err, ErrScheduledMessageNotFound)
+		assert.Contains(t, err.Error(), "No message exists")
+	})
+
+	t.Run("scheduled emails survive a restart", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		dir := filepath.Join(t.TempDir(), "outbox")
+		queue, err := NewDiskQueue(dir)
+		require.NoError(t, err)
+		mail := newOutboxTestService(t, queue, &mockOutboxProvider{})
+
+		result, err := mail.SendWithFailover(ctx, newScheduleTestEmail(mail, "durable"))
+		require.NoError(t, err)
+		assert.Equal(t, testRelayProvider, result.Provider)
+
+		queue, err = NewDiskQueue(dir)
+		require.NoError(t, err)
+		mail = newOutboxTestService(t, queue, &mockOutboxProvider{})
+		require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: &mockMandrillScheduler{}}))
+		scheduled, err := mail.ListScheduled(ctx)
+		require.NoError(t, err)
+		require.Len(t, scheduled, 1)
+		assert.Equal(t, result.MessageID, scheduled[0].ID)
+		assert.Equal(t, "durable", scheduled[0].Subject)
+		assert.Equal(t, []ServiceProvider{testRelayProvider}, scheduled[0].Providers)
+
+		require.NoError(t, mail.CancelScheduled(ctx, result.MessageID))
+		queue, err = NewDiskQueue(dir)
+		require.NoError(t, err)
+		job, err := queue.Get(ctx, result.MessageID)
+		require.NoError(t, err)
+		assert.Equal(t, OutboxCanceled, job.Status)
+	})
+
+	t.Run("nothing is scheduled", func(t *testing.T) {
+		t.Parallel()
+
+		mail := newFailoverTestService(t)
+		scheduled, err := mail.ListScheduled(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, scheduled)
+		require.ErrorIs(t, mail.CancelScheduled(context.Background(), "missing"), ErrScheduledMessageNotFound)
+	})
+}
+
+// TestMandrillClient_Scheduled will test the mandrillClient methods ListScheduled() and CancelScheduled()
+func TestMandrillClient_Scheduled(t *testing.T) {
+	t.Parallel()
+
+	newClient := func(t *testing.T, status int, response string) *mandrillClient {
+		api, err := gochimp.NewMandrill("1234567")
+		require.NoError(t, err)
+		api.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			var params map[string]interface{}
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&params))
+			assert.Equal(t, "1234567", params["key"])
+			if strings.HasSuffix(req.URL.Path, "/messages/cancel-scheduled.json") {
+				assert.Equal(t, "abc123", params["id"])
+			}
+			return &http.Response{
+				Body:       io.NopCloser(strings.NewReader(response)),
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Request:    req,
+				Status:     http.StatusText(status),
+				StatusCode: status,
+			}, nil
+		})
+		return &mandrillClient{api: api}
+	}
+
+	t.Run("list", func(t *testing.T) {
+		t.Parallel()
+
+		client := newClient(t, http.StatusOK, `[{"_id":"abc123","created_at":"2024-01-02 03:04:05","send_at":"2024-01-03 03:04:05","from_email":"no-reply@domain.com","to":"test@domain.com","subject":"Test"}]`)
+		scheduled, err := client.ListScheduled(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []mandrillScheduledMessage{{
+			CreatedAt: "2024-01-02 03:04:05",
+			FromEmail: "no-reply@domain.com",
+			ID:        "abc123",
+			SendAt:    "2024-01-03 03:04:05",
+			Subject:   "Test",
+			To:        "test@domain.com",
+		}}, scheduled)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		t.Parallel()
+
+		client := newClient(t, http.StatusOK, `{"_id":"abc123"}`)
+		require.NoError(t, client.CancelScheduled(context.Background(), "abc123"))
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		t.Parallel()
+
+		client := newClient(t, http.StatusInternalServerError, `{"status":"error","code":11,"name":"Unknown_Message","message":"No message exists with the id 'abc123'"}`)
+		err := client.CancelScheduled(context.Background(), "abc123")
+		var apiErr gochimp.MandrillError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, "Unknown_Message", apiErr.Name)
+	})
+
+	t.Run("http error", func(t *testing.T) {
+		t.Parallel()
+
+		client := newClient(t, http.StatusBadGateway, `bad gateway`)
+		_, err := client.ListScheduled(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "HTTP")
+	})
+}
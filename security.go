@@ -0,0 +1,49 @@
+package gomail
+
+import "fmt"
+
+// messageSecurity signs and encrypts the raw MIME built for the SMTP and AWS SES providers
+//
+// S/MIME or OpenPGP is applied first (it replaces the body entity), then DKIM signs the final message
+type messageSecurity struct {
+	dkim  *dkimSigner
+	pgp   *pgpConfig
+	smime *smimeConfig
+}
+
+// secure returns the message with the security requested by the email and configured for the service
+//
+// A nil security returns the message as is, unless the email requests S/MIME or OpenPGP (not configured)
+func (s *messageSecurity) secure(email *Email, message []byte) ([]byte, error) {
+	if s == nil {
+		s = &messageSecurity{}
+	}
+
+	var err error
+	if message, err = s.smime.apply(email, message); err != nil {
+		return nil, err
+	}
+	if message, err = s.pgp.apply(email, message); err != nil {
+		return nil, err
+	}
+	return s.dkim.sign(message)
+}
+
+// validateSecurity checks the email does not request both S/MIME and OpenPGP
+func (e *Email) validateSecurity() error {
+	if (e.SMIMESign || e.SMIMEEncrypt) && (e.PGPSign || e.PGPEncrypt) {
+		return ErrSMIMEAndPGP
+	}
+	return nil
+}
+
+// checkSecurity refuses providers that cannot sign or encrypt the email, so it is never sent in the clear
+func (e *Email) checkSecurity(p Provider) error {
+	if (e.SMIMESign || e.SMIMEEncrypt) && !p.Capabilities().SMIME {
+		return permanentError(fmt.Errorf("service provider: %s: %w", p.Name(), ErrSMIMENotSupported))
+	}
+	if (e.PGPSign || e.PGPEncrypt) && !p.Capabilities().OpenPGP {
+		return permanentError(fmt.Errorf("service provider: %s: %w", p.Name(), ErrPGPNotSupported))
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package gomail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	sendGridDefaultBaseURL = "https://api.sendgrid.com"
+	sendGridMaxCategories  = 10
+	sendGridSendPath       = "/v3/mail/send"
+)
+
+// sendGridInterface is an interface for SendGrid/mocking
+type sendGridInterface interface {
+	SendEmail(ctx context.Context, message *sendGridMessage) (sendGridResponse, error)
+}
+
+// sendGridMessage is the SendGrid v3 Mail Send request body
+type sendGridMessage struct {
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	Categories       []string                  `json:"categories,omitempty"`
+	Content          []sendGridContent         `json:"content"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	ReplyTo          *sendGridAddress          `json:"reply_to,omitempty"`
+	TrackingSettings *sendGridTrackingSettings `json:"tracking_settings,omitempty"`
+	Subject          string                    `json:"subject"`
+}
+
+// sendGridPersonalization is the recipients of a SendGrid message
+type sendGridPersonalization struct {
+	Bcc []sendGridAddress `json:"bcc,omitempty"`
+	Cc  []sendGridAddress `json:"cc,omitempty"`
+	To  []sendGridAddress `json:"to"`
+}
+
+// sendGridAddress is an email address with an optional name
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// sendGridContent is a body part of a SendGrid message
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// sendGridAttachment is a base64 encoded attachment
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Disposition string `json:"disposition"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type,omitempty"`
+}
+
+// sendGridTrackingSettings toggles click and open tracking
+type sendGridTrackingSettings struct {
+	ClickTracking sendGridClickTracking `json:"click_tracking"`
+	OpenTracking  sendGridOpenTracking  `json:"open_tracking"`
+}
+
+// sendGridClickTracking is the click tracking setting
+type sendGridClickTracking struct {
+	Enable     bool `json:"enable"`
+	EnableText bool `json:"enable_text"`
+}
+
+// sendGridOpenTracking is the open tracking setting
+type sendGridOpenTracking struct {
+	Enable bool `json:"enable"`
+}
+
+// sendGridResponse is the response of an accepted SendGrid message
+type sendGridResponse struct {
+	MessageID  string `json:"message_id"`
+	StatusCode int    `json:"status_code"`
+}
+
+// sendGridError is an error response from the SendGrid api
+type sendGridError struct {
+	Errors     []sendGridErrorDetail `json:"errors"`
+	StatusCode int                   `json:"-"`
+}
+
+// sendGridErrorDetail is a single error returned by SendGrid
+type sendGridErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error returns the error messages from SendGrid
+func (e *sendGridError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, apiErr := range e.Errors {
+		if len(apiErr.Field) > 0 {
+			messages = append(messages, apiErr.Field+": "+apiErr.Message)
+		} else {
+			messages = append(messages, apiErr.Message)
+		}
+	}
+	return fmt.Sprintf("sendgrid returned status %d: %s", e.StatusCode, strings.Join(messages, ", "))
+}
+
+// sendGridClient is a minimal client for the SendGrid v3 Mail Send api
+type sendGridClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// newSendGridClient will create a new SendGrid client (base url defaults to the SendGrid api)
+func newSendGridClient(apiKey, baseURL string) *sendGridClient {
+	if len(baseURL) == 0 {
+		baseURL = sendGridDefaultBaseURL
+	}
+	return &sendGridClient{
+		apiKey:     apiKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+// SendEmail posts the message to the SendGrid Mail Send api
+func (c *sendGridClient) SendEmail(ctx context.Context, message *sendGridMessage) (response sendGridResponse, err error) {
+	var payload []byte
+	if payload, err = json.Marshal(message); err != nil {
+		return response, err
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+sendGridSendPath, bytes.NewReader(payload)); err != nil {
+		return response, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp *http.Response
+	if resp, err = c.httpClient.Do(req); err != nil {
+		return response, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// Check for an error response
+	response.StatusCode = resp.StatusCode
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &sendGridError{StatusCode: resp.StatusCode}
+		body, _ := io.ReadAll(resp.Body)
+		_ = json.Unmarshal(body, apiErr)
+		return response, apiErr
+	}
+
+	response.MessageID = resp.Header.Get("X-Message-Id")
+	return response, nil
+}
+
+// sendGridProvider is the SendGrid provider
+type sendGridProvider struct {
+	client sendGridInterface
+}
+
+// Name returns the name of the provider
+func (p *sendGridProvider) Name() string {
+	return "sendgrid"
+}
+
+// Capabilities returns the features supported by SendGrid
+func (p *sendGridProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Attachments: true,
+		Bcc:         true,
+		Cc:          true,
+		Importance:  true,
+		Tags:        true,
+		TrackClicks: true,
+		TrackOpens:  true,
+	}
+}
+
+// Send sends the email using SendGrid
+func (p *sendGridProvider) Send(ctx context.Context, email *Email) (SendResult, error) {
+	return sendViaSendGrid(ctx, p.client, email)
+}
+
+// sendViaSendGrid sends an email using the SendGrid service
+func sendViaSendGrid(ctx context.Context, client sendGridInterface, email *Email) (result SendResult, err error) {
+	// Create the SendGrid message
+	message := &sendGridMessage{
+		From: sendGridAddress{
+			Email: email.FromAddress,
+			Name:  email.FromName,
+		},
+		Subject: email.Subject,
+		TrackingSettings: &sendGridTrackingSettings{
+			ClickTracking: sendGridClickTracking{Enable: email.TrackClicks, EnableText: email.TrackClicks},
+			OpenTracking:  sendGridOpenTracking{Enable: email.TrackOpens},
+		},
+	}
+
+	// Warn about features that are set but not available
+	if email.AutoText {
+		log.Printf("warning: auto text is enabled, but SendGrid does not offer this feature")
+	}
+	if len(email.ReturnPath) > 0 || email.VERP || email.DSN != nil {
+		log.Printf("warning: a return path, VERP or DSN is set, but SendGrid uses the return path of the sending domain")
+	}
+
+	// Add a custom reply to address
+	if len(email.ReplyToAddress) > 0 {
+		message.ReplyTo = &sendGridAddress{Email: email.ReplyToAddress}
+	}
+
+	// Convert recipients (to, cc, bcc)
+	personalization := sendGridPersonalization{}
+	for _, recipient := range email.Recipients {
+		personalization.To = append(personalization.To, sendGridAddress{Email: recipient})
+	}
+	for _, recipient := range email.RecipientsCc {
+		personalization.Cc = append(personalization.Cc, sendGridAddress{Email: recipient})
+	}
+	for _, recipient := range email.RecipientsBcc {
+		personalization.Bcc = append(personalization.Bcc, sendGridAddress{Email: recipient})
+	}
+	message.Personalizations = []sendGridPersonalization{personalization}
+
+	// Add the content (plain text must be first)
+	if len(email.PlainTextContent) > 0 {
+		message.Content = append(message.Content, sendGridContent{Type: "text/plain", Value: email.PlainTextContent})
+	}
+	if len(email.HTMLContent) > 0 {
+		message.Content = append(message.Content, sendGridContent{Type: "text/html", Value: email.HTMLContent})
+	}
+
+	// Convert tags to categories
+	message.Categories = email.Tags
+	if len(message.Categories) > sendGridMaxCategories {
+		log.Printf("warning: SendGrid only allows %d categories, extra tags are ignored", sendGridMaxCategories)
+		message.Categories = message.Categories[:sendGridMaxCategories]
+	}
+
+	// Convert attachments to SendGrid format
+	for _, attachment := range email.Attachments {
+
+		// Read all content from the attachment
+		var content []byte
+		if content, err = attachment.Bytes(); err != nil {
+			return result, err
+		}
+
+		// Add to the message (base64 encoded)
+		message.Attachments = append(message.Attachments, sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(content),
+			Disposition: "attachment",
+			Filename:    attachment.FileName,
+			Type:        attachment.FileType,
+		})
+	}
+
+	// Add importance
+	if email.Important {
+		message.Headers = map[string]string{
+			"X-Priority":        "1 (Highest)",
+			"X-MSMail-Priority": "High",
+			"Importance":        "High",
+		}
+	}
+
+	// Send the email
+	var resp sendGridResponse
+	if resp, err = client.SendEmail(ctx, message); err != nil {
+		return result, classifySendGridError(err)
+	}
+
+	// Build the result from the response
+	result = newSendResult(SendGrid, email, RecipientAccepted)
+	result.MessageID = resp.MessageID
+	result.RawResponse = resp
+
+	return result, nil
+}
+
+// classifySendGridError marks rate limits and server errors as transient
+func classifySendGridError(err error) error {
+	var apiErr *sendGridError
+	if errors.As(err, &apiErr) {
+		err = fmt.Errorf("%w: %w", ErrSendGridError, err)
+		if apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError {
+			return transientError(err)
+		}
+		return permanentError(err)
+	}
+	return classifyError(err)
+}
@@ -0,0 +1,203 @@
+package gomail
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSendGridInterface is a mocking interface for SendGrid
+type mockSendGridInterface struct{}
+
+// SendEmail is for mocking
+func (m *mockSendGridInterface) SendEmail(_ context.Context, message *sendGridMessage) (sendGridResponse, error) {
+	to := message.Personalizations[0].To[0].Email
+
+	// Success
+	if to == "test@domain.com" {
+		return sendGridResponse{MessageID: "14c5d75ce93.dfd.64b469.filter0001.16648.5515E0B88.0", StatusCode: http.StatusAccepted}, nil
+	}
+
+	// Invalid from address
+	if to == "test@badhostname.com" {
+		return sendGridResponse{StatusCode: http.StatusForbidden}, &sendGridError{
+			Errors:     []sendGridErrorDetail{{Field: "from", Message: "The from address does not match a verified Sender Identity."}},
+			StatusCode: http.StatusForbidden,
+		}
+	}
+
+	// Invalid api key
+	if to == "test@badtoken.com" {
+		return sendGridResponse{StatusCode: http.StatusUnauthorized}, &sendGridError{StatusCode: http.StatusUnauthorized}
+	}
+
+	// Default is success
+	return sendGridResponse{StatusCode: http.StatusAccepted}, nil
+}
+
+// newMockSendGridClient will create a new mock client for SendGrid
+func newMockSendGridClient() sendGridInterface {
+	return &mockSendGridInterface{}
+}
+
+// TestSendViaSendGrid will test the sendViaSendGrid() method
+func TestSendViaSendGrid(t *testing.T) {
+	t.Parallel()
+
+	// Start the service
+	mail := new(MailService)
+
+	// Set all the defaults, toggle all warnings
+	mail.AutoText = true
+	mail.FromDomain = "example.com"
+	mail.FromName = "No Reply"
+	mail.FromUsername = "no-reply"
+	mail.Important = true
+	mail.TrackClicks = true
+	mail.TrackOpens = true
+
+	// Setup mock client
+	client := newMockSendGridClient()
+
+	// New email
+	email := mail.NewEmail()
+	email.HTMLContent = "<html>Test</html>"
+	email.PlainTextContent = "Test"
+	email.Tags = []string{"tag1", "tag2"}
+
+	// Add an attachment
+	f, err := os.Open("examples/test-attachment-file.txt")
+	if err != nil {
+		require.NoError(t, err, "failed to attach file")
+	} else {
+		email.AddAttachment("test-attachment-file.txt", "text/plain", f)
+	}
+
+	// Create the list of tests
+	tests := []struct {
+		name          string
+		input         string
+		expectedError bool
+	}{
+		{"successful send", "test@domain.com", false},
+		{"invalid from address error", "test@badhostname.com", true},
+		{"invalid token error", "test@badtoken.com", true},
+	}
+
+	// Loop tests
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email.Recipients = []string{test.input}
+			email.RecipientsCc = []string{test.input}
+			email.RecipientsBcc = []string{test.input}
+			email.ReplyToAddress = test.input
+			result, err := sendViaSendGrid(context.Background(), client, email)
+			if test.expectedError {
+				require.ErrorIs(t, err, ErrSendGridError)
+				assert.True(t, IsPermanent(err))
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, SendGrid, result.Provider)
+				assert.Equal(t, "14c5d75ce93.dfd.64b469.filter0001.16648.5515E0B88.0", result.MessageID)
+				assert.Len(t, result.Recipients, 3)
+			}
+		})
+	}
+}
+
+// TestSendGridClient_SendEmail will test the SendEmail() method against a local server
+func TestSendGridClient_SendEmail(t *testing.T) {
+	t.Parallel()
+
+	t.Run("successful send maps the email", func(t *testing.T) {
+		var received sendGridMessage
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, sendGridSendPath, r.URL.Path)
+			assert.Equal(t, "Bearer test-api-key", r.Header.Get("Authorization"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			w.Header().Set("X-Message-Id", "test-message-id")
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		email := &Email{
+			FromAddress:      "no-reply@example.com",
+			FromName:         "No Reply",
+			HTMLContent:      "<html>Test</html>",
+			Important:        true,
+			PlainTextContent: "Test",
+			Recipients:       []string{"to@domain.com"},
+			RecipientsBcc:    []string{"bcc@domain.com"},
+			RecipientsCc:     []string{"cc@domain.com"},
+			ReplyToAddress:   "reply@example.com",
+			Subject:          "Test subject",
+			Tags:             []string{"tag1"},
+			TrackClicks:      true,
+			TrackOpens:       true,
+		}
+		email.AddAttachment("file.txt", "text/plain", strings.NewReader("attachment contents"))
+
+		result, err := sendViaSendGrid(context.Background(), newSendGridClient("test-api-key", server.URL+"/"), email)
+		require.NoError(t, err)
+		assert.Equal(t, "test-message-id", result.MessageID)
+
+		// Check the mapping of the email
+		require.Len(t, received.Personalizations, 1)
+		assert.Equal(t, "to@domain.com", received.Personalizations[0].To[0].Email)
+		assert.Equal(t, "cc@domain.com", received.Personalizations[0].Cc[0].Email)
+		assert.Equal(t, "bcc@domain.com", received.Personalizations[0].Bcc[0].Email)
+		assert.Equal(t, "No Reply", received.From.Name)
+		require.NotNil(t, received.ReplyTo)
+		assert.Equal(t, "reply@example.com", received.ReplyTo.Email)
+		require.Len(t, received.Content, 2)
+		assert.Equal(t, "text/plain", received.Content[0].Type)
+		assert.Equal(t, "text/html", received.Content[1].Type)
+		assert.Equal(t, []string{"tag1"}, received.Categories)
+		require.NotNil(t, received.TrackingSettings)
+		assert.True(t, received.TrackingSettings.ClickTracking.Enable)
+		assert.True(t, received.TrackingSettings.OpenTracking.Enable)
+		assert.Equal(t, "High", received.Headers["Importance"])
+		require.Len(t, received.Attachments, 1)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("attachment contents")), received.Attachments[0].Content)
+		assert.Equal(t, "file.txt", received.Attachments[0].Filename)
+	})
+
+	t.Run("error response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":[{"message":"The subject is required.","field":"subject"}]}`))
+		}))
+		defer server.Close()
+
+		_, err := newSendGridClient("test-api-key", server.URL).SendEmail(context.Background(), &sendGridMessage{})
+		require.Error(t, err)
+		assert.Equal(t, "sendgrid returned status 400: subject: The subject is required.", err.Error())
+	})
+
+	t.Run("server error is transient", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		email := &Email{FromAddress: "no-reply@example.com", Recipients: []string{"to@domain.com"}, Subject: "Test", PlainTextContent: "Test"}
+		_, err := sendViaSendGrid(context.Background(), newSendGridClient("test-api-key", server.URL), email)
+		require.ErrorIs(t, err, ErrSendGridError)
+		assert.True(t, IsTransient(err))
+	})
+
+	t.Run("default base url", func(t *testing.T) {
+		client := newSendGridClient("test-api-key", "")
+		assert.Equal(t, sendGridDefaultBaseURL, client.baseURL)
+		assert.Equal(t, defaultHTTPTimeout, client.httpClient.Timeout)
+	})
+}
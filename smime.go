@@ -0,0 +1,435 @@
+package gomail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// smimeLineLength is the line length of the base64 encoded S/MIME parts
+const smimeLineLength = 76
+
+// smimeConfig signs and encrypts raw MIME messages with S/MIME (RFC 8551)
+//
+// The certificates and keys are immutable after loading, so the config is safe for concurrent use
+type smimeConfig struct {
+	certificate  *x509.Certificate            // signer certificate (nil if signing is not configured)
+	chain        []*x509.Certificate          // intermediate certificates added to the signature
+	privateKey   crypto.PrivateKey            // signer private key (RSA or ECDSA)
+	recipients   map[string]*x509.Certificate // encryption certificates by lower case address
+	encryptToOwn bool                         // also encrypt to the signer certificate (the sender can read the sent copy)
+}
+
+// newSMIMEConfig will create the S/MIME config from PEM certificates and keys
+//
+// The certificate PEM can include intermediate certificates after the signer certificate, the recipient
+// certificates are used for encryption and must have RSA keys
+func newSMIMEConfig(certificatePEM, privateKeyPEM []byte, recipientPEMs map[string]string) (*smimeConfig, error) {
+	config := &smimeConfig{recipients: make(map[string]*x509.Certificate, len(recipientPEMs))}
+
+	// The signer needs both the certificate and the private key
+	if len(certificatePEM) > 0 || len(privateKeyPEM) > 0 {
+		if len(certificatePEM) == 0 || len(privateKeyPEM) == 0 {
+			return nil, fmt.Errorf("smime signing requires a certificate and private key: %w", ErrInvalidSMIMEConfig)
+		}
+		certificates, err := parseSMIMECertificates(certificatePEM)
+		if err != nil {
+			return nil, err
+		}
+		if config.privateKey, err = parseSMIMEPrivateKey(privateKeyPEM); err != nil {
+			return nil, err
+		}
+		if !smimeKeyMatches(certificates[0], config.privateKey) {
+			return nil, fmt.Errorf("smime private key does not match the certificate: %w", ErrInvalidSMIMEConfig)
+		}
+		config.certificate, config.chain = certificates[0], certificates[1:]
+		_, config.encryptToOwn = config.certificate.PublicKey.(*rsa.PublicKey)
+	}
+
+	// Load the encryption certificate for each recipient
+	for address, certificatePEM := range recipientPEMs {
+		certificates, err := parseSMIMECertificates([]byte(certificatePEM))
+		if err != nil {
+			return nil, fmt.Errorf("smime recipient %s: %w", address, err)
+		}
+		if _, ok := certificates[0].PublicKey.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("smime recipient %s certificate must have an rsa key: %w", address, ErrInvalidSMIMECertificate)
+		}
+		config.recipients[smimeAddress(address)] = certificates[0]
+	}
+
+	return config, nil
+}
+
+// parseSMIMECertificates parses every certificate in the PEM (at least one is required)
+func parseSMIMECertificates(certificatePEM []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, certificatePEM = pem.Decode(certificatePEM); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidSMIMECertificate, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("smime certificate is not PEM encoded: %w", ErrInvalidSMIMECertificate)
+	}
+	return certificates, nil
+}
+
+// parseSMIMEPrivateKey parses an RSA or ECDSA private key from PEM (PKCS#1, SEC 1 or PKCS#8)
+func parseSMIMEPrivateKey(privateKeyPEM []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("smime private key is not PEM encoded: %w", ErrInvalidSMIMEConfig)
+	}
+
+	var key crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smime private key: %w: %w", ErrInvalidSMIMEConfig, err)
+	}
+
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("smime private key type %T is not supported, use RSA or ECDSA: %w", key, ErrInvalidSMIMEConfig)
+	}
+}
+
+// smimeKeyMatches returns true if the private key belongs to the certificate
+func smimeKeyMatches(certificate *x509.Certificate, privateKey crypto.PrivateKey) bool {
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	publicKey, ok := certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && publicKey.Equal(signer.Public())
+}
+
+// smimeAddress returns the lower case address used to look up a recipient certificate
+func smimeAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// apply signs and/or encrypts the message as requested by the email
+//
+// A nil config returns ErrSMIMENotConfigured if the email requests S/MIME, otherwise the message as is
+func (c *smimeConfig) apply(email *Email, message []byte) ([]byte, error) {
+	if !email.SMIMESign && !email.SMIMEEncrypt {
+		return message, nil
+	}
+	if c == nil || (email.SMIMESign && c.certificate == nil) {
+		return nil, fmt.Errorf("smime is requested but no certificate is configured: %w", ErrSMIMENotConfigured)
+	}
+
+	// Sign first, so the signature is protected by the encryption
+	headers, entity := splitMIMEEntity(message)
+	var err error
+	if email.SMIMESign {
+		if entity, err = c.sign(entity); err != nil {
+			return nil, err
+		}
+	}
+	if email.SMIMEEncrypt {
+		if entity, err = c.encrypt(email, entity); err != nil {
+			return nil, err
+		}
+	}
+	return append(headers, entity...), nil
+}
+
+// sign wraps the entity in a multipart/signed entity with a detached signature
+func (c *smimeConfig) sign(entity []byte) ([]byte, error) {
+	signedData, err := pkcs7.NewSignedData(entity)
+	if err != nil {
+		return nil, fmt.Errorf("smime signing failed: %w", err)
+	}
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err = signedData.AddSignerChain(c.certificate, c.privateKey, c.chain, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("smime signing failed: %w", err)
+	}
+	signedData.Detach()
+	var signature []byte
+	if signature, err = signedData.Finish(); err != nil {
+		return nil, fmt.Errorf("smime signing failed: %w", err)
+	}
+
+	var boundary string
+	if boundary, err = mimeBoundary(); err != nil {
+		return nil, err
+	}
+
+	// The signed entity is everything between the first boundary and the line break before the next
+	var buf bytes.Buffer
+	buf.Grow(len(entity) + len(signature)*2 + 512)
+	buf.WriteString("Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=sha-256;\r\n")
+	buf.WriteString("\tboundary=\"" + boundary + "\"\r\n\r\n")
+	buf.WriteString("This is an S/MIME signed message\r\n\r\n")
+	buf.WriteString("--" + boundary + "\r\n")
+	buf.Write(entity)
+	buf.WriteString("\r\n--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n\r\n")
+	buf.Write(mimeBase64(signature))
+	buf.WriteString("--" + boundary + "--\r\n")
+	return buf.Bytes(), nil
+}
+
+// encrypt replaces the entity with an application/pkcs7-mime enveloped-data entity for every recipient
+//
+// Every recipient (to, cc and bcc) must have a certificate, bcc recipients are visible in the envelope
+func (c *smimeConfig) encrypt(email *Email, entity []byte) ([]byte, error) {
+	recipients := make([]*x509.Certificate, 0, len(email.Recipients)+len(email.RecipientsCc)+len(email.RecipientsBcc)+1)
+	for _, list := range [][]string{email.Recipients, email.RecipientsCc, email.RecipientsBcc} {
+		for _, address := range list {
+			certificate, ok := c.recipients[smimeAddress(address)]
+			if !ok {
+				return nil, fmt.Errorf("smime recipient %s: %w", address, ErrSMIMEMissingCertificate)
+			}
+			recipients = append(recipients, certificate)
+		}
+	}
+	if c.encryptToOwn {
+		recipients = append(recipients, c.certificate)
+	}
+
+	encrypted, err := smimeEnvelope(entity, recipients)
+	if err != nil {
+		return nil, fmt.Errorf("smime encryption failed: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(encrypted)*2 + 256)
+	buf.WriteString("Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=\"smime.p7m\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("Content-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n")
+	buf.Write(mimeBase64(encrypted))
+	return buf.Bytes(), nil
+}
+
+// splitMIMEEntity splits a message into the outer headers and the body entity (the Content-* headers and the body)
+//
+// Line endings in the entity are converted to CRLF, the canonical form that is signed
+func splitMIMEEntity(message []byte) (headers, entity []byte) {
+	header, body, found := bytes.Cut(message, []byte("\r\n\r\n"))
+	if !found {
+		header, body, _ = bytes.Cut(message, []byte("\n\n"))
+	}
+
+	var content []byte
+	inContent := false
+	for _, line := range strings.SplitAfter(strings.ReplaceAll(string(header), "\r\n", "\n"), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		line = strings.TrimSuffix(line, "\n") + "\r\n"
+
+		// Folded lines belong to the previous header
+		if line[0] != ' ' && line[0] != '\t' {
+			inContent = strings.HasPrefix(strings.ToLower(line), "content-")
+		}
+		if inContent {
+			content = append(content, line...)
+		} else {
+			headers = append(headers, line...)
+		}
+	}
+
+	entity = make([]byte, 0, len(content)+len(body)+2)
+	entity = append(entity, content...)
+	entity = append(entity, "\r\n"...)
+	entity = append(entity, mimeCRLF(body)...)
+	return headers, entity
+}
+
+// mimeCRLF converts bare line feeds to CRLF
+func mimeCRLF(data []byte) []byte {
+	if bytes.Count(data, []byte("\n")) == bytes.Count(data, []byte("\r\n")) {
+		return data
+	}
+	return bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+}
+
+// mimeBase64 encodes the data as base64 in lines of 76 characters
+func mimeBase64(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	buf.Grow(len(encoded) + len(encoded)/smimeLineLength*2 + 2)
+	for len(encoded) > smimeLineLength {
+		buf.WriteString(encoded[:smimeLineLength] + "\r\n")
+		encoded = encoded[smimeLineLength:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// mimeBoundary returns a random multipart boundary
+func mimeBoundary() (string, error) {
+	random := make([]byte, 30)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("mime boundary: %w", err)
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// smimeEnabled returns true if any S/MIME setting is configured
+func (m *MailService) smimeEnabled() bool {
+	return len(m.SMIMECertificate) > 0 || len(m.SMIMECertificateFile) > 0 ||
+		len(m.SMIMEPrivateKey) > 0 || len(m.SMIMEPrivateKeyFile) > 0 || len(m.SMIMERecipientCertificates) > 0
+}
+
+// loadSMIMEConfig will create the S/MIME config from the MailService settings (nil if S/MIME is not configured)
+func (m *MailService) loadSMIMEConfig() (*smimeConfig, error) {
+	if !m.smimeEnabled() {
+		return nil, nil //nolint:nilnil // smime is optional
+	}
+
+	// Load the certificate and key from the files if they are not given
+	certificate, privateKey := []byte(m.SMIMECertificate), []byte(m.SMIMEPrivateKey)
+	var err error
+	if len(certificate) == 0 && len(m.SMIMECertificateFile) > 0 {
+		if certificate, err = os.ReadFile(m.SMIMECertificateFile); err != nil {
+			return nil, fmt.Errorf("smime certificate file: %w", err)
+		}
+	}
+	if len(privateKey) == 0 && len(m.SMIMEPrivateKeyFile) > 0 {
+		if privateKey, err = os.ReadFile(m.SMIMEPrivateKeyFile); err != nil {
+			return nil, fmt.Errorf("smime private key file: %w", err)
+		}
+	}
+	return newSMIMEConfig(certificate, privateKey, m.SMIMERecipientCertificates)
+}
+
+// The ASN.1 structures of a PKCS #7 enveloped-data message (RFC 2315)
+//
+// pkcs7.Encrypt picks the content encryption algorithm from a package variable, so the
+// message is built here with AES-256-CBC for every call instead of changing that setting
+type (
+	smimeContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+	}
+	smimeEnvelopedData struct {
+		Version              int
+		RecipientInfos       []smimeRecipientInfo `asn1:"set"`
+		EncryptedContentInfo smimeEncryptedContentInfo
+	}
+	smimeRecipientInfo struct {
+		Version                int
+		IssuerAndSerialNumber  smimeIssuerAndSerial
+		KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedKey           []byte
+	}
+	smimeIssuerAndSerial struct {
+		IssuerName   asn1.RawValue
+		SerialNumber *big.Int
+	}
+	smimeEncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           asn1.RawValue `asn1:"tag:0,optional"`
+	}
+)
+
+// smimeEnvelope encrypts the content with AES-256-CBC and the key with RSA (PKCS #1 v1.5) for each recipient
+func smimeEnvelope(content []byte, recipients []*x509.Certificate) ([]byte, error) {
+	// Encrypt the padded content with a random key
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(content)%aes.BlockSize
+	plaintext := make([]byte, len(content)+padding)
+	copy(plaintext, content)
+	for i := len(content); i < len(plaintext); i++ {
+		plaintext[i] = byte(padding)
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	// Encrypt the key for each recipient
+	infos := make([]smimeRecipientInfo, 0, len(recipients))
+	for _, recipient := range recipients {
+		publicKey, ok := recipient.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("smime certificate %s: %w", recipient.Subject, pkcs7.ErrUnsupportedKeyType)
+		}
+		var encryptedKey []byte
+		if encryptedKey, err = rsa.EncryptPKCS1v15(rand.Reader, publicKey, key); err != nil {
+			return nil, err
+		}
+		infos = append(infos, smimeRecipientInfo{
+			EncryptedKey: encryptedKey,
+			IssuerAndSerialNumber: smimeIssuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: recipient.RawIssuer},
+				SerialNumber: recipient.SerialNumber,
+			},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: pkcs7.OIDEncryptionAlgorithmRSA},
+		})
+	}
+
+	enveloped, err := asn1.Marshal(smimeEnvelopedData{
+		EncryptedContentInfo: smimeEncryptedContentInfo{
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  pkcs7.OIDEncryptionAlgorithmAES256CBC,
+				Parameters: asn1.RawValue{Tag: asn1.TagOctetString, Bytes: iv},
+			},
+			ContentType:      pkcs7.OIDData,
+			EncryptedContent: asn1.RawValue{Bytes: ciphertext, Class: asn1.ClassContextSpecific},
+		},
+		RecipientInfos: infos,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(smimeContentInfo{
+		Content:     asn1.RawValue{Bytes: enveloped, Class: asn1.ClassContextSpecific, IsCompound: true},
+		ContentType: pkcs7.OIDEnvelopedData,
+	})
+}
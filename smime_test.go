@@ -0,0 +1,547 @@
+package gomail
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSMIMEIdentity is a certificate and private key issued by the test CA
+type testSMIMEIdentity struct {
+	certificate    *x509.Certificate
+	certificatePEM []byte
+	key            crypto.Signer
+	keyPEM         []byte
+}
+
+// testSMIMEPKI is a root CA, an intermediate CA and the identities it issued
+type testSMIMEPKI struct {
+	root         *x509.Certificate
+	intermediate testSMIMEIdentity
+	sender       testSMIMEIdentity // RSA, issued by the intermediate
+	senderECDSA  testSMIMEIdentity // ECDSA, issued by the intermediate
+	recipient    testSMIMEIdentity // RSA, issued by the intermediate
+	other        testSMIMEIdentity // RSA, issued by the intermediate
+}
+
+// testSMIMEPKIOnce generates the test PKI once (RSA keys are slow to generate)
+var testSMIMEPKIOnce = sync.OnceValues(newTestSMIMEPKI)
+
+// newTestSMIMEPKI will create the test CA and identities
+func newTestSMIMEPKI() (*testSMIMEPKI, error) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	rootTemplate := &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NotAfter:              time.Now().Add(time.Hour),
+		NotBefore:             time.Now().Add(-time.Hour),
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-mail test root"},
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	pki := new(testSMIMEPKI)
+	if pki.root, err = x509.ParseCertificate(rootDER); err != nil {
+		return nil, err
+	}
+
+	// Issue the intermediate CA and the identities
+	issue := func(serial int64, name string, key crypto.Signer, isCA bool, issuer testSMIMEIdentity) (identity testSMIMEIdentity, issueErr error) {
+		template := &x509.Certificate{
+			BasicConstraintsValid: true,
+			IsCA:                  isCA,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			NotAfter:              time.Now().Add(time.Hour),
+			NotBefore:             time.Now().Add(-time.Hour),
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: name},
+		}
+		if isCA {
+			template.KeyUsage = x509.KeyUsageCertSign
+		} else {
+			template.EmailAddresses = []string{name}
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+		}
+		var der []byte
+		if der, issueErr = x509.CreateCertificate(rand.Reader, template, issuer.certificate, key.Public(), issuer.key); issueErr != nil {
+			return identity, issueErr
+		}
+		if identity.certificate, issueErr = x509.ParseCertificate(der); issueErr != nil {
+			return identity, issueErr
+		}
+		var keyDER []byte
+		if keyDER, issueErr = x509.MarshalPKCS8PrivateKey(key); issueErr != nil {
+			return identity, issueErr
+		}
+		identity.certificatePEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		identity.key = key
+		identity.keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+		return identity, nil
+	}
+
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if pki.intermediate, err = issue(2, "go-mail test intermediate", intermediateKey, true, testSMIMEIdentity{certificate: pki.root, key: rootKey}); err != nil {
+		return nil, err
+	}
+
+	identities := []struct {
+		identity *testSMIMEIdentity
+		name     string
+		ecdsa    bool
+	}{
+		{&pki.sender, "no-reply@example.com", false},
+		{&pki.senderECDSA, "no-reply@example.com", true},
+		{&pki.recipient, "test@domain.com", false},
+		{&pki.other, "other@domain.com", false},
+	}
+	for index, identity := range identities {
+		var key crypto.Signer
+		if identity.ecdsa {
+			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		} else {
+			key, err = rsa.GenerateKey(rand.Reader, 2048)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if *identity.identity, err = issue(int64(index+3), identity.name, key, false, pki.intermediate); err != nil {
+			return nil, err
+		}
+	}
+	return pki, nil
+}
+
+// testSMIME returns the test PKI
+func testSMIME(t testing.TB) *testSMIMEPKI {
+	t.Helper()
+	pki, err := testSMIMEPKIOnce()
+	require.NoError(t, err)
+	return pki
+}
+
+// roots returns a pool with the root CA
+func (p *testSMIMEPKI) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(p.root)
+	return pool
+}
+
+// senderChainPEM returns the sender certificate followed by the intermediate certificate
+func (p *testSMIMEPKI) senderChainPEM() []byte {
+	return append(append([]byte{}, p.sender.certificatePEM...), p.intermediate.certificatePEM...)
+}
+
+// parseTestMIME parses the message headers and returns the media type, params and body
+func parseTestMIME(t *testing.T, message []byte) (mail.Header, string, map[string]string, []byte) {
+	t.Helper()
+	parsed, err := mail.ReadMessage(bytes.NewReader(message))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(parsed.Body)
+	require.NoError(t, err)
+	return parsed.Header, mediaType, params, body
+}
+
+// verifyTestSMIME verifies the multipart/signed message against the test root and returns the signed entity
+func verifyTestSMIME(t *testing.T, pki *testSMIMEPKI, message []byte) []byte {
+	t.Helper()
+
+	_, mediaType, params, body := parseTestMIME(t, message)
+	require.Equal(t, "multipart/signed", mediaType)
+	assert.Equal(t, "application/pkcs7-signature", params["protocol"])
+	assert.Equal(t, "sha-256", params["micalg"])
+
+	// The signed entity is the raw first part (between the delimiters)
+	delimiter := []byte("--" + params["boundary"] + "\r\n")
+	start := bytes.Index(body, delimiter)
+	require.GreaterOrEqual(t, start, 0)
+	entity := body[start+len(delimiter):]
+	end := bytes.Index(entity, []byte("\r\n--"+params["boundary"]))
+	require.GreaterOrEqual(t, end, 0)
+	entity = entity[:end]
+
+	// The second part is the detached signature
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	_, err := reader.NextPart()
+	require.NoError(t, err)
+	part, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "application/pkcs7-signature; name=\"smime.p7s\"", part.Header.Get("Content-Type"))
+	encoded, err := io.ReadAll(part)
+	require.NoError(t, err)
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(encoded)), ""))
+	require.NoError(t, err)
+
+	p7, err := pkcs7.Parse(signature)
+	require.NoError(t, err)
+	p7.Content = entity
+	require.NoError(t, p7.VerifyWithChain(pki.roots()))
+	return entity
+}
+
+// decryptTestSMIME decrypts the application/pkcs7-mime message with the identity and returns the entity
+func decryptTestSMIME(t *testing.T, identity testSMIMEIdentity, message []byte) ([]byte, error) {
+	t.Helper()
+
+	header, mediaType, params, body := parseTestMIME(t, message)
+	require.Equal(t, "application/pkcs7-mime", mediaType)
+	assert.Equal(t, "enveloped-data", params["smime-type"])
+	assert.Equal(t, "base64", header.Get("Content-Transfer-Encoding"))
+
+	encrypted, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(encrypted)
+	require.NoError(t, err)
+	return p7.Decrypt(identity.certificate, identity.key)
+}
+
+// newTestSMIMEConfig will create the S/MIME config for the sender with certificates for the test recipient
+func newTestSMIMEConfig(t *testing.T, pki *testSMIMEPKI) *smimeConfig {
+	t.Helper()
+	config, err := newSMIMEConfig(pki.senderChainPEM(), pki.sender.keyPEM, map[string]string{
+		"Test@Domain.com": string(pki.recipient.certificatePEM),
+	})
+	require.NoError(t, err)
+	return config
+}
+
+// TestNewSMIMEConfig will test the newSMIMEConfig() method
+func TestNewSMIMEConfig(t *testing.T) {
+	t.Parallel()
+
+	pki := testSMIME(t)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ed25519DER, err := x509.MarshalPKCS8PrivateKey(ed25519Key)
+	require.NoError(t, err)
+	ed25519PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ed25519DER})
+
+	tests := []struct {
+		name        string
+		certificate []byte
+		privateKey  []byte
+		recipients  map[string]string
+		expectedErr error
+	}{
+		{"signer with chain", pki.senderChainPEM(), pki.sender.keyPEM, nil, nil},
+		{"ecdsa signer", pki.senderECDSA.certificatePEM, pki.senderECDSA.keyPEM, nil, nil},
+		{"recipients only", nil, nil, map[string]string{"test@domain.com": string(pki.recipient.certificatePEM)}, nil},
+		{"certificate without key", pki.sender.certificatePEM, nil, nil, ErrInvalidSMIMEConfig},
+		{"key without certificate", nil, pki.sender.keyPEM, nil, ErrInvalidSMIMEConfig},
+		{"certificate not pem", []byte("invalid"), pki.sender.keyPEM, nil, ErrInvalidSMIMECertificate},
+		{"invalid certificate", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("bad")}), pki.sender.keyPEM, nil, ErrInvalidSMIMECertificate},
+		{"key not pem", pki.sender.certificatePEM, []byte("invalid"), nil, ErrInvalidSMIMEConfig},
+		{"key does not match", pki.sender.certificatePEM, pki.recipient.keyPEM, nil, ErrInvalidSMIMEConfig},
+		{"unsupported ed25519 key", pki.sender.certificatePEM, ed25519PEM, nil, ErrInvalidSMIMEConfig},
+		{"invalid recipient", nil, nil, map[string]string{"test@domain.com": "invalid"}, ErrInvalidSMIMECertificate},
+		{"ecdsa recipient", nil, nil, map[string]string{"test@domain.com": string(pki.senderECDSA.certificatePEM)}, ErrInvalidSMIMECertificate},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, configErr := newSMIMEConfig(test.certificate, test.privateKey, test.recipients)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, configErr, test.expectedErr)
+				return
+			}
+			require.NoError(t, configErr)
+			assert.Len(t, config.recipients, len(test.recipients))
+		})
+	}
+
+	t.Run("intermediates are added to the chain", func(t *testing.T) {
+		config := newTestSMIMEConfig(t, pki)
+		assert.Equal(t, pki.sender.certificate, config.certificate)
+		require.Len(t, config.chain, 1)
+		assert.Equal(t, pki.intermediate.certificate, config.chain[0])
+		assert.True(t, config.encryptToOwn)
+		assert.Contains(t, config.recipients, "test@domain.com")
+	})
+}
+
+// TestSMIME_RoundTrip will test signed and encrypted messages can be verified and decrypted
+func TestSMIME_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	pki := testSMIME(t)
+	config := newTestSMIMEConfig(t, pki)
+
+	newEmail := func(sign, encrypt bool) *Email {
+		return &Email{
+			FromAddress:      "no-reply@example.com",
+			FromName:         "No Reply",
+			HTMLContent:      "<html>Secret content</html>",
+			PlainTextContent: "Secret content",
+			Recipients:       []string{"test@domain.com"},
+			SMIMEEncrypt:     encrypt,
+			SMIMESign:        sign,
+			Subject:          "Signed and sealed",
+		}
+	}
+
+	t.Run("signed via smtp", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		_, err := sendViaSMTP(context.Background(), newSMTPDialer(server.addr, nil, SMTPTLSNone, nil), &messageSecurity{smime: config}, newEmail(true, false))
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		header, _, _, _ := parseTestMIME(t, []byte(messages[0].data))
+		assert.Equal(t, "Signed and sealed", header.Get("Subject"))
+		assert.Equal(t, "1.0", header.Get("Mime-Version"))
+
+		// The signed entity is the original multipart/mixed message
+		entity := verifyTestSMIME(t, pki, []byte(messages[0].data))
+		assert.True(t, bytes.HasPrefix(entity, []byte("Content-Type: multipart/mixed;\r\n\tboundary=")))
+		assert.Contains(t, string(entity), "Secret content")
+	})
+
+	t.Run("signed with ecdsa", func(t *testing.T) {
+		ecdsaConfig, err := newSMIMEConfig(pki.senderECDSA.certificatePEM, pki.senderECDSA.keyPEM, nil)
+		require.NoError(t, err)
+		assert.False(t, ecdsaConfig.encryptToOwn)
+
+		raw, err := awsSesRawMessage(newEmail(true, false), true, &messageSecurity{smime: ecdsaConfig})
+		require.NoError(t, err)
+		verifyTestSMIME(t, &testSMIMEPKI{root: pki.intermediate.certificate}, raw)
+	})
+
+	t.Run("tampered message fails verification", func(t *testing.T) {
+		raw, err := awsSesRawMessage(newEmail(true, false), true, &messageSecurity{smime: config})
+		require.NoError(t, err)
+		_, _, params, body := parseTestMIME(t, raw)
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		_, err = reader.NextPart()
+		require.NoError(t, err)
+		part, err := reader.NextPart()
+		require.NoError(t, err)
+		encoded, err := io.ReadAll(part)
+		require.NoError(t, err)
+		signature, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(encoded)), ""))
+		require.NoError(t, err)
+		p7, err := pkcs7.Parse(signature)
+		require.NoError(t, err)
+		_, entity := splitMIMEEntity(raw)
+		p7.Content = bytes.Replace(entity, []byte("Secret content"), []byte("Secret c0ntent"), 1)
+		require.Error(t, p7.VerifyWithChain(pki.roots()))
+	})
+
+	t.Run("encrypted via aws ses", func(t *testing.T) {
+		raw, err := awsSesRawMessage(newEmail(false, true), true, &messageSecurity{smime: config})
+		require.NoError(t, err)
+		assert.NotContains(t, string(raw), "Secret content")
+
+		// The recipient and the sender can decrypt, another key cannot
+		entity, err := decryptTestSMIME(t, pki.recipient, raw)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(entity, []byte("Content-Type: multipart/mixed;")))
+		assert.Contains(t, string(entity), "Secret content")
+		_, err = decryptTestSMIME(t, pki.sender, raw)
+		require.NoError(t, err)
+		_, err = decryptTestSMIME(t, pki.other, raw)
+		require.Error(t, err)
+	})
+
+	t.Run("signed then encrypted", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		_, err := sendViaSMTP(context.Background(), newSMTPDialer(server.addr, nil, SMTPTLSNone, nil), &messageSecurity{smime: config}, newEmail(true, true))
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		entity, err := decryptTestSMIME(t, pki.recipient, []byte(messages[0].data))
+		require.NoError(t, err)
+
+		// The decrypted entity is a signed message
+		signed := verifyTestSMIME(t, pki, entity)
+		assert.Contains(t, string(signed), "Secret content")
+	})
+
+	t.Run("dkim signs the secured message", func(t *testing.T) {
+		signer, err := newDKIMSigner("football.example.com", "brisbane", testDKIMEd25519PrivateKey(t), nil)
+		require.NoError(t, err)
+		raw, err := awsSesRawMessage(newEmail(true, true), false, &messageSecurity{dkim: signer, smime: config})
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(raw, []byte("DKIM-Signature:")))
+		verifyTestDKIM(t, raw)
+		_, err = decryptTestSMIME(t, pki.recipient, raw)
+		require.NoError(t, err)
+	})
+
+	t.Run("recipient without a certificate", func(t *testing.T) {
+		email := newEmail(false, true)
+		email.RecipientsBcc = []string{"unknown@domain.com"}
+		_, err := awsSesRawMessage(email, true, &messageSecurity{smime: config})
+		require.ErrorIs(t, err, ErrSMIMEMissingCertificate)
+		assert.Contains(t, err.Error(), "unknown@domain.com")
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		_, err := awsSesRawMessage(newEmail(true, false), true, nil)
+		require.ErrorIs(t, err, ErrSMIMENotConfigured)
+
+		// Encryption only config cannot sign
+		encryptOnly, err := newSMIMEConfig(nil, nil, map[string]string{"test@domain.com": string(pki.recipient.certificatePEM)})
+		require.NoError(t, err)
+		_, err = awsSesRawMessage(newEmail(true, false), true, &messageSecurity{smime: encryptOnly})
+		require.ErrorIs(t, err, ErrSMIMENotConfigured)
+		raw, err := awsSesRawMessage(newEmail(false, true), true, &messageSecurity{smime: encryptOnly})
+		require.NoError(t, err)
+		_, err = decryptTestSMIME(t, pki.recipient, raw)
+		require.NoError(t, err)
+	})
+}
+
+// TestSMIMEEnvelope will test the smimeEnvelope() method
+func TestSMIMEEnvelope(t *testing.T) {
+	t.Parallel()
+
+	pki := testSMIME(t)
+	content := []byte("Content-Type: text/plain\r\n\r\nSecret content\r\n")
+	encrypted, err := smimeEnvelope(content, []*x509.Certificate{pki.recipient.certificate, pki.other.certificate})
+	require.NoError(t, err)
+
+	// Every recipient can decrypt it
+	for _, identity := range []testSMIMEIdentity{pki.recipient, pki.other} {
+		p7, parseErr := pkcs7.Parse(encrypted)
+		require.NoError(t, parseErr)
+		decrypted, decryptErr := p7.Decrypt(identity.certificate, identity.key)
+		require.NoError(t, decryptErr)
+		assert.Equal(t, content, decrypted)
+	}
+
+	// The content is encrypted with AES-256-CBC without changing the pkcs7 package setting
+	var info smimeContentInfo
+	_, err = asn1.Unmarshal(encrypted, &info)
+	require.NoError(t, err)
+	var enveloped smimeEnvelopedData
+	_, err = asn1.Unmarshal(info.Content.Bytes, &enveloped)
+	require.NoError(t, err)
+	assert.True(t, enveloped.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm.Equal(pkcs7.OIDEncryptionAlgorithmAES256CBC))
+	require.Len(t, enveloped.RecipientInfos, 2)
+	assert.Equal(t, pkcs7.EncryptionAlgorithmDESCBC, pkcs7.ContentEncryptionAlgorithm)
+
+	// Only RSA certificates can be used
+	_, err = smimeEnvelope(content, []*x509.Certificate{pki.senderECDSA.certificate})
+	require.ErrorIs(t, err, pkcs7.ErrUnsupportedKeyType)
+}
+
+// TestSplitMIMEEntity will test the splitMIMEEntity() method
+func TestSplitMIMEEntity(t *testing.T) {
+	t.Parallel()
+
+	headers, entity := splitMIMEEntity([]byte("From: a@example.com\nContent-Type: multipart/mixed;\n\tboundary=\"b\"\nSubject: Hi\n  there\nContent-Transfer-Encoding: 7bit\n\nline 1\nline 2\n"))
+	assert.Equal(t, "From: a@example.com\r\nSubject: Hi\r\n  there\r\n", string(headers))
+	assert.Equal(t, "Content-Type: multipart/mixed;\r\n\tboundary=\"b\"\r\nContent-Transfer-Encoding: 7bit\r\n\r\nline 1\r\nline 2\r\n", string(entity))
+}
+
+// TestMailService_loadSMIMEConfig will test loading S/MIME from the MailService
+func TestMailService_loadSMIMEConfig(t *testing.T) {
+	t.Parallel()
+
+	pki := testSMIME(t)
+	dir := t.TempDir()
+	certificateFile := filepath.Join(dir, "smime.crt")
+	keyFile := filepath.Join(dir, "smime.key")
+	require.NoError(t, os.WriteFile(certificateFile, pki.senderChainPEM(), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pki.sender.keyPEM, 0o600))
+
+	t.Run("not configured", func(t *testing.T) {
+		config, err := (&MailService{}).loadSMIMEConfig()
+		require.NoError(t, err)
+		assert.Nil(t, config)
+	})
+
+	t.Run("certificate and key files", func(t *testing.T) {
+		config, err := (&MailService{SMIMECertificateFile: certificateFile, SMIMEPrivateKeyFile: keyFile}).loadSMIMEConfig()
+		require.NoError(t, err)
+		assert.Equal(t, pki.sender.certificate, config.certificate)
+		assert.Len(t, config.chain, 1)
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		_, err := (&MailService{SMIMECertificateFile: certificateFile + ".missing", SMIMEPrivateKeyFile: keyFile}).loadSMIMEConfig()
+		require.ErrorIs(t, err, os.ErrNotExist)
+		_, err = (&MailService{SMIMECertificateFile: certificateFile, SMIMEPrivateKeyFile: keyFile + ".missing"}).loadSMIMEConfig()
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("startup fails with an invalid certificate", func(t *testing.T) {
+		mail := newTestSMTPMailService(t, newTestSMTPServer(t))
+		mail.SMIMECertificate = "invalid"
+		mail.SMIMEPrivateKey = string(pki.sender.keyPEM)
+		require.ErrorIs(t, mail.StartUp(), ErrInvalidSMIMECertificate)
+	})
+
+	t.Run("startup signs and encrypts smtp messages", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		mail := newTestSMTPMailService(t, server)
+		mail.SMIMECertificate = string(pki.senderChainPEM())
+		mail.SMIMEPrivateKey = string(pki.sender.keyPEM)
+		mail.SMIMERecipientCertificates = map[string]string{"test@domain.com": string(pki.recipient.certificatePEM)}
+		require.NoError(t, mail.StartUp())
+		defer func() {
+			_ = mail.Close()
+		}()
+
+		email := newTestSMTPEmail(mail)
+		email.SMIMESign = true
+		email.SMIMEEncrypt = true
+		require.NoError(t, mail.SendEmail(context.Background(), email, SMTP))
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		entity, err := decryptTestSMIME(t, pki.recipient, []byte(messages[0].data))
+		require.NoError(t, err)
+		assert.Contains(t, string(verifyTestSMIME(t, pki, entity)), "Test email content")
+	})
+
+	t.Run("providers without smime are refused", func(t *testing.T) {
+		mail := new(MailService)
+		mail.MaxToRecipients = maxToRecipients
+		provider := &mockCustomProvider{}
+		require.NoError(t, mail.RegisterProvider(testRelayProvider, provider))
+
+		email := newTestSMTPEmail(mail)
+		email.FromAddress = "no-reply@example.com"
+		email.SMIMEEncrypt = true
+		err := mail.SendEmail(context.Background(), email, testRelayProvider)
+		require.ErrorIs(t, err, ErrSMIMENotSupported)
+		assert.True(t, IsPermanent(err))
+		assert.Empty(t, provider.sent)
+	})
+}
@@ -1,92 +1,298 @@
 package gomail
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/smtp"
+	"net/textproto"
+	"strings"
+)
+
+// smtpSender is an interface for delivering a built message over SMTP/mocking
+type smtpSender interface {
+	SendMail(ctx context.Context, envelope smtpEnvelope, msg []byte) error
+}
+
+// smtpEnvelope is the SMTP envelope of a message (MAIL FROM, RCPT TO and the DSN parameters)
+type smtpEnvelope struct {
+	dsn  *DSN
+	from string
+	to   []string
+}
+
+// SMTPTLSMode is how TLS is used for SMTP connections
+type SMTPTLSMode int
 
-	"github.com/domodwyer/mailyak"
+// SMTP TLS modes
+const (
+	SMTPTLSOpportunistic SMTPTLSMode = iota // upgrade with STARTTLS if the server offers it (default)
+	SMTPTLSNone                             // never use TLS (internal relays only)
+	SMTPTLSRequired                         // require STARTTLS, fail if the server does not offer it
+	SMTPTLSImplicit                         // connect with TLS (ie: port 465)
 )
 
-// smtpInterface is an interface for mailyak/mocking
-type smtpInterface interface {
-	AddHeader(name, value string)
-	Attach(name string, r io.Reader)
-	AttachInline(name string, r io.Reader)
-	AttachInlineWithMimeType(name string, r io.Reader, mimeType string)
-	AttachWithMimeType(name string, r io.Reader, mimeType string)
-	Bcc(addrs ...string)
-	Cc(addrs ...string)
-	ClearAttachments()
-	From(addr string)
-	FromName(name string)
-	HTML() *mailyak.BodyPart
-	MimeBuf() (*bytes.Buffer, error)
-	Plain() *mailyak.BodyPart
-	ReplyTo(addr string)
-	Send() error
-	String() string
-	Subject(sub string)
-	To(addrs ...string)
-	WriteBccHeader(shouldWrite bool)
+// String returns the name of the TLS mode
+func (m SMTPTLSMode) String() string {
+	switch m {
+	case SMTPTLSOpportunistic:
+		return "opportunistic"
+	case SMTPTLSNone:
+		return "none"
+	case SMTPTLSRequired:
+		return "required"
+	case SMTPTLSImplicit:
+		return "implicit"
+	default:
+		return fmt.Sprintf("SMTPTLSMode(%d)", int(m))
+	}
 }
 
-// newSMTPClient will create a new yak client given the connection string and auth
-func newSMTPClient(host string, auth smtp.Auth) smtpInterface {
-	return mailyak.New(host, auth)
+// smtpDialer delivers messages by dialing the SMTP server for each message
+//
+// The connection config is immutable after creation, so the dialer is safe for concurrent use
+type smtpDialer struct {
+	addr      string
+	auth      smtp.Auth
+	tlsConfig *tls.Config
+	tlsMode   SMTPTLSMode
 }
 
-// sendViaSMTP sends an email using the smtp service
-func sendViaSMTP(client smtpInterface, email *Email) (err error) {
-	// Add the "to" recipients
-	client.To(email.Recipients...)
+// newSMTPDialer will create a new dialer given the connection string (host:port), auth and TLS settings
+//
+// The tls config is cloned, the ServerName defaults to the host and the MinVersion to TLS 1.2
+func newSMTPDialer(addr string, auth smtp.Auth, tlsMode SMTPTLSMode, tlsConfig *tls.Config) *smtpDialer {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{} //nolint:gosec // MinVersion is set below
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if len(tlsConfig.ServerName) == 0 {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	return &smtpDialer{addr: addr, auth: auth, tlsConfig: tlsConfig, tlsMode: tlsMode}
+}
 
-	// Add the "cc" recipients
-	if len(email.RecipientsCc) > 0 {
-		client.Cc(email.RecipientsCc...)
+// SendMail is a context-aware smtp.SendMail: the dial honors the context and the connection
+// is closed if the context is canceled or its deadline passes during the conversation
+func (d *smtpDialer) SendMail(ctx context.Context, envelope smtpEnvelope, msg []byte) error {
+	client, err := d.dial(ctx)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		_ = client.Close()
+	}()
 
-	// Add the "bcc" recipients
-	if len(email.RecipientsBcc) > 0 {
-		client.WriteBccHeader(true)
-		client.Bcc(email.RecipientsBcc...)
+	return smtpWithContext(ctx, client, func() error {
+		if err = smtpDeliver(client, envelope, msg); err != nil {
+			return err
+		}
+		return client.Quit()
+	})
+}
+
+// dial connects to the server and completes the handshake (EHLO, STARTTLS and AUTH)
+func (d *smtpDialer) dial(ctx context.Context) (*smtp.Client, error) {
+	host, _, err := net.SplitHostPort(d.addr)
+	if err != nil {
+		return nil, err
 	}
 
-	// Add the basics
-	client.From(email.FromAddress)
-	client.FromName(email.FromName)
-	client.Subject(email.Subject)
+	// Dial the server (with TLS for implicit mode)
+	var conn net.Conn
+	if d.tlsMode == SMTPTLSImplicit {
+		dialer := &tls.Dialer{Config: d.tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", d.addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", d.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	// Add a custom reply to address
-	if len(email.ReplyToAddress) > 0 {
-		client.ReplyTo(email.ReplyToAddress)
+	// Run the handshake
+	var client *smtp.Client
+	if err = smtpWithContext(ctx, conn, func() (handshakeErr error) {
+		if client, handshakeErr = smtp.NewClient(conn, host); handshakeErr != nil {
+			return handshakeErr
+		}
+		return d.handshake(client)
+	}); err != nil {
+		_ = conn.Close()
+		return nil, err
 	}
+	return client, nil
+}
 
-	// Add plain text
-	if len(email.PlainTextContent) > 0 {
-		client.Plain().Set(email.PlainTextContent)
+// smtpWithContext runs fn and closes the connection if the context is done before fn returns
+func smtpWithContext(ctx context.Context, conn io.Closer, fn func() error) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	err := fn()
+	if !stop() && err != nil {
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
 	}
+	return err
+}
 
-	// Add html
-	if len(email.HTMLContent) > 0 {
-		client.HTML().Set(email.HTMLContent)
+// handshake greets the server, upgrades to TLS (per the TLS mode) and authenticates if supported
+func (d *smtpDialer) handshake(client *smtp.Client) (err error) {
+	if err = client.Hello("localhost"); err != nil {
+		return err
 	}
 
-	// Add any attachments
-	if len(email.Attachments) > 0 {
-		for _, att := range email.Attachments {
-			client.Attach(att.FileName, att.FileReader)
+	// Upgrade the connection with STARTTLS
+	if d.tlsMode == SMTPTLSOpportunistic || d.tlsMode == SMTPTLSRequired {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(d.tlsConfig); err != nil {
+				return err
+			}
+		} else if d.tlsMode == SMTPTLSRequired {
+			return fmt.Errorf("server %s: %w", d.addr, ErrSMTPStartTLSNotSupported)
 		}
 	}
 
-	// Add importance?
-	if email.Important {
-		client.AddHeader("X-Priority", "1 (Highest)")
-		client.AddHeader("X-MSMail-Priority", "High")
-		client.AddHeader("Importance", "High")
+	if d.auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err = client.Auth(d.auth); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
+// smtpDeliver sends a single message on an open connection (MAIL, RCPT and DATA)
+//
+// The DSN parameters are only sent if the server advertises the DSN extension
+func smtpDeliver(client *smtp.Client, envelope smtpEnvelope, msg []byte) (err error) {
+	if ok, _ := client.Extension("DSN"); ok && envelope.dsn != nil {
+		err = smtpEnvelopeWithDSN(client, envelope)
+	} else {
+		err = smtpEnvelopePlain(client, envelope)
+	}
+	if err != nil {
+		return err
+	}
+
+	var writer io.WriteCloser
+	if writer, err = client.Data(); err != nil {
+		return err
+	}
+	if _, err = writer.Write(msg); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// smtpEnvelopePlain sends the envelope without any DSN parameters
+func smtpEnvelopePlain(client *smtp.Client, envelope smtpEnvelope) (err error) {
+	if err = client.Mail(envelope.from); err != nil {
+		return err
+	}
+	for _, addr := range envelope.to {
+		if err = client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// smtpEnvelopeWithDSN sends the envelope with the DSN parameters (RET and ENVID on MAIL, NOTIFY and ORCPT on RCPT)
+func smtpEnvelopeWithDSN(client *smtp.Client, envelope smtpEnvelope) (err error) {
+	command := "MAIL FROM:<" + envelope.from + ">"
+	if ok, _ := client.Extension("8BITMIME"); ok {
+		command += " BODY=8BITMIME"
+	}
+	if len(envelope.dsn.Return) > 0 {
+		command += " RET=" + envelope.dsn.Return
+	}
+	if len(envelope.dsn.EnvelopeID) > 0 {
+		command += " ENVID=" + smtpXText(envelope.dsn.EnvelopeID)
+	}
+	if err = smtpCommand(client, 250, command); err != nil {
+		return err
+	}
+
+	for _, addr := range envelope.to {
+		command = "RCPT TO:<" + addr + ">"
+		if len(envelope.dsn.Notify) > 0 {
+			command += " NOTIFY=" + strings.Join(envelope.dsn.Notify, ",")
+		}
+		command += " ORCPT=rfc822;" + smtpXText(addr)
+		if err = smtpCommand(client, 25, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// smtpCommand sends a raw command and reads the reply (the code can be a prefix, ie: 25 for 250 or 251)
+func smtpCommand(client *smtp.Client, expectCode int, command string) error {
+	if strings.ContainsAny(command, "\r\n") {
+		return fmt.Errorf("smtp command contains a line break: %w", ErrInvalidSMTPCommand)
+	}
+	id, err := client.Text.Cmd("%s", command)
+	if err != nil {
+		return err
+	}
+	client.Text.StartResponse(id)
+	defer client.Text.EndResponse(id)
+	_, _, err = client.Text.ReadResponse(expectCode)
+	return err
+}
+
+// smtpProvider is the SMTP provider
+//
+// A fresh message is built for every send, so concurrent sends never share recipients, attachments or headers
+type smtpProvider struct {
+	security *messageSecurity
+	sender   smtpSender
+}
+
+// Name returns the name of the provider
+func (p *smtpProvider) Name() string {
+	return "smtp"
+}
+
+// Close closes any pooled connections
+func (p *smtpProvider) Close() error {
+	if closer, ok := p.sender.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Capabilities returns the features supported by SMTP
+func (p *smtpProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Attachments: true,
+		Bcc:         true,
+		Cc:          true,
+		Importance:  true,
+		OpenPGP:     true,
+		ReturnPath:  true,
+		SMIME:       true,
+	}
+}
+
+// Send sends the email using SMTP
+func (p *smtpProvider) Send(ctx context.Context, email *Email) (SendResult, error) {
+	return sendViaSMTP(ctx, p.sender, p.security, email)
+}
+
+// sendViaSMTP sends an email using the smtp service (recipients are on the envelope, bcc is not written into the message)
+func sendViaSMTP(ctx context.Context, sender smtpSender, security *messageSecurity, email *Email) (result SendResult, err error) {
 	// Warn about features that are set but not available
 	if email.TrackClicks {
 		log.Printf("warning: track clicks is enabled, SMTP does not have this feature")
@@ -98,6 +304,91 @@ func sendViaSMTP(client smtpInterface, email *Email) (err error) {
 		log.Printf("warning: auto text is enabled, SMTP does not have this feature")
 	}
 
-	// Send via smtp
-	return client.Send()
+	// Generate the message id for this send (the email is not changed), so the result has it
+	if len(email.MessageID) == 0 {
+		withID := *email
+		if withID.MessageID, err = newMessageID(email.FromAddress); err != nil {
+			return result, err
+		}
+		email = &withID
+	}
+
+	// Build the message and secure it (S/MIME, OpenPGP and DKIM, if enabled)
+	var msg []byte
+	if msg, err = email.buildMIME(mimeOptions{}); err != nil {
+		return result, err
+	}
+	if msg, err = security.secure(email, msg); err != nil {
+		return result, err
+	}
+
+	// Send via smtp to every recipient (to, cc, bcc)
+	recipients := make([]string, 0, len(email.Recipients)+len(email.RecipientsCc)+len(email.RecipientsBcc))
+	recipients = append(recipients, email.Recipients...)
+	recipients = append(recipients, email.RecipientsCc...)
+	recipients = append(recipients, email.RecipientsBcc...)
+	if email.VERP && len(email.ReturnPath) > 0 {
+		return sendViaSMTPWithVERP(ctx, sender, email, recipients, msg)
+	}
+	envelope := smtpEnvelope{dsn: email.DSN, from: email.envelopeSender(""), to: recipients}
+	if err = sender.SendMail(ctx, envelope, msg); err != nil {
+		return result, classifySMTPError(err)
+	}
+
+	// SMTP accepted every recipient or the send would have failed
+	result = newSendResult(SMTP, email, RecipientAccepted)
+	result.MessageID = email.MessageID
+	return result, nil
+}
+
+// sendViaSMTPWithVERP sends the message in a separate transaction for each recipient,
+// with the recipient encoded in the envelope sender so bounces identify the recipient
+//
+// A recipient rejected by the server does not stop the others. Once a recipient has accepted
+// the message no error is returned (a retry or failover would send it again), the result has
+// the status of each recipient instead: rejected, or not sent if the connection failed first.
+// An error is only returned if no recipient accepted the message.
+func sendViaSMTPWithVERP(ctx context.Context, sender smtpSender, email *Email, recipients []string, msg []byte) (result SendResult, err error) {
+	result = newSendResult(SMTP, email, RecipientAccepted)
+	result.MessageID = email.MessageID
+	accepted := 0
+	for i, recipient := range recipients {
+		envelope := smtpEnvelope{dsn: email.DSN, from: email.envelopeSender(recipient), to: []string{recipient}}
+		sendErr := sender.SendMail(ctx, envelope, msg)
+		if sendErr == nil {
+			accepted++
+			continue
+		}
+		err = classifySMTPError(sendErr)
+
+		var replyErr *textproto.Error
+		if errors.As(sendErr, &replyErr) {
+			result.Recipients[i].RejectReason = replyErr.Msg
+			result.Recipients[i].Status = RecipientRejected
+			continue
+		}
+
+		// The connection failed, the remaining recipients were not sent
+		for j := i; j < len(recipients); j++ {
+			result.Recipients[j].RejectReason = sendErr.Error()
+			result.Recipients[j].Status = RecipientNotSent
+		}
+		break
+	}
+	if accepted == 0 {
+		return result, err
+	}
+	return result, nil
+}
+
+// classifySMTPError marks 4xx SMTP replies as transient and 5xx replies as permanent
+func classifySMTPError(err error) error {
+	var replyErr *textproto.Error
+	if errors.As(err, &replyErr) {
+		if replyErr.Code >= 400 && replyErr.Code < 500 {
+			return transientError(err)
+		}
+		return permanentError(err)
+	}
+	return classifyError(err)
 }
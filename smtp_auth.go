@@ -0,0 +1,153 @@
+package gomail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPAuthMode is the SMTP authentication mechanism
+type SMTPAuthMode int
+
+// SMTP authentication modes
+const (
+	SMTPAuthAuto    SMTPAuthMode = iota // XOAUTH2 with a token source, PLAIN with a password, otherwise none (default)
+	SMTPAuthNone                        // never authenticate (internal relays)
+	SMTPAuthPlain                       // AUTH PLAIN
+	SMTPAuthLogin                       // AUTH LOGIN (ie: Office365)
+	SMTPAuthCRAMMD5                     // AUTH CRAM-MD5
+	SMTPAuthXOAuth2                     // AUTH XOAUTH2 with a bearer token (ie: Gmail, Microsoft)
+)
+
+// SMTPTokenSource returns a valid OAuth2 access token, it is called for every new connection
+// so it can refresh the token when it expires (ie: oauth2.TokenSource)
+type SMTPTokenSource func() (string, error)
+
+// String returns the name of the auth mode
+func (m SMTPAuthMode) String() string {
+	switch m {
+	case SMTPAuthAuto:
+		return "auto"
+	case SMTPAuthNone:
+		return "none"
+	case SMTPAuthPlain:
+		return "plain"
+	case SMTPAuthLogin:
+		return "login"
+	case SMTPAuthCRAMMD5:
+		return "cram-md5"
+	case SMTPAuthXOAuth2:
+		return "xoauth2"
+	default:
+		return fmt.Sprintf("SMTPAuthMode(%d)", int(m))
+	}
+}
+
+// newSMTPAuth will create the smtp.Auth for the mode (nil means no authentication)
+func newSMTPAuth(mode SMTPAuthMode, host, username, password string, tokenSource SMTPTokenSource) (smtp.Auth, error) {
+	hasPassword := len(username) > 0 && len(password) > 0
+	hasToken := len(username) > 0 && tokenSource != nil
+
+	// Pick the mechanism from the credentials
+	if mode == SMTPAuthAuto {
+		switch {
+		case hasToken:
+			mode = SMTPAuthXOAuth2
+		case hasPassword:
+			mode = SMTPAuthPlain
+		default:
+			mode = SMTPAuthNone
+		}
+	}
+
+	switch mode {
+	case SMTPAuthNone:
+		return nil, nil //nolint:nilnil // no authentication
+	case SMTPAuthPlain, SMTPAuthLogin, SMTPAuthCRAMMD5:
+		if !hasPassword {
+			return nil, fmt.Errorf("smtp auth %s requires a username and password: %w", mode, ErrMissingSMTPCredentials)
+		}
+		if mode == SMTPAuthLogin {
+			return &smtpLoginAuth{host: host, password: password, username: username}, nil
+		} else if mode == SMTPAuthCRAMMD5 {
+			return smtp.CRAMMD5Auth(username, password), nil
+		}
+		return smtp.PlainAuth("", username, password, host), nil
+	case SMTPAuthXOAuth2:
+		if !hasToken {
+			return nil, fmt.Errorf("smtp auth %s requires a username and token source: %w", mode, ErrMissingSMTPCredentials)
+		}
+		return &smtpXOAuth2Auth{host: host, tokenSource: tokenSource, username: username}, nil
+	default:
+		return nil, fmt.Errorf("smtp auth mode %s is not supported: %w", mode, ErrInvalidSMTPAuthMode)
+	}
+}
+
+// smtpCheckServer refuses to send credentials in the clear (unless the server is local) or to the wrong host
+func smtpCheckServer(server *smtp.ServerInfo, host string) error {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return ErrSMTPUnencryptedAuth
+	}
+	if server.Name != host {
+		return fmt.Errorf("smtp auth expected host %s but connected to %s: %w", host, server.Name, ErrSMTPAuthWrongHost)
+	}
+	return nil
+}
+
+// smtpLoginAuth implements the AUTH LOGIN mechanism
+type smtpLoginAuth struct {
+	host     string
+	password string
+	username string
+}
+
+// Start begins the LOGIN exchange, the username and password are sent when prompted
+func (a *smtpLoginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := smtpCheckServer(server, a.host); err != nil {
+		return "", nil, err
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next answers the server prompts (Username: and Password:)
+func (a *smtpLoginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected smtp auth login prompt %q: %w", fromServer, ErrSMTPAuthLogin)
+	}
+}
+
+// smtpXOAuth2Auth implements the AUTH XOAUTH2 mechanism with a fresh token for every connection
+type smtpXOAuth2Auth struct {
+	host        string
+	tokenSource SMTPTokenSource
+	username    string
+}
+
+// Start sends the username and bearer token as the initial response
+func (a *smtpXOAuth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := smtpCheckServer(server, a.host); err != nil {
+		return "", nil, err
+	}
+	token, err := a.tokenSource()
+	if err != nil {
+		return "", nil, fmt.Errorf("smtp auth xoauth2 token: %w", err)
+	}
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + token + "\x01\x01"), nil
+}
+
+// Next replies to an error challenge with an empty response, so the server returns the final error
+func (a *smtpXOAuth2Auth) Next(_ []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
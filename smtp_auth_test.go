@@ -0,0 +1,281 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errTestTokenSource is returned by a failing token source
+var errTestTokenSource = errors.New("token expired and refresh failed")
+
+// TestNewSMTPAuth will test the newSMTPAuth() method
+func TestNewSMTPAuth(t *testing.T) {
+	t.Parallel()
+
+	tokenSource := func() (string, error) { return "token", nil }
+
+	tests := []struct {
+		name        string
+		mode        SMTPAuthMode
+		username    string
+		password    string
+		tokenSource SMTPTokenSource
+		expected    string
+		expectedErr error
+	}{
+		{"auto without credentials", SMTPAuthAuto, "", "", nil, "", nil},
+		{"auto with username only", SMTPAuthAuto, "user", "", nil, "", nil},
+		{"auto with password", SMTPAuthAuto, "user", "pass", nil, "PLAIN", nil},
+		{"auto with token source", SMTPAuthAuto, "user", "pass", tokenSource, "XOAUTH2", nil},
+		{"none ignores credentials", SMTPAuthNone, "user", "pass", nil, "", nil},
+		{"plain", SMTPAuthPlain, "user", "pass", nil, "PLAIN", nil},
+		{"login", SMTPAuthLogin, "user", "pass", nil, "LOGIN", nil},
+		{"cram-md5", SMTPAuthCRAMMD5, "user", "pass", nil, "CRAM-MD5", nil},
+		{"xoauth2", SMTPAuthXOAuth2, "user", "", tokenSource, "XOAUTH2", nil},
+		{"plain missing password", SMTPAuthPlain, "user", "", nil, "", ErrMissingSMTPCredentials},
+		{"login missing username", SMTPAuthLogin, "", "pass", nil, "", ErrMissingSMTPCredentials},
+		{"xoauth2 missing token source", SMTPAuthXOAuth2, "user", "pass", nil, "", ErrMissingSMTPCredentials},
+		{"invalid mode", SMTPAuthMode(99), "user", "pass", nil, "", ErrInvalidSMTPAuthMode},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := newSMTPAuth(test.mode, "localhost", test.username, test.password, test.tokenSource)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			if len(test.expected) == 0 {
+				assert.Nil(t, auth)
+				return
+			}
+			require.NotNil(t, auth)
+			mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "localhost", TLS: true})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, mechanism)
+		})
+	}
+
+	assert.Equal(t, "cram-md5", SMTPAuthCRAMMD5.String())
+	assert.Equal(t, "SMTPAuthMode(99)", SMTPAuthMode(99).String())
+}
+
+// TestSMTPLoginAuth will test the LOGIN mechanism
+func TestSMTPLoginAuth(t *testing.T) {
+	t.Parallel()
+
+	auth := &smtpLoginAuth{host: "smtp.example.com", password: "pass", username: "user"}
+
+	t.Run("refuses unencrypted connections", func(t *testing.T) {
+		_, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com"})
+		require.ErrorIs(t, err, ErrSMTPUnencryptedAuth)
+	})
+
+	t.Run("refuses the wrong host", func(t *testing.T) {
+		_, _, err := auth.Start(&smtp.ServerInfo{Name: "other.example.com", TLS: true})
+		require.ErrorIs(t, err, ErrSMTPAuthWrongHost)
+	})
+
+	t.Run("answers the prompts", func(t *testing.T) {
+		mechanism, initial, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true})
+		require.NoError(t, err)
+		assert.Equal(t, "LOGIN", mechanism)
+		assert.Nil(t, initial)
+
+		response, err := auth.Next([]byte("Username:"), true)
+		require.NoError(t, err)
+		assert.Equal(t, "user", string(response))
+		response, err = auth.Next([]byte("Password:"), true)
+		require.NoError(t, err)
+		assert.Equal(t, "pass", string(response))
+		response, err = auth.Next(nil, false)
+		require.NoError(t, err)
+		assert.Nil(t, response)
+
+		_, err = auth.Next([]byte("Token:"), true)
+		require.ErrorIs(t, err, ErrSMTPAuthLogin)
+	})
+}
+
+// TestSMTPXOAuth2Auth will test the XOAUTH2 mechanism
+func TestSMTPXOAuth2Auth(t *testing.T) {
+	t.Parallel()
+
+	server := &smtp.ServerInfo{Name: "smtp.gmail.com", TLS: true}
+
+	t.Run("initial response", func(t *testing.T) {
+		auth := &smtpXOAuth2Auth{host: "smtp.gmail.com", tokenSource: func() (string, error) {
+			return "ya29.token", nil
+		}, username: "user@gmail.com"}
+		mechanism, initial, err := auth.Start(server)
+		require.NoError(t, err)
+		assert.Equal(t, "XOAUTH2", mechanism)
+		assert.Equal(t, "user=user@gmail.com\x01auth=Bearer ya29.token\x01\x01", string(initial))
+
+		// An error challenge is answered with an empty response
+		response, err := auth.Next([]byte(`{"status":"401"}`), true)
+		require.NoError(t, err)
+		assert.NotNil(t, response)
+		assert.Empty(t, response)
+	})
+
+	t.Run("token source error", func(t *testing.T) {
+		auth := &smtpXOAuth2Auth{host: "smtp.gmail.com", tokenSource: func() (string, error) {
+			return "", errTestTokenSource
+		}, username: "user@gmail.com"}
+		_, _, err := auth.Start(server)
+		require.ErrorIs(t, err, errTestTokenSource)
+	})
+}
+
+// TestSMTPDialer_Auth will test each auth mode against a local SMTP server
+func TestSMTPDialer_Auth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		mode     SMTPAuthMode
+		password string
+		valid    bool
+	}{
+		{"plain", SMTPAuthPlain, "secret", true},
+		{"plain wrong password", SMTPAuthPlain, "wrong", false},
+		{"login", SMTPAuthLogin, "secret", true},
+		{"login wrong password", SMTPAuthLogin, "wrong", false},
+		{"cram-md5", SMTPAuthCRAMMD5, "secret", true},
+		{"cram-md5 wrong password", SMTPAuthCRAMMD5, "wrong", false},
+		{"xoauth2", SMTPAuthXOAuth2, "secret", true},
+		{"xoauth2 expired token", SMTPAuthXOAuth2, "expired", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestSMTPServer(t)
+			server.requireAuth("user", "secret", "PLAIN", "LOGIN", "CRAM-MD5", "XOAUTH2")
+
+			var tokenSource SMTPTokenSource
+			password := test.password
+			if test.mode == SMTPAuthXOAuth2 {
+				tokenSource = func() (string, error) { return test.password, nil }
+				password = ""
+			}
+			auth, err := newSMTPAuth(test.mode, "127.0.0.1", "user", password, tokenSource)
+			require.NoError(t, err)
+
+			err = newSMTPDialer(server.addr, auth, SMTPTLSNone, nil).SendMail(
+				context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("Subject: Test\r\n\r\nTest"),
+			)
+			if !test.valid {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "535")
+				assert.Empty(t, server.messages())
+				return
+			}
+			require.NoError(t, err)
+			messages := server.messages()
+			require.Len(t, messages, 1)
+			assert.Equal(t, smtpMechanism(t, auth), messages[0].auth)
+		})
+	}
+
+	t.Run("token is refreshed for every connection", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		server.requireAuth("user", "token-2", "XOAUTH2")
+
+		calls := 0
+		auth, err := newSMTPAuth(SMTPAuthXOAuth2, "127.0.0.1", "user", "", func() (string, error) {
+			calls++
+			return "token-" + strconv.Itoa(calls), nil
+		})
+		require.NoError(t, err)
+
+		dialer := newSMTPDialer(server.addr, auth, SMTPTLSNone, nil)
+		send := func() error {
+			return dialer.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("Test"))
+		}
+		require.Error(t, send())
+		require.NoError(t, send())
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("relay without credentials", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		require.NoError(t, newSMTPDialer(server.addr, nil, SMTPTLSNone, nil).SendMail(
+			context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("Test"),
+		))
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Empty(t, messages[0].auth)
+	})
+}
+
+// smtpMechanism returns the mechanism name of the auth
+func smtpMechanism(t *testing.T, auth smtp.Auth) string {
+	t.Helper()
+	mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "127.0.0.1"})
+	require.NoError(t, err)
+	return mechanism
+}
+
+// TestMailService_StartUpSMTPAuth will test loading the SMTP provider with the auth settings
+func TestMailService_StartUpSMTPAuth(t *testing.T) {
+	t.Parallel()
+
+	t.Run("relay without credentials", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		mail := newTestSMTPMailService(t, server)
+		require.NoError(t, mail.StartUp())
+		defer func() {
+			_ = mail.Close()
+		}()
+		assert.Contains(t, mail.AvailableProviders, SMTP)
+		require.NoError(t, mail.SendEmail(context.Background(), newTestSMTPEmail(mail), SMTP))
+		assert.Len(t, server.messages(), 1)
+	})
+
+	t.Run("login mode", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		server.requireAuth("user", "secret", "LOGIN")
+		mail := newTestSMTPMailService(t, server)
+		mail.SMTPAuthMode = SMTPAuthLogin
+		mail.SMTPUsername = "user"
+		mail.SMTPPassword = "secret"
+		require.NoError(t, mail.StartUp())
+		defer func() {
+			_ = mail.Close()
+		}()
+		require.NoError(t, mail.SendEmail(context.Background(), newTestSMTPEmail(mail), SMTP))
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "LOGIN", messages[0].auth)
+	})
+
+	t.Run("xoauth2 with token source", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		server.requireAuth("user@example.com", "ya29.token", "PLAIN", "XOAUTH2")
+		mail := newTestSMTPMailService(t, server)
+		mail.SMTPUsername = "user@example.com"
+		mail.SMTPTokenSource = func() (string, error) { return "ya29.token", nil }
+		require.NoError(t, mail.StartUp())
+		defer func() {
+			_ = mail.Close()
+		}()
+		require.NoError(t, mail.SendEmail(context.Background(), newTestSMTPEmail(mail), SMTP))
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "XOAUTH2", messages[0].auth)
+	})
+
+	t.Run("missing credentials for the mode", func(t *testing.T) {
+		mail := newTestSMTPMailService(t, newTestSMTPServer(t))
+		mail.SMTPAuthMode = SMTPAuthCRAMMD5
+		require.ErrorIs(t, mail.StartUp(), ErrMissingSMTPCredentials)
+	})
+}
@@ -0,0 +1,166 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+const (
+	smtpDefaultIdleTimeout  = 30 * time.Second
+	smtpDefaultMaxIdleConns = 2
+	smtpDefaultMaxOpenConns = 10
+)
+
+// smtpPool delivers messages over a bounded pool of reusable SMTP connections
+//
+// Connections are reset (RSET) after every message and probed (NOOP) before they are reused,
+// idle connections are closed after the idle timeout. The pool is safe for concurrent use.
+type smtpPool struct {
+	dialer      *smtpDialer
+	idle        []*smtpPoolConn
+	idleTimeout time.Duration
+	maxIdle     int
+	mu          sync.Mutex
+	closed      bool
+	slots       chan struct{}
+}
+
+// smtpPoolConn is a connection in the pool
+type smtpPoolConn struct {
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// newSMTPPool will create a new pool using the dialer for new connections (zero values use the defaults)
+func newSMTPPool(dialer *smtpDialer, maxIdle, maxOpen int, idleTimeout time.Duration) *smtpPool {
+	if maxIdle <= 0 {
+		maxIdle = smtpDefaultMaxIdleConns
+	}
+	if maxOpen <= 0 {
+		maxOpen = smtpDefaultMaxOpenConns
+	}
+	if maxIdle > maxOpen {
+		maxIdle = maxOpen
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = smtpDefaultIdleTimeout
+	}
+	return &smtpPool{
+		dialer:      dialer,
+		idleTimeout: idleTimeout,
+		maxIdle:     maxIdle,
+		slots:       make(chan struct{}, maxOpen),
+	}
+}
+
+// SendMail delivers the message on a pooled connection (waits for a free connection if max open is reached)
+func (p *smtpPool) SendMail(ctx context.Context, envelope smtpEnvelope, msg []byte) error {
+	// Wait for a connection slot
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() {
+		<-p.slots
+	}()
+
+	conn, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Deliver the message, then reset the connection for the next message
+	if err = smtpWithContext(ctx, conn.client, func() error {
+		return smtpDeliver(conn.client, envelope, msg)
+	}); err != nil {
+		p.release(conn, smtpReusable(err))
+		return err
+	}
+	p.release(conn, true)
+	return nil
+}
+
+// get returns a healthy idle connection, or dials a new one
+func (p *smtpPool) get(ctx context.Context) (*smtpPoolConn, error) {
+	for {
+		conn := p.popIdle()
+		if conn == nil {
+			break
+		}
+
+		// Close connections that were idle for too long or fail the health probe
+		if time.Since(conn.lastUsed) > p.idleTimeout {
+			_ = conn.client.Close()
+			continue
+		}
+		if err := smtpWithContext(ctx, conn.client, conn.client.Noop); err != nil {
+			_ = conn.client.Close()
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		return conn, nil
+	}
+
+	client, err := p.dialer.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &smtpPoolConn{client: client}, nil
+}
+
+// popIdle removes the most recently used idle connection from the pool
+func (p *smtpPool) popIdle() *smtpPoolConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) == 0 {
+		return nil
+	}
+	conn := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return conn
+}
+
+// release resets the connection and returns it to the pool, or closes it
+func (p *smtpPool) release(conn *smtpPoolConn, reuse bool) {
+	if reuse && conn.client.Reset() == nil {
+		conn.lastUsed = time.Now()
+
+		p.mu.Lock()
+		if !p.closed && len(p.idle) < p.maxIdle {
+			p.idle = append(p.idle, conn)
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+		_ = conn.client.Quit()
+	}
+	_ = conn.client.Close()
+}
+
+// Close closes the idle connections, connections in use are closed when their send finishes
+func (p *smtpPool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, conn := range idle {
+		_ = conn.client.Quit()
+		_ = conn.client.Close()
+	}
+	return nil
+}
+
+// smtpReusable returns true if the connection can still be used after the error (the server replied)
+func smtpReusable(err error) bool {
+	var replyErr *textproto.Error
+	return errors.As(err, &replyErr) && replyErr.Code != 421
+}
@@ -0,0 +1,223 @@
+package gomail
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPoolMessage is a small message for pool tests and benchmarks
+var testPoolMessage = []byte("Subject: Test\r\n\r\nTest email content")
+
+// TestNewSMTPPool will test the defaults of newSMTPPool()
+func TestNewSMTPPool(t *testing.T) {
+	t.Parallel()
+
+	pool := newSMTPPool(newSMTPDialer("localhost:25", nil, SMTPTLSOpportunistic, nil), 0, 0, 0)
+	assert.Equal(t, smtpDefaultMaxIdleConns, pool.maxIdle)
+	assert.Equal(t, smtpDefaultMaxOpenConns, cap(pool.slots))
+	assert.Equal(t, smtpDefaultIdleTimeout, pool.idleTimeout)
+
+	// Max idle can not be more than max open
+	pool = newSMTPPool(newSMTPDialer("localhost:25", nil, SMTPTLSOpportunistic, nil), 5, 1, time.Minute)
+	assert.Equal(t, 1, pool.maxIdle)
+	assert.Equal(t, time.Minute, pool.idleTimeout)
+}
+
+// TestSMTPPool_SendMail will test the SendMail() method
+func TestSMTPPool_SendMail(t *testing.T) {
+	t.Parallel()
+
+	t.Run("connections are reused and reset", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), 1, 1, time.Minute)
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{fmt.Sprintf("to-%d@example.com", i)}}, testPoolMessage))
+		}
+
+		connections, _ := server.stats()
+		assert.Equal(t, 1, connections)
+		assert.Len(t, server.messages(), 3)
+		assert.Equal(t, 3, server.commandCount("RSET"))
+		assert.Equal(t, 2, server.commandCount("NOOP"))
+		assert.Equal(t, 1, server.commandCount("EHLO"))
+	})
+
+	t.Run("max open connections", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), 2, 2, time.Minute)
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage))
+			}()
+		}
+		wg.Wait()
+
+		connections, maxActive := server.stats()
+		assert.LessOrEqual(t, maxActive, 2)
+		assert.LessOrEqual(t, connections, 2)
+		assert.Len(t, server.messages(), 20)
+	})
+
+	t.Run("idle connections time out", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), 1, 1, 10*time.Millisecond)
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		require.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage))
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage))
+
+		connections, _ := server.stats()
+		assert.Equal(t, 2, connections)
+	})
+
+	t.Run("broken connections are replaced", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), 1, 1, time.Minute)
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		require.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage))
+		server.dropConnections()
+		require.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage))
+
+		connections, _ := server.stats()
+		assert.Equal(t, 2, connections)
+		assert.Len(t, server.messages(), 2)
+	})
+
+	t.Run("rejected recipient keeps the connection", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), 1, 1, time.Minute)
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		err := pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"reject@example.com"}}, testPoolMessage)
+		require.Error(t, err)
+		assert.True(t, IsPermanent(classifySMTPError(err)))
+		require.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage))
+
+		connections, _ := server.stats()
+		assert.Equal(t, 1, connections)
+	})
+
+	t.Run("waiting for a connection honors the context", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), 1, 1, time.Minute)
+		pool.slots <- struct{}{} // all connections are in use
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := pool.SendMail(ctx, smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("close releases idle connections", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), 1, 1, time.Minute)
+
+		require.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage))
+		require.NoError(t, pool.Close())
+		assert.Empty(t, pool.idle)
+		assert.Equal(t, 1, server.commandCount("QUIT"))
+
+		// Sends after close do not keep connections
+		require.NoError(t, pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage))
+		assert.Empty(t, pool.idle)
+	})
+}
+
+// TestMailService_Close will test the Close() method
+func TestMailService_Close(t *testing.T) {
+	t.Parallel()
+
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromDomain = testDomainEmail
+	mail.PostmarkServerToken = "1234567"
+	mail.SMTPHost = testDomainEmail
+	mail.SMTPUsername = "fake"
+	mail.SMTPPassword = "fake"
+	require.NoError(t, mail.StartUp())
+
+	provider, ok := mail.LookupProvider(SMTP)
+	require.True(t, ok)
+	assert.IsType(t, &smtpPool{}, provider.(*smtpProvider).sender)
+	require.NoError(t, mail.Close())
+
+	// The pool can be disabled
+	mail.SMTPDisablePool = true
+	require.NoError(t, mail.StartUp())
+	provider, _ = mail.LookupProvider(SMTP)
+	assert.IsType(t, &smtpDialer{}, provider.(*smtpProvider).sender)
+	require.NoError(t, mail.Close())
+}
+
+// BenchmarkSMTPDialer_SendMail dials a new connection for every message
+func BenchmarkSMTPDialer_SendMail(b *testing.B) {
+	server := newTestSMTPServer(b)
+	dialer := newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dialer.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSMTPPool_SendMail reuses pooled connections
+func BenchmarkSMTPPool_SendMail(b *testing.B) {
+	server := newTestSMTPServer(b)
+	pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), 1, 1, time.Minute)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSMTPPool_SendMailParallel reuses pooled connections from parallel senders
+func BenchmarkSMTPPool_SendMailParallel(b *testing.B) {
+	server := newTestSMTPServer(b)
+	pool := newSMTPPool(newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil), smtpDefaultMaxIdleConns, smtpDefaultMaxOpenConns, time.Minute)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := pool.SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, testPoolMessage); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,430 @@
+package gomail
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec // CRAM-MD5 is part of the protocol
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testSMTPMessage is a message received by the test SMTP server
+type testSMTPMessage struct {
+	auth       string
+	data       string
+	from       string
+	mailParams string   // parameters after the MAIL FROM path, ie: RET=HDRS
+	rcptParams []string // parameters after each RCPT TO path, ie: NOTIFY=SUCCESS
+	tls        bool
+	to         []string
+}
+
+// testSMTPServer is a minimal in-process SMTP server for testing
+type testSMTPServer struct {
+	active      int
+	addr        string
+	commands    []string
+	conns       map[net.Conn]bool
+	connections int
+	listener    net.Listener
+	maxActive   int
+	mu          sync.Mutex
+	received    []testSMTPMessage
+	stall       bool
+	auth        testSMTPAuth // require authentication with these credentials
+	dsn         bool         // advertise the DSN extension
+	implicitTLS bool         // connections start with TLS
+	tlsConfig   *tls.Config  // offer STARTTLS (or implicit TLS) with this config
+}
+
+// testSMTPAuth are the credentials required by the test SMTP server
+type testSMTPAuth struct {
+	mechanisms []string // advertised mechanisms, ie: PLAIN LOGIN CRAM-MD5 XOAUTH2
+	secret     string   // password or token
+	username   string
+}
+
+// newTestSMTPServer will start a test SMTP server that is closed when the test ends
+func newTestSMTPServer(t testing.TB) *testSMTPServer {
+	t.Helper()
+	return newTestSMTPServerTLS(t, nil, false)
+}
+
+// newTestSMTPServerTLS will start a test SMTP server offering STARTTLS, or implicit TLS
+func newTestSMTPServerTLS(t testing.TB, tlsConfig *tls.Config, implicitTLS bool) *testSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &testSMTPServer{
+		addr:        listener.Addr().String(),
+		conns:       make(map[net.Conn]bool),
+		implicitTLS: implicitTLS,
+		listener:    listener,
+		tlsConfig:   tlsConfig,
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go server.serve()
+	return server
+}
+
+// messages returns the messages received so far
+func (s *testSMTPServer) messages() []testSMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]testSMTPMessage(nil), s.received...)
+}
+
+// stats returns the number of connections accepted and the most that were open at the same time
+func (s *testSMTPServer) stats() (connections, maxActive int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections, s.maxActive
+}
+
+// commandCount returns the number of times the command was received
+func (s *testSMTPServer) commandCount(command string) (count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, received := range s.commands {
+		if received == command {
+			count++
+		}
+	}
+	return count
+}
+
+// dropConnections closes every open connection (ie: the server timed out idle clients)
+func (s *testSMTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// requireAuth makes the server advertise the mechanisms and require authentication before MAIL
+func (s *testSMTPServer) requireAuth(username, secret string, mechanisms ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = testSMTPAuth{mechanisms: mechanisms, secret: secret, username: username}
+}
+
+// authSettings returns the required credentials
+func (s *testSMTPServer) authSettings() testSMTPAuth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.auth
+}
+
+// enableDSN makes the server advertise the DSN extension
+func (s *testSMTPServer) enableDSN() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dsn = true
+}
+
+// setStalled toggles answering new connections
+func (s *testSMTPServer) setStalled(stall bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stall = stall
+}
+
+// isStalled returns true if the server should never answer
+func (s *testSMTPServer) isStalled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stall
+}
+
+// serve accepts connections until the listener is closed
+func (s *testSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle runs the SMTP conversation for a single connection
+func (s *testSMTPServer) handle(raw net.Conn) {
+	s.mu.Lock()
+	s.conns[raw] = true
+	s.connections++
+	s.active++
+	s.maxActive = max(s.maxActive, s.active)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, raw)
+		s.active--
+		s.mu.Unlock()
+		_ = raw.Close()
+	}()
+	conn := raw
+
+	// Start with TLS
+	secure := false
+	if s.implicitTLS {
+		tlsConn := tls.Server(conn, s.tlsConfig)
+		if tlsConn.Handshake() != nil {
+			return
+		}
+		conn, secure = tlsConn, true
+	}
+
+	reader := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		for _, line := range lines {
+			_, _ = conn.Write([]byte(line + "\r\n"))
+		}
+	}
+
+	// Hold the connection open without a greeting
+	if s.isStalled() {
+		_, _ = reader.ReadString('\n')
+		return
+	}
+	reply("220 localhost ESMTP test server")
+
+	auth := s.authSettings()
+	s.mu.Lock()
+	dsn := s.dsn
+	s.mu.Unlock()
+	authenticated := ""
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	var message testSMTPMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		if fields := strings.Fields(command); len(fields) > 0 {
+			s.mu.Lock()
+			s.commands = append(s.commands, fields[0])
+			s.mu.Unlock()
+		}
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			lines := []string{"250-localhost"}
+			if s.tlsConfig != nil && !secure {
+				lines = append(lines, "250-STARTTLS")
+			}
+			if len(auth.mechanisms) > 0 {
+				lines = append(lines, "250-AUTH "+strings.Join(auth.mechanisms, " "))
+			}
+			if dsn {
+				lines = append(lines, "250-DSN")
+			}
+			reply(append(lines, "250 8BITMIME")...)
+		case strings.HasPrefix(command, "AUTH ") && len(auth.mechanisms) > 0:
+			mechanism, ok := testSMTPAuthenticate(auth, line[len("AUTH "):], readLine, reply)
+			if !ok {
+				reply("535 5.7.8 Authentication credentials invalid")
+				continue
+			}
+			authenticated = mechanism
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(command, "MAIL FROM:") && len(auth.mechanisms) > 0 && len(authenticated) == 0:
+			reply("530 5.7.0 Authentication required")
+		case command == "STARTTLS" && s.tlsConfig != nil && !secure:
+			reply("220 2.0.0 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			reader = bufio.NewReader(conn)
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			from, params := testSMTPPathParams(line[len("MAIL FROM:"):])
+			message = testSMTPMessage{auth: authenticated, from: from, mailParams: params, tls: secure}
+			reply("250 2.1.0 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			to, params := testSMTPPathParams(line[len("RCPT TO:"):])
+			if strings.HasPrefix(to, "reject@") {
+				reply("550 5.1.1 No such user")
+				continue
+			}
+			message.to = append(message.to, to)
+			message.rcptParams = append(message.rcptParams, params)
+			reply("250 2.1.5 OK")
+		case command == "DATA":
+			reply("354 Start mail input")
+			var data strings.Builder
+			for {
+				if line, err = reader.ReadString('\n'); err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			message.data = data.String()
+			s.mu.Lock()
+			s.received = append(s.received, message)
+			s.mu.Unlock()
+			reply("250 2.0.0 OK queued")
+		case command == "RSET", command == "NOOP":
+			reply("250 2.0.0 OK")
+		case command == "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			reply("502 5.5.2 Command not recognized")
+		}
+	}
+}
+
+// testSMTPAuthenticate runs the AUTH exchange and returns the mechanism if the credentials are valid
+func testSMTPAuthenticate(auth testSMTPAuth, arg string, readLine func() (string, error), reply func(...string)) (string, bool) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	mechanism = strings.ToUpper(mechanism)
+	if !slices.Contains(auth.mechanisms, mechanism) {
+		return mechanism, false
+	}
+
+	// challenge sends the prompt and returns the decoded answer
+	challenge := func(prompt string) string {
+		reply("334 " + base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := readLine()
+		if err != nil {
+			return ""
+		}
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		return string(decoded)
+	}
+	decode := func(value string) string {
+		decoded, _ := base64.StdEncoding.DecodeString(value)
+		return string(decoded)
+	}
+
+	switch mechanism {
+	case "PLAIN":
+		response := decode(initial)
+		if len(initial) == 0 {
+			response = challenge("")
+		}
+		return mechanism, response == "\x00"+auth.username+"\x00"+auth.secret
+	case "LOGIN":
+		username := challenge("Username:")
+		password := challenge("Password:")
+		return mechanism, username == auth.username && password == auth.secret
+	case "CRAM-MD5":
+		nonce := "<12345.67890@localhost>"
+		username, digest, _ := strings.Cut(challenge(nonce), " ")
+		mac := hmac.New(md5.New, []byte(auth.secret))
+		mac.Write([]byte(nonce))
+		return mechanism, username == auth.username && digest == hex.EncodeToString(mac.Sum(nil))
+	case "XOAUTH2":
+		if decode(initial) == "user="+auth.username+"\x01auth=Bearer "+auth.secret+"\x01\x01" {
+			return mechanism, true
+		}
+		// Send the error details and wait for the empty client response
+		challenge(`{"status":"401","schemes":"bearer","scope":"https://mail.google.com/"}`)
+		return mechanism, false
+	default:
+		return mechanism, false
+	}
+}
+
+// testSMTPPathParams returns the address and parameters from a MAIL or RCPT argument (ie: <from@example.com> BODY=8BITMIME)
+func testSMTPPathParams(arg string) (path, params string) {
+	arg = strings.TrimSpace(arg)
+	if end := strings.Index(arg, ">"); strings.HasPrefix(arg, "<") && end > 0 {
+		return arg[1:end], strings.TrimSpace(arg[end+1:])
+	}
+	return arg, ""
+}
+
+// newTestTLSConfigs will create a self-signed certificate for 127.0.0.1 and return
+// the server tls config and a client tls config that trusts the certificate
+func newTestTLSConfigs(t testing.TB) (serverConfig, clientConfig *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		NotAfter:              time.Now().Add(time.Hour),
+		NotBefore:             time.Now().Add(-time.Hour),
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-mail test"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	serverConfig = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}},
+		MinVersion:   tls.VersionTLS12,
+	}
+	clientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return serverConfig, clientConfig
+}
+
+// newTestSMTPMailService will create a mail service for the test SMTP server (no auth, no TLS)
+func newTestSMTPMailService(t testing.TB, server *testSMTPServer) *MailService {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(server.addr)
+	require.NoError(t, err)
+
+	mail := new(MailService)
+	mail.FromUsername = testUsernameEmail
+	mail.FromDomain = testDomainEmail
+	mail.SMTPHost = host
+	mail.SMTPPort, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	mail.SMTPTLSMode = SMTPTLSNone
+	return mail
+}
+
+// newTestSMTPEmail will create a simple email for the test SMTP server
+func newTestSMTPEmail(mail *MailService) *Email {
+	email := mail.NewEmail()
+	email.Subject = "Test subject"
+	email.PlainTextContent = "Test email content"
+	email.Recipients = []string{"test@domain.com"}
+	return email
+}
@@ -1,42 +1,38 @@
 package gomail
 
 import (
-	"bytes"
-	"io"
+	"context"
+	"crypto/tls"
+	"net"
 	"net/smtp"
+	"net/textproto"
 	"os"
-	"regexp"
 	"testing"
+	"time"
 
-	"github.com/domodwyer/mailyak"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// mockSMTPInterface is a mocking interface for SMTP
-type mockSMTPInterface struct {
-	html      mailyak.BodyPart
-	plain     mailyak.BodyPart
-	toAddrs   []string
-	trimRegex *regexp.Regexp
-}
+// mockSMTPSender is a mocking interface for delivering SMTP messages
+type mockSMTPSender struct{}
 
-// Send will mock sending the email
-func (m *mockSMTPInterface) Send() error {
-	if len(m.toAddrs) > 0 {
+// SendMail will mock sending the email
+func (m *mockSMTPSender) SendMail(_ context.Context, envelope smtpEnvelope, _ []byte) error {
+	if to := envelope.to; len(to) > 0 {
 
 		// Valid email
-		if m.toAddrs[0] == "test@domain.com" {
+		if to[0] == "test@domain.com" {
 			return nil
 		}
 
 		// Bad username - Auth
-		if m.toAddrs[0] == "test@badusername.com" {
+		if to[0] == "test@badusername.com" {
 			return ErrSMTPAuth
 		}
 
 		// Bad hostname
-		if m.toAddrs[0] == "test@badhostname.com" {
+		if to[0] == "test@badhostname.com" {
 			return ErrDNSLookup
 		}
 
@@ -46,101 +42,63 @@ func (m *mockSMTPInterface) Send() error {
 	return nil
 }
 
-// MimeBuf will mock the mime type
-func (m *mockSMTPInterface) MimeBuf() (*bytes.Buffer, error) {
-	return &bytes.Buffer{}, nil
-}
-
-// String is a mock method
-func (m *mockSMTPInterface) String() string {
-	return ""
-}
-
-// HTML is a mock method
-func (m *mockSMTPInterface) HTML() *mailyak.BodyPart {
-	return &m.html
-}
-
-// Plain is a mock method
-func (m *mockSMTPInterface) Plain() *mailyak.BodyPart {
-	return &m.plain
-}
-
-// To is a mock method
-func (m *mockSMTPInterface) To(addrs ...string) {
-	m.toAddrs = []string{}
-
-	for _, addr := range addrs {
-		trimmed := m.trimRegex.ReplaceAllString(addr, "")
-		if trimmed == "" {
-			continue
-		}
-
-		m.toAddrs = append(m.toAddrs, trimmed)
-	}
-}
-
-// Bcc is a mock method
-func (m *mockSMTPInterface) Bcc(_ ...string) {}
-
-// WriteBccHeader is a mock method
-func (m *mockSMTPInterface) WriteBccHeader(_ bool) {}
-
-// Cc is a mock method
-func (m *mockSMTPInterface) Cc(_ ...string) {}
-
-// From is a mock method
-func (m *mockSMTPInterface) From(_ string) {}
-
-// FromName is a mock method
-func (m *mockSMTPInterface) FromName(_ string) {}
-
-// ReplyTo is a mock method
-func (m *mockSMTPInterface) ReplyTo(_ string) {}
-
-// Subject is a mock method
-func (m *mockSMTPInterface) Subject(_ string) {}
-
-// AddHeader is a mock method
-func (m *mockSMTPInterface) AddHeader(_, _ string) {}
-
-// Attach is a mock method
-func (m *mockSMTPInterface) Attach(_ string, _ io.Reader) {}
-
-// AttachWithMimeType is a mock method
-func (m *mockSMTPInterface) AttachWithMimeType(_ string, _ io.Reader, _ string) {}
-
-// AttachInline is a mock method
-func (m *mockSMTPInterface) AttachInline(_ string, _ io.Reader) {}
-
-// AttachInlineWithMimeType is a mock method
-func (m *mockSMTPInterface) AttachInlineWithMimeType(_ string, _ io.Reader, _ string) {}
-
-// ClearAttachments is a mock method
-func (m *mockSMTPInterface) ClearAttachments() {}
+// TestSMTPDialer_SendMail will test the SendMail() method
+func TestSMTPDialer_SendMail(t *testing.T) {
+	t.Parallel()
 
-// TestNewSMTPClient is a basic test for creating a client
-func TestNewSMTPClient(t *testing.T) {
 	auth := smtp.PlainAuth("", "user", "password", "host")
 
 	t.Run("empty host error", func(t *testing.T) {
-		client := newSMTPClient("", auth)
-		err := client.Send()
+		err := newSMTPDialer("", auth, SMTPTLSOpportunistic, nil).SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("test"))
 		assert.Error(t, err)
 	})
 
-	t.Run("example.com host error", func(t *testing.T) {
-		client := newSMTPClient("example.com", auth)
-		err := client.Send()
+	t.Run("missing port error", func(t *testing.T) {
+		err := newSMTPDialer("example.com", auth, SMTPTLSOpportunistic, nil).SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("test"))
 		assert.Error(t, err)
 	})
-}
 
-// newMockSMTPClient will create a new mock client for SMTP
-func newMockSMTPClient() smtpInterface {
-	return &mockSMTPInterface{
-		trimRegex: regexp.MustCompile("\r?\n"),
-	}
+	t.Run("successful send", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		err := newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil).SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com", "cc@example.com"}}, []byte("Subject: Test\r\n\r\nTest"))
+		require.NoError(t, err)
+
+		messages := server.messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "from@example.com", messages[0].from)
+		assert.Equal(t, []string{"to@example.com", "cc@example.com"}, messages[0].to)
+		assert.Contains(t, messages[0].data, "Subject: Test")
+	})
+
+	t.Run("rejected recipient", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		err := newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil).SendMail(context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"reject@example.com"}}, []byte("test"))
+		var replyErr *textproto.Error
+		require.ErrorAs(t, err, &replyErr)
+		assert.Equal(t, 550, replyErr.Code)
+	})
+
+	t.Run("canceled context does not dial", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil).SendMail(ctx, smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("test"))
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, server.messages())
+	})
+
+	t.Run("deadline aborts a stalled server", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		server.setStalled(true)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := newSMTPDialer(server.addr, nil, SMTPTLSOpportunistic, nil).SendMail(ctx, smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("test"))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.True(t, IsTransient(classifySMTPError(err)))
+	})
 }
 
 // TestSendViaSMTP will test the sendViaSMTP() method
@@ -159,8 +117,8 @@ func TestSendViaSMTP(t *testing.T) {
 	mail.TrackClicks = true
 	mail.TrackOpens = true
 
-	// Setup mock client
-	client := newMockSMTPClient()
+	// Setup mock sender
+	sender := &mockSMTPSender{}
 
 	// New email
 	email := mail.NewEmail()
@@ -193,12 +151,137 @@ func TestSendViaSMTP(t *testing.T) {
 			email.RecipientsCc = []string{test.input}
 			email.RecipientsBcc = []string{test.input}
 			email.ReplyToAddress = test.input
-			err := sendViaSMTP(client, email)
+			result, err := sendViaSMTP(context.Background(), sender, nil, email)
 			if test.expectedError {
 				assert.Error(t, err)
 			} else {
-				assert.NoError(t, err)
+				require.NoError(t, err)
+				assert.Equal(t, SMTP, result.Provider)
+				assert.Len(t, result.Recipients, 3)
+				assert.NotEmpty(t, result.MessageID)
+				assert.Empty(t, email.MessageID)
 			}
 		})
 	}
+
+	t.Run("message id of the email is returned", func(t *testing.T) {
+		email.Recipients = []string{"test@domain.com"}
+		email.MessageID = "<abc123@example.com>"
+		result, err := sendViaSMTP(context.Background(), sender, nil, email)
+		require.NoError(t, err)
+		assert.Equal(t, "<abc123@example.com>", result.MessageID)
+	})
+}
+
+// TestClassifySMTPError will test the classifySMTPError() method
+func TestClassifySMTPError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"mailbox busy", &textproto.Error{Code: 450, Msg: "4.2.1 Mailbox busy"}, true},
+		{"greylisted", &textproto.Error{Code: 421, Msg: "4.7.0 Try again later"}, true},
+		{"auth failed", &textproto.Error{Code: 535, Msg: "5.7.8 Authentication failed"}, false},
+		{"no such user", &textproto.Error{Code: 550, Msg: "5.1.1 No such user"}, false},
+		{"connection refused", &net.OpError{Op: "dial", Err: ErrBadHostname}, true},
+		{"unknown error", ErrSMTPAuth, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := classifySMTPError(test.err)
+			require.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.transient, IsTransient(err))
+		})
+	}
+}
+
+// TestSMTPDialer_TLSModes will test the TLS modes against a local TLS SMTP server
+func TestSMTPDialer_TLSModes(t *testing.T) {
+	t.Parallel()
+
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	send := func(server *testSMTPServer, mode SMTPTLSMode, tlsConfig *tls.Config) error {
+		return newSMTPDialer(server.addr, nil, mode, tlsConfig).SendMail(
+			context.Background(), smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("Subject: Test\r\n\r\nTest"),
+		)
+	}
+
+	tests := []struct {
+		name        string
+		startTLS    bool
+		implicitTLS bool
+		mode        SMTPTLSMode
+		expectedTLS bool
+		expectedErr error
+	}{
+		{"opportunistic with STARTTLS", true, false, SMTPTLSOpportunistic, true, nil},
+		{"opportunistic without STARTTLS", false, false, SMTPTLSOpportunistic, false, nil},
+		{"required with STARTTLS", true, false, SMTPTLSRequired, true, nil},
+		{"required without STARTTLS", false, false, SMTPTLSRequired, false, ErrSMTPStartTLSNotSupported},
+		{"none skips STARTTLS", true, false, SMTPTLSNone, false, nil},
+		{"implicit TLS", false, true, SMTPTLSImplicit, true, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var server *testSMTPServer
+			if test.startTLS || test.implicitTLS {
+				server = newTestSMTPServerTLS(t, serverConfig, test.implicitTLS)
+			} else {
+				server = newTestSMTPServer(t)
+			}
+
+			err := send(server, test.mode, clientConfig)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				assert.Empty(t, server.messages())
+				return
+			}
+			require.NoError(t, err)
+			messages := server.messages()
+			require.Len(t, messages, 1)
+			assert.Equal(t, test.expectedTLS, messages[0].tls)
+		})
+	}
+
+	t.Run("untrusted certificate fails", func(t *testing.T) {
+		server := newTestSMTPServerTLS(t, serverConfig, false)
+		err := send(server, SMTPTLSRequired, nil)
+		var certErr *tls.CertificateVerificationError
+		require.ErrorAs(t, err, &certErr)
+		assert.Empty(t, server.messages())
+	})
+
+	t.Run("implicit TLS against a plain server fails", func(t *testing.T) {
+		server := newTestSMTPServer(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		err := newSMTPDialer(server.addr, nil, SMTPTLSImplicit, clientConfig).SendMail(ctx, smtpEnvelope{from: "from@example.com", to: []string{"to@example.com"}}, []byte("test"))
+		require.Error(t, err)
+		assert.Empty(t, server.messages())
+	})
+
+}
+
+// TestNewSMTPDialer will test the tls config defaults of newSMTPDialer()
+func TestNewSMTPDialer(t *testing.T) {
+	t.Parallel()
+
+	dialer := newSMTPDialer("smtp.example.com:587", nil, SMTPTLSRequired, nil)
+	assert.Equal(t, "smtp.example.com", dialer.tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS12), dialer.tlsConfig.MinVersion)
+
+	// Custom values are kept and the config is cloned
+	custom := &tls.Config{ServerName: "mail.example.com", MinVersion: tls.VersionTLS13}
+	dialer = newSMTPDialer("smtp.example.com:587", nil, SMTPTLSImplicit, custom)
+	assert.Equal(t, "mail.example.com", dialer.tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS13), dialer.tlsConfig.MinVersion)
+	assert.NotSame(t, custom, dialer.tlsConfig)
+
+	assert.Equal(t, "implicit", SMTPTLSImplicit.String())
+	assert.Equal(t, "SMTPTLSMode(9)", SMTPTLSMode(9).String())
 }
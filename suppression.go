@@ -0,0 +1,312 @@
+package gomail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SuppressionReason is why a recipient was added to the suppression list
+type SuppressionReason string
+
+// Suppression reasons
+const (
+	SuppressionHardBounce  SuppressionReason = "hard_bounce" // The address permanently bounced
+	SuppressionComplaint   SuppressionReason = "complaint"   // The recipient marked a message as spam
+	SuppressionUnsubscribe SuppressionReason = "unsubscribe" // The recipient unsubscribed
+	SuppressionManual      SuppressionReason = "manual"      // The address was added by hand
+)
+
+// SuppressionAction decides what happens to a suppressed recipient when sending
+type SuppressionAction int
+
+// Suppression actions
+const (
+	SuppressionDrop   SuppressionAction = iota // remove the recipient and send to the others (default)
+	SuppressionReject                          // refuse to send the email
+	SuppressionAllow                           // send to the recipient anyway
+)
+
+// String returns the name of the action
+func (a SuppressionAction) String() string {
+	switch a {
+	case SuppressionDrop:
+		return "drop"
+	case SuppressionReject:
+		return "reject"
+	case SuppressionAllow:
+		return "allow"
+	default:
+		return fmt.Sprintf("SuppressionAction(%d)", int(a))
+	}
+}
+
+// SuppressionActions is the action for suppressed recipients by reason
+type SuppressionActions map[SuppressionReason]SuppressionAction
+
+// Suppression is an entry of the suppression list
+//
+// DO NOT CHANGE ORDER - Optimized for memory (maligned)
+type Suppression struct {
+	CreatedAt time.Time         `json:"created_at" mapstructure:"created_at"` // when the address was suppressed
+	Email     string            `json:"email" mapstructure:"email"`           // suppressed email address (lowercase)
+	Note      string            `json:"note" mapstructure:"note"`             // optional details, ie: the bounce diagnostic code
+	Reason    SuppressionReason `json:"reason" mapstructure:"reason"`         // why the address is suppressed
+}
+
+// SuppressionStore is the list of addresses that should not be sent to
+//
+// Addresses are matched case-insensitively, implementations must be safe for concurrent use
+type SuppressionStore interface {
+	Add(ctx context.Context, suppression Suppression) error
+	Get(ctx context.Context, email string) (suppression Suppression, found bool, err error)
+	List(ctx context.Context) ([]Suppression, error)
+	Remove(ctx context.Context, email string) error
+}
+
+// suppressionKey normalizes the address for lookups ("Name <Address>" is reduced to the address)
+func suppressionKey(email string) string {
+	if parsed, err := mail.ParseAddress(email); err == nil {
+		email = parsed.Address
+	}
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// newSuppressionEntry normalizes the entry before it is stored
+func newSuppressionEntry(suppression Suppression) (Suppression, error) {
+	suppression.Email = suppressionKey(suppression.Email)
+	if len(suppression.Email) == 0 {
+		return suppression, ErrMissingSuppressionEmail
+	}
+	if len(suppression.Reason) == 0 {
+		suppression.Reason = SuppressionManual
+	}
+	if suppression.CreatedAt.IsZero() {
+		suppression.CreatedAt = time.Now().UTC()
+	}
+	return suppression, nil
+}
+
+// MemorySuppressionStore is a SuppressionStore kept in memory
+type MemorySuppressionStore struct {
+	entries map[string]Suppression
+	mu      sync.RWMutex
+}
+
+// NewMemorySuppressionStore returns an empty in-memory suppression list
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{entries: make(map[string]Suppression)}
+}
+
+// Add will add (or replace) the address in the suppression list
+func (s *MemorySuppressionStore) Add(_ context.Context, suppression Suppression) (err error) {
+	if suppression, err = newSuppressionEntry(suppression); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[suppression.Email] = suppression
+	return nil
+}
+
+// Get will return the entry for the address
+func (s *MemorySuppressionStore) Get(_ context.Context, email string) (Suppression, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	suppression, found := s.entries[suppressionKey(email)]
+	return suppression, found, nil
+}
+
+// List will return every entry sorted by address
+func (s *MemorySuppressionStore) List(_ context.Context) ([]Suppression, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedSuppressions(s.entries), nil
+}
+
+// Remove will remove the address from the suppression list (no error if it is not listed)
+func (s *MemorySuppressionStore) Remove(_ context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, suppressionKey(email))
+	return nil
+}
+
+// sortedSuppressions returns the entries sorted by address
+func sortedSuppressions(entries map[string]Suppression) []Suppression {
+	list := make([]Suppression, 0, len(entries))
+	for _, suppression := range entries {
+		list = append(list, suppression)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Email < list[j].Email })
+	return list
+}
+
+// FileSuppressionStore is a SuppressionStore saved as a JSON file
+//
+// The file is loaded once, every change rewrites it (write to a temp file, then rename)
+type FileSuppressionStore struct {
+	memory *MemorySuppressionStore
+	path   string
+	mu     sync.Mutex
+}
+
+// NewFileSuppressionStore loads the suppression list from the file (a missing file is an empty list)
+func NewFileSuppressionStore(path string) (*FileSuppressionStore, error) {
+	store := &FileSuppressionStore{memory: NewMemorySuppressionStore(), path: path}
+	contents, err := os.ReadFile(path) //nolint:gosec // path is set by the application
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read suppression list: %w", err)
+	}
+
+	var list []Suppression
+	if err = json.Unmarshal(contents, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse suppression list %s: %w", path, err)
+	}
+	for _, suppression := range list {
+		if err = store.memory.Add(context.Background(), suppression); err != nil {
+			return nil, fmt.Errorf("failed to parse suppression list %s: %w", path, err)
+		}
+	}
+	return store, nil
+}
+
+// Add will add (or replace) the address in the suppression list and save the file
+func (s *FileSuppressionStore) Add(ctx context.Context, suppression Suppression) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.memory.Add(ctx, suppression); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// Get will return the entry for the address
+func (s *FileSuppressionStore) Get(ctx context.Context, email string) (Suppression, bool, error) {
+	return s.memory.Get(ctx, email)
+}
+
+// List will return every entry sorted by address
+func (s *FileSuppressionStore) List(ctx context.Context) ([]Suppression, error) {
+	return s.memory.List(ctx)
+}
+
+// Remove will remove the address from the suppression list and save the file
+func (s *FileSuppressionStore) Remove(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.memory.Remove(ctx, email); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// save writes the list to the file
+func (s *FileSuppressionStore) save() error {
+	list, _ := s.memory.List(context.Background())
+	contents, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(s.path, contents); err != nil {
+		return fmt.Errorf("failed to save suppression list: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes and syncs a temp file next to the file, then renames it, so a crash never leaves a partial file
+func writeFileAtomic(path string, contents []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(temp.Name())
+	}()
+	if _, err = temp.Write(contents); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err = temp.Sync(); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// suppressionAction returns the configured action for the reason (drop by default)
+func (m *MailService) suppressionAction(reason SuppressionReason) SuppressionAction {
+	if action, ok := m.SuppressionActions[reason]; ok {
+		return action
+	}
+	return SuppressionDrop
+}
+
+// filterSuppressed returns a copy of the email without the suppressed recipients (To, Cc and Bcc)
+//
+// Dropped recipients are reported with the suppressed status, a recipient with the reject
+// action refuses the whole email, as does a suppressed TO list (ErrAllRecipientsSuppressed).
+// The email is returned as is if there is no store.
+func (m *MailService) filterSuppressed(ctx context.Context, email *Email) (*Email, []RecipientResult, error) {
+	if m.SuppressionStore == nil {
+		return email, nil, nil
+	}
+
+	var suppressed []RecipientResult
+	filter := func(recipients []string) ([]string, error) {
+		kept := make([]string, 0, len(recipients))
+		for _, recipient := range recipients {
+			suppression, found, err := m.SuppressionStore.Get(ctx, recipient)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check the suppression list: %w", err)
+			}
+			if !found || m.suppressionAction(suppression.Reason) == SuppressionAllow {
+				kept = append(kept, recipient)
+				continue
+			}
+			if m.suppressionAction(suppression.Reason) == SuppressionReject {
+				return nil, fmt.Errorf("recipient %s is suppressed (%s): %w", recipient, suppression.Reason, ErrRecipientSuppressed)
+			}
+			suppressed = append(suppressed, RecipientResult{
+				Email:        recipient,
+				RejectReason: "suppressed: " + string(suppression.Reason),
+				Status:       RecipientSuppressed,
+			})
+		}
+		return kept, nil
+	}
+
+	filtered := *email
+	var err error
+	if filtered.Recipients, err = filter(email.Recipients); err != nil {
+		return email, nil, err
+	}
+	if filtered.RecipientsCc, err = filter(email.RecipientsCc); err != nil {
+		return email, nil, err
+	}
+	if filtered.RecipientsBcc, err = filter(email.RecipientsBcc); err != nil {
+		return email, nil, err
+	}
+	if len(suppressed) == 0 {
+		return email, nil, nil
+	}
+	// Providers require a TO recipient, the Cc and Bcc recipients are not sent without one
+	if len(filtered.Recipients) == 0 {
+		return email, suppressed, fmt.Errorf("%d suppressed recipient(s): %w", len(suppressed), ErrAllRecipientsSuppressed)
+	}
+	return &filtered, suppressed, nil
+}
@@ -0,0 +1,275 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errSuppressionStore is a mock store that fails every lookup
+type errSuppressionStore struct {
+	*MemorySuppressionStore
+}
+
+// Get is for mocking
+func (s *errSuppressionStore) Get(context.Context, string) (Suppression, bool, error) {
+	return Suppression{}, false, ErrAWSServiceError
+}
+
+// testSuppressionStore runs the same checks against any suppression store
+func testSuppressionStore(t *testing.T, store SuppressionStore) {
+	ctx := context.Background()
+
+	require.NoError(t, store.Add(ctx, Suppression{Email: "Bounced@Domain.com", Reason: SuppressionHardBounce, Note: "550 user unknown"}))
+	require.NoError(t, store.Add(ctx, Suppression{Email: "Someone <manual@domain.com>"}))
+	require.ErrorIs(t, store.Add(ctx, Suppression{Email: " "}), ErrMissingSuppressionEmail)
+
+	// Lookups ignore case and display names
+	suppression, found, err := store.Get(ctx, "bounced@domain.com")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "bounced@domain.com", suppression.Email)
+	assert.Equal(t, SuppressionHardBounce, suppression.Reason)
+	assert.Equal(t, "550 user unknown", suppression.Note)
+	assert.WithinDuration(t, time.Now(), suppression.CreatedAt, time.Minute)
+
+	suppression, found, err = store.Get(ctx, "MANUAL@domain.com")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, SuppressionManual, suppression.Reason)
+
+	_, found, err = store.Get(ctx, "other@domain.com")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Adding again replaces the entry
+	require.NoError(t, store.Add(ctx, Suppression{Email: "bounced@domain.com", Reason: SuppressionComplaint}))
+	list, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "bounced@domain.com", list[0].Email)
+	assert.Equal(t, SuppressionComplaint, list[0].Reason)
+	assert.Equal(t, "manual@domain.com", list[1].Email)
+
+	// Removing is case-insensitive and idempotent
+	require.NoError(t, store.Remove(ctx, "Bounced@domain.com"))
+	require.NoError(t, store.Remove(ctx, "bounced@domain.com"))
+	list, err = store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "manual@domain.com", list[0].Email)
+}
+
+// TestMemorySuppressionStore will test the MemorySuppressionStore methods
+func TestMemorySuppressionStore(t *testing.T) {
+	t.Parallel()
+
+	testSuppressionStore(t, NewMemorySuppressionStore())
+}
+
+// TestFileSuppressionStore will test the FileSuppressionStore methods
+func TestFileSuppressionStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("changes are saved to the file", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "suppressions.json")
+		store, err := NewFileSuppressionStore(path)
+		require.NoError(t, err)
+		testSuppressionStore(t, store)
+
+		// A new store loads the saved list
+		store, err = NewFileSuppressionStore(path)
+		require.NoError(t, err)
+		list, err := store.List(context.Background())
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, "manual@domain.com", list[0].Email)
+		assert.Equal(t, SuppressionManual, list[0].Reason)
+
+		// No temp files are left behind
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("invalid files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		invalidJSON := filepath.Join(dir, "invalid.json")
+		require.NoError(t, os.WriteFile(invalidJSON, []byte("{"), 0o600))
+		_, err := NewFileSuppressionStore(invalidJSON)
+		require.Error(t, err)
+
+		missingEmail := filepath.Join(dir, "missing.json")
+		require.NoError(t, os.WriteFile(missingEmail, []byte(`[{"reason":"manual"}]`), 0o600))
+		_, err = NewFileSuppressionStore(missingEmail)
+		require.ErrorIs(t, err, ErrMissingSuppressionEmail)
+
+		_, err = NewFileSuppressionStore(dir)
+		require.Error(t, err)
+	})
+
+	t.Run("save failure", func(t *testing.T) {
+		t.Parallel()
+
+		store, err := NewFileSuppressionStore(filepath.Join(t.TempDir(), "missing", "suppressions.json"))
+		require.NoError(t, err)
+		require.Error(t, store.Add(context.Background(), Suppression{Email: "test@domain.com"}))
+	})
+}
+
+// TestSuppressionAction_String will test the method String()
+func TestSuppressionAction_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "drop", SuppressionDrop.String())
+	assert.Equal(t, "reject", SuppressionReject.String())
+	assert.Equal(t, "allow", SuppressionAllow.String())
+	assert.Equal(t, "SuppressionAction(9)", SuppressionAction(9).String())
+}
+
+// TestMailService_SuppressedRecipients tests the suppression list when sending
+func TestMailService_SuppressedRecipients(t *testing.T) {
+	t.Parallel()
+
+	newService := func(t *testing.T, actions SuppressionActions) (*MailService, *mockCaptureMandrillInterface) {
+		mail := newFailoverTestService(t)
+		client := &mockCaptureMandrillInterface{}
+		require.NoError(t, mail.RegisterProvider(Mandrill, &mandrillProvider{client: client, async: true}))
+
+		store := NewMemorySuppressionStore()
+		ctx := context.Background()
+		require.NoError(t, store.Add(ctx, Suppression{Email: "bounced@domain.com", Reason: SuppressionHardBounce}))
+		require.NoError(t, store.Add(ctx, Suppression{Email: "complained@domain.com", Reason: SuppressionComplaint}))
+		require.NoError(t, store.Add(ctx, Suppression{Email: "unsubscribed@domain.com", Reason: SuppressionUnsubscribe}))
+		mail.SuppressionStore = store
+		mail.SuppressionActions = actions
+		return mail, client
+	}
+	newEmail := func(mail *MailService) *Email {
+		email := mail.NewEmail()
+		email.Subject = "Test subject"
+		email.PlainTextContent = "Test email content"
+		email.Recipients = []string{"test@domain.com", "Bounced@domain.com"}
+		email.RecipientsCc = []string{"complained@domain.com", "cc@domain.com"}
+		email.RecipientsBcc = []string{"unsubscribed@domain.com"}
+		return email
+	}
+	sentTo := func(client *mockCaptureMandrillInterface) []string {
+		var recipients []string
+		for _, to := range client.messages[0].To {
+			recipients = append(recipients, to.Email)
+		}
+		return recipients
+	}
+
+	t.Run("suppressed recipients are dropped and reported", func(t *testing.T) {
+		t.Parallel()
+
+		mail, client := newService(t, nil)
+		email := newEmail(mail)
+		result, err := mail.SendEmailWithResult(context.Background(), email, Mandrill)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"test@domain.com", "cc@domain.com"}, sentTo(client))
+
+		// The caller's email is not changed
+		assert.Equal(t, []string{"test@domain.com", "Bounced@domain.com"}, email.Recipients)
+		assert.Len(t, email.RecipientsBcc, 1)
+
+		var suppressed []RecipientResult
+		for _, recipient := range result.Recipients {
+			if recipient.Status == RecipientSuppressed {
+				suppressed = append(suppressed, recipient)
+			}
+		}
+		require.Len(t, suppressed, 3)
+		assert.Equal(t, RecipientResult{Email: "Bounced@domain.com", RejectReason: "suppressed: hard_bounce", Status: RecipientSuppressed}, suppressed[0])
+		assert.Equal(t, "complained@domain.com", suppressed[1].Email)
+		assert.Equal(t, "suppressed: unsubscribe", suppressed[2].RejectReason)
+	})
+
+	t.Run("actions are configured per reason", func(t *testing.T) {
+		t.Parallel()
+
+		mail, client := newService(t, SuppressionActions{
+			SuppressionComplaint:   SuppressionAllow,
+			SuppressionUnsubscribe: SuppressionAllow,
+		})
+		require.NoError(t, mail.SendEmail(context.Background(), newEmail(mail), Mandrill))
+		assert.ElementsMatch(t, []string{"test@domain.com", "complained@domain.com", "cc@domain.com", "unsubscribed@domain.com"}, sentTo(client))
+
+		mail, client = newService(t, SuppressionActions{SuppressionHardBounce: SuppressionReject})
+		err := mail.SendEmail(context.Background(), newEmail(mail), Mandrill)
+		require.ErrorIs(t, err, ErrRecipientSuppressed)
+		assert.Contains(t, err.Error(), "Bounced@domain.com")
+		assert.Empty(t, client.messages)
+	})
+
+	t.Run("email is not sent when every TO recipient is suppressed", func(t *testing.T) {
+		t.Parallel()
+
+		mail, client := newService(t, nil)
+		email := newEmail(mail)
+		email.Recipients = []string{"bounced@domain.com"}
+		result, err := mail.SendEmailWithResult(context.Background(), email, Mandrill)
+		require.ErrorIs(t, err, ErrAllRecipientsSuppressed)
+		assert.Len(t, result.Recipients, 3)
+		assert.Empty(t, client.messages)
+
+		// Not tried on other providers
+		_, err = mail.SendWithFailover(context.Background(), email)
+		require.ErrorIs(t, err, ErrAllRecipientsSuppressed)
+		assert.Empty(t, client.messages)
+	})
+
+	t.Run("email is not sent when every recipient is suppressed", func(t *testing.T) {
+		t.Parallel()
+
+		mail, client := newService(t, nil)
+		email := newEmail(mail)
+		email.Recipients = []string{"bounced@domain.com"}
+		email.RecipientsCc = []string{"complained@domain.com"}
+		result, err := mail.SendEmailWithResult(context.Background(), email, Mandrill)
+		require.ErrorIs(t, err, ErrAllRecipientsSuppressed)
+		assert.Len(t, result.Recipients, 3)
+		assert.Empty(t, client.messages)
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		t.Parallel()
+
+		mail, client := newService(t, nil)
+		result, err := mail.SendWithFailover(context.Background(), newEmail(mail), Mandrill)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"test@domain.com", "cc@domain.com"}, sentTo(client))
+		require.Len(t, result.Recipients, 4)
+		assert.Equal(t, RecipientAccepted, result.Recipients[0].Status)
+		assert.Equal(t, RecipientSuppressed, result.Recipients[1].Status)
+
+		email := newEmail(mail)
+		email.Recipients = []string{"bounced@domain.com"}
+		email.RecipientsCc = nil
+		_, err = mail.SendWithFailover(context.Background(), email, Mandrill)
+		require.ErrorIs(t, err, ErrAllRecipientsSuppressed)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		t.Parallel()
+
+		mail, client := newService(t, nil)
+		mail.SuppressionStore = &errSuppressionStore{MemorySuppressionStore: NewMemorySuppressionStore()}
+		err := mail.SendEmail(context.Background(), newEmail(mail), Mandrill)
+		require.ErrorIs(t, err, ErrAWSServiceError)
+		assert.False(t, errors.Is(err, ErrRecipientSuppressed))
+		assert.Empty(t, client.messages)
+	})
+}
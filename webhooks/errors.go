@@ -0,0 +1,12 @@
+package webhooks
+
+import "errors"
+
+// Errors returned when verifying the webhook requests
+var (
+	ErrInvalidSNSCert       = errors.New("invalid sns signing certificate")
+	ErrInvalidSNSSignature  = errors.New("invalid sns message signature")
+	ErrInvalidSNSURL        = errors.New("sns url is not an aws sns endpoint")
+	ErrSNSSubscriptionError = errors.New("sns subscription confirmation failed")
+	ErrUnexpectedSNSTopic   = errors.New("sns topic is not accepted")
+)
@@ -0,0 +1,269 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	gomail "github.com/mrz1836/go-mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPostmarkInboundPayload is a Postmark inbound webhook payload
+const testPostmarkInboundPayload = `{
+  "FromName": "Jane Doe",
+  "MessageStream": "inbound",
+  "From": "jane@domain.com",
+  "FromFull": {"Email": "jane@domain.com", "Name": "Jane Doe", "MailboxHash": ""},
+  "To": "\"Support\" <support+ticket-42@inbound.example.com>",
+  "ToFull": [{"Email": "support+ticket-42@inbound.example.com", "Name": "Support", "MailboxHash": "ticket-42"}],
+  "Cc": "cc@domain.com",
+  "CcFull": [{"Email": "cc@domain.com", "Name": "", "MailboxHash": ""}],
+  "Bcc": "",
+  "BccFull": [],
+  "OriginalRecipient": "support+ticket-42@inbound.example.com",
+  "Subject": "Re: Your ticket",
+  "MessageID": "73e6d360-66eb-11e1-8e72-a8904824019b",
+  "ReplyTo": "Jane Doe <reply@domain.com>",
+  "MailboxHash": "ticket-42",
+  "Date": "Fri, 16 Oct 2026 16:45:32 -04:00",
+  "TextBody": "Thanks for the help",
+  "HtmlBody": "<p>Thanks for the help</p>",
+  "StrippedTextReply": "Thanks for the help",
+  "Tag": "support",
+  "Headers": [
+    {"Name": "X-Spam-Status", "Value": "No"},
+    {"Name": "X-Spam-Score", "Value": "-0.1"},
+    {"Name": "Message-ID", "Value": "<CAB123@mail.domain.com>"},
+    {"Name": "Received", "Value": "by mx1"},
+    {"Name": "Received", "Value": "by mx2"}
+  ],
+  "Attachments": [
+    {"Name": "notes.txt", "Content": "YXR0YWNobWVudCBjb250ZW50cw==", "ContentType": "text/plain", "ContentLength": 19}
+  ]
+}`
+
+// testMandrillInboundEvents is a Mandrill inbound webhook batch (with a non inbound event to skip)
+const testMandrillInboundEvents = `[
+  {
+    "event": "inbound",
+    "_id": "mandrill-inbound-1",
+    "ts": 1792166400,
+    "msg": {
+      "raw_msg": "From: jane@domain.com\r\nSubject: Re: Your ticket\r\n\r\nThanks for the help",
+      "headers": {
+        "Message-Id": "<CAB123@mail.domain.com>",
+        "Reply-To": "Jane Doe <reply@domain.com>",
+        "Received": ["by mx1", "by mx2"]
+      },
+      "text": "Thanks for the help",
+      "html": "<p>Thanks for the help</p>",
+      "from_email": "jane@domain.com",
+      "from_name": "Jane Doe",
+      "to": [["support@inbound.example.com", "Support"], ["other@inbound.example.com", null]],
+      "cc": [["cc@domain.com", null]],
+      "email": "support@inbound.example.com",
+      "subject": "Re: Your ticket",
+      "tags": ["support"],
+      "spam_report": {"score": 1.5, "matched_rules": []},
+      "attachments": {
+        "notes.txt": {"name": "notes.txt", "type": "text/plain", "content": "attachment contents", "base64": false},
+        "data.bin": {"name": "data.bin", "type": "application/octet-stream", "content": "AAEC", "base64": true}
+      },
+      "images": {
+        "logo.png": {"name": "logo.png", "type": "image/png", "content": "iVBORw0KGgo="}
+      }
+    }
+  },
+  {"event": "hard_bounce", "_id": "not-inbound", "ts": 1792166400, "msg": {}}
+]`
+
+// readTestAttachments will read the name and contents of every attachment
+func readTestAttachments(t *testing.T, email *gomail.Email) map[string]string {
+	contents := make(map[string]string, len(email.Attachments))
+	for _, attachment := range email.Attachments {
+		content, err := attachment.Bytes()
+		require.NoError(t, err)
+		contents[attachment.FileName+" ("+attachment.FileType+")"] = string(content)
+	}
+	return contents
+}
+
+// TestPostmarkInboundHandler will test the NewPostmarkInboundHandler() handler
+func TestPostmarkInboundHandler(t *testing.T) {
+	t.Parallel()
+
+	newRequest := func(method, username, password, body string) *http.Request {
+		req := httptest.NewRequest(method, "/inbound/postmark", strings.NewReader(body))
+		if len(username) > 0 {
+			req.SetBasicAuth(username, password)
+		}
+		return req
+	}
+
+	t.Run("valid inbound email", func(t *testing.T) {
+		var received *InboundEmail
+		handler := NewPostmarkInboundHandler("postmark", "secret", func(_ context.Context, inbound *InboundEmail) error {
+			received = inbound
+			return nil
+		})
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newRequest(http.MethodPost, "postmark", "secret", testPostmarkInboundPayload))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NotNil(t, received)
+
+		assert.Equal(t, gomail.Postmark, received.Provider)
+		assert.Equal(t, "73e6d360-66eb-11e1-8e72-a8904824019b", received.ProviderMessageID)
+		assert.Equal(t, "support+ticket-42@inbound.example.com", received.OriginalRecipient)
+		assert.InDelta(t, -0.1, received.SpamScore, 0.0001)
+		assert.Equal(t, []string{"by mx1", "by mx2"}, received.Headers.Values("Received"))
+
+		email := received.Email
+		assert.Equal(t, "jane@domain.com", email.FromAddress)
+		assert.Equal(t, "Jane Doe", email.FromName)
+		assert.Equal(t, []string{"support+ticket-42@inbound.example.com"}, email.Recipients)
+		assert.Equal(t, []string{"cc@domain.com"}, email.RecipientsCc)
+		assert.Empty(t, email.RecipientsBcc)
+		assert.Equal(t, "reply@domain.com", email.ReplyToAddress)
+		assert.Equal(t, "Re: Your ticket", email.Subject)
+		assert.Equal(t, "Thanks for the help", email.PlainTextContent)
+		assert.Equal(t, "<p>Thanks for the help</p>", email.HTMLContent)
+		assert.Equal(t, []string{"support"}, email.Tags)
+		assert.Equal(t, "<CAB123@mail.domain.com>", email.MessageID)
+		assert.True(t, email.Date.Equal(time.Date(2026, 10, 16, 20, 45, 32, 0, time.UTC)))
+		assert.Equal(t, map[string]string{"notes.txt (text/plain)": "attachment contents"}, readTestAttachments(t, email))
+	})
+
+	t.Run("refused requests", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			handler  http.Handler
+			request  *http.Request
+			expected int
+		}{
+			{"wrong method", NewPostmarkInboundHandler("postmark", "secret", nil), newRequest(http.MethodGet, "postmark", "secret", ""), http.StatusMethodNotAllowed},
+			{"missing credentials", NewPostmarkInboundHandler("postmark", "secret", nil), newRequest(http.MethodPost, "", "", testPostmarkInboundPayload), http.StatusUnauthorized},
+			{"wrong password", NewPostmarkInboundHandler("postmark", "secret", nil), newRequest(http.MethodPost, "postmark", "wrong", testPostmarkInboundPayload), http.StatusUnauthorized},
+			{"handler without credentials", NewPostmarkInboundHandler("", "", nil), newRequest(http.MethodPost, "", "", testPostmarkInboundPayload), http.StatusUnauthorized},
+			{"invalid json", NewPostmarkInboundHandler("postmark", "secret", nil), newRequest(http.MethodPost, "postmark", "secret", "{"), http.StatusBadRequest},
+			{"invalid attachment", NewPostmarkInboundHandler("postmark", "secret", nil), newRequest(http.MethodPost, "postmark", "secret", `{"Attachments":[{"Name":"a","Content":"!!"}]}`), http.StatusBadRequest},
+			{"callback error", NewPostmarkInboundHandler("postmark", "secret", func(context.Context, *InboundEmail) error {
+				return gomail.ErrMissingEmailContents
+			}), newRequest(http.MethodPost, "postmark", "secret", testPostmarkInboundPayload), http.StatusInternalServerError},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				test.handler.ServeHTTP(w, test.request)
+				assert.Equal(t, test.expected, w.Code)
+			})
+		}
+	})
+}
+
+// TestMandrillInboundHandler will test the NewMandrillInboundHandler() handler
+func TestMandrillInboundHandler(t *testing.T) {
+	t.Parallel()
+
+	const webhookURL = "https://example.com/inbound/mandrill"
+	newRequest := func(key, events string) *http.Request {
+		form := url.Values{"mandrill_events": {events}}
+		req := httptest.NewRequest(http.MethodPost, "/inbound/mandrill", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Mandrill-Signature", base64.StdEncoding.EncodeToString(mandrillSignature(key, webhookURL, form)))
+		return req
+	}
+
+	t.Run("valid inbound batch", func(t *testing.T) {
+		var received []*InboundEmail
+		handler := NewMandrillInboundHandler("webhook-key", webhookURL, func(_ context.Context, inbound *InboundEmail) error {
+			received = append(received, inbound)
+			return nil
+		})
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newRequest("webhook-key", testMandrillInboundEvents))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, received, 1)
+
+		inbound := received[0]
+		assert.Equal(t, gomail.Mandrill, inbound.Provider)
+		assert.Equal(t, "mandrill-inbound-1", inbound.ProviderMessageID)
+		assert.Equal(t, "support@inbound.example.com", inbound.OriginalRecipient)
+		assert.InDelta(t, 1.5, inbound.SpamScore, 0.0001)
+		assert.Contains(t, inbound.RawMessage, "Subject: Re: Your ticket")
+		assert.Equal(t, []string{"by mx1", "by mx2"}, inbound.Headers.Values("Received"))
+
+		email := inbound.Email
+		assert.Equal(t, "jane@domain.com", email.FromAddress)
+		assert.Equal(t, "Jane Doe", email.FromName)
+		assert.Equal(t, []string{"support@inbound.example.com", "other@inbound.example.com"}, email.Recipients)
+		assert.Equal(t, []string{"cc@domain.com"}, email.RecipientsCc)
+		assert.Equal(t, "reply@domain.com", email.ReplyToAddress)
+		assert.Equal(t, "Re: Your ticket", email.Subject)
+		assert.Equal(t, "Thanks for the help", email.PlainTextContent)
+		assert.Equal(t, "<p>Thanks for the help</p>", email.HTMLContent)
+		assert.Equal(t, []string{"support"}, email.Tags)
+		assert.Equal(t, "<CAB123@mail.domain.com>", email.MessageID)
+		assert.Equal(t, time.Unix(1792166400, 0).UTC(), email.Date)
+		assert.Equal(t, map[string]string{
+			"data.bin (application/octet-stream)": "\x00\x01\x02",
+			"logo.png (image/png)":                "\x89PNG\r\n\x1a\n",
+			"notes.txt (text/plain)":              "attachment contents",
+		}, readTestAttachments(t, email))
+	})
+
+	t.Run("url check and test batch", func(t *testing.T) {
+		handler := NewMandrillInboundHandler("webhook-key", webhookURL, func(context.Context, *InboundEmail) error {
+			return gomail.ErrMissingEmailContents
+		})
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/inbound/mandrill", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, newRequest("webhook-key", "[]"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("refused requests", func(t *testing.T) {
+		unsigned := newRequest("webhook-key", testMandrillInboundEvents)
+		unsigned.Header.Del("X-Mandrill-Signature")
+		invalidSignature := newRequest("webhook-key", testMandrillInboundEvents)
+		invalidSignature.Header.Set("X-Mandrill-Signature", "!!")
+
+		tests := []struct {
+			name     string
+			key      string
+			request  *http.Request
+			callback InboundCallback
+			expected int
+		}{
+			{"wrong method", "webhook-key", httptest.NewRequest(http.MethodGet, "/inbound/mandrill", nil), nil, http.StatusMethodNotAllowed},
+			{"missing signature", "webhook-key", unsigned, nil, http.StatusForbidden},
+			{"invalid signature", "webhook-key", invalidSignature, nil, http.StatusForbidden},
+			{"wrong key", "webhook-key", newRequest("other-key", testMandrillInboundEvents), nil, http.StatusForbidden},
+			{"handler without key", "", newRequest("", testMandrillInboundEvents), nil, http.StatusForbidden},
+			{"invalid json", "webhook-key", newRequest("webhook-key", "["), nil, http.StatusBadRequest},
+			{"invalid attachment", "webhook-key", newRequest("webhook-key", `[{"event":"inbound","msg":{"images":{"a":{"content":"!!"}}}}]`), nil, http.StatusBadRequest},
+			{"callback error", "webhook-key", newRequest("webhook-key", testMandrillInboundEvents), func(context.Context, *InboundEmail) error {
+				return gomail.ErrMissingEmailContents
+			}, http.StatusInternalServerError},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				NewMandrillInboundHandler(test.key, webhookURL, test.callback).ServeHTTP(w, test.request)
+				assert.Equal(t, test.expected, w.Code)
+			})
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // mandrill signs webhooks with HMAC-SHA1
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	gomail "github.com/mrz1836/go-mail"
+)
+
+// mandrillEventTypes maps the Mandrill message events to the delivery event types
+var mandrillEventTypes = map[string]EventType{
+	"click":       EventClicked,
+	"deferral":    EventDelayed,
+	"hard_bounce": EventBounced,
+	"open":        EventOpened,
+	"reject":      EventRejected,
+	"send":        EventSent,
+	"soft_bounce": EventBounced,
+	"spam":        EventComplained,
+	"unsub":       EventUnsubscribed,
+}
+
+// mandrillHandler receives Mandrill webhooks
+type mandrillHandler struct {
+	callback   Callback
+	key        string
+	webhookURL string
+}
+
+// mandrillEvent is a message event in the Mandrill webhook batch
+type mandrillEvent struct {
+	Msg struct {
+		BounceDescription string `json:"bounce_description"`
+		Diag              string `json:"diag"`
+		Email             string `json:"email"`
+	} `json:"msg"`
+	Event string `json:"event"`
+	ID    string `json:"_id"`
+	URL   string `json:"url"`
+	TS    int64  `json:"ts"`
+}
+
+// NewMandrillHandler returns a handler for the Mandrill message event webhooks (batched in mandrill_events)
+//
+// Requests are verified with the X-Mandrill-Signature header, signed with the webhook key
+// for the webhook url exactly as it is configured in Mandrill
+func NewMandrillHandler(webhookKey, webhookURL string, callback Callback) http.Handler {
+	return &mandrillHandler{callback: callback, key: webhookKey, webhookURL: webhookURL}
+}
+
+// ServeHTTP verifies the signature and delivers every event of the batch to the callback
+func (h *mandrillHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Mandrill checks the url exists with a HEAD request when the webhook is added
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	} else if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodHead+", "+http.MethodPost)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid mandrill webhook", http.StatusBadRequest)
+		return
+	}
+	if !verifyMandrillSignature(h.key, h.webhookURL, r.PostForm, r.Header.Get("X-Mandrill-Signature")) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	events, err := mandrillEvents([]byte(r.PostForm.Get("mandrill_events")))
+	if err != nil {
+		http.Error(w, "invalid mandrill webhook", http.StatusBadRequest)
+		return
+	}
+	deliver(w, r, h.callback, events)
+}
+
+// verifyMandrillSignature checks the base64 HMAC-SHA1 of the webhook url followed by the sorted post parameters
+func verifyMandrillSignature(key, webhookURL string, params map[string][]string, signature string) bool {
+	if len(key) == 0 || len(signature) == 0 {
+		return false
+	}
+	expected, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mandrillSignature(key, webhookURL, params), expected)
+}
+
+// mandrillSignature signs the webhook url and post parameters with the webhook key
+func mandrillSignature(key, webhookURL string, params map[string][]string) []byte {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(webhookURL))
+	for _, name := range names {
+		for _, value := range params[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	return mac.Sum(nil)
+}
+
+// mandrillEvents converts the message events of the batch (sync events are skipped)
+func mandrillEvents(batch []byte) ([]*DeliveryEvent, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(batch, &raws); err != nil {
+		return nil, err
+	}
+
+	events := make([]*DeliveryEvent, 0, len(raws))
+	for _, raw := range raws {
+		var record mandrillEvent
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return nil, err
+		}
+		eventType, ok := mandrillEventTypes[record.Event]
+		if !ok {
+			continue
+		}
+		event := &DeliveryEvent{
+			MessageID: record.ID,
+			Provider:  gomail.Mandrill,
+			Raw:       raw,
+			Recipient: record.Msg.Email,
+			Timestamp: time.Unix(record.TS, 0).UTC(),
+			Type:      eventType,
+			URL:       record.URL,
+		}
+		switch record.Event {
+		case "hard_bounce":
+			event.BounceType = BounceHard
+		case "soft_bounce":
+			event.BounceType = BounceSoft
+		}
+		if eventType == EventBounced || eventType == EventRejected || eventType == EventDelayed {
+			event.BounceReason = record.Msg.Diag
+			if len(event.BounceReason) == 0 {
+				event.BounceReason = record.Msg.BounceDescription
+			}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,126 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	gomail "github.com/mrz1836/go-mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testMandrillKey = "webhook-key"
+	testMandrillURL = "https://example.com/webhooks/mandrill"
+)
+
+// newTestMandrillRequest will create a signed Mandrill webhook request for the events
+func newTestMandrillRequest(events string) *http.Request {
+	form := url.Values{"mandrill_events": {events}}
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/mandrill", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Mandrill-Signature", base64.StdEncoding.EncodeToString(mandrillSignature(testMandrillKey, testMandrillURL, form)))
+	return req
+}
+
+// TestMandrillHandler will test the NewMandrillHandler() handler
+func TestMandrillHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("message events", func(t *testing.T) {
+		t.Parallel()
+
+		var events []*DeliveryEvent
+		handler := NewMandrillHandler(testMandrillKey, testMandrillURL, func(_ context.Context, event *DeliveryEvent) error {
+			events = append(events, event)
+			return nil
+		})
+
+		batch := `[
+			{"event":"hard_bounce","_id":"id-1","ts":1792229370,"msg":{"email":"one@domain.com","diag":"smtp;550 5.1.1 user unknown","bounce_description":"bad_mailbox"}},
+			{"event":"soft_bounce","_id":"id-2","ts":1792229370,"msg":{"email":"two@domain.com","bounce_description":"mailbox_full"}},
+			{"event":"deferral","_id":"id-3","ts":1792229370,"msg":{"email":"three@domain.com","diag":"451 try again later"}},
+			{"event":"click","_id":"id-4","ts":1792229370,"url":"https://example.com/","msg":{"email":"four@domain.com"}},
+			{"event":"spam","_id":"id-5","ts":1792229370,"msg":{"email":"five@domain.com"}},
+			{"type":"whitelist","action":"add","ts":1792229370},
+			{"event":"unsub","_id":"id-6","ts":1792229370,"msg":{"email":"six@domain.com"}}
+		]`
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newTestMandrillRequest(batch))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, events, 6)
+
+		expected := []DeliveryEvent{
+			{Type: EventBounced, MessageID: "id-1", Recipient: "one@domain.com", BounceType: BounceHard, BounceReason: "smtp;550 5.1.1 user unknown"},
+			{Type: EventBounced, MessageID: "id-2", Recipient: "two@domain.com", BounceType: BounceSoft, BounceReason: "mailbox_full"},
+			{Type: EventDelayed, MessageID: "id-3", Recipient: "three@domain.com", BounceReason: "451 try again later"},
+			{Type: EventClicked, MessageID: "id-4", Recipient: "four@domain.com", URL: "https://example.com/"},
+			{Type: EventComplained, MessageID: "id-5", Recipient: "five@domain.com"},
+			{Type: EventUnsubscribed, MessageID: "id-6", Recipient: "six@domain.com"},
+		}
+		for i, event := range expected {
+			assert.Equal(t, event.Type, events[i].Type)
+			assert.Equal(t, event.MessageID, events[i].MessageID)
+			assert.Equal(t, event.Recipient, events[i].Recipient)
+			assert.Equal(t, event.BounceType, events[i].BounceType)
+			assert.Equal(t, event.BounceReason, events[i].BounceReason)
+			assert.Equal(t, event.URL, events[i].URL)
+			assert.Equal(t, gomail.Mandrill, events[i].Provider)
+			assert.Equal(t, time.Unix(1792229370, 0).UTC(), events[i].Timestamp)
+			assert.NotEmpty(t, events[i].Raw)
+		}
+	})
+
+	t.Run("webhook url check", func(t *testing.T) {
+		t.Parallel()
+
+		w := httptest.NewRecorder()
+		NewMandrillHandler(testMandrillKey, testMandrillURL, nil).ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/webhooks/mandrill", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("refused requests", func(t *testing.T) {
+		t.Parallel()
+
+		batch := `[{"event":"send","_id":"id-1","ts":1792229370,"msg":{"email":"one@domain.com"}}]`
+		tests := []struct {
+			name     string
+			key      string
+			request  func() *http.Request
+			callback Callback
+			expected int
+		}{
+			{"wrong method", testMandrillKey, func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/webhooks/mandrill", nil)
+			}, nil, http.StatusMethodNotAllowed},
+			{"missing signature", testMandrillKey, func() *http.Request {
+				req := newTestMandrillRequest(batch)
+				req.Header.Del("X-Mandrill-Signature")
+				return req
+			}, nil, http.StatusForbidden},
+			{"invalid signature encoding", testMandrillKey, func() *http.Request {
+				req := newTestMandrillRequest(batch)
+				req.Header.Set("X-Mandrill-Signature", "not base64!")
+				return req
+			}, nil, http.StatusForbidden},
+			{"wrong key", "other-key", func() *http.Request { return newTestMandrillRequest(batch) }, nil, http.StatusForbidden},
+			{"handler without key", "", func() *http.Request { return newTestMandrillRequest(batch) }, nil, http.StatusForbidden},
+			{"invalid events", testMandrillKey, func() *http.Request { return newTestMandrillRequest("{") }, nil, http.StatusBadRequest},
+			{"callback error", testMandrillKey, func() *http.Request { return newTestMandrillRequest(batch) },
+				func(context.Context, *DeliveryEvent) error { return errTestEventCallback }, http.StatusInternalServerError},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				NewMandrillHandler(test.key, testMandrillURL, test.callback).ServeHTTP(w, test.request())
+				assert.Equal(t, test.expected, w.Code)
+			})
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gomail "github.com/mrz1836/go-mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostmarkHandler will test the NewPostmarkHandler() handler
+func TestPostmarkHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("record types", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name     string
+			body     string
+			expected *DeliveryEvent
+		}{
+			{
+				"hard bounce",
+				`{"RecordType":"Bounce","Type":"HardBounce","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Email":"one@domain.com",` +
+					`"Description":"The server was unable to deliver your message","BouncedAt":"2026-10-17T09:29:30Z","Inactive":true}`,
+				&DeliveryEvent{Type: EventBounced, Recipient: "one@domain.com", BounceType: BounceHard, BounceReason: "The server was unable to deliver your message"},
+			},
+			{
+				"soft bounce",
+				`{"RecordType":"Bounce","Type":"SoftBounce","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Email":"one@domain.com",` +
+					`"Description":"Mailbox full","BouncedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventBounced, Recipient: "one@domain.com", BounceType: BounceSoft, BounceReason: "Mailbox full"},
+			},
+			{
+				"inactive bounce type is hard",
+				`{"RecordType":"Bounce","Type":"Blocked","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Email":"one@domain.com","BouncedAt":"2026-10-17T09:29:30Z","Inactive":true}`,
+				&DeliveryEvent{Type: EventBounced, Recipient: "one@domain.com", BounceType: BounceHard},
+			},
+			{
+				"unknown bounce type",
+				`{"RecordType":"Bounce","Type":"Blocked","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Email":"one@domain.com","BouncedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventBounced, Recipient: "one@domain.com", BounceType: BounceUndetermined},
+			},
+			{
+				"spam complaint bounce",
+				`{"RecordType":"Bounce","Type":"SpamComplaint","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Email":"one@domain.com","BouncedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventComplained, Recipient: "one@domain.com"},
+			},
+			{
+				"spam complaint",
+				`{"RecordType":"SpamComplaint","Type":"SpamComplaint","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Email":"one@domain.com",` +
+					`"Description":"The subscriber explicitly marked this message as spam","BouncedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventComplained, Recipient: "one@domain.com", BounceReason: "The subscriber explicitly marked this message as spam"},
+			},
+			{
+				"delivery",
+				`{"RecordType":"Delivery","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Recipient":"one@domain.com","DeliveredAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventDelivered, Recipient: "one@domain.com"},
+			},
+			{
+				"open",
+				`{"RecordType":"Open","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Recipient":"one@domain.com","ReceivedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventOpened, Recipient: "one@domain.com"},
+			},
+			{
+				"click",
+				`{"RecordType":"Click","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Recipient":"one@domain.com",` +
+					`"OriginalLink":"https://example.com/","ReceivedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventClicked, Recipient: "one@domain.com", URL: "https://example.com/"},
+			},
+			{
+				"unsubscribe",
+				`{"RecordType":"SubscriptionChange","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Recipient":"one@domain.com",` +
+					`"SuppressSending":true,"SuppressionReason":"ManualSuppression","ChangedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventUnsubscribed, Recipient: "one@domain.com", BounceReason: "ManualSuppression"},
+			},
+			{
+				"suppressed after a hard bounce",
+				`{"RecordType":"SubscriptionChange","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Recipient":"one@domain.com",` +
+					`"SuppressSending":true,"SuppressionReason":"HardBounce","ChangedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventBounced, Recipient: "one@domain.com", BounceType: BounceHard, BounceReason: "HardBounce"},
+			},
+			{
+				"suppressed after a spam complaint",
+				`{"RecordType":"SubscriptionChange","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Recipient":"one@domain.com",` +
+					`"SuppressSending":true,"SuppressionReason":"SpamComplaint","ChangedAt":"2026-10-17T09:29:30Z"}`,
+				&DeliveryEvent{Type: EventComplained, Recipient: "one@domain.com", BounceReason: "SpamComplaint"},
+			},
+			{
+				"resubscribe has no event",
+				`{"RecordType":"SubscriptionChange","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Recipient":"one@domain.com","SuppressSending":false}`,
+				nil,
+			},
+			{
+				"unknown record type has no event",
+				`{"RecordType":"Inbound","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483"}`,
+				nil,
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				var events []*DeliveryEvent
+				handler := NewPostmarkHandler("user", "pass", func(_ context.Context, event *DeliveryEvent) error {
+					events = append(events, event)
+					return nil
+				})
+				req := httptest.NewRequest(http.MethodPost, "/webhooks/postmark", strings.NewReader(test.body))
+				req.SetBasicAuth("user", "pass")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				require.Equal(t, http.StatusOK, w.Code)
+
+				if test.expected == nil {
+					assert.Empty(t, events)
+					return
+				}
+				require.Len(t, events, 1)
+				assert.Equal(t, test.expected.Type, events[0].Type)
+				assert.Equal(t, test.expected.Recipient, events[0].Recipient)
+				assert.Equal(t, test.expected.BounceType, events[0].BounceType)
+				assert.Equal(t, test.expected.BounceReason, events[0].BounceReason)
+				assert.Equal(t, test.expected.URL, events[0].URL)
+				assert.Equal(t, "883953f4-6105-42a2-a16a-77a8eac79483", events[0].MessageID)
+				assert.Equal(t, gomail.Postmark, events[0].Provider)
+				assert.Equal(t, time.Date(2026, 10, 17, 9, 29, 30, 0, time.UTC), events[0].Timestamp)
+				assert.JSONEq(t, test.body, string(events[0].Raw))
+			})
+		}
+	})
+
+	t.Run("refused requests", func(t *testing.T) {
+		t.Parallel()
+
+		body := `{"RecordType":"Delivery","MessageID":"883953f4-6105-42a2-a16a-77a8eac79483","Recipient":"one@domain.com"}`
+		tests := []struct {
+			name     string
+			username string
+			password string
+			method   string
+			auth     bool
+			body     string
+			callback Callback
+			expected int
+		}{
+			{"wrong method", "user", "pass", http.MethodGet, true, "", nil, http.StatusMethodNotAllowed},
+			{"missing credentials", "user", "pass", http.MethodPost, false, body, nil, http.StatusUnauthorized},
+			{"wrong credentials", "user", "other", http.MethodPost, true, body, nil, http.StatusUnauthorized},
+			{"handler without credentials", "", "", http.MethodPost, true, body, nil, http.StatusUnauthorized},
+			{"invalid json", "user", "pass", http.MethodPost, true, "{", nil, http.StatusBadRequest},
+			{"invalid record", "user", "pass", http.MethodPost, true, `[]`, nil, http.StatusBadRequest},
+			{"callback error", "user", "pass", http.MethodPost, true, body,
+				func(context.Context, *DeliveryEvent) error { return errTestEventCallback }, http.StatusInternalServerError},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				req := httptest.NewRequest(test.method, "/webhooks/postmark", strings.NewReader(test.body))
+				if test.auth {
+					req.SetBasicAuth("user", "pass")
+				}
+				w := httptest.NewRecorder()
+				NewPostmarkHandler(test.username, test.password, test.callback).ServeHTTP(w, req)
+				assert.Equal(t, test.expected, w.Code)
+			})
+		}
+	})
+}
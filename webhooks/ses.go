@@ -0,0 +1,370 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	gomail "github.com/mrz1836/go-mail"
+)
+
+// snsMaxCertificateSize is the largest signing certificate fetched from SNS
+const snsMaxCertificateSize = 64 << 10
+
+// snsHostPattern matches the SNS endpoints that serve certificates and subscription urls
+var snsHostPattern = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// CertFetcher returns the certificate at the SNS signing certificate url (replaceable for tests)
+type CertFetcher func(ctx context.Context, certURL string) (*x509.Certificate, error)
+
+// SESOptions are the options of the AWS SES handler
+//
+// DO NOT CHANGE ORDER - Optimized for memory (maligned)
+type SESOptions struct {
+	CertFetcher          CertFetcher  // fetches the signing certificates (defaults to an https fetch, cached by url)
+	HTTPClient           *http.Client // fetches certificates and confirms subscriptions (defaults to a client with a 10s timeout)
+	TopicARNs            []string     // only accept messages from these topics (every topic if empty)
+	ConfirmSubscriptions bool         // confirm SNS subscriptions by visiting the subscribe url
+}
+
+// defaultHTTPTimeout is the timeout of the default SESOptions.HTTPClient (a slow endpoint must not hold the webhook)
+const defaultHTTPTimeout = 10 * time.Second
+
+// sesHandler receives AWS SES notifications delivered by SNS
+type sesHandler struct {
+	callback Callback
+	certs    sync.Map
+	options  SESOptions
+}
+
+// snsMessage is an SNS http(s) delivery
+type snsMessage struct {
+	Message          string `json:"Message"`
+	MessageID        string `json:"MessageId"`
+	Signature        string `json:"Signature"`
+	SignatureVersion string `json:"SignatureVersion"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	Subject          string `json:"Subject"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	Timestamp        string `json:"Timestamp"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Type             string `json:"Type"`
+}
+
+// sesRecipient is a recipient in an SES bounce, complaint or delay
+type sesRecipient struct {
+	DiagnosticCode string `json:"diagnosticCode"`
+	EmailAddress   string `json:"emailAddress"`
+}
+
+// sesNotification is an SES notification (notifications or configuration set event publishing)
+type sesNotification struct {
+	Bounce *struct {
+		BouncedRecipients []sesRecipient `json:"bouncedRecipients"`
+		BounceSubType     string         `json:"bounceSubType"`
+		BounceType        string         `json:"bounceType"`
+		Timestamp         string         `json:"timestamp"`
+	} `json:"bounce"`
+	Click *struct {
+		Link      string `json:"link"`
+		Timestamp string `json:"timestamp"`
+	} `json:"click"`
+	Complaint *struct {
+		ComplainedRecipients  []sesRecipient `json:"complainedRecipients"`
+		ComplaintFeedbackType string         `json:"complaintFeedbackType"`
+		Timestamp             string         `json:"timestamp"`
+	} `json:"complaint"`
+	Delivery *struct {
+		Recipients []string `json:"recipients"`
+		Timestamp  string   `json:"timestamp"`
+	} `json:"delivery"`
+	DeliveryDelay *struct {
+		DelayedRecipients []sesRecipient `json:"delayedRecipients"`
+		DelayType         string         `json:"delayType"`
+		Timestamp         string         `json:"timestamp"`
+	} `json:"deliveryDelay"`
+	Open *struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"open"`
+	Reject *struct {
+		Reason string `json:"reason"`
+	} `json:"reject"`
+	Mail struct {
+		Destination []string `json:"destination"`
+		MessageID   string   `json:"messageId"`
+		Timestamp   string   `json:"timestamp"`
+	} `json:"mail"`
+	EventType        string `json:"eventType"`
+	NotificationType string `json:"notificationType"`
+}
+
+// NewSESHandler returns a handler for AWS SES notifications delivered by SNS (bounces, complaints,
+// deliveries and the configuration set events)
+//
+// Every SNS message is verified with the signing certificate of the SNS endpoint before it is used
+func NewSESHandler(options SESOptions, callback Callback) http.Handler {
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	h := &sesHandler{callback: callback, options: options}
+	if h.options.CertFetcher == nil {
+		h.options.CertFetcher = h.fetchCertificate
+	}
+	return h
+}
+
+// ServeHTTP verifies the SNS message, confirms subscriptions and delivers the SES events to the callback
+func (h *sesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var message snsMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&message); err != nil {
+		http.Error(w, "invalid sns message", http.StatusBadRequest)
+		return
+	}
+	if err := h.verify(r.Context(), &message); err != nil {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	switch message.Type {
+	case "SubscriptionConfirmation":
+		if h.options.ConfirmSubscriptions {
+			if err := h.confirmSubscription(r.Context(), message.SubscribeURL); err != nil {
+				http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	case "Notification":
+		events, err := sesEvents([]byte(message.Message))
+		if err != nil {
+			http.Error(w, "invalid ses notification", http.StatusBadRequest)
+			return
+		}
+		deliver(w, r, h.callback, events)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// verify checks the topic and the signature of the SNS message
+func (h *sesHandler) verify(ctx context.Context, message *snsMessage) error {
+	if len(h.options.TopicARNs) > 0 {
+		accepted := false
+		for _, arn := range h.options.TopicARNs {
+			accepted = accepted || arn == message.TopicArn
+		}
+		if !accepted {
+			return fmt.Errorf("%s: %w", message.TopicArn, ErrUnexpectedSNSTopic)
+		}
+	}
+	if err := validateSNSURL(message.SigningCertURL); err != nil {
+		return err
+	}
+
+	// Signature version 1 is SHA1, version 2 is SHA256
+	var algorithm x509.SignatureAlgorithm
+	switch message.SignatureVersion {
+	case "1":
+		algorithm = x509.SHA1WithRSA
+	case "2":
+		algorithm = x509.SHA256WithRSA
+	default:
+		return fmt.Errorf("signature version %q: %w", message.SignatureVersion, ErrInvalidSNSSignature)
+	}
+	signature, err := base64.StdEncoding.DecodeString(message.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSNSSignature, err)
+	}
+	cert, err := h.options.CertFetcher(ctx, message.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	if err = cert.CheckSignature(algorithm, message.signedContent(), signature); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSNSSignature, err)
+	}
+	return nil
+}
+
+// signedContent returns the string signed by SNS for the message type
+func (m *snsMessage) signedContent() []byte {
+	fields := [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}}
+	if m.Type == "Notification" {
+		if len(m.Subject) > 0 {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", m.Timestamp}, [2]string{"TopicArn", m.TopicArn}, [2]string{"Type", m.Type})
+	} else {
+		fields = append(fields, [2]string{"SubscribeURL", m.SubscribeURL}, [2]string{"Timestamp", m.Timestamp},
+			[2]string{"Token", m.Token}, [2]string{"TopicArn", m.TopicArn}, [2]string{"Type", m.Type})
+	}
+
+	var content strings.Builder
+	for _, field := range fields {
+		content.WriteString(field[0] + "\n" + field[1] + "\n")
+	}
+	return []byte(content.String())
+}
+
+// validateSNSURL checks the url is an https url of an SNS endpoint
+func validateSNSURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" || !snsHostPattern.MatchString(parsed.Hostname()) {
+		return fmt.Errorf("%s: %w", rawURL, ErrInvalidSNSURL)
+	}
+	return nil
+}
+
+// fetchCertificate downloads the PEM signing certificate (cached by url)
+func (h *sesHandler) fetchCertificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	if cert, ok := h.certs.Load(certURL); ok {
+		return cert.(*x509.Certificate), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrInvalidSNSCert, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, snsMaxCertificateSize))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, ErrInvalidSNSCert
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSNSCert, err)
+	}
+	h.certs.Store(certURL, cert)
+	return cert, nil
+}
+
+// confirmSubscription visits the subscribe url of the SNS endpoint
+func (h *sesHandler) confirmSubscription(ctx context.Context, subscribeURL string) error {
+	if err := validateSNSURL(subscribeURL); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, subscribeURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.options.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: status %d", ErrSNSSubscriptionError, resp.StatusCode)
+	}
+	return nil
+}
+
+// sesEvents converts an SES notification into a delivery event for each recipient
+//
+// Open and click events do not identify the recipient that acted (SES only lists every destination
+// of the message), so they are a single event with an empty recipient.
+func sesEvents(raw []byte) ([]*DeliveryEvent, error) {
+	var notification sesNotification
+	if err := json.Unmarshal(raw, &notification); err != nil {
+		return nil, err
+	}
+	newEvent := func(eventType EventType, recipient, timestamp string) *DeliveryEvent {
+		if len(timestamp) == 0 {
+			timestamp = notification.Mail.Timestamp
+		}
+		return &DeliveryEvent{
+			MessageID: notification.Mail.MessageID,
+			Provider:  gomail.AwsSes,
+			Raw:       raw,
+			Recipient: recipient,
+			Timestamp: parseTime(timestamp),
+			Type:      eventType,
+		}
+	}
+	forDestinations := func(eventType EventType, timestamp string) []*DeliveryEvent {
+		events := make([]*DeliveryEvent, 0, len(notification.Mail.Destination))
+		for _, recipient := range notification.Mail.Destination {
+			events = append(events, newEvent(eventType, recipient, timestamp))
+		}
+		return events
+	}
+
+	// Notifications set notificationType, configuration set events set eventType
+	var events []*DeliveryEvent
+	switch eventType := notification.NotificationType + notification.EventType; {
+	case eventType == "Bounce" && notification.Bounce != nil:
+		bounceType := BounceUndetermined
+		switch notification.Bounce.BounceType {
+		case "Permanent":
+			bounceType = BounceHard
+		case "Transient":
+			bounceType = BounceSoft
+		}
+		for _, recipient := range notification.Bounce.BouncedRecipients {
+			event := newEvent(EventBounced, recipient.EmailAddress, notification.Bounce.Timestamp)
+			event.BounceType = bounceType
+			event.BounceReason = recipient.DiagnosticCode
+			if len(event.BounceReason) == 0 {
+				event.BounceReason = notification.Bounce.BounceSubType
+			}
+			events = append(events, event)
+		}
+	case eventType == "Complaint" && notification.Complaint != nil:
+		for _, recipient := range notification.Complaint.ComplainedRecipients {
+			event := newEvent(EventComplained, recipient.EmailAddress, notification.Complaint.Timestamp)
+			event.BounceReason = notification.Complaint.ComplaintFeedbackType
+			events = append(events, event)
+		}
+	case eventType == "Delivery" && notification.Delivery != nil:
+		for _, recipient := range notification.Delivery.Recipients {
+			events = append(events, newEvent(EventDelivered, recipient, notification.Delivery.Timestamp))
+		}
+	case eventType == "DeliveryDelay" && notification.DeliveryDelay != nil:
+		for _, recipient := range notification.DeliveryDelay.DelayedRecipients {
+			event := newEvent(EventDelayed, recipient.EmailAddress, notification.DeliveryDelay.Timestamp)
+			event.BounceReason = notification.DeliveryDelay.DelayType
+			events = append(events, event)
+		}
+	case eventType == "Open" && notification.Open != nil:
+		events = append(events, newEvent(EventOpened, "", notification.Open.Timestamp))
+	case eventType == "Click" && notification.Click != nil:
+		event := newEvent(EventClicked, "", notification.Click.Timestamp)
+		event.URL = notification.Click.Link
+		events = append(events, event)
+	case eventType == "Reject" && notification.Reject != nil:
+		events = forDestinations(EventRejected, "")
+		for _, event := range events {
+			event.BounceReason = notification.Reject.Reason
+		}
+	case eventType == "Send":
+		events = forDestinations(EventSent, "")
+	}
+	return events, nil
+}
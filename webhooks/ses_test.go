@@ -0,0 +1,342 @@
+package webhooks
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // sns signature version 1 is SHA1
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gomail "github.com/mrz1836/go-mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSNSCertURL   = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-test.pem"
+	testSNSTopicArn  = "arn:aws:sns:us-east-1:123456789012:ses-events"
+	testSESMessageID = "0100017d3b5ea3b1-1c33bbf5-test-000000"
+)
+
+// errTestEventCallback is returned by the callbacks of the handler tests
+var errTestEventCallback = errors.New("event callback error")
+
+// testSNSSigner signs SNS messages with a self signed certificate
+type testSNSSigner struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// newTestSNSSigner will create the signing key and certificate once
+var newTestSNSSigner = sync.OnceValues(func() (*testSNSSigner, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		NotAfter:     time.Now().Add(time.Hour),
+		NotBefore:    time.Now().Add(-time.Hour),
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &testSNSSigner{cert: cert, key: key}, nil
+})
+
+// fetcher returns a cert fetcher that serves the signing certificate for the test url
+func (s *testSNSSigner) fetcher(fetches *atomic.Int32) CertFetcher {
+	return func(_ context.Context, certURL string) (*x509.Certificate, error) {
+		if fetches != nil {
+			fetches.Add(1)
+		}
+		if certURL != testSNSCertURL {
+			return nil, ErrInvalidSNSCert
+		}
+		return s.cert, nil
+	}
+}
+
+// sign will sign the SNS message with the signature version
+func (s *testSNSSigner) sign(t *testing.T, message *snsMessage, version string) []byte {
+	message.SignatureVersion = version
+	message.SigningCertURL = testSNSCertURL
+	var hash crypto.Hash
+	var digest []byte
+	if version == "1" {
+		sum := sha1.Sum(message.signedContent()) //nolint:gosec // sns signature version 1
+		hash, digest = crypto.SHA1, sum[:]
+	} else {
+		sum := sha256.Sum256(message.signedContent())
+		hash, digest = crypto.SHA256, sum[:]
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, hash, digest)
+	require.NoError(t, err)
+	message.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	body, err := json.Marshal(message)
+	require.NoError(t, err)
+	return body
+}
+
+// newTestSNSNotification will create an SNS notification for the SES notification
+func newTestSNSNotification(notification string) *snsMessage {
+	return &snsMessage{
+		Message:   notification,
+		MessageID: "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		Timestamp: "2026-10-17T09:30:00.000Z",
+		TopicArn:  testSNSTopicArn,
+		Type:      "Notification",
+	}
+}
+
+// testSESNotification will create an SES notification of the type with the event body
+func testSESNotification(field, eventType, body string) string {
+	return `{"` + field + `":"` + eventType + `","mail":{"timestamp":"2026-10-17T09:29:00.000Z","messageId":"` + testSESMessageID +
+		`","destination":["one@domain.com","two@domain.com"]}` + body + `}`
+}
+
+// TestSESHandler will test the NewSESHandler() handler
+func TestSESHandler(t *testing.T) {
+	t.Parallel()
+
+	signer, err := newTestSNSSigner()
+	require.NoError(t, err)
+
+	post := func(handler http.Handler, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhooks/ses", strings.NewReader(string(body))))
+		return w
+	}
+	collect := func(events *[]*DeliveryEvent) Callback {
+		return func(_ context.Context, event *DeliveryEvent) error {
+			*events = append(*events, event)
+			return nil
+		}
+	}
+
+	t.Run("notifications and configuration set events", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			notification string
+			expected     []DeliveryEvent
+		}{
+			{
+				"permanent bounce",
+				testSESNotification("notificationType", "Bounce", `,"bounce":{"bounceType":"Permanent","bounceSubType":"General","timestamp":"2026-10-17T09:29:30.000Z",`+
+					`"bouncedRecipients":[{"emailAddress":"one@domain.com","diagnosticCode":"smtp; 550 5.1.1 user unknown"}]}`),
+				[]DeliveryEvent{{Type: EventBounced, Recipient: "one@domain.com", BounceType: BounceHard, BounceReason: "smtp; 550 5.1.1 user unknown"}},
+			},
+			{
+				"transient bounce without a diagnostic code",
+				testSESNotification("eventType", "Bounce", `,"bounce":{"bounceType":"Transient","bounceSubType":"MailboxFull","timestamp":"2026-10-17T09:29:30.000Z",`+
+					`"bouncedRecipients":[{"emailAddress":"one@domain.com"}]}`),
+				[]DeliveryEvent{{Type: EventBounced, Recipient: "one@domain.com", BounceType: BounceSoft, BounceReason: "MailboxFull"}},
+			},
+			{
+				"undetermined bounce",
+				testSESNotification("notificationType", "Bounce", `,"bounce":{"bounceType":"Undetermined","timestamp":"2026-10-17T09:29:30.000Z",`+
+					`"bouncedRecipients":[{"emailAddress":"one@domain.com"}]}`),
+				[]DeliveryEvent{{Type: EventBounced, Recipient: "one@domain.com", BounceType: BounceUndetermined}},
+			},
+			{
+				"complaint",
+				testSESNotification("notificationType", "Complaint", `,"complaint":{"complaintFeedbackType":"abuse","timestamp":"2026-10-17T09:29:30.000Z",`+
+					`"complainedRecipients":[{"emailAddress":"two@domain.com"}]}`),
+				[]DeliveryEvent{{Type: EventComplained, Recipient: "two@domain.com", BounceReason: "abuse"}},
+			},
+			{
+				"delivery",
+				testSESNotification("notificationType", "Delivery", `,"delivery":{"timestamp":"2026-10-17T09:29:30.000Z","recipients":["one@domain.com","two@domain.com"]}`),
+				[]DeliveryEvent{{Type: EventDelivered, Recipient: "one@domain.com"}, {Type: EventDelivered, Recipient: "two@domain.com"}},
+			},
+			{
+				"delivery delay",
+				testSESNotification("eventType", "DeliveryDelay", `,"deliveryDelay":{"delayType":"MailboxFull","timestamp":"2026-10-17T09:29:30.000Z",`+
+					`"delayedRecipients":[{"emailAddress":"one@domain.com"}]}`),
+				[]DeliveryEvent{{Type: EventDelayed, Recipient: "one@domain.com", BounceReason: "MailboxFull"}},
+			},
+			{
+				"open",
+				testSESNotification("eventType", "Open", `,"open":{"timestamp":"2026-10-17T09:29:30.000Z"}`),
+				[]DeliveryEvent{{Type: EventOpened}},
+			},
+			{
+				"click",
+				testSESNotification("eventType", "Click", `,"click":{"link":"https://example.com/","timestamp":"2026-10-17T09:29:30.000Z"}`),
+				[]DeliveryEvent{{Type: EventClicked, URL: "https://example.com/"}},
+			},
+			{
+				"unknown event type",
+				testSESNotification("eventType", "Rendering Failure", ""),
+				nil,
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				var events []*DeliveryEvent
+				handler := NewSESHandler(SESOptions{CertFetcher: signer.fetcher(nil)}, collect(&events))
+				w := post(handler, signer.sign(t, newTestSNSNotification(test.notification), "2"))
+				require.Equal(t, http.StatusOK, w.Code)
+				require.Len(t, events, len(test.expected))
+				for i, expected := range test.expected {
+					assert.Equal(t, expected.Type, events[i].Type)
+					assert.Equal(t, expected.Recipient, events[i].Recipient)
+					assert.Equal(t, expected.BounceType, events[i].BounceType)
+					assert.Equal(t, expected.BounceReason, events[i].BounceReason)
+					assert.Equal(t, expected.URL, events[i].URL)
+					assert.Equal(t, testSESMessageID, events[i].MessageID)
+					assert.Equal(t, gomail.AwsSes, events[i].Provider)
+					assert.Equal(t, time.Date(2026, 10, 17, 9, 29, 30, 0, time.UTC), events[i].Timestamp)
+					assert.JSONEq(t, test.notification, string(events[i].Raw))
+				}
+			})
+		}
+	})
+
+	t.Run("send and reject use the mail timestamp", func(t *testing.T) {
+		var events []*DeliveryEvent
+		handler := NewSESHandler(SESOptions{CertFetcher: signer.fetcher(nil)}, collect(&events))
+		require.Equal(t, http.StatusOK, post(handler, signer.sign(t, newTestSNSNotification(testSESNotification("eventType", "Send", `,"send":{}`)), "1")).Code)
+		require.Equal(t, http.StatusOK, post(handler, signer.sign(t, newTestSNSNotification(testSESNotification("eventType", "Reject", `,"reject":{"reason":"Bad content"}`)), "1")).Code)
+		require.Len(t, events, 4)
+		assert.Equal(t, EventSent, events[0].Type)
+		assert.Equal(t, EventRejected, events[3].Type)
+		assert.Equal(t, "Bad content", events[3].BounceReason)
+		assert.Equal(t, time.Date(2026, 10, 17, 9, 29, 0, 0, time.UTC), events[3].Timestamp)
+	})
+
+	t.Run("subscription confirmation", func(t *testing.T) {
+		var visited []string
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			visited = append(visited, req.URL.String())
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("<ConfirmSubscriptionResponse/>"))}, nil
+		})}
+		handler := NewSESHandler(SESOptions{CertFetcher: signer.fetcher(nil), ConfirmSubscriptions: true, HTTPClient: client}, nil)
+
+		subscribeURL := "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&TopicArn=" + testSNSTopicArn + "&Token=abc"
+		message := &snsMessage{
+			Message:      "You have chosen to subscribe to the topic",
+			MessageID:    "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+			SubscribeURL: subscribeURL,
+			Timestamp:    "2026-10-17T09:30:00.000Z",
+			Token:        "abc",
+			TopicArn:     testSNSTopicArn,
+			Type:         "SubscriptionConfirmation",
+		}
+		require.Equal(t, http.StatusOK, post(handler, signer.sign(t, message, "1")).Code)
+		assert.Equal(t, []string{subscribeURL}, visited)
+
+		// Subscribe urls outside of sns are never visited
+		message.SubscribeURL = "https://attacker.example.com/"
+		assert.Equal(t, http.StatusBadGateway, post(handler, signer.sign(t, message, "1")).Code)
+		assert.Len(t, visited, 1)
+
+		// Confirmation is optional
+		message.SubscribeURL = subscribeURL
+		handler = NewSESHandler(SESOptions{CertFetcher: signer.fetcher(nil), HTTPClient: client}, nil)
+		assert.Equal(t, http.StatusOK, post(handler, signer.sign(t, message, "1")).Code)
+		assert.Len(t, visited, 1)
+	})
+
+	t.Run("default certificate fetcher caches by url", func(t *testing.T) {
+		var fetches atomic.Int32
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			fetches.Add(1)
+			body := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signer.cert.Raw})
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(string(body)))}, nil
+		})}
+		var events []*DeliveryEvent
+		handler := NewSESHandler(SESOptions{HTTPClient: client}, collect(&events))
+		notification := testSESNotification("eventType", "Send", `,"send":{}`)
+		require.Equal(t, http.StatusOK, post(handler, signer.sign(t, newTestSNSNotification(notification), "2")).Code)
+		require.Equal(t, http.StatusOK, post(handler, signer.sign(t, newTestSNSNotification(notification), "2")).Code)
+		assert.Len(t, events, 4)
+		assert.Equal(t, int32(1), fetches.Load())
+	})
+
+	t.Run("refused requests", func(t *testing.T) {
+		notification := testSESNotification("eventType", "Send", `,"send":{}`)
+		tampered := newTestSNSNotification(notification)
+		body := signer.sign(t, tampered, "2")
+		body = []byte(strings.Replace(string(body), "one@domain.com", "attacker@domain.com", 1))
+
+		otherCert := newTestSNSNotification(notification)
+		signer.sign(t, otherCert, "2")
+		otherCert.SigningCertURL = "https://attacker.example.com/cert.pem"
+		otherCertBody, err := json.Marshal(otherCert)
+		require.NoError(t, err)
+
+		badVersion := newTestSNSNotification(notification)
+		signer.sign(t, badVersion, "2")
+		badVersion.SignatureVersion = "3"
+		badVersionBody, err := json.Marshal(badVersion)
+		require.NoError(t, err)
+
+		tests := []struct {
+			name     string
+			options  SESOptions
+			method   string
+			body     []byte
+			callback Callback
+			expected int
+		}{
+			{"wrong method", SESOptions{}, http.MethodGet, nil, nil, http.StatusMethodNotAllowed},
+			{"invalid json", SESOptions{}, http.MethodPost, []byte("{"), nil, http.StatusBadRequest},
+			{"tampered message", SESOptions{}, http.MethodPost, body, nil, http.StatusForbidden},
+			{"certificate outside of sns", SESOptions{}, http.MethodPost, otherCertBody, nil, http.StatusForbidden},
+			{"unknown signature version", SESOptions{}, http.MethodPost, badVersionBody, nil, http.StatusForbidden},
+			{"topic not accepted", SESOptions{TopicARNs: []string{"arn:aws:sns:us-east-1:123456789012:other"}}, http.MethodPost,
+				signer.sign(t, newTestSNSNotification(notification), "2"), nil, http.StatusForbidden},
+			{"invalid notification", SESOptions{}, http.MethodPost, signer.sign(t, newTestSNSNotification("{"), "2"), nil, http.StatusBadRequest},
+			{"callback error", SESOptions{TopicARNs: []string{testSNSTopicArn}}, http.MethodPost, signer.sign(t, newTestSNSNotification(notification), "2"),
+				func(context.Context, *DeliveryEvent) error { return errTestEventCallback }, http.StatusInternalServerError},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				test.options.CertFetcher = signer.fetcher(nil)
+				w := httptest.NewRecorder()
+				NewSESHandler(test.options, test.callback).ServeHTTP(w, httptest.NewRequest(test.method, "/webhooks/ses", strings.NewReader(string(test.body))))
+				assert.Equal(t, test.expected, w.Code)
+			})
+		}
+	})
+
+	t.Run("default http client has a timeout", func(t *testing.T) {
+		handler, ok := NewSESHandler(SESOptions{}, nil).(*sesHandler)
+		require.True(t, ok)
+		require.NotNil(t, handler.options.HTTPClient)
+		assert.Equal(t, defaultHTTPTimeout, handler.options.HTTPClient.Timeout)
+	})
+}
+
+// roundTripFunc is an http transport for tests
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip will call the function
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
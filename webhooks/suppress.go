@@ -0,0 +1,42 @@
+package webhooks
+
+import (
+	"context"
+
+	gomail "github.com/mrz1836/go-mail"
+)
+
+// SuppressionCallback returns a callback that adds the recipients of hard bounces, complaints and
+// unsubscribes to the suppression list, then calls next (if set) with every event
+func SuppressionCallback(store gomail.SuppressionStore, next Callback) Callback {
+	return func(ctx context.Context, event *DeliveryEvent) error {
+		if reason, ok := suppressionReason(event); ok && len(event.Recipient) > 0 {
+			if err := store.Add(ctx, gomail.Suppression{
+				CreatedAt: event.Timestamp,
+				Email:     event.Recipient,
+				Note:      event.BounceReason,
+				Reason:    reason,
+			}); err != nil {
+				return err
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		return next(ctx, event)
+	}
+}
+
+// suppressionReason returns the suppression reason for the event (soft bounces are not suppressed)
+func suppressionReason(event *DeliveryEvent) (gomail.SuppressionReason, bool) {
+	switch {
+	case event.Type == EventBounced && event.BounceType == BounceHard:
+		return gomail.SuppressionHardBounce, true
+	case event.Type == EventComplained:
+		return gomail.SuppressionComplaint, true
+	case event.Type == EventUnsubscribed:
+		return gomail.SuppressionUnsubscribe, true
+	default:
+		return "", false
+	}
+}
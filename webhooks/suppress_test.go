@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gomail "github.com/mrz1836/go-mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errTestCallback is returned by the test callback
+var errTestCallback = errors.New("callback error")
+
+// TestSuppressionCallback will test the SuppressionCallback() callback
+func TestSuppressionCallback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := gomail.NewMemorySuppressionStore()
+	var calls int
+	callback := SuppressionCallback(store, func(context.Context, *DeliveryEvent) error {
+		calls++
+		return nil
+	})
+
+	timestamp := time.Date(2026, 10, 17, 9, 29, 30, 0, time.UTC)
+	events := []*DeliveryEvent{
+		{Type: EventBounced, BounceType: BounceHard, BounceReason: "550 user unknown", Recipient: "hard@domain.com", Timestamp: timestamp},
+		{Type: EventBounced, BounceType: BounceSoft, Recipient: "soft@domain.com"},
+		{Type: EventComplained, Recipient: "complained@domain.com", Timestamp: timestamp},
+		{Type: EventUnsubscribed, Recipient: "unsubscribed@domain.com", Timestamp: timestamp},
+		{Type: EventDelivered, Recipient: "delivered@domain.com"},
+		{Type: EventComplained},
+	}
+	for _, event := range events {
+		require.NoError(t, callback(ctx, event))
+	}
+	assert.Equal(t, len(events), calls)
+
+	list, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.Equal(t, gomail.Suppression{CreatedAt: timestamp, Email: "complained@domain.com", Reason: gomail.SuppressionComplaint}, list[0])
+	assert.Equal(t, gomail.Suppression{CreatedAt: timestamp, Email: "hard@domain.com", Note: "550 user unknown", Reason: gomail.SuppressionHardBounce}, list[1])
+	assert.Equal(t, gomail.SuppressionUnsubscribe, list[2].Reason)
+
+	// Without a next callback
+	require.NoError(t, SuppressionCallback(store, nil)(ctx, events[0]))
+
+	// Errors from next are returned
+	err = SuppressionCallback(store, func(context.Context, *DeliveryEvent) error { return errTestCallback })(ctx, events[0])
+	require.ErrorIs(t, err, errTestCallback)
+}
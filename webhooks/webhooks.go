@@ -0,0 +1,104 @@
+// Package webhooks receives the delivery events (bounces, complaints, deliveries, opens, clicks)
+// reported by the email providers and converts them into a single DeliveryEvent, and the inbound
+// emails received by the providers as an InboundEmail
+//
+// Each provider has an http.Handler that verifies the request before the events are delivered to the callback:
+// AWS SES through SNS notifications (certificate signatures), Postmark (basic auth) and Mandrill (X-Mandrill-Signature)
+package webhooks
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	gomail "github.com/mrz1836/go-mail"
+)
+
+// maxBodySize is the largest webhook request accepted
+const maxBodySize = 10 << 20
+
+// EventType is the type of delivery event
+type EventType string
+
+// Delivery event types
+const (
+	EventBounced      EventType = "bounced"      // The message bounced for the recipient (see BounceType)
+	EventClicked      EventType = "clicked"      // The recipient clicked a tracked link
+	EventComplained   EventType = "complained"   // The recipient marked the message as spam
+	EventDelayed      EventType = "delayed"      // Delivery to the recipient was delayed and will be retried
+	EventDelivered    EventType = "delivered"    // The recipient's mail server accepted the message
+	EventOpened       EventType = "opened"       // The recipient opened the message
+	EventRejected     EventType = "rejected"     // The provider refused to send the message to the recipient
+	EventSent         EventType = "sent"         // The provider sent the message
+	EventUnsubscribed EventType = "unsubscribed" // The recipient unsubscribed
+)
+
+// BounceType is the classification of a bounce
+type BounceType string
+
+// Bounce types
+const (
+	BounceHard         BounceType = "hard"         // Permanent failure, do not send to the recipient again
+	BounceSoft         BounceType = "soft"         // Temporary failure, the recipient can be retried later
+	BounceUndetermined BounceType = "undetermined" // The provider could not classify the bounce
+)
+
+// DeliveryEvent is a provider-neutral delivery event for a single recipient
+//
+// DO NOT CHANGE ORDER - Optimized for memory (maligned)
+type DeliveryEvent struct {
+	Timestamp    time.Time              `json:"timestamp" mapstructure:"timestamp"`         // when the event happened
+	Raw          json.RawMessage        `json:"raw" mapstructure:"raw"`                     // unmodified event from the provider
+	BounceReason string                 `json:"bounce_reason" mapstructure:"bounce_reason"` // description or diagnostic code of a bounce, complaint or rejection
+	BounceType   BounceType             `json:"bounce_type" mapstructure:"bounce_type"`     // classification of a bounce (bounced events only)
+	MessageID    string                 `json:"message_id" mapstructure:"message_id"`       // provider message id (matches gomail.SendResult.MessageID)
+	Recipient    string                 `json:"recipient" mapstructure:"recipient"`         // recipient email address (empty for SES opens and clicks, SES does not identify the recipient)
+	Type         EventType              `json:"type" mapstructure:"type"`                   // type of event
+	URL          string                 `json:"url" mapstructure:"url"`                     // link that was clicked (clicked events only)
+	Provider     gomail.ServiceProvider `json:"provider" mapstructure:"provider"`           // provider that reported the event
+}
+
+// Callback receives the delivery events, an error makes the handler fail the request so the provider retries
+type Callback func(ctx context.Context, event *DeliveryEvent) error
+
+// deliver sends the events to the callback and writes the response
+func deliver(w http.ResponseWriter, r *http.Request, callback Callback, events []*DeliveryEvent) {
+	for _, event := range events {
+		if err := callback(r.Context(), event); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// methodNotAllowed writes a 405 response with the allowed methods
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// basicAuthorized returns true if the request has the basic auth credentials (compared in constant time),
+// otherwise it writes a 401 response for the realm (empty credentials never match)
+func basicAuthorized(w http.ResponseWriter, r *http.Request, realm, username, password string) bool {
+	requestUsername, requestPassword, ok := r.BasicAuth()
+	if ok && len(username) > 0 && len(password) > 0 &&
+		subtle.ConstantTimeCompare([]byte(requestUsername), []byte(username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(requestPassword), []byte(password)) == 1 {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	return false
+}
+
+// parseTime parses an RFC 3339 timestamp (zero if it does not parse)
+func parseTime(value string) time.Time {
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return timestamp
+}